@@ -10,14 +10,27 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/adrian83/chat/pkg/attachment"
+	"github.com/adrian83/chat/pkg/bot"
 	"github.com/adrian83/chat/pkg/config"
 	"github.com/adrian83/chat/pkg/db"
 	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/filter"
 	"github.com/adrian83/chat/pkg/handler"
+	"github.com/adrian83/chat/pkg/history"
+	"github.com/adrian83/chat/pkg/membership"
+	"github.com/adrian83/chat/pkg/metrics"
+	"github.com/adrian83/chat/pkg/ownership"
+	"github.com/adrian83/chat/pkg/pin"
+	"github.com/adrian83/chat/pkg/poll"
+	"github.com/adrian83/chat/pkg/retention"
+	"github.com/adrian83/chat/pkg/scheduler"
 	"github.com/adrian83/chat/pkg/user"
+	"github.com/adrian83/chat/pkg/webhook"
 
 	session "github.com/adrian83/go-redis-session"
 	"github.com/go-redis/redis"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	logger "github.com/sirupsen/logrus"
 	"golang.org/x/net/websocket"
@@ -25,6 +38,11 @@ import (
 
 const (
 	configPrefix = "chat"
+
+	// readinessTimeout is a time in which all readiness checks have to finish.
+	readinessTimeout = 2 * time.Second
+	// shutdownTimeout is a time in which clients should be disconnected and pending state persisted.
+	shutdownTimeout = 10 * time.Second
 )
 
 func initLogger() {
@@ -66,7 +84,7 @@ func initRethink(config *config.Config) *db.RethinkDB {
 	return rethink
 }
 
-func initSession(config *config.Config) (*session.Store, func()) {
+func initSession(config *config.Config, appMetrics *metrics.Metrics) (*session.Store, *redis.Client, func()) {
 	options := &redis.Options{
 		Addr:     fmt.Sprintf("%v:%v", config.SessionDbHost, config.SessionDbPort),
 		Password: config.SessionDbPassword,
@@ -74,6 +92,7 @@ func initSession(config *config.Config) (*session.Store, func()) {
 	}
 
 	client := redis.NewClient(options)
+	client.WrapProcess(appMetrics.WrapRedisProcess)
 
 	sessionStore := session.NewStore(client, handler.SessionValidFor)
 
@@ -85,7 +104,213 @@ func initSession(config *config.Config) (*session.Store, func()) {
 
 	logger.Info("SessionStore created.")
 
-	return sessionStore, closeFunc
+	return sessionStore, client, closeFunc
+}
+
+func initAttachments(config *config.Config, rethink *db.RethinkDB) *attachment.Service {
+	storage, err := attachment.NewLocalStorage(config.AttachmentsPath)
+	if err != nil {
+		logger.Errorf("Error while creating attachments storage! Error: %v", err)
+		panic(err)
+	}
+
+	logger.Infof("Attachments storage created in %v", config.AttachmentsPath)
+
+	images := attachment.NewImageProcessor(config.ImagesMaxPixels, config.ThumbnailSize)
+
+	return attachment.NewService(rethink.GetAttachmentTable(), storage, images, config.AttachmentsMaxSize)
+}
+
+func initContentFilter(config *config.Config) *filter.Filter {
+	rules := filter.SecretRules(filter.Action(config.SecretsAction))
+
+	if config.ContentFilterRules != "" {
+		custom, err := filter.LoadRules(config.ContentFilterRules)
+		if err != nil {
+			logger.Errorf("Error while reading content filter rules! Error: %v", err)
+			panic(err)
+		}
+
+		rules = append(rules, custom...)
+	}
+
+	contentFilter, err := filter.NewFilter(rules)
+	if err != nil {
+		logger.Errorf("Error while creating content filter! Error: %v", err)
+		panic(err)
+	}
+
+	logger.Infof("Content filter created with %v rules", len(rules))
+
+	return contentFilter
+}
+
+// bots contains constructors of bots which can be enabled in configuration.
+var bots = map[string]func(pipeline *messagePipeline) bot.Bot{
+	"echo": func(*messagePipeline) bot.Bot { return bot.NewEchoBot(exchange.MainRoomName()) },
+	"reminder": func(pipeline *messagePipeline) bot.Bot {
+		return bot.NewReminderBot(pipeline.scheduler, exchange.MainRoomName())
+	},
+}
+
+func initBots(ctx context.Context, config *config.Config, chatRooms *exchange.Rooms, pipeline *messagePipeline) []*bot.Runner {
+	runners := make([]*bot.Runner, 0, len(config.Bots))
+
+	for _, name := range config.Bots {
+		newBot, ok := bots[name]
+		if !ok {
+			logger.Warnf("Unknown bot: %v", name)
+			continue
+		}
+
+		runners = append(runners, bot.Start(ctx, newBot(pipeline), chatRooms, pipeline.configure))
+	}
+
+	return runners
+}
+
+func initWebhooks(rethink *db.RethinkDB, appMetrics *metrics.Metrics) (*webhook.Service, *webhook.Dispatcher) {
+	webhookService := webhook.NewService(rethink.GetWebhookTable())
+
+	if err := webhookService.Load(); err != nil {
+		logger.Errorf("Error while loading webhooks! Error: %v", err)
+		panic(err)
+	}
+
+	dispatcher := webhook.NewDispatcher(webhookService, rethink.GetDeadLetterTable(), webhook.DefaultConfig())
+	dispatcher.SetDropCounter(appMetrics)
+	dispatcher.Start()
+
+	logger.Info("Webhook dispatcher started")
+
+	return webhookService, dispatcher
+}
+
+func initRoomOwners(rethink *db.RethinkDB) *ownership.Store {
+	owners := ownership.NewStore(rethink.GetRoomOwnerTable())
+
+	if err := owners.Load(); err != nil {
+		logger.Errorf("Error while loading owners of rooms! Error: %v", err)
+		panic(err)
+	}
+
+	return owners
+}
+
+func initMemberships(rethink *db.RethinkDB) *membership.Store {
+	memberships := membership.NewStore(rethink.GetRoomMemberTable())
+
+	if err := memberships.Load(); err != nil {
+		logger.Errorf("Error while loading memberships of rooms! Error: %v", err)
+		panic(err)
+	}
+
+	memberships.Start()
+
+	return memberships
+}
+
+func initHistory(rethink *db.RethinkDB, appMetrics *metrics.Metrics) *history.Store {
+	store := history.NewStore(rethink.GetMessageTable())
+	store.SetDropCounter(appMetrics)
+	store.Start()
+
+	logger.Info("Message history store started")
+
+	return store
+}
+
+func initRetention(config *config.Config, rethink *db.RethinkDB, attachments *attachment.Service, pins *pin.Service) (*retention.Service, *retention.Purger) {
+	defaults := retention.Policy{Days: config.RetentionDays, Messages: config.RetentionMessages}
+	policies := retention.NewService(rethink.GetRetentionTable(), defaults)
+
+	if err := policies.Load(); err != nil {
+		logger.Errorf("Error while loading retention policies! Error: %v", err)
+		panic(err)
+	}
+
+	var archive retention.Archive
+	if config.RetentionArchive {
+		archive = rethink.GetArchivedMessageTable()
+
+		storage, err := attachment.NewLocalStorage(config.ArchivePath)
+		if err != nil {
+			logger.Errorf("Error while creating attachments archive! Error: %v", err)
+			panic(err)
+		}
+		attachments.SetArchive(storage)
+
+		logger.Infof("Attachments of archived messages are moved into %v", config.ArchivePath)
+	}
+
+	purger := retention.NewPurger(policies, rethink.GetMessageTable(), archive, attachments, config.RetentionInterval)
+	purger.SetRemovalListener(pins)
+	purger.Start()
+
+	logger.Infof("Messages purger started, default policy: %v days, %v messages, archive: %v",
+		defaults.Days, defaults.Messages, config.RetentionArchive)
+
+	return policies, purger
+}
+
+func initScheduler(config *config.Config, rethink *db.RethinkDB, chatRooms *exchange.Rooms) *scheduler.Scheduler {
+	schedulerConfig := scheduler.DefaultConfig()
+	schedulerConfig.MaxLateness = config.SchedulerLateness
+	schedulerConfig.MaxPerUser = config.SchedulerPerUser
+
+	messageScheduler := scheduler.NewScheduler(rethink.GetScheduledTable(), chatRooms, schedulerConfig)
+
+	if err := messageScheduler.Load(); err != nil {
+		logger.Errorf("Error while loading scheduled messages! Error: %v", err)
+		panic(err)
+	}
+
+	messageScheduler.Start()
+
+	logger.Info("Message scheduler started")
+
+	return messageScheduler
+}
+
+func initPolls(config *config.Config, rethink *db.RethinkDB, chatRooms *exchange.Rooms) *poll.Service {
+	pollConfig := poll.DefaultConfig()
+	pollConfig.TallyDelay = config.PollTallyDelay
+	pollConfig.MaxPerRoom = config.PollsPerRoom
+	pollConfig.MaxPerUser = config.PollsPerUser
+	pollConfig.VoterKey = []byte(config.PollVoterKey)
+
+	if config.PollVoterKey == "" {
+		logger.Warn("Poll voter key not set, voters of anonymous polls cannot change their votes after restart")
+	}
+
+	polls := poll.NewService(rethink.GetPollTable(), chatRooms, pollConfig)
+
+	if err := polls.Load(); err != nil {
+		logger.Errorf("Error while loading open polls! Error: %v", err)
+		panic(err)
+	}
+
+	polls.Start()
+	chatRooms.AddWelcomer(polls)
+
+	logger.Info("Polls service started")
+
+	return polls
+}
+
+func initPins(config *config.Config, rethink *db.RethinkDB, chatRooms *exchange.Rooms) *pin.Service {
+	pins := pin.NewService(rethink.GetPinTable(), rethink.GetMessageTable(), chatRooms, config.AdminUsers)
+
+	if err := pins.Load(); err != nil {
+		logger.Errorf("Error while loading pinned messages! Error: %v", err)
+		panic(err)
+	}
+
+	chatRooms.AddWelcomer(pins)
+
+	logger.Info("Pinned messages loaded")
+
+	return pins
 }
 
 func main() {
@@ -95,16 +320,40 @@ func main() {
 	// read config
 	appConfig := initConfig()
 
+	// init metrics
+	appMetrics := metrics.New()
+	if appConfig.MetricsToken == "" {
+		logger.Warn("Metrics token is not configured, metrics are not available")
+	}
+
 	// init database
 	rethink := initRethink(appConfig)
+	rethink.SetObserver(appMetrics)
 	defer rethink.Close()
 
 	// init session
-	sessionStore, closeFnc := initSession(appConfig)
+	sessionStore, redisClient, closeFnc := initSession(appConfig, appMetrics)
 	defer closeFnc()
 
+	// init webhooks
+	webhookService, webhookDispatcher := initWebhooks(rethink, appMetrics)
+
+	// init message history
+	historyStore := initHistory(rethink, appMetrics)
+
 	// create chat rooms
-	chatRooms := exchange.NewRooms()
+	memberships := initMemberships(rethink)
+
+	chatRooms := exchange.NewRooms(webhookDispatcher, historyStore, memberships)
+	chatRooms.SetLimits(exchange.Limits{
+		MaxRoomMembers:  appConfig.MaxRoomMembers,
+		MaxRooms:        appConfig.MaxRooms,
+		MaxRoomsPerUser: appConfig.MaxRoomsPerUser,
+	})
+	chatRooms.SetOwners(initRoomOwners(rethink))
+	chatRooms.SetMemberships(memberships)
+	chatRooms.SetDropCounter(appMetrics)
+	appMetrics.Watch(chatRooms)
 
 	// ---------------------------------------
 	// useful structures
@@ -113,13 +362,32 @@ func main() {
 	userTable := rethink.GetUserTable()
 	userService := user.NewUserService(userTable)
 
+	attachmentService := initAttachments(appConfig, rethink)
+
+	// init pinned messages
+	pins := initPins(appConfig, rethink, chatRooms)
+
+	// init retention of messages
+	retentionService, purger := initRetention(appConfig, rethink, attachmentService, pins)
+
+	// init scheduled messages and reminders
+	messageScheduler := initScheduler(appConfig, rethink, chatRooms)
+
+	// init polls
+	polls := initPolls(appConfig, rethink, chatRooms)
+
+	contentFilter := initContentFilter(appConfig)
+	flagStore := filter.NewFlagStore(rethink.GetFlagTable())
+
 	templateRepository := handler.NewTemplateRepository(appConfig.StaticsPath)
 
-	loginHandler := handler.NewLoginHandler(templateRepository, userService, sessionStore)
+	loginHandler := handler.NewLoginHandler(templateRepository, userService, sessionStore, appMetrics)
 	logoutHandler := handler.NewLogoutHandler(templateRepository, sessionStore)
 	registerHandler := handler.NewRegisterHandler(templateRepository, userService)
 	indexHandler := handler.NewIndexHandler(templateRepository, sessionStore)
 	conversationHandler := handler.NewConversationHandler(templateRepository, sessionStore)
+	attachmentHandler := handler.NewAttachmentHandler(sessionStore, attachmentService, chatRooms, appConfig.AttachmentsMaxSize)
+	webhookHandler := handler.NewWebhookHandler(sessionStore, webhookService, chatRooms)
 
 	// ---------------------------------------
 	// routing
@@ -129,6 +397,14 @@ func main() {
 
 	router.HandleFunc("/", indexHandler.ShowIndexPage)
 
+	healthHandler := handler.NewHealthHandler(readinessTimeout,
+		handler.HealthCheck{Name: "rethinkdb", Check: rethink.Ping},
+		handler.HealthCheck{Name: "redis", Check: func(ctx context.Context) error {
+			return redisClient.WithContext(ctx).Ping().Err()
+		}},
+		handler.HealthCheck{Name: "rooms", Check: chatRooms.Ping},
+	)
+
 	router.HandleFunc("/login", loginHandler.ShowLoginPage).Methods("GET")
 	router.HandleFunc("/login", loginHandler.LoginUser).Methods("POST")
 
@@ -139,7 +415,61 @@ func main() {
 
 	router.HandleFunc("/conversation", conversationHandler.ShowConversationPage).Methods("GET")
 
-	router.Handle("/talk", websocket.Handler(connect(sessionStore, chatRooms)))
+	pipeline := &messagePipeline{
+		rooms:             chatRooms,
+		history:           historyStore,
+		scheduler:         messageScheduler,
+		polls:             polls,
+		pins:              pins,
+		metrics:           appMetrics,
+		attachments:       attachmentService,
+		contentFilter:     filter.NewMiddleware(contentFilter, flagStore),
+		messagesPerSecond: appConfig.MessagesPerSecond,
+		messagesBurst:     appConfig.MessagesBurst,
+	}
+
+	admins := handler.NewAdministrators(appConfig.AdminUsers)
+
+	incomingHookService := webhook.NewIncomingService(rethink.GetIncomingHookTable(), userService)
+	incomingHookLimiter := exchange.NewRateLimiter(appConfig.HookMessagesPerSec, appConfig.HookMessagesBurst)
+	incomingWebhookHandler := handler.NewIncomingWebhookHandler(sessionStore, incomingHookService, chatRooms, admins,
+		incomingHookLimiter, pipeline.integrationHandler())
+	roomHandler := handler.NewRoomHandler(sessionStore, chatRooms, historyStore, pipeline.apiHandler(), admins)
+	adminHandler := handler.NewAdminHandler(templateRepository, sessionStore, chatRooms, flagStore, admins)
+
+	router.HandleFunc("/admin", adminHandler.ShowDashboard).Methods("GET")
+
+	err := registerAPIRoutes(router, &apiHandlers{
+		rooms:            roomHandler,
+		webhooks:         webhookHandler,
+		incomingWebhooks: incomingWebhookHandler,
+		retention:        handler.NewRetentionHandler(sessionStore, retentionService, chatRooms, admins),
+		scheduled:        handler.NewScheduledHandler(sessionStore, messageScheduler),
+		admin:            adminHandler,
+		attachments:      attachmentHandler,
+		health:           healthHandler,
+		metrics:          appMetrics.Handler(appConfig.MetricsToken),
+	})
+	if err != nil {
+		logger.Errorf("Error while registering API routes! Error: %v", err)
+		panic(err)
+	}
+
+	// clients are disconnected when this context is cancelled
+	clientsCtx, disconnectClients := context.WithCancel(context.Background())
+	defer disconnectClients()
+
+	connectionLimiter := exchange.NewConnectionLimiter(appConfig.MaxConnections, appConfig.MaxUserConnections)
+
+	router.Handle("/talk", connect(clientsCtx, sessionStore, chatRooms, connectionLimiter, pipeline))
+
+	// ---------------------------------------
+	// bots
+	// ---------------------------------------
+
+	for _, runner := range initBots(clientsCtx, appConfig, chatRooms, pipeline) {
+		defer runner.Stop()
+	}
 
 	// ---------------------------------------
 	// http server
@@ -160,53 +490,188 @@ func main() {
 
 	<-stopChan
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
+	// stop accepting new connections, websocket connections are not closed by the server
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Warnf("Error while stopping server. Error: %v", err)
 	}
 
+	// inform clients about restart, send queued messages and close connections
+	disconnectClients()
+
+	if err := chatRooms.Shutdown(ctx); err != nil {
+		logger.Warnf("Error while disconnecting clients. Error: %v", err)
+	}
+
+	if err := messageScheduler.Close(ctx); err != nil {
+		logger.Warnf("Error while stopping message scheduler. Error: %v", err)
+	}
+
+	if err := polls.Close(ctx); err != nil {
+		logger.Warnf("Error while stopping polls service. Error: %v", err)
+	}
+
+	chatRooms.Stop()
+
+	if err := webhookDispatcher.Close(ctx); err != nil {
+		logger.Warnf("Error while stopping webhook dispatcher. Error: %v", err)
+	}
+
+	if err := purger.Close(ctx); err != nil {
+		logger.Warnf("Error while stopping messages purger. Error: %v", err)
+	}
+
+	if err := historyStore.Close(ctx); err != nil {
+		logger.Warnf("Error while stopping message history store. Error: %v", err)
+	}
+
+	if err := memberships.Close(ctx); err != nil {
+		logger.Warnf("Error while stopping memberships store. Error: %v", err)
+	}
+
 	logger.Info("Server stopped.")
 }
 
-func connect(sessionStore *session.Store, chatRooms *exchange.Rooms) func(*websocket.Conn) {
+// messagePipeline keeps dependencies needed to build routers for clients.
+type messagePipeline struct {
+	rooms             *exchange.Rooms
+	history           *history.Store
+	scheduler         *scheduler.Scheduler
+	polls             *poll.Service
+	pins              *pin.Service
+	metrics           *metrics.Metrics
+	attachments       *attachment.Service
+	contentFilter     exchange.Middleware
+	messagesPerSecond float64
+	messagesBurst     int
+}
+
+// configure registers routes and middlewares for messages sent by given client.
+func (p *messagePipeline) configure(router *exchange.Router, client *exchange.Client) {
+	router.Use(
+		p.metrics.Middleware,
+		exchange.RecoveryMiddleware,
+		exchange.LoggingMiddleware,
+		exchange.NewRateLimitMiddleware(p.messagesPerSecond, p.messagesBurst),
+	)
+
+	router.UseFor(exchange.MsgTextMsgMT,
+		exchange.ValidateTextMessage,
+		exchange.NewMembershipMiddleware(p.rooms),
+		p.contentFilter,
+		scheduler.NewRemindMiddleware(p.scheduler, client),
+		exchange.NewAttachmentsMiddleware(p.attachments),
+		exchange.RenderMarkdown,
+	)
+
+	router.UseFor(exchange.MsgScheduleMT,
+		exchange.ValidateTextMessage,
+		exchange.NewMembershipMiddleware(p.rooms),
+		p.contentFilter,
+		exchange.RenderMarkdown,
+	)
+
+	router.UseFor(exchange.MsgCreatePollMT,
+		exchange.ValidateTextMessage,
+		exchange.NewMembershipMiddleware(p.rooms),
+		p.contentFilter,
+	)
+
+	router.UseFor(exchange.MsgVoteMT, exchange.NewMembershipMiddleware(p.rooms))
+
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgUserJoinedRoomMT, exchange.NewAddClientToRoomHandler(p.rooms, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgTextMsgMT, exchange.NewSendMsgToRoomHandler(p.rooms)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgCreateRoomMT, exchange.NewCreateRoomHandler(p.rooms, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgUserLeftRoomMT, exchange.NewRemoveClientFromRoomHandler(p.rooms, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgLogoutMT, exchange.NewLogoutHandler(client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgRoomsDirectoryMT, exchange.NewRoomsDirectoryHandler(p.rooms, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgSetTopicMT, exchange.NewSetTopicHandler(p.rooms, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgSearchMT, exchange.NewSearchHandler(p.rooms, p.history, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgScheduleMT, scheduler.NewScheduleHandler(p.scheduler, client)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgCreatePollMT, poll.NewCreatePollHandler(p.polls)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgVoteMT, poll.NewVoteHandler(p.polls)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgPinMT, pin.NewPinHandler(p.pins)))
+	router.RegisterRoute(exchange.NewRoute(exchange.MsgUnpinMT, pin.NewUnpinHandler(p.pins)))
+}
+
+// apiHandler returns handler of text messages posted by users through JSON API.
+// Messages have to pass the same checks as messages sent through websocket.
+func (p *messagePipeline) apiHandler() exchange.Handler {
+	return exchange.Chain(exchange.NewSendMsgToRoomHandler(p.rooms),
+		exchange.RecoveryMiddleware,
+		exchange.LoggingMiddleware,
+		exchange.ValidateTextMessage,
+		exchange.NewMembershipMiddleware(p.rooms),
+		p.contentFilter,
+		exchange.NewAttachmentsMiddleware(p.attachments),
+		exchange.RenderMarkdown,
+	)
+}
+
+// integrationHandler returns handler of text messages posted by integrations (not connected clients).
+func (p *messagePipeline) integrationHandler() exchange.Handler {
+	return exchange.Chain(exchange.NewSendMsgToRoomHandler(p.rooms),
+		exchange.RecoveryMiddleware,
+		exchange.LoggingMiddleware,
+		exchange.ValidateTextMessage,
+		p.contentFilter,
+		exchange.RenderMarkdown,
+	)
+}
+
+// connect returns handler which upgrades requests of logged in users to websocket connections.
+// Requests exceeding connection limits are rejected with 503 status before the upgrade.
+func connect(ctx context.Context, sessionStore *session.Store, chatRooms *exchange.Rooms,
+	limiter *exchange.ConnectionLimiter, pipeline *messagePipeline) http.Handler {
 	logger.Infof("New connection")
 
-	return func(wsc *websocket.Conn) {
-		sessionID, err := handler.ReadSessionIDFromCookie(wsc.Request())
-		if err != nil {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := handler.ReadSessionIDFromCookie(req); err != nil {
+			pipeline.metrics.Connected(metrics.ConnectionNoSession)
 			logger.Error(err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		sess, err := sessionStore.Find(sessionID)
+		usr, err := handler.ReadUserFromSession(sessionStore, req)
 		if err != nil {
-			logger.Errorf("Error while getting user session. Error: %v", err)
+			pipeline.metrics.Connected(metrics.ConnectionUnauthenticated)
+			logger.Errorf("Error while getting user data from session. Error: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		var user user.User
-		if err = sess.Get("user", &user); err != nil {
-			logger.Errorf("Error while getting user data from session. Error: %v", err)
+		release, err := limiter.Acquire(usr.Name())
+		if err != nil {
+			pipeline.metrics.Connected(metrics.ConnectionLimited)
+			logger.Warnf("Connection of %v rejected. Error: %v", usr.Name(), err)
+			http.Error(w, fmt.Sprintf("Service unavailable: %v", err), http.StatusServiceUnavailable)
 			return
 		}
+		// websocket handler returns when the connection is closed or the upgrade failed
+		defer release()
 
-		router := exchange.NewRouter()
+		websocket.Handler(func(wsc *websocket.Conn) {
+			pipeline.metrics.Connected(metrics.ConnectionAccepted)
 
-		wsConn := exchange.NewWebSocketConn(wsc)
-		client := exchange.NewClient(sessionID, &user, chatRooms, wsConn, router)
+			router := exchange.NewRouter()
 
-		router.RegisterRoute(exchange.NewRoute(exchange.MsgUserJoinedRoomMT, exchange.NewAddClientToRoomHandler(chatRooms, client)))
-		router.RegisterRoute(exchange.NewRoute(exchange.MsgTextMsgMT, exchange.NewSendMsgToRoomHandler(chatRooms)))
-		router.RegisterRoute(exchange.NewRoute(exchange.MsgCreateRoomMT, exchange.NewCreateRoomHandler(chatRooms, client)))
-		router.RegisterRoute(exchange.NewRoute(exchange.MsgUserLeftRoomMT, exchange.NewRemoveClientFromRoomHandler(chatRooms, client)))
-		router.RegisterRoute(exchange.NewRoute(exchange.MsgLogoutMT, exchange.NewLogoutHandler(client)))
+			wsConn := pipeline.metrics.Connection(exchange.NewWebSocketConn(wsc))
+			// id of the client is sent to other users and shown to administrators,
+			// so it is random instead of being derived from the session
+			client := exchange.NewClient(uuid.New().String(), usr, chatRooms, wsConn, router)
 
-		chatRooms.AddClientToRoom(exchange.MainRoomName(), client)
+			pipeline.configure(router, client)
 
-		logger.Infof("New connection received from %v, %v", client, &user)
+			chatRooms.AddClientToRoom(exchange.MainRoomName(), client)
 
-		client.Start()
-	}
+			logger.Infof("New connection received from %v, %v", client, usr)
+
+			client.Start(ctx)
+
+			pipeline.metrics.Disconnected(client.DisconnectReason())
+		}).ServeHTTP(w, req)
+	})
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/handler"
+
+	"github.com/gorilla/mux"
+)
+
+// apiHandlers contains handlers of the JSON API, attachments, health checks and metrics.
+type apiHandlers struct {
+	rooms            *handler.RoomHandler
+	webhooks         *handler.WebhookHandler
+	incomingWebhooks *handler.IncomingWebhookHandler
+	retention        *handler.RetentionHandler
+	scheduled        *handler.ScheduledHandler
+	admin            *handler.AdminHandler
+	attachments      *handler.AttachmentHandler
+	health           *handler.HealthHandler
+	metrics          http.Handler
+}
+
+// registerAPIRoutes registers JSON API, attachments, health checks and metrics routes together
+// with the route serving their OpenAPI document. Error is returned if the document is out of sync
+// with the routes.
+func registerAPIRoutes(router *mux.Router, handlers *apiHandlers) error {
+	router.HandleFunc("/api/rooms", handlers.rooms.List).Methods("GET")
+	router.HandleFunc("/api/rooms", handlers.rooms.Create).Methods("POST")
+	router.HandleFunc("/api/rooms/{room}", handlers.rooms.Delete).Methods("DELETE")
+	router.HandleFunc("/api/rooms/{room}/members", handlers.rooms.Members).Methods("GET")
+	router.HandleFunc("/api/rooms/{room}/messages", handlers.rooms.History).Methods("GET")
+	router.HandleFunc("/api/rooms/{room}/messages", handlers.rooms.Post).Methods("POST")
+	router.HandleFunc("/api/rooms/{room}/export", handlers.rooms.Export).Methods("GET")
+	router.HandleFunc("/api/directory", handlers.rooms.Directory).Methods("GET")
+	router.HandleFunc("/api/search", handlers.rooms.Search).Methods("GET")
+
+	router.HandleFunc("/api/rooms/{room}/webhooks", handlers.webhooks.List).Methods("GET")
+	router.HandleFunc("/api/rooms/{room}/webhooks", handlers.webhooks.Register).Methods("POST")
+	router.HandleFunc("/api/rooms/{room}/webhooks/{id}", handlers.webhooks.Delete).Methods("DELETE")
+
+	router.HandleFunc("/api/rooms/{room}/incoming-webhooks", handlers.incomingWebhooks.List).Methods("GET")
+	router.HandleFunc("/api/rooms/{room}/incoming-webhooks", handlers.incomingWebhooks.Create).Methods("POST")
+	router.HandleFunc("/api/rooms/{room}/incoming-webhooks/{id}", handlers.incomingWebhooks.Delete).Methods("DELETE")
+	router.HandleFunc("/api/hooks/{token}", handlers.incomingWebhooks.Post).Methods("POST")
+
+	router.HandleFunc("/api/rooms/{room}/retention", handlers.retention.Get).Methods("GET")
+	router.HandleFunc("/api/rooms/{room}/retention", handlers.retention.Set).Methods("PUT")
+	router.HandleFunc("/api/rooms/{room}/retention", handlers.retention.Reset).Methods("DELETE")
+
+	router.HandleFunc("/api/scheduled", handlers.scheduled.List).Methods("GET")
+	router.HandleFunc("/api/scheduled/{id}", handlers.scheduled.Cancel).Methods("DELETE")
+
+	router.HandleFunc("/api/admin/clients", handlers.admin.Clients).Methods("GET")
+	router.HandleFunc("/api/admin/clients/{id}", handlers.admin.Disconnect).Methods("DELETE")
+	router.HandleFunc("/api/admin/rooms", handlers.admin.Rooms).Methods("GET")
+	router.HandleFunc("/api/admin/rooms/{room}", handlers.admin.DeleteRoom).Methods("DELETE")
+	router.HandleFunc("/api/admin/flags", handlers.admin.Flags).Methods("GET")
+	router.HandleFunc("/api/admin/flags/{id}/resolve", handlers.admin.ResolveFlag).Methods("POST")
+
+	router.HandleFunc("/attachments", handlers.attachments.Upload).Methods("POST")
+	router.HandleFunc("/attachments/{id}", handlers.attachments.Download).Methods("GET")
+	router.HandleFunc("/attachments/{id}/thumbnail", handlers.attachments.DownloadThumbnail).Methods("GET")
+
+	router.HandleFunc("/healthz", handlers.health.Live).Methods("GET")
+	router.HandleFunc("/readyz", handlers.health.Ready).Methods("GET")
+
+	router.Handle("/metrics", handlers.metrics).Methods("GET")
+
+	openAPIHandler := handler.NewOpenAPIHandler(router)
+	router.HandleFunc(handler.OpenAPIPath, openAPIHandler.Serve).Methods("GET")
+
+	return openAPIHandler.Generate()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adrian83/chat/pkg/handler"
+	"github.com/adrian83/chat/pkg/openapi"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIRoutesShouldMatchOpenAPIDocument(t *testing.T) {
+	// given
+	router := mux.NewRouter()
+
+	handlers := &apiHandlers{
+		rooms:            &handler.RoomHandler{},
+		webhooks:         &handler.WebhookHandler{},
+		incomingWebhooks: &handler.IncomingWebhookHandler{},
+		retention:        &handler.RetentionHandler{},
+		scheduled:        &handler.ScheduledHandler{},
+		admin:            &handler.AdminHandler{},
+		attachments:      &handler.AttachmentHandler{},
+		health:           &handler.HealthHandler{},
+		metrics:          http.NotFoundHandler(),
+	}
+
+	// when
+	err := registerAPIRoutes(router, handlers)
+
+	// then
+	assert.NoError(t, err)
+}
+
+func TestAPIRoutesShouldServeOpenAPIDocument(t *testing.T) {
+	// given
+	router := mux.NewRouter()
+
+	handlers := &apiHandlers{
+		rooms:            &handler.RoomHandler{},
+		webhooks:         &handler.WebhookHandler{},
+		incomingWebhooks: &handler.IncomingWebhookHandler{},
+		retention:        &handler.RetentionHandler{},
+		scheduled:        &handler.ScheduledHandler{},
+		admin:            &handler.AdminHandler{},
+		attachments:      &handler.AttachmentHandler{},
+		health:           &handler.HealthHandler{},
+		metrics:          http.NotFoundHandler(),
+	}
+	assert.NoError(t, registerAPIRoutes(router, handlers))
+
+	// when
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", handler.OpenAPIPath, nil))
+
+	// then
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var document openapi.Document
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&document))
+	assert.Equal(t, openapi.Version, document.OpenAPI)
+	assert.Contains(t, document.Paths, "/api/rooms/{room}/messages")
+	assert.Contains(t, document.Paths["/api/rooms/{room}/messages"], "post")
+	assert.Contains(t, document.Paths, "/attachments/{id}")
+	assert.Contains(t, document.Paths, "/readyz")
+}
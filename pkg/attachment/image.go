@@ -0,0 +1,552 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// gif decoder has to be registered to process gif images
+	_ "image/gif"
+)
+
+const (
+	jpegQuality      = 90
+	thumbnailQuality = 80
+
+	contentTypeJPEG = "image/jpeg"
+	contentTypePNG  = "image/png"
+	contentTypeGIF  = "image/gif"
+)
+
+var (
+	// ErrInvalidImage is returned when uploaded image cannot be decoded.
+	ErrInvalidImage = errors.New("invalid image")
+	// ErrImageTooLarge is returned when uploaded image has too many pixels.
+	ErrImageTooLarge = errors.New("image has too many pixels")
+)
+
+// imageContentTypes contains types of images which are processed during upload.
+var imageContentTypes = map[string]struct{}{
+	contentTypeJPEG: {},
+	contentTypePNG:  {},
+	contentTypeGIF:  {},
+}
+
+func isImage(contentType string) bool {
+	_, ok := imageContentTypes[contentType]
+	return ok
+}
+
+// processedImage is a result of processing uploaded image.
+type processedImage struct {
+	data          []byte
+	width         int
+	height        int
+	thumbnail     []byte
+	thumbnailType string
+}
+
+// ImageProcessor validates uploaded images, removes metadata from them and creates thumbnails.
+type ImageProcessor struct {
+	maxPixels     int
+	thumbnailSize int
+}
+
+// NewImageProcessor returns new ImageProcessor. Images with more than maxPixels pixels
+// (width × height) are rejected before they are decoded, because small files can decode
+// into huge images. Thumbnails fit in a square with side of thumbnailSize pixels.
+func NewImageProcessor(maxPixels, thumbnailSize int) *ImageProcessor {
+	return &ImageProcessor{
+		maxPixels:     maxPixels,
+		thumbnailSize: thumbnailSize,
+	}
+}
+
+func (p *ImageProcessor) process(contentType string, data []byte) (*processedImage, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > int64(p.maxPixels) {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	result := &processedImage{data: data}
+
+	switch contentType {
+	case contentTypeJPEG:
+		orientation := jpegOrientation(data)
+		if orientation > 1 {
+			// metadata is dropped while encoding so image has to be rotated to look the same
+			img = orient(toRGBA(img), orientation)
+			if result.data, err = encodeJPEG(img, jpegQuality); err != nil {
+				return nil, err
+			}
+		} else if result.data, err = stripJPEG(data); err != nil {
+			return nil, err
+		}
+	case contentTypePNG:
+		if result.data, err = stripPNG(data); err != nil {
+			return nil, err
+		}
+	case contentTypeGIF:
+		if result.data, err = stripGIF(data); err != nil {
+			return nil, err
+		}
+	}
+
+	bounds := img.Bounds()
+	result.width, result.height = bounds.Dx(), bounds.Dy()
+
+	// decoded image isn't copied, thumbnail is computed from it directly
+	thumbnail := resize(img, p.thumbnailSize)
+
+	if contentType == contentTypeJPEG {
+		result.thumbnail, err = encodeJPEG(thumbnail, thumbnailQuality)
+		result.thumbnailType = contentTypeJPEG
+	} else {
+		result.thumbnail, err = encodePNG(thumbnail)
+		result.thumbnailType = contentTypePNG
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("cannot encode jpeg image, error: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("cannot encode png image, error: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// resize scales image down (using box filter) so it fits in a square with given side.
+// Images which are already small enough are only converted to RGBA.
+func resize(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= size && srcH <= size {
+		return toRGBA(src)
+	}
+
+	dstW, dstH := size, size
+	if srcW > srcH {
+		dstH = maxInt(1, srcH*size/srcW)
+	} else {
+		dstW = maxInt(1, srcW*size/srcH)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, maxInt((y+1)*srcH/dstH, y*srcH/dstH+1)
+
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, maxInt((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.RGBAModel.Convert(src.At(bounds.Min.X+sx, bounds.Min.Y+sy)).(color.RGBA)
+					r += int(c.R)
+					g += int(c.G)
+					b += int(c.B)
+					a += int(c.A)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// orient transforms image according to the EXIF orientation tag (values 1-8).
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+const (
+	jpegMarkerSOI   = 0xD8
+	jpegMarkerSOS   = 0xDA
+	jpegMarkerAPP0  = 0xE0
+	jpegMarkerAPP1  = 0xE1
+	jpegMarkerAPP2  = 0xE2
+	jpegMarkerAPP14 = 0xEE
+	jpegMarkerAPP15 = 0xEF
+	jpegMarkerCOM   = 0xFE
+
+	exifOrientationTag = 0x0112
+)
+
+var errInvalidJPEG = fmt.Errorf("%w: malformed jpeg segments", ErrInvalidImage)
+
+// jpegSegment is a part of jpeg file preceding the image data.
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+// jpegSegments returns segments preceding image data and offset at which the image data starts.
+func jpegSegments(data []byte) ([]jpegSegment, int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil, 0, errInvalidJPEG
+	}
+
+	segments := make([]jpegSegment, 0)
+	pos := 2
+
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, errInvalidJPEG
+		}
+
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// fill byte
+			pos++
+			continue
+		}
+
+		if marker == jpegMarkerSOS {
+			return segments, pos, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, errInvalidJPEG
+		}
+
+		segments = append(segments, jpegSegment{marker: marker, data: data[pos:end]})
+		pos = end
+	}
+
+	return nil, 0, errInvalidJPEG
+}
+
+// stripJPEG removes comments and application segments (EXIF, XMP, IPTC...) from jpeg file.
+// JFIF header, ICC color profile and Adobe color transform segments are kept, because they
+// are needed to properly display the image.
+func stripJPEG(data []byte) ([]byte, error) {
+	segments, imageStart, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(data))
+	result = append(result, 0xFF, jpegMarkerSOI)
+
+	for _, segment := range segments {
+		isApp := segment.marker >= jpegMarkerAPP0 && segment.marker <= jpegMarkerAPP15
+		keep := segment.marker == jpegMarkerAPP0 || segment.marker == jpegMarkerAPP2 || segment.marker == jpegMarkerAPP14
+
+		if segment.marker == jpegMarkerCOM || (isApp && !keep) {
+			continue
+		}
+
+		result = append(result, segment.data...)
+	}
+
+	return append(result, data[imageStart:]...), nil
+}
+
+// jpegOrientation returns value of EXIF orientation tag or 0 if it cannot be found.
+func jpegOrientation(data []byte) int {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return 0
+	}
+
+	for _, segment := range segments {
+		// marker (2 bytes), length (2 bytes), "Exif\0\0" (6 bytes)
+		if segment.marker != jpegMarkerAPP1 || len(segment.data) < 10 || string(segment.data[4:10]) != "Exif\x00\x00" {
+			continue
+		}
+
+		return exifOrientation(segment.data[10:])
+	}
+
+	return 0
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 0
+}
+
+// pngMetadataChunks contains types of png chunks with textual metadata, timestamps and EXIF.
+var pngMetadataChunks = map[string]struct{}{
+	"tEXt": {},
+	"zTXt": {},
+	"iTXt": {},
+	"eXIf": {},
+	"tIME": {},
+}
+
+var (
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	errInvalidPNG = fmt.Errorf("%w: malformed png chunks", ErrInvalidImage)
+)
+
+// stripPNG removes metadata chunks from png file.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errInvalidPNG
+	}
+
+	result := make([]byte, 0, len(data))
+	result = append(result, pngSignature...)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errInvalidPNG
+		}
+
+		// length (4 bytes), type (4 bytes), data, crc (4 bytes)
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, errInvalidPNG
+		}
+
+		if _, metadata := pngMetadataChunks[string(data[pos+4:pos+8])]; !metadata {
+			result = append(result, data[pos:end]...)
+		}
+
+		pos = end
+	}
+
+	return result, nil
+}
+
+const (
+	gifHeaderLength      = 6
+	gifScreenLength      = 7
+	gifImageLength       = 10
+	gifExtension         = 0x21
+	gifImageSeparator    = 0x2C
+	gifTrailer           = 0x3B
+	gifCommentLabel      = 0xFE
+	gifApplicationLabel  = 0xFF
+	gifColorTableFlag    = 0x80
+	gifColorTableSizeBit = 0x07
+)
+
+// gifKeptApplications contains identifiers of application extensions needed to play animations.
+var gifKeptApplications = map[string]struct{}{
+	"NETSCAPE2.0": {},
+	"ANIMEXTS1.0": {},
+}
+
+var errInvalidGIF = fmt.Errorf("%w: malformed gif blocks", ErrInvalidImage)
+
+// stripGIF removes comment extensions and application extensions (XMP, ICC...) from gif file.
+// Extensions controlling looping of animations are kept.
+func stripGIF(data []byte) ([]byte, error) {
+	pos := gifHeaderLength + gifScreenLength
+	if len(data) < pos || (string(data[:gifHeaderLength]) != "GIF87a" && string(data[:gifHeaderLength]) != "GIF89a") {
+		return nil, errInvalidGIF
+	}
+
+	pos += gifColorTableLength(data[gifHeaderLength+4])
+	if pos > len(data) {
+		return nil, errInvalidGIF
+	}
+
+	result := make([]byte, 0, len(data))
+	result = append(result, data[:pos]...)
+
+	for pos < len(data) {
+		start := pos
+
+		switch data[pos] {
+		case gifTrailer:
+			return append(result, gifTrailer), nil
+		case gifExtension:
+			if pos+2 > len(data) {
+				return nil, errInvalidGIF
+			}
+
+			label := data[pos+1]
+			end, err := gifSubBlocksEnd(data, pos+2)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+
+			if label == gifCommentLabel || (label == gifApplicationLabel && !gifKeptApplication(data[start+2:end])) {
+				continue
+			}
+		case gifImageSeparator:
+			if pos+gifImageLength+1 > len(data) {
+				return nil, errInvalidGIF
+			}
+
+			// descriptor, local color table, LZW minimum code size and image data
+			pos += gifImageLength + gifColorTableLength(data[pos+9]) + 1
+			end, err := gifSubBlocksEnd(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+		default:
+			return nil, errInvalidGIF
+		}
+
+		result = append(result, data[start:pos]...)
+	}
+
+	return nil, errInvalidGIF
+}
+
+func gifColorTableLength(flags byte) int {
+	if flags&gifColorTableFlag == 0 {
+		return 0
+	}
+	return 3 << (int(flags&gifColorTableSizeBit) + 1)
+}
+
+// gifSubBlocksEnd returns position right after the sequence of sub-blocks starting at given position.
+func gifSubBlocksEnd(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errInvalidGIF
+		}
+
+		size := int(data[pos])
+		pos++
+
+		if size == 0 {
+			return pos, nil
+		}
+
+		pos += size
+	}
+}
+
+// gifKeptApplication returns true if sub-blocks of application extension identify kept application.
+func gifKeptApplication(blocks []byte) bool {
+	// first sub-block contains 8 bytes of identifier and 3 bytes of authentication code
+	if len(blocks) < 12 || blocks[0] != 11 {
+		return false
+	}
+
+	_, kept := gifKeptApplications[string(blocks[1:12])]
+	return kept
+}
@@ -0,0 +1,214 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testJPEG(t *testing.T, width, height int, exif []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	data := buf.Bytes()
+
+	if exif == nil {
+		return data
+	}
+
+	segment := []byte{0xFF, jpegMarkerAPP1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}
+	segment = append(segment, exif...)
+
+	// insert EXIF segment right after SOI marker
+	return append(append([]byte{0xFF, jpegMarkerSOI}, segment...), data[2:]...)
+}
+
+// exifWithOrientation returns EXIF payload with single (little endian) IFD entry.
+func exifWithOrientation(orientation byte) []byte {
+	exif := []byte("Exif\x00\x00")
+	exif = append(exif, 'I', 'I', 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00) // TIFF header, IFD at offset 8
+	exif = append(exif, 0x01, 0x00)                                   // one entry
+	exif = append(exif, 0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, orientation, 0x00, 0x00, 0x00)
+	exif = append(exif, []byte("GPS 52.2297N 21.0122E")...)
+	return exif
+}
+
+func TestProcessShouldStripExifAndApplyOrientation(t *testing.T) {
+	// given
+	data := testJPEG(t, 40, 20, exifWithOrientation(6))
+	processor := NewImageProcessor(1000, 10)
+
+	// when
+	result, err := processor.process(contentTypeJPEG, data)
+
+	// then
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(result.data, []byte("Exif")))
+	assert.False(t, bytes.Contains(result.data, []byte("GPS")))
+	assert.Equal(t, 20, result.width)
+	assert.Equal(t, 40, result.height)
+
+	thumbnail, _, err := image.DecodeConfig(bytes.NewReader(result.thumbnail))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, thumbnail.Width)
+	assert.Equal(t, 10, thumbnail.Height)
+}
+
+func TestProcessShouldStripExifWithoutReencoding(t *testing.T) {
+	// given
+	plain := testJPEG(t, 16, 16, nil)
+	data := testJPEG(t, 16, 16, exifWithOrientation(1))
+	processor := NewImageProcessor(1000, 10)
+
+	// when
+	result, err := processor.process(contentTypeJPEG, data)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, plain, result.data)
+}
+
+func TestProcessShouldRejectImagesWithTooManyPixels(t *testing.T) {
+	// given
+	data := testJPEG(t, 40, 20, nil)
+	processor := NewImageProcessor(799, 10)
+
+	// when
+	_, err := processor.process(contentTypeJPEG, data)
+
+	// then
+	assert.Equal(t, ErrImageTooLarge, err)
+}
+
+func TestProcessShouldAcceptImagesWithLimitPixels(t *testing.T) {
+	// given
+	data := testJPEG(t, 40, 20, nil)
+	processor := NewImageProcessor(800, 10)
+
+	// when
+	_, err := processor.process(contentTypeJPEG, data)
+
+	// then
+	assert.NoError(t, err)
+}
+
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 10), G: uint8(y * 10), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+// pngChunk returns png chunk with given type and data and valid crc.
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+func TestProcessShouldStripPNGMetadata(t *testing.T) {
+	// given
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, testImage(20, 10)))
+	plain := buf.Bytes()
+
+	// metadata chunks are inserted right after IHDR chunk (signature 8 bytes, IHDR 25 bytes)
+	data := append([]byte{}, plain[:33]...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00GPS 52.2297N 21.0122E"))...)
+	data = append(data, pngChunk("tIME", []byte{0x07, 0xE4, 3, 10, 12, 0, 0})...)
+	data = append(data, plain[33:]...)
+
+	processor := NewImageProcessor(1000, 10)
+
+	// when
+	result, err := processor.process(contentTypePNG, data)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, plain, result.data)
+	assert.Equal(t, 20, result.width)
+	assert.Equal(t, contentTypePNG, result.thumbnailType)
+
+	thumbnail, _, err := image.DecodeConfig(bytes.NewReader(result.thumbnail))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, thumbnail.Width)
+	assert.Equal(t, 5, thumbnail.Height)
+}
+
+// gifExtensionBlock returns gif extension with given label and data in a single sub-block.
+func gifExtensionBlock(label byte, data []byte) []byte {
+	block := []byte{gifExtension, label, byte(len(data))}
+	return append(append(block, data...), 0)
+}
+
+func TestProcessShouldStripGIFCommentsAndApplicationExtensions(t *testing.T) {
+	// given
+	frame := image.NewPaletted(image.Rect(0, 0, 20, 10), palette.Plan9)
+	animation := &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: 0}
+
+	var buf bytes.Buffer
+	assert.NoError(t, gif.EncodeAll(&buf, animation))
+	plain := buf.Bytes()
+
+	// extensions are inserted right before the trailer
+	xmp := append([]byte("XMP DataXMP"), []byte("GPS 52.2297N")...)
+	data := append([]byte{}, plain[:len(plain)-1]...)
+	data = append(data, gifExtensionBlock(gifCommentLabel, []byte("GPS 52.2297N 21.0122E"))...)
+	data = append(data, gifExtensionBlock(gifApplicationLabel, xmp)...)
+	data = append(data, gifTrailer)
+
+	processor := NewImageProcessor(1000, 10)
+
+	// when
+	result, err := processor.process(contentTypeGIF, data)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, plain, result.data)
+	assert.True(t, bytes.Contains(result.data, []byte("NETSCAPE2.0")))
+	assert.False(t, bytes.Contains(result.data, []byte("GPS")))
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(result.data))
+	assert.NoError(t, err)
+	assert.Len(t, decoded.Image, 2)
+	assert.Equal(t, contentTypePNG, result.thumbnailType)
+}
+
+func TestProcessShouldRejectMalformedGIF(t *testing.T) {
+	// given
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)
+
+	var buf bytes.Buffer
+	assert.NoError(t, gif.Encode(&buf, frame, nil))
+	data := buf.Bytes()
+
+	// when
+	_, err := stripGIF(data[:len(data)-3])
+
+	// then
+	assert.True(t, errors.Is(err, ErrInvalidImage))
+}
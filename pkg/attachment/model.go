@@ -0,0 +1,63 @@
+package attachment
+
+import (
+	"time"
+)
+
+// Attachment is a struct containing metadata of uploaded file.
+type Attachment struct {
+	ID          string    `json:"id" gorethink:"id,omitempty"`
+	Name        string    `json:"name" gorethink:"name"`
+	ContentType string    `json:"contentType" gorethink:"contentType"`
+	Size        int64     `json:"size" gorethink:"size"`
+	Width       int       `json:"width,omitempty" gorethink:"width,omitempty"`
+	Height      int       `json:"height,omitempty" gorethink:"height,omitempty"`
+	Thumbnail   string    `json:"thumbnailContentType,omitempty" gorethink:"thumbnail,omitempty"`
+	Room        string    `json:"room" gorethink:"room"`
+	Owner       string    `json:"owner" gorethink:"owner"`
+	Created     time.Time `json:"created" gorethink:"created"`
+	// Used is a time when the attachment was uploaded or attached to a message the last time.
+	// The attachment expires together with the messages posted at that time.
+	Used time.Time `json:"used" gorethink:"used"`
+}
+
+// Empty returns 'true' if the Attachment struct is empty, false otherwise.
+func (a *Attachment) Empty() bool {
+	return a == nil || a.ID == ""
+}
+
+// URL returns path under which attachment can be downloaded.
+func (a *Attachment) URL() string {
+	return "/attachments/" + a.ID
+}
+
+// HasThumbnail returns 'true' if thumbnail was created for the attachment.
+func (a *Attachment) HasThumbnail() bool {
+	return a.Thumbnail != ""
+}
+
+// ThumbnailURL returns path under which thumbnail of the attachment can be downloaded
+// or empty string if there is no thumbnail.
+func (a *Attachment) ThumbnailURL() string {
+	if !a.HasThumbnail() {
+		return ""
+	}
+	return a.URL() + "/thumbnail"
+}
+
+func (a *Attachment) thumbnailID() string {
+	return a.ID + "_thumbnail"
+}
+
+// Inline returns 'true' if attachment can be safely displayed by the browser,
+// 'false' if it should be downloaded.
+func (a *Attachment) Inline() bool {
+	_, ok := inlineContentTypes[a.ContentType]
+	return ok
+}
+
+var inlineContentTypes = map[string]struct{}{
+	"image/png":  {},
+	"image/jpeg": {},
+	"image/gif":  {},
+}
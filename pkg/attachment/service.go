@@ -0,0 +1,379 @@
+package attachment
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultContentType = "application/octet-stream"
+	// sniffLen is a number of bytes used to detect content type.
+	sniffLen = 512
+	// expireBatchSize is a maximal number of expired attachments read at once.
+	expireBatchSize = 500
+)
+
+// errBatchFull stops reading expired attachments when the batch is full.
+var errBatchFull = errors.New("batch is full")
+
+var (
+	// ErrTooLarge is returned when uploaded file exceeds allowed size.
+	ErrTooLarge = errors.New("attachment is too large")
+	// ErrNotFound is returned when attachment cannot be found.
+	ErrNotFound = errors.New("attachment not found")
+	// ErrWrongRoom is returned when attachment was uploaded into a different room.
+	ErrWrongRoom = errors.New("attachment belongs to a different room")
+	// ErrNoArchive is returned when attachment is archived, but the archive isn't set.
+	ErrNoArchive = errors.New("archive of attachments isn't set")
+)
+
+// Database is an interface which defines persistence of attachments metadata.
+type Database interface {
+	UUID() (string, error)
+	Insert(interface{}) error
+	Upsert(interface{}) error
+	Get(id string, result interface{}) error
+	Delete(id string) error
+	Distinct(property string, result interface{}) error
+	FindEach(property string, value interface{}, orderField string, from, to interface{},
+		newResult func() interface{}, f func(result interface{}) error) error
+}
+
+// Service struct responsible for storing and reading attachments.
+type Service struct {
+	db      Database
+	storage Storage
+	images  *ImageProcessor
+	maxSize int64
+	archive Storage
+}
+
+// NewService returns new instance of Service.
+func NewService(db Database, storage Storage, images *ImageProcessor, maxSize int64) *Service {
+	return &Service{
+		db:      db,
+		storage: storage,
+		images:  images,
+		maxSize: maxSize,
+	}
+}
+
+// SetArchive sets storage into which archived attachments are moved.
+// It should be called before Archive is used.
+func (s *Service) SetArchive(archive Storage) {
+	s.archive = archive
+}
+
+// Upload stores content of the file and persists its metadata. Content type is detected
+// from the content itself. Metadata is removed from images and thumbnails are created for them.
+// Returns ErrTooLarge if content is bigger than allowed.
+func (s *Service) Upload(owner, room, name string, content io.Reader) (*Attachment, error) {
+	id, err := s.db.UUID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	attachment := &Attachment{
+		ID:      id,
+		Name:    name,
+		Room:    room,
+		Owner:   owner,
+		Created: now,
+		Used:    now,
+	}
+
+	reader := bufio.NewReaderSize(io.LimitReader(content, s.maxSize+1), sniffLen)
+
+	// Peek returns error if content is shorter than sniffLen, which is fine
+	head, _ := reader.Peek(sniffLen)
+	attachment.ContentType = detectContentType(head)
+
+	if isImage(attachment.ContentType) {
+		err = s.saveImage(attachment, reader)
+	} else {
+		err = s.save(attachment, reader)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Insert(attachment); err != nil {
+		s.remove(attachment)
+		return nil, fmt.Errorf("cannot store attachment metadata, error: %w", err)
+	}
+
+	return attachment, nil
+}
+
+func (s *Service) save(attachment *Attachment, content io.Reader) error {
+	size, err := s.storage.Save(attachment.ID, content)
+	if err != nil {
+		s.remove(attachment)
+		return err
+	}
+
+	if size > s.maxSize {
+		s.remove(attachment)
+		return ErrTooLarge
+	}
+
+	attachment.Size = size
+
+	return nil
+}
+
+func (s *Service) saveImage(attachment *Attachment, content io.Reader) error {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("cannot read image, error: %w", err)
+	}
+
+	if int64(len(data)) > s.maxSize {
+		return ErrTooLarge
+	}
+
+	img, err := s.images.process(attachment.ContentType, data)
+	if err != nil {
+		return err
+	}
+
+	if err := s.save(attachment, bytes.NewReader(img.data)); err != nil {
+		return err
+	}
+
+	attachment.Width, attachment.Height = img.width, img.height
+
+	if _, err := s.storage.Save(attachment.thumbnailID(), bytes.NewReader(img.thumbnail)); err != nil {
+		s.remove(attachment)
+		return err
+	}
+
+	attachment.Thumbnail = img.thumbnailType
+
+	return nil
+}
+
+// detectContentType returns media type of the content. Parameters (like charset)
+// are kept only for textual content.
+func detectContentType(head []byte) string {
+	contentType := http.DetectContentType(head)
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return defaultContentType
+	}
+
+	if isImage(mediaType) {
+		return mediaType
+	}
+
+	return contentType
+}
+
+// Find returns metadata of attachment with given id or ErrNotFound.
+func (s *Service) Find(id string) (*Attachment, error) {
+	var attachment Attachment
+	if err := s.db.Get(id, &attachment); err != nil {
+		return nil, err
+	}
+
+	if attachment.Empty() {
+		return nil, ErrNotFound
+	}
+
+	return &attachment, nil
+}
+
+// Open returns reader with content of given attachment.
+func (s *Service) Open(attachment *Attachment) (io.ReadCloser, error) {
+	return s.storage.Open(attachment.ID)
+}
+
+// OpenThumbnail returns reader with thumbnail of given attachment.
+func (s *Service) OpenThumbnail(attachment *Attachment) (io.ReadCloser, error) {
+	if !attachment.HasThumbnail() {
+		return nil, ErrNotFound
+	}
+	return s.storage.Open(attachment.thumbnailID())
+}
+
+// Resolve returns data of attachments with given ids which can be sent to the
+// clients. Every attachment has to be uploaded into given room. Attachments are marked
+// as used, so they don't expire before the message they are attached to.
+func (s *Service) Resolve(room string, ids []string) ([]*exchange.Attachment, error) {
+	result := make([]*exchange.Attachment, 0, len(ids))
+	now := time.Now().UTC()
+
+	for _, id := range ids {
+		attachment, err := s.Find(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if attachment.Room != room {
+			return nil, ErrWrongRoom
+		}
+
+		attachment.Used = now
+		if err := s.db.Upsert(attachment); err != nil {
+			return nil, fmt.Errorf("cannot mark attachment %v as used, error: %w", id, err)
+		}
+
+		result = append(result, &exchange.Attachment{
+			ID:           attachment.ID,
+			Name:         attachment.Name,
+			ContentType:  attachment.ContentType,
+			Size:         attachment.Size,
+			Width:        attachment.Width,
+			Height:       attachment.Height,
+			URL:          attachment.URL(),
+			ThumbnailURL: attachment.ThumbnailURL(),
+		})
+	}
+
+	return result, nil
+}
+
+// Rooms returns sorted names of the rooms with attachments.
+func (s *Service) Rooms() ([]string, error) {
+	rooms := make([]string, 0)
+	if err := s.db.Distinct("room", &rooms); err != nil {
+		return nil, fmt.Errorf("cannot read rooms with attachments, error: %w", err)
+	}
+	return rooms, nil
+}
+
+// Expire removes attachments of the room which were neither uploaded nor attached to a message
+// since given time and returns number of removed attachments. If archive is true, they are moved
+// into the archive. Attachments which cannot be removed are skipped.
+func (s *Service) Expire(room string, before time.Time, archive bool) (int, error) {
+	remove := s.Delete
+	if archive {
+		remove = s.Archive
+	}
+
+	var removed int
+
+	for {
+		batch, err := s.expired(room, before)
+		if err != nil {
+			return removed, err
+		}
+
+		var removedInBatch int
+		for _, attachment := range batch {
+			if err := remove(attachment.ID); err != nil {
+				logger.Warnf("Cannot remove expired attachment %v of room %v. Error: %v", attachment.ID, room, err)
+				continue
+			}
+			removedInBatch++
+		}
+		removed += removedInBatch
+
+		// the same attachments would be read again if none of them could be removed
+		if len(batch) < expireBatchSize || removedInBatch == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// expired returns at most expireBatchSize least recently used attachments of the room used before given time.
+func (s *Service) expired(room string, before time.Time) ([]*Attachment, error) {
+	batch := make([]*Attachment, 0, expireBatchSize)
+
+	newAttachment := func() interface{} {
+		return &Attachment{}
+	}
+
+	err := s.db.FindEach("room", room, "used", time.Unix(0, 0).UTC(), before, newAttachment, func(result interface{}) error {
+		batch = append(batch, result.(*Attachment))
+		if len(batch) >= expireBatchSize {
+			return errBatchFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFull) {
+		return nil, fmt.Errorf("cannot read expired attachments of room %v, error: %w", room, err)
+	}
+
+	return batch, nil
+}
+
+// Delete removes content and metadata of attachment with given id or returns ErrNotFound.
+func (s *Service) Delete(id string) error {
+	attachment, err := s.Find(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Delete(id); err != nil {
+		return fmt.Errorf("cannot remove attachment %v, error: %w", id, err)
+	}
+
+	s.remove(attachment)
+
+	return nil
+}
+
+// Archive moves content of attachment with given id (and its thumbnail) into the archive
+// and removes the attachment, so it cannot be downloaded anymore. Returns ErrNotFound if
+// the attachment doesn't exist.
+func (s *Service) Archive(id string) error {
+	if s.archive == nil {
+		return ErrNoArchive
+	}
+
+	attachment, err := s.Find(id)
+	if err != nil {
+		return err
+	}
+
+	ids := []string{attachment.ID}
+	if attachment.HasThumbnail() {
+		ids = append(ids, attachment.thumbnailID())
+	}
+
+	for _, id := range ids {
+		if err := s.copyToArchive(id); err != nil {
+			return err
+		}
+	}
+
+	return s.Delete(id)
+}
+
+func (s *Service) copyToArchive(id string) error {
+	content, err := s.storage.Open(id)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	if _, err := s.archive.Save(id, content); err != nil {
+		return fmt.Errorf("cannot archive attachment %v, error: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *Service) remove(attachment *Attachment) {
+	for _, id := range []string{attachment.ID, attachment.thumbnailID()} {
+		if err := s.storage.Delete(id); err != nil {
+			logger.Warnf("Cannot remove content of attachment %v. Error: %v", id, err)
+		}
+	}
+}
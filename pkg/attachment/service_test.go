@@ -0,0 +1,144 @@
+package attachment
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadShouldRejectTooLargeFiles(t *testing.T) {
+	// given
+	storage, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	service := NewService(dbtest.NewTable("id"), storage, NewImageProcessor(100, 10), 4)
+
+	// when
+	_, err = service.Upload("john", "main", "log.txt", strings.NewReader("too long"))
+
+	// then
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+func TestResolveShouldRejectAttachmentsFromOtherRooms(t *testing.T) {
+	// given
+	storage, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	service := NewService(dbtest.NewTable("id"), storage, NewImageProcessor(100, 10), 100)
+
+	uploaded, err := service.Upload("john", "main", "log.txt", strings.NewReader("content"))
+	assert.NoError(t, err)
+
+	// when
+	resolved, err1 := service.Resolve("main", []string{uploaded.ID})
+	_, err2 := service.Resolve("other", []string{uploaded.ID})
+
+	// then
+	assert.NoError(t, err1)
+	assert.Equal(t, "/attachments/"+uploaded.ID, resolved[0].URL)
+	assert.Equal(t, "text/plain; charset=utf-8", resolved[0].ContentType)
+	assert.Equal(t, ErrWrongRoom, err2)
+}
+
+func TestDeleteShouldRemoveContentAndMetadata(t *testing.T) {
+	// given
+	storage, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	service := NewService(dbtest.NewTable("id"), storage, NewImageProcessor(100, 10), 100)
+
+	uploaded, err := service.Upload("john", "main", "log.txt", strings.NewReader("content"))
+	assert.NoError(t, err)
+
+	// when
+	deleteErr := service.Delete(uploaded.ID)
+	_, findErr := service.Find(uploaded.ID)
+	_, openErr := storage.Open(uploaded.ID)
+	missingErr := service.Delete(uploaded.ID)
+
+	// then
+	assert.NoError(t, deleteErr)
+	assert.Equal(t, ErrNotFound, findErr)
+	assert.Error(t, openErr)
+	assert.Equal(t, ErrNotFound, missingErr)
+}
+
+func TestArchiveShouldMoveContentIntoArchive(t *testing.T) {
+	// given
+	storage, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	archive, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	service := NewService(dbtest.NewTable("id"), storage, NewImageProcessor(100, 10), 100)
+
+	uploaded, err := service.Upload("john", "main", "log.txt", strings.NewReader("content"))
+	assert.NoError(t, err)
+
+	// when
+	noArchiveErr := service.Archive(uploaded.ID)
+	service.SetArchive(archive)
+	archiveErr := service.Archive(uploaded.ID)
+	_, findErr := service.Find(uploaded.ID)
+	_, openErr := storage.Open(uploaded.ID)
+	archived, archivedErr := archive.Open(uploaded.ID)
+
+	// then
+	assert.Equal(t, ErrNoArchive, noArchiveErr)
+	assert.NoError(t, archiveErr)
+	assert.Equal(t, ErrNotFound, findErr)
+	assert.Error(t, openErr)
+	assert.NoError(t, archivedErr)
+
+	content, err := ioutil.ReadAll(archived)
+	assert.NoError(t, err)
+	assert.NoError(t, archived.Close())
+	assert.Equal(t, "content", string(content))
+}
+
+func TestExpireShouldRemoveAttachmentsNotUsedSinceGivenTime(t *testing.T) {
+	// given
+	storage, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	db := dbtest.NewTable("id")
+	service := NewService(db, storage, NewImageProcessor(100, 10), 100)
+
+	before := time.Now().UTC().Add(-time.Hour)
+
+	uploaded := make([]*Attachment, 0)
+	for _, room := range []string{"main", "main", "main", "ops"} {
+		attachment, err := service.Upload("john", room, "log.txt", strings.NewReader("content"))
+		assert.NoError(t, err)
+		uploaded = append(uploaded, attachment)
+	}
+
+	// all attachments except the third one weren't used recently
+	for _, i := range []int{0, 1, 3} {
+		uploaded[i].Used = before.Add(-time.Minute)
+		assert.NoError(t, db.Upsert(uploaded[i]))
+	}
+
+	// when
+	_, resolveErr := service.Resolve("main", []string{uploaded[1].ID})
+	removed, expireErr := service.Expire("main", before, false)
+	rooms, roomsErr := service.Rooms()
+
+	// then
+	assert.NoError(t, resolveErr)
+	assert.NoError(t, expireErr)
+	assert.Equal(t, 1, removed)
+	assert.False(t, db.Has(uploaded[0].ID))
+	assert.True(t, db.Has(uploaded[1].ID))
+	assert.True(t, db.Has(uploaded[2].ID))
+	assert.True(t, db.Has(uploaded[3].ID))
+
+	assert.NoError(t, roomsErr)
+	assert.Equal(t, []string{"main", "ops"}, rooms)
+}
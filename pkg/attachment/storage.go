@@ -0,0 +1,73 @@
+package attachment
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage is an interface which defines place where content of attachments is kept.
+type Storage interface {
+	Save(id string, content io.Reader) (int64, error)
+	Open(id string) (io.ReadCloser, error)
+	Delete(id string) error
+}
+
+// NewLocalStorage returns new instance of LocalStorage which keeps files in given directory.
+// Directory is created if it doesn't exist.
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("cannot create attachments directory %v, error: %w", dir, err)
+	}
+
+	return &LocalStorage{dir: dir}, nil
+}
+
+// LocalStorage is a Storage implementation which keeps files on local disk.
+type LocalStorage struct {
+	dir string
+}
+
+// Save writes given content into file named after given id.
+func (s *LocalStorage) Save(id string, content io.Reader) (int64, error) {
+	file, err := os.OpenFile(s.path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create file for attachment %v, error: %w", id, err)
+	}
+
+	written, err := io.Copy(file, content)
+	if err != nil {
+		_ = file.Close()
+		return written, fmt.Errorf("cannot write attachment %v, error: %w", id, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return written, fmt.Errorf("cannot close file for attachment %v, error: %w", id, err)
+	}
+
+	return written, nil
+}
+
+// Open returns reader with content of attachment with given id.
+func (s *LocalStorage) Open(id string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open attachment %v, error: %w", id, err)
+	}
+
+	return file, nil
+}
+
+// Delete removes file with content of attachment with given id.
+func (s *LocalStorage) Delete(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove attachment %v, error: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
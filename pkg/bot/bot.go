@@ -0,0 +1,140 @@
+// Package bot allows to write automated participants of the chat. Bots use
+// the same rooms and message rules as users connected through websocket,
+// but they run inside the server process.
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	idPrefix   = "bot-"
+	bufferSize = 50
+)
+
+// Bot is an automated participant of the chat.
+type Bot interface {
+	// Name returns name under which bot is visible in the rooms.
+	Name() string
+	// Rooms returns names of rooms bot joins at startup.
+	Rooms() []string
+	// OnMessage is invoked for every text message sent by others in rooms bot is a member of.
+	OnMessage(msg *exchange.Message, replier Replier)
+}
+
+// Replier sends messages on behalf of the bot.
+type Replier interface {
+	Reply(room, content string)
+}
+
+// Configurer registers routes and middlewares for messages sent by the client.
+type Configurer func(router *exchange.Router, client *exchange.Client)
+
+// user represents bot as exchange user.
+type user struct {
+	name string
+}
+
+func (u *user) Name() string {
+	return u.name
+}
+
+// Runner connects Bot to the rooms and passes messages between them.
+type Runner struct {
+	bot    Bot
+	client *exchange.Client
+	conn   *exchange.ChannelConnection
+}
+
+// Start creates client for given bot, adds it to bot's rooms and starts processing messages.
+// Rooms which don't exist are created. Bot is disconnected when the context is done.
+func Start(ctx context.Context, bot Bot, rooms *exchange.Rooms, configure Configurer) *Runner {
+	conn := exchange.NewChannelConn(bufferSize)
+	router := exchange.NewRouter()
+	client := exchange.NewClient(idPrefix+bot.Name(), &user{name: bot.Name()}, rooms, conn, router)
+
+	configure(router, client)
+
+	runner := &Runner{
+		bot:    bot,
+		client: client,
+		conn:   conn,
+	}
+
+	go client.Start(ctx)
+	go runner.run()
+
+	for _, room := range bot.Rooms() {
+		if room != exchange.MainRoomName() {
+			// nothing happens if room already exists
+			rooms.CreateRoom(room, client)
+		}
+		rooms.AddClientToRoom(room, client)
+	}
+
+	logger.Infof("Bot %v started", bot.Name())
+
+	return runner
+}
+
+// Reply sends text message to given room.
+func (r *Runner) Reply(room, content string) {
+	msg := &exchange.Message{
+		MsgType: exchange.MsgTextMsgMT,
+		Room:    room,
+		Content: content,
+	}
+
+	if err := r.conn.Post(msg); err != nil {
+		logger.Warnf("Bot %v cannot send message to room %v. Error: %v", r.bot.Name(), room, err)
+	}
+}
+
+// Stop disconnects bot from all rooms.
+func (r *Runner) Stop() {
+	if err := r.conn.Close(); err != nil {
+		logger.Warnf("Error while stopping bot %v. Error: %v", r.bot.Name(), err)
+	}
+}
+
+func (r *Runner) run() {
+	for {
+		select {
+		case msg := <-r.conn.Messages():
+			r.handle(msg)
+		case <-r.conn.Closed():
+			logger.Infof("Bot %v stopped", r.bot.Name())
+			return
+		}
+	}
+}
+
+func (r *Runner) handle(msg *exchange.Message) {
+	switch msg.MsgType {
+	case exchange.MsgTextMsgMT:
+		if msg.SenderID == r.client.ID() {
+			return
+		}
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger.Errorf("Bot %v failed to handle message %v. Error: %v", r.bot.Name(), msg, rec)
+			}
+		}()
+
+		r.bot.OnMessage(msg, r)
+
+	case exchange.MsgErrorMsgMT:
+		logger.Warnf("Bot %v received error: %v", r.bot.Name(), msg.Content)
+	}
+}
+
+// String is a string representation of Runner struct.
+func (r *Runner) String() string {
+	return fmt.Sprintf(`{"bot":"%v"}`, r.bot.Name())
+}
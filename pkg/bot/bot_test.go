@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/scheduler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reply struct {
+	room    string
+	content string
+}
+
+type recordingReplier struct {
+	replies []reply
+}
+
+func (r *recordingReplier) Reply(room, content string) {
+	r.replies = append(r.replies, reply{room: room, content: content})
+}
+
+func TestEchoBotShouldRepeatCommandText(t *testing.T) {
+	// given
+	replier := &recordingReplier{}
+	bot := NewEchoBot()
+
+	// when
+	bot.OnMessage(&exchange.Message{Room: "main", Content: "!echo hello there"}, replier)
+	bot.OnMessage(&exchange.Message{Room: "main", Content: "hello there"}, replier)
+
+	// then
+	assert.Equal(t, []reply{{room: "main", content: "hello there"}}, replier.replies)
+}
+
+type recordingReminders struct {
+	jobs []*scheduler.Job
+	err  error
+}
+
+func (r *recordingReminders) Schedule(job *scheduler.Job) (*scheduler.Job, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.jobs = append(r.jobs, job)
+	return job, nil
+}
+
+func TestReminderBotShouldScheduleReminder(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	replier := &recordingReplier{}
+	reminders := &recordingReminders{}
+
+	bot := NewReminderBot(reminders)
+	bot.now = func() time.Time { return now }
+
+	// when
+	bot.OnMessage(&exchange.Message{Room: "dev", SenderName: "john", Content: "!remind 10m deploy"}, replier)
+
+	// then
+	assert.Equal(t, []*scheduler.Job{{
+		Kind:      scheduler.KindReminder,
+		Room:      "dev",
+		Sender:    "john",
+		Recipient: "john",
+		Content:   "deploy",
+		Due:       now.Add(10 * time.Minute),
+	}}, reminders.jobs)
+	assert.Equal(t, []reply{{room: "dev", content: "@john I will remind you in 10m0s"}}, replier.replies)
+}
+
+func TestReminderBotShouldRejectInvalidCommands(t *testing.T) {
+	// given
+	replier := &recordingReplier{}
+	reminders := &recordingReminders{}
+	bot := NewReminderBot(reminders)
+
+	// when
+	for _, content := range []string{"!remind", "!remind 10m", "!remind soon deploy", "!remind 48h deploy"} {
+		bot.OnMessage(&exchange.Message{Room: "dev", Content: content}, replier)
+	}
+	bot.OnMessage(&exchange.Message{Room: "dev", Content: "!reminders"}, replier)
+
+	reminders.err = scheduler.ErrTooManyJobs
+	bot.OnMessage(&exchange.Message{Room: "dev", SenderName: "john", Content: "!remind 10m deploy"}, replier)
+
+	// then
+	assert.Empty(t, reminders.jobs)
+	assert.Len(t, replier.replies, 5)
+	assert.Equal(t, reply{room: "dev", content: "@john cannot schedule reminder: " + scheduler.ErrTooManyJobs.Error()}, replier.replies[4])
+}
+
+func TestRunnerShouldPassMessagesBetweenRoomsAndBot(t *testing.T) {
+	// given
+	rooms := exchange.NewRooms()
+	configure := func(router *exchange.Router, client *exchange.Client) {
+		router.RegisterRoute(exchange.NewRoute(exchange.MsgTextMsgMT, exchange.NewSendMsgToRoomHandler(rooms)))
+	}
+
+	runner := Start(context.Background(), NewEchoBot(exchange.MainRoomName()), rooms, configure)
+	defer runner.Stop()
+
+	conn := exchange.NewChannelConn(10)
+	router := exchange.NewRouter()
+	client := exchange.NewClient("john-session", &user{name: "john"}, rooms, conn, router)
+	configure(router, client)
+
+	go client.Start(context.Background())
+	defer conn.Close()
+
+	// bot joined earlier, so it is in the room when john's join is confirmed
+	rooms.AddClientToRoom(exchange.MainRoomName(), client)
+	waitFor(t, conn, func(msg *exchange.Message) bool {
+		return msg.MsgType == exchange.MsgUserJoinedRoomMT
+	})
+
+	// when
+	assert.NoError(t, conn.Post(&exchange.Message{MsgType: exchange.MsgTextMsgMT, Room: exchange.MainRoomName(), Content: "!echo hi"}))
+
+	// then
+	reply := waitFor(t, conn, func(msg *exchange.Message) bool {
+		return msg.MsgType == exchange.MsgTextMsgMT && msg.SenderName == "echo"
+	})
+	assert.Equal(t, "hi", reply.Content)
+}
+
+func waitFor(t *testing.T, conn *exchange.ChannelConnection, matches func(*exchange.Message) bool) *exchange.Message {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-conn.Messages():
+			if matches(msg) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("expected message not received")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+const echoCommand = "!echo "
+
+// NewEchoBot returns bot which repeats messages starting with '!echo '.
+func NewEchoBot(rooms ...string) *EchoBot {
+	return &EchoBot{rooms: rooms}
+}
+
+// EchoBot repeats messages starting with '!echo '.
+type EchoBot struct {
+	rooms []string
+}
+
+// Name returns name of the bot.
+func (b *EchoBot) Name() string {
+	return "echo"
+}
+
+// Rooms returns names of rooms bot joins at startup.
+func (b *EchoBot) Rooms() []string {
+	return b.rooms
+}
+
+// OnMessage repeats text following the '!echo ' command.
+func (b *EchoBot) OnMessage(msg *exchange.Message, replier Replier) {
+	if !strings.HasPrefix(msg.Content, echoCommand) {
+		return
+	}
+
+	if text := strings.TrimSpace(strings.TrimPrefix(msg.Content, echoCommand)); text != "" {
+		replier.Reply(msg.Room, text)
+	}
+}
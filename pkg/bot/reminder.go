@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/scheduler"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	remindCommand = "!remind"
+	remindUsage   = "Usage: !remind <duration, e.g. 10m or 1h30m> <text>"
+
+	maxReminderDelay = 24 * time.Hour
+)
+
+// Reminders is an interface wrapping method used to schedule reminders.
+type Reminders interface {
+	Schedule(job *scheduler.Job) (*scheduler.Job, error)
+}
+
+// NewReminderBot returns bot which reminds about things after requested time.
+func NewReminderBot(reminders Reminders, rooms ...string) *ReminderBot {
+	return &ReminderBot{
+		reminders: reminders,
+		rooms:     rooms,
+		now:       time.Now,
+	}
+}
+
+// ReminderBot reminds about things after requested time. Reminders are handed off
+// to the scheduler, so they survive restarts of the server and are sent only
+// to the user who requested them.
+type ReminderBot struct {
+	reminders Reminders
+	rooms     []string
+	now       func() time.Time
+}
+
+// Name returns name of the bot.
+func (b *ReminderBot) Name() string {
+	return "reminder"
+}
+
+// Rooms returns names of rooms bot joins at startup.
+func (b *ReminderBot) Rooms() []string {
+	return b.rooms
+}
+
+// OnMessage schedules reminder requested with '!remind <duration> <text>' command.
+func (b *ReminderBot) OnMessage(msg *exchange.Message, replier Replier) {
+	if msg.Content != remindCommand && !strings.HasPrefix(msg.Content, remindCommand+" ") {
+		return
+	}
+
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(msg.Content, remindCommand)), " ", 2)
+	if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+		replier.Reply(msg.Room, remindUsage)
+		return
+	}
+
+	delay, err := time.ParseDuration(fields[0])
+	if err != nil || delay <= 0 || delay > maxReminderDelay {
+		replier.Reply(msg.Room, fmt.Sprintf("Invalid duration '%v', it should be positive and not longer than %v. %v", fields[0], maxReminderDelay, remindUsage))
+		return
+	}
+
+	_, err = b.reminders.Schedule(&scheduler.Job{
+		Kind:      scheduler.KindReminder,
+		Room:      msg.Room,
+		Sender:    msg.SenderName,
+		Recipient: msg.SenderName,
+		Content:   strings.TrimSpace(fields[1]),
+		Due:       b.now().Add(delay),
+	})
+
+	switch {
+	case errors.Is(err, scheduler.ErrTooManyJobs) || errors.Is(err, scheduler.ErrInvalidDue):
+		replier.Reply(msg.Room, fmt.Sprintf("@%v cannot schedule reminder: %v", msg.SenderName, err))
+	case err != nil:
+		logger.Errorf("Cannot schedule reminder of %v in room %v. Error: %v", msg.SenderName, msg.Room, err)
+		replier.Reply(msg.Room, fmt.Sprintf("@%v cannot schedule reminder, try again later", msg.SenderName))
+	default:
+		replier.Reply(msg.Room, fmt.Sprintf("@%v I will remind you in %v", msg.SenderName, delay))
+	}
+}
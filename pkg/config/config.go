@@ -1,6 +1,10 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -16,14 +20,52 @@ func ReadConfig(prefix string) (*Config, error) {
 
 // Config is a struct representing whole application configuration.
 type Config struct {
-	ServerPort        int    `json:"serverPort" envconfig:"SERVER_PORT"`
-	ServerHost        string `json:"serverHost" envconfig:"SERVER_HOST"`
-	SessionDbName     int    `json:"sessionDbName" envconfig:"SESSION_DB_NAME"`
-	SessionDbPassword string `json:"sessionDbPassword" envconfig:"SESSION_DB_PASSWORD"`
-	SessionDbHost     string `json:"sessionDbHost" envconfig:"SESSION_DB_HOST"`
-	SessionDbPort     int    `json:"sessionDbPort" envconfig:"SESSION_DB_PORT"`
-	DatabaseHost      string `json:"databaseHost" envconfig:"DATABASE_HOST"`
-	DatabasePort      int    `json:"databasePort" envconfig:"DATABASE_PORT"`
-	DatabaseName      string `json:"databaseName" envconfig:"DATABASE_NAME"`
-	StaticsPath       string `json:"staticsPath" envconfig:"STATICS_PATH"`
+	ServerPort         int           `json:"serverPort" envconfig:"SERVER_PORT"`
+	ServerHost         string        `json:"serverHost" envconfig:"SERVER_HOST"`
+	SessionDbName      int           `json:"sessionDbName" envconfig:"SESSION_DB_NAME"`
+	SessionDbPassword  string        `json:"-" envconfig:"SESSION_DB_PASSWORD"`
+	SessionDbHost      string        `json:"sessionDbHost" envconfig:"SESSION_DB_HOST"`
+	SessionDbPort      int           `json:"sessionDbPort" envconfig:"SESSION_DB_PORT"`
+	DatabaseHost       string        `json:"databaseHost" envconfig:"DATABASE_HOST"`
+	DatabasePort       int           `json:"databasePort" envconfig:"DATABASE_PORT"`
+	DatabaseName       string        `json:"databaseName" envconfig:"DATABASE_NAME"`
+	StaticsPath        string        `json:"staticsPath" envconfig:"STATICS_PATH"`
+	AttachmentsPath    string        `json:"attachmentsPath" envconfig:"ATTACHMENTS_PATH" default:"attachments"`
+	AttachmentsMaxSize int64         `json:"attachmentsMaxSize" envconfig:"ATTACHMENTS_MAX_SIZE" default:"10485760"`
+	ImagesMaxPixels    int           `json:"imagesMaxPixels" envconfig:"IMAGES_MAX_PIXELS" default:"16777216"`
+	ThumbnailSize      int           `json:"thumbnailSize" envconfig:"THUMBNAIL_SIZE" default:"320"`
+	MessagesPerSecond  float64       `json:"messagesPerSecond" envconfig:"MESSAGES_PER_SECOND" default:"5"`
+	MessagesBurst      int           `json:"messagesBurst" envconfig:"MESSAGES_BURST" default:"20"`
+	HookMessagesPerSec float64       `json:"hookMessagesPerSec" envconfig:"HOOK_MESSAGES_PER_SEC" default:"1"`
+	HookMessagesBurst  int           `json:"hookMessagesBurst" envconfig:"HOOK_MESSAGES_BURST" default:"10"`
+	ContentFilterRules string        `json:"contentFilterRules" envconfig:"CONTENT_FILTER_RULES"`
+	SecretsAction      string        `json:"secretsAction" envconfig:"SECRETS_ACTION" default:"reject"`
+	Bots               []string      `json:"bots" envconfig:"BOTS"`
+	AdminUsers         []string      `json:"adminUsers" envconfig:"ADMIN_USERS"`
+	MetricsToken       string        `json:"-" envconfig:"METRICS_TOKEN"`
+	MaxRoomMembers     int           `json:"maxRoomMembers" envconfig:"MAX_ROOM_MEMBERS" default:"1000"`
+	MaxRooms           int           `json:"maxRooms" envconfig:"MAX_ROOMS" default:"1000"`
+	MaxRoomsPerUser    int           `json:"maxRoomsPerUser" envconfig:"MAX_ROOMS_PER_USER" default:"50"`
+	MaxConnections     int           `json:"maxConnections" envconfig:"MAX_CONNECTIONS" default:"10000"`
+	MaxUserConnections int           `json:"maxUserConnections" envconfig:"MAX_USER_CONNECTIONS" default:"10"`
+	RetentionDays      int           `json:"retentionDays" envconfig:"RETENTION_DAYS" default:"0"`
+	RetentionMessages  int           `json:"retentionMessages" envconfig:"RETENTION_MESSAGES" default:"0"`
+	RetentionInterval  time.Duration `json:"retentionInterval" envconfig:"RETENTION_INTERVAL" default:"1h"`
+	RetentionArchive   bool          `json:"retentionArchive" envconfig:"RETENTION_ARCHIVE" default:"false"`
+	ArchivePath        string        `json:"archivePath" envconfig:"ARCHIVE_PATH" default:"archive"`
+	SchedulerLateness  time.Duration `json:"schedulerLateness" envconfig:"SCHEDULER_LATENESS" default:"24h"`
+	SchedulerPerUser   int           `json:"schedulerPerUser" envconfig:"SCHEDULER_PER_USER" default:"100"`
+	PollVoterKey       string        `json:"-" envconfig:"POLL_VOTER_KEY"`
+	PollTallyDelay     time.Duration `json:"pollTallyDelay" envconfig:"POLL_TALLY_DELAY" default:"1s"`
+	PollsPerRoom       int           `json:"pollsPerRoom" envconfig:"POLLS_PER_ROOM" default:"10"`
+	PollsPerUser       int           `json:"pollsPerUser" envconfig:"POLLS_PER_USER" default:"5"`
+}
+
+// String returns configuration in JSON format. Secrets excluded from JSON aren't shown, so it can be logged.
+func (c *Config) String() string {
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("cannot format configuration, error: %v", err)
+	}
+	return string(bytes)
 }
@@ -0,0 +1,258 @@
+// Package dbtest provides in-memory database table which can be used in tests instead of RethinkDB table.
+package dbtest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Table keeps copies of the persisted structs in memory. Like in RethinkDB, properties
+// are names from gorethink tags of the structs' fields. It is safe for concurrent use.
+type Table struct {
+	lock       sync.Mutex
+	primaryKey string
+	rows       map[string]reflect.Value
+	next       int
+}
+
+// NewTable returns new Table with given primary key, containing given structs.
+func NewTable(primaryKey string, entities ...interface{}) *Table {
+	table := &Table{
+		primaryKey: primaryKey,
+		rows:       map[string]reflect.Value{},
+	}
+
+	for _, entity := range entities {
+		table.put(entity)
+	}
+
+	return table
+}
+
+// UUID returns new id, unique within the table.
+func (t *Table) UUID() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.next++
+	return fmt.Sprintf("uuid-%v", t.next), nil
+}
+
+// Insert persists copy of given struct.
+func (t *Table) Insert(entity interface{}) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.put(entity)
+	return nil
+}
+
+// Upsert persists copy of given struct, replacing struct with the same primary key.
+func (t *Table) Upsert(entity interface{}) error {
+	return t.Insert(entity)
+}
+
+// Get sets result to copy of the struct with given primary key. If such struct
+// doesn't exist result stays untouched.
+func (t *Table) Get(id string, result interface{}) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if row, ok := t.rows[id]; ok {
+		reflect.ValueOf(result).Elem().Set(row)
+	}
+	return nil
+}
+
+// GetAll sets result, which should be a pointer to a slice, to copies of the structs
+// with given primary keys. Keys of structs which don't exist are skipped.
+func (t *Table) GetAll(ids []string, result interface{}) error {
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	return t.collect(result, func(row reflect.Value) bool {
+		return wanted[fmt.Sprint(field(row, t.primaryKey).Interface())]
+	})
+}
+
+// Find sets result to copy of the first struct, by primary key, with given property equal
+// to given value. If such struct doesn't exist result stays untouched.
+func (t *Table) Find(property string, value, result interface{}) error {
+	found := reflect.New(reflect.SliceOf(reflect.TypeOf(result).Elem()))
+	if err := t.FindAll(property, value, found.Interface()); err != nil {
+		return err
+	}
+
+	if found.Elem().Len() > 0 {
+		reflect.ValueOf(result).Elem().Set(found.Elem().Index(0))
+	}
+	return nil
+}
+
+// FindAll sets result, which should be a pointer to a slice, to copies of the structs
+// with given property equal to given value.
+func (t *Table) FindAll(property string, value, result interface{}) error {
+	return t.collect(result, func(row reflect.Value) bool {
+		return reflect.DeepEqual(field(row, property).Interface(), value)
+	})
+}
+
+// All sets result, which should be a pointer to a slice, to copies of all structs.
+func (t *Table) All(result interface{}) error {
+	return t.collect(result, func(reflect.Value) bool {
+		return true
+	})
+}
+
+// FindEach passes copies of the structs with given property equal to given value and order
+// field not lower than from and lower than to, sorted ascending by order field and primary key,
+// to f. Result of newResult is ignored, like in RethinkDB each struct is decoded into a new pointer.
+// Order field can be time, string or int.
+func (t *Table) FindEach(property string, value interface{}, orderField string, from, to interface{},
+	newResult func() interface{}, f func(result interface{}) error) error {
+	resultType := reflect.TypeOf(newResult())
+
+	found := reflect.New(reflect.SliceOf(resultType))
+	err := t.collect(found.Interface(), func(row reflect.Value) bool {
+		order := field(row, orderField).Interface()
+		return reflect.DeepEqual(field(row, property).Interface(), value) && !less(order, from) && less(order, to)
+	})
+	if err != nil {
+		return err
+	}
+
+	// rows are sorted by primary key, so the stable sort keeps it as the second key
+	rows := found.Elem()
+	orderOf := func(i int) interface{} {
+		return field(reflect.Indirect(rows.Index(i)), orderField).Interface()
+	}
+	sort.SliceStable(rows.Interface(), func(i, j int) bool {
+		return less(orderOf(i), orderOf(j))
+	})
+
+	for i := 0; i < rows.Len(); i++ {
+		if err := f(rows.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Distinct sets result, which should be a pointer to a slice of strings, to sorted distinct
+// values of given property.
+func (t *Table) Distinct(property string, result interface{}) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	values := map[string]bool{}
+	for _, row := range t.rows {
+		values[fmt.Sprint(field(row, property).Interface())] = true
+	}
+
+	distinct := make([]string, 0, len(values))
+	for value := range values {
+		distinct = append(distinct, value)
+	}
+	sort.Strings(distinct)
+
+	*result.(*[]string) = distinct
+	return nil
+}
+
+// Delete removes struct with given primary key.
+func (t *Table) Delete(id string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.rows, id)
+	return nil
+}
+
+// Len returns number of persisted structs.
+func (t *Table) Len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return len(t.rows)
+}
+
+// Has returns true if struct with given primary key is persisted.
+func (t *Table) Has(id string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, ok := t.rows[id]
+	return ok
+}
+
+func (t *Table) put(entity interface{}) {
+	row := reflect.Indirect(reflect.ValueOf(entity))
+
+	copied := reflect.New(row.Type()).Elem()
+	copied.Set(row)
+
+	t.rows[fmt.Sprint(field(copied, t.primaryKey).Interface())] = copied
+}
+
+// collect sets result to copies of the matching structs sorted by primary key.
+func (t *Table) collect(result interface{}, matches func(row reflect.Value) bool) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ids := make([]string, 0, len(t.rows))
+	for id, row := range t.rows {
+		if matches(row) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	slice := reflect.ValueOf(result).Elem()
+	elemType := slice.Type().Elem()
+	found := reflect.MakeSlice(slice.Type(), 0, len(ids))
+
+	for _, id := range ids {
+		row := t.rows[id]
+		if elemType.Kind() == reflect.Ptr {
+			copied := reflect.New(row.Type())
+			copied.Elem().Set(row)
+			row = copied
+		}
+		found = reflect.Append(found, row)
+	}
+
+	slice.Set(found)
+	return nil
+}
+
+// less returns true if the first value of order field is lower than the second one.
+func less(a, b interface{}) bool {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Before(b.(time.Time))
+	case string:
+		return a < b.(string)
+	case int:
+		return a < b.(int)
+	default:
+		panic(fmt.Sprintf("values of type %T cannot be ordered", a))
+	}
+}
+
+// field returns field of the struct with given name in its gorethink tag.
+func field(row reflect.Value, property string) reflect.Value {
+	for i := 0; i < row.NumField(); i++ {
+		name := strings.Split(row.Type().Field(i).Tag.Get("gorethink"), ",")[0]
+		if name == property {
+			return row.Field(i)
+		}
+	}
+	panic(fmt.Sprintf("struct %v has no property %v", row.Type(), property))
+}
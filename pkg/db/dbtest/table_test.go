@@ -0,0 +1,82 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type entity struct {
+	Name  string `gorethink:"name"`
+	Group string `gorethink:"group,omitempty"`
+}
+
+func TestTableShouldKeepCopiesOfEntities(t *testing.T) {
+	// given
+	anna := &entity{Name: "anna", Group: "ops"}
+	table := NewTable("name", anna, entity{Name: "john", Group: "dev"})
+
+	// when
+	anna.Group = "dev"
+	assert.NoError(t, table.Upsert(&entity{Name: "mike", Group: "ops"}))
+	assert.NoError(t, table.Delete("john"))
+
+	var found entity
+	assert.NoError(t, table.Get("anna", &found))
+
+	var first, missing entity
+	assert.NoError(t, table.Find("group", "ops", &first))
+	assert.NoError(t, table.Find("group", "dev", &missing))
+
+	ops := make([]*entity, 0)
+	assert.NoError(t, table.FindAll("group", "ops", &ops))
+
+	all := make([]entity, 0)
+	assert.NoError(t, table.All(&all))
+
+	// then
+	assert.Equal(t, entity{Name: "anna", Group: "ops"}, found)
+	assert.Equal(t, entity{Name: "anna", Group: "ops"}, first)
+	assert.Equal(t, entity{}, missing)
+	assert.Equal(t, []*entity{{Name: "anna", Group: "ops"}, {Name: "mike", Group: "ops"}}, ops)
+	assert.Equal(t, []entity{{Name: "anna", Group: "ops"}, {Name: "mike", Group: "ops"}}, all)
+	assert.Equal(t, 2, table.Len())
+	assert.False(t, table.Has("john"))
+}
+
+type event struct {
+	ID      string    `gorethink:"id"`
+	Room    string    `gorethink:"room"`
+	Created time.Time `gorethink:"created"`
+}
+
+func TestTableShouldFindEachEntityInRangeOrderedByOrderField(t *testing.T) {
+	// given
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	table := NewTable("id",
+		event{ID: "a", Room: "ops", Created: start.Add(2 * time.Minute)},
+		event{ID: "b", Room: "ops", Created: start},
+		event{ID: "c", Room: "ops", Created: start.Add(time.Minute)},
+		event{ID: "d", Room: "dev", Created: start.Add(time.Minute)},
+		event{ID: "e", Room: "ops", Created: start.Add(3 * time.Minute)},
+	)
+
+	// when
+	found := make([]string, 0)
+	err := table.FindEach("room", "ops", "created", start, start.Add(3*time.Minute), func() interface{} {
+		return &event{}
+	}, func(result interface{}) error {
+		found = append(found, result.(*event).ID)
+		return nil
+	})
+
+	rooms := make([]string, 0)
+	distinctErr := table.Distinct("room", &rooms)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "a"}, found)
+	assert.NoError(t, distinctErr)
+	assert.Equal(t, []string{"dev", "ops"}, rooms)
+}
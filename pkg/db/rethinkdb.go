@@ -1,8 +1,10 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	logger "github.com/sirupsen/logrus"
 	r "gopkg.in/gorethink/gorethink.v4"
@@ -11,15 +13,90 @@ import (
 const (
 	usersTableName    = "users"
 	usersTableNameKey = "name"
+
+	attachmentsTableName    = "attachments"
+	attachmentsTableNameKey = "id"
+
+	flagsTableName    = "flags"
+	flagsTableNameKey = "id"
+
+	webhooksTableName    = "webhooks"
+	webhooksTableNameKey = "id"
+
+	deadLettersTableName    = "webhook_dead_letters"
+	deadLettersTableNameKey = "id"
+
+	incomingHooksTableName    = "incoming_webhooks"
+	incomingHooksTableNameKey = "id"
+
+	messagesTableName    = "messages"
+	messagesTableNameKey = "id"
+
+	archivedMessagesTableName    = "archived_messages"
+	archivedMessagesTableNameKey = "id"
+
+	retentionTableName    = "retention_policies"
+	retentionTableNameKey = "room"
+
+	scheduledTableName    = "scheduled_messages"
+	scheduledTableNameKey = "id"
+
+	pollsTableName    = "polls"
+	pollsTableNameKey = "id"
+
+	pinsTableName    = "pins"
+	pinsTableNameKey = "id"
+
+	roomOwnersTableName    = "room_owners"
+	roomOwnersTableNameKey = "room"
+
+	roomMembersTableName    = "room_members"
+	roomMembersTableNameKey = "id"
 )
 
+// orderIndex is a compound secondary index on the property, order field and primary key.
+// It allows to read elements with given property value sorted by the order field without
+// scanning the table. Primary key makes the order unambiguous for equal order fields.
+type orderIndex struct {
+	property   string
+	orderField string
+}
+
+// tables contains names, primary keys and order indexes of all tables used by the application.
+var tables = []struct {
+	name       string
+	primaryKey string
+	indexes    []orderIndex
+}{
+	{name: usersTableName, primaryKey: usersTableNameKey},
+	{name: attachmentsTableName, primaryKey: attachmentsTableNameKey, indexes: []orderIndex{{property: "room", orderField: "used"}}},
+	{name: flagsTableName, primaryKey: flagsTableNameKey},
+	{name: webhooksTableName, primaryKey: webhooksTableNameKey},
+	{name: deadLettersTableName, primaryKey: deadLettersTableNameKey},
+	{name: incomingHooksTableName, primaryKey: incomingHooksTableNameKey},
+	{name: messagesTableName, primaryKey: messagesTableNameKey, indexes: []orderIndex{{property: "room", orderField: "created"}}},
+	{name: archivedMessagesTableName, primaryKey: archivedMessagesTableNameKey},
+	{name: retentionTableName, primaryKey: retentionTableNameKey},
+	{name: scheduledTableName, primaryKey: scheduledTableNameKey},
+	{name: pollsTableName, primaryKey: pollsTableNameKey},
+	{name: pinsTableName, primaryKey: pinsTableNameKey},
+	{name: roomOwnersTableName, primaryKey: roomOwnersTableNameKey},
+	{name: roomMembersTableName, primaryKey: roomMembersTableNameKey},
+}
+
+// Observer is notified about duration of every query executed on the tables.
+type Observer interface {
+	ObserveQuery(table, operation string, duration time.Duration)
+}
+
 // RethinkDB is a struct that allows communication with RethinkDB.
 type RethinkDB struct {
 	host string
 	name string
 	port int
 
-	session *r.Session
+	session  *r.Session
+	observer Observer
 }
 
 // NewRethinkDB returns new instance of RethinkDB (not connected).
@@ -58,20 +135,44 @@ func (rt *RethinkDB) Setup() error {
 		}
 	}
 
-	tableExists, err := rt.containsTable(usersTableName)
-	if err != nil {
-		return fmt.Errorf("cannot check if table %v exist, error: %w", usersTableName, err)
-	}
+	for _, table := range tables {
+		tableExists, err := rt.containsTable(table.name)
+		if err != nil {
+			return fmt.Errorf("cannot check if table %v exist, error: %w", table.name, err)
+		}
 
-	if !tableExists {
-		if err := rt.createTable(usersTableName, usersTableNameKey); err != nil {
-			return err
+		if !tableExists {
+			if err := rt.createTable(table.name, table.primaryKey); err != nil {
+				return err
+			}
+		}
+
+		for _, index := range table.indexes {
+			if err := rt.setupIndex(table.name, index.name(table.primaryKey), index.fields(table.primaryKey)); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// Ping checks if RethinkDB responds to queries.
+func (rt *RethinkDB) Ping(ctx context.Context) error {
+	cursor, err := r.Expr(1).Run(rt.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return fmt.Errorf("cannot query RethinkDB, error: %w", err)
+	}
+
+	return cursor.Close()
+}
+
+// SetObserver sets observer notified about queries executed on the tables.
+// It should be called before tables are used.
+func (rt *RethinkDB) SetObserver(observer Observer) {
+	rt.observer = observer
+}
+
 // Close closes connection to RethinkDB.
 func (rt *RethinkDB) Close() {
 	if err := rt.session.Close(); err != nil {
@@ -95,9 +196,57 @@ func (rt *RethinkDB) UUID() (string, error) {
 }
 
 func (rt *RethinkDB) createTable(tableName, primaryKey string) error {
-	_, err := r.DB(rt.name).TableCreate(tableName, r.TableCreateOpts{PrimaryKey: primaryKey}).Run(rt.session)
+	if _, err := r.DB(rt.name).TableCreate(tableName, r.TableCreateOpts{PrimaryKey: primaryKey}).Run(rt.session); err != nil {
+		return fmt.Errorf("cannot create table %v with primary key %v, error: %w", tableName, primaryKey, err)
+	}
+
+	return nil
+}
+
+func (rt *RethinkDB) setupIndex(tableName, indexName string, fields []string) error {
+	table := r.DB(rt.name).Table(tableName)
+
+	cursor, err := table.IndexList().Contains(indexName).Run(rt.session)
+	if err != nil {
+		return fmt.Errorf("cannot check if index %v of table %v exist, error: %w", indexName, tableName, err)
+	}
+
+	indexExists, err := rt.boolResp(cursor)
+	if err != nil {
+		return fmt.Errorf("cannot check if index %v of table %v exist, error: %w", indexName, tableName, err)
+	}
+
+	if !indexExists {
+		create := table.IndexCreateFunc(indexName, func(row r.Term) interface{} {
+			values := make([]interface{}, 0, len(fields))
+			for _, field := range fields {
+				values = append(values, row.Field(field))
+			}
+			return values
+		})
+
+		if err := create.Exec(rt.session); err != nil {
+			return fmt.Errorf("cannot create index %v of table %v, error: %w", indexName, tableName, err)
+		}
+	}
+
+	if err := table.IndexWait(indexName).Exec(rt.session); err != nil {
+		return fmt.Errorf("cannot wait for index %v of table %v, error: %w", indexName, tableName, err)
+	}
+
+	return nil
+}
+
+func (i orderIndex) name(primaryKey string) string {
+	return indexName(i.property, i.orderField, primaryKey)
+}
 
-	return fmt.Errorf("cannot create table %v with primary key %v, error: %v", tableName, primaryKey, err.Error())
+func (i orderIndex) fields(primaryKey string) []string {
+	return []string{i.property, i.orderField, primaryKey}
+}
+
+func indexName(property, orderField, primaryKey string) string {
+	return property + "_" + orderField + "_" + primaryKey
 }
 
 func (rt *RethinkDB) containsDB() (bool, error) {
@@ -133,18 +282,96 @@ func (rt *RethinkDB) boolResp(cursor *r.Cursor) (bool, error) {
 
 // GetUserTable returns users table.
 func (rt *RethinkDB) GetUserTable() *RethinkTable {
-	return &RethinkTable{
-		name:    usersTableName,
-		term:    r.DB(rt.name).Table(usersTableName),
+	return rt.table(usersTableName)
+}
+
+// GetAttachmentTable returns attachments table.
+func (rt *RethinkDB) GetAttachmentTable() *RethinkTable {
+	return rt.table(attachmentsTableName)
+}
+
+// GetFlagTable returns table with messages flagged for moderators.
+func (rt *RethinkDB) GetFlagTable() *RethinkTable {
+	return rt.table(flagsTableName)
+}
+
+// GetWebhookTable returns table with webhooks registered by room owners.
+func (rt *RethinkDB) GetWebhookTable() *RethinkTable {
+	return rt.table(webhooksTableName)
+}
+
+// GetDeadLetterTable returns table with webhook deliveries which failed.
+func (rt *RethinkDB) GetDeadLetterTable() *RethinkTable {
+	return rt.table(deadLettersTableName)
+}
+
+// GetIncomingHookTable returns table with hooks posting messages into rooms.
+func (rt *RethinkDB) GetIncomingHookTable() *RethinkTable {
+	return rt.table(incomingHooksTableName)
+}
+
+// GetMessageTable returns table with messages posted in rooms.
+func (rt *RethinkDB) GetMessageTable() *RethinkTable {
+	return rt.table(messagesTableName)
+}
+
+// GetArchivedMessageTable returns table with messages moved out of rooms' history by retention policies.
+func (rt *RethinkDB) GetArchivedMessageTable() *RethinkTable {
+	return rt.table(archivedMessagesTableName)
+}
+
+// GetRetentionTable returns table with retention policies of the rooms.
+func (rt *RethinkDB) GetRetentionTable() *RethinkTable {
+	return rt.table(retentionTableName)
+}
+
+// GetScheduledTable returns table with messages and reminders waiting to be posted into the rooms.
+func (rt *RethinkDB) GetScheduledTable() *RethinkTable {
+	return rt.table(scheduledTableName)
+}
+
+// GetPollTable returns table with polls created in the rooms.
+func (rt *RethinkDB) GetPollTable() *RethinkTable {
+	return rt.table(pollsTableName)
+}
+
+// GetPinTable returns table with messages pinned in the rooms.
+func (rt *RethinkDB) GetPinTable() *RethinkTable {
+	return rt.table(pinsTableName)
+}
+
+// GetRoomOwnerTable returns table with owners of the rooms.
+func (rt *RethinkDB) GetRoomOwnerTable() *RethinkTable {
+	return rt.table(roomOwnersTableName)
+}
+
+// GetRoomMemberTable returns table with rooms joined by the users.
+func (rt *RethinkDB) GetRoomMemberTable() *RethinkTable {
+	return rt.table(roomMembersTableName)
+}
+
+func (rt *RethinkDB) table(name string) *RethinkTable {
+	table := &RethinkTable{
+		name:    name,
+		term:    r.DB(rt.name).Table(name),
 		rethink: rt,
 	}
+
+	for _, spec := range tables {
+		if spec.name == name {
+			table.primaryKey = spec.primaryKey
+		}
+	}
+
+	return table
 }
 
 // RethinkTable represents RethinkDB table.
 type RethinkTable struct {
-	name    string
-	term    r.Term
-	rethink *RethinkDB
+	name       string
+	primaryKey string
+	term       r.Term
+	rethink    *RethinkDB
 }
 
 // UUID returns new UUID.
@@ -154,11 +381,22 @@ func (t *RethinkTable) UUID() (string, error) {
 
 // Insert persists given struct into table in RethinkDB.
 func (t *RethinkTable) Insert(entity interface{}) error {
+	defer t.observe("insert", time.Now())
+
 	return t.term.Insert(entity).Exec(t.rethink.session)
 }
 
+// Upsert persists given struct into table in RethinkDB, replacing element with the same primary key.
+func (t *RethinkTable) Upsert(entity interface{}) error {
+	defer t.observe("upsert", time.Now())
+
+	return t.term.Insert(entity, r.InsertOpts{Conflict: "replace"}).Exec(t.rethink.session)
+}
+
 // Find searches for first element with given property equal to given value.
 func (t *RethinkTable) Find(property string, value, result interface{}) error {
+	defer t.observe("find", time.Now())
+
 	cursor, err := t.term.Filter(r.Row.Field(property).Eq(value)).Run(t.rethink.session)
 	if err != nil {
 		return err
@@ -174,3 +412,225 @@ func (t *RethinkTable) Find(property string, value, result interface{}) error {
 
 	return nil
 }
+
+// Get searches for element with given primary key. If such element
+// doesn't exist result stays untouched.
+func (t *RethinkTable) Get(id string, result interface{}) error {
+	defer t.observe("get", time.Now())
+
+	cursor, err := t.term.Get(id).Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	if cursor.IsNil() {
+		return nil
+	}
+
+	return cursor.One(result)
+}
+
+// GetAll searches for elements with given primary keys. Elements which don't exist
+// are skipped. Result should be a pointer to a slice.
+func (t *RethinkTable) GetAll(ids []string, result interface{}) error {
+	defer t.observe("get_all", time.Now())
+
+	// result stays untouched if nothing can be found
+	if len(ids) == 0 {
+		return nil
+	}
+
+	keys := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, id)
+	}
+
+	cursor, err := t.term.GetAll(keys...).Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(result)
+}
+
+// FindAll searches for all elements with given property equal to given value.
+// Result should be a pointer to a slice.
+func (t *RethinkTable) FindAll(property string, value, result interface{}) error {
+	defer t.observe("find_all", time.Now())
+
+	cursor, err := t.term.Filter(r.Row.Field(property).Eq(value)).Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(result)
+}
+
+// FindBefore searches for at most limit elements with given property equal to given value
+// which are before given order field value and primary key. Elements are sorted descending
+// by order field and primary key, so elements with equal order fields are never skipped
+// between pages. Empty beforeKey means elements with order field lower than before.
+// The table has to have order index on given property and order field.
+// Result should be a pointer to a slice.
+func (t *RethinkTable) FindBefore(property string, value interface{}, orderField string, before interface{}, beforeKey string,
+	limit int, result interface{}) error {
+	defer t.observe("find_before", time.Now())
+
+	index := indexName(property, orderField, t.primaryKey)
+
+	cursor, err := t.term.
+		Between([]interface{}{value, r.MinVal, r.MinVal}, []interface{}{value, before, beforeKey}, r.BetweenOpts{Index: index}).
+		OrderBy(r.OrderByOpts{Index: r.Desc(index)}).
+		Limit(limit).
+		Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(result)
+}
+
+// FindMatching searches for at most limit elements which text field matches given regular
+// expression, property is one of the keys of given values, filters are equal to given values and order
+// field is not lower than from and lower than to. If toKey isn't empty, elements which order field
+// is equal to to and primary key is lower than toKey are found as well. If the key of values is mapped
+// to a value other than nil, order field of elements with such property has to be lower than that value too.
+// Elements are sorted descending by order field and primary key. The table has to have order index
+// on given property and order field. Result should be a pointer to a slice.
+func (t *RethinkTable) FindMatching(textField, pattern, property string, values map[string]interface{}, filters map[string]interface{},
+	orderField string, from, to interface{}, toKey string, limit int, result interface{}) error {
+	defer t.observe("find_matching", time.Now())
+
+	index := indexName(property, orderField, t.primaryKey)
+
+	condition := r.Row.Field(textField).Match(pattern).Ne(nil)
+	for field, value := range filters {
+		condition = condition.And(r.Row.Field(field).Eq(value))
+	}
+
+	var upperKey interface{} = r.MinVal
+	if toKey != "" {
+		upperKey = toKey
+	}
+
+	// every value is read with the index, so at most limit elements of each are sorted in memory
+	sequences := make([]interface{}, 0, len(values))
+	for value, until := range values {
+		valueCondition := condition
+		if until != nil {
+			valueCondition = valueCondition.And(r.Row.Field(orderField).Lt(until))
+		}
+
+		sequences = append(sequences, t.term.
+			Between([]interface{}{value, from, r.MinVal}, []interface{}{value, to, upperKey}, r.BetweenOpts{Index: index}).
+			OrderBy(r.OrderByOpts{Index: r.Desc(index)}).
+			Filter(valueCondition).
+			Limit(limit))
+	}
+
+	// result stays untouched if nothing can match
+	if len(sequences) == 0 {
+		return nil
+	}
+
+	cursor, err := r.Union(sequences...).
+		OrderBy(r.Desc(orderField), r.Desc(t.primaryKey)).
+		Limit(limit).
+		Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(result)
+}
+
+// FindEach searches for elements with given property equal to given value and order field
+// not lower than from and lower than to. Elements are sorted ascending by order field and read
+// one by one, each is decoded into a new pointer returned by newResult and passed to f.
+// Reading stops at the first error returned by f. The table has to have order index on given
+// property and order field.
+func (t *RethinkTable) FindEach(property string, value interface{}, orderField string, from, to interface{},
+	newResult func() interface{}, f func(result interface{}) error) error {
+	defer t.observe("find_each", time.Now())
+
+	index := indexName(property, orderField, t.primaryKey)
+
+	cursor, err := t.term.
+		Between([]interface{}{value, from, r.MinVal}, []interface{}{value, to, r.MinVal}, r.BetweenOpts{Index: index}).
+		OrderBy(r.OrderByOpts{Index: index}).
+		Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	for result := newResult(); cursor.Next(result); result = newResult() {
+		if err := f(result); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// FindNth searches for element with given property equal to given value which is n-th (counting
+// from zero) when elements are sorted descending by order field. If such element doesn't exist
+// result stays untouched. The table has to have order index on given property and order field.
+func (t *RethinkTable) FindNth(property string, value interface{}, orderField string, n int, result interface{}) error {
+	defer t.observe("find_nth", time.Now())
+
+	index := indexName(property, orderField, t.primaryKey)
+
+	cursor, err := t.term.
+		Between([]interface{}{value, r.MinVal, r.MinVal}, []interface{}{value, r.MaxVal, r.MaxVal}, r.BetweenOpts{Index: index}).
+		OrderBy(r.OrderByOpts{Index: r.Desc(index)}).
+		Skip(n).
+		Limit(1).
+		Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	if err := cursor.One(result); err != nil && err != r.ErrEmptyResult {
+		return err
+	}
+
+	return nil
+}
+
+// Distinct returns distinct values of given property. Result should be a pointer to a slice.
+func (t *RethinkTable) Distinct(property string, result interface{}) error {
+	defer t.observe("distinct", time.Now())
+
+	cursor, err := t.term.Field(property).Distinct().Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(result)
+}
+
+// All returns all elements from the table. Result should be a pointer to a slice.
+func (t *RethinkTable) All(result interface{}) error {
+	defer t.observe("all", time.Now())
+
+	cursor, err := t.term.Run(t.rethink.session)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(result)
+}
+
+// Delete removes element with given primary key.
+func (t *RethinkTable) Delete(id string) error {
+	defer t.observe("delete", time.Now())
+
+	return t.term.Get(id).Delete().Exec(t.rethink.session)
+}
+
+func (t *RethinkTable) observe(operation string, start time.Time) {
+	if t.rethink.observer != nil {
+		t.rethink.observer.ObserveQuery(t.name, operation, time.Since(start))
+	}
+}
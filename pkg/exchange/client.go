@@ -1,27 +1,52 @@
 package exchange
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
 )
 
+const (
+	// DisconnectClosed means that the other side closed the connection.
+	DisconnectClosed = "closed"
+	// DisconnectReceiveError means that message couldn't be received from the connection.
+	DisconnectReceiveError = "receive_error"
+	// DisconnectSendError means that message couldn't be sent through the connection.
+	DisconnectSendError = "send_error"
+	// DisconnectKicked means that the client was disconnected by the server.
+	DisconnectKicked = "kicked"
+	// DisconnectShutdown means that the client was disconnected because the server is shutting down.
+	DisconnectShutdown = "shutdown"
+
+	// DroppedClientStopped means that message wasn't sent because the client already stopped.
+	DroppedClientStopped = "client_stopped"
+)
+
 // User is an interface which defines persisten data about application user.
 type user interface {
 	Name() string
 }
 
 // NewClient returns new Client instance
-func NewClient(id string, user user, rooms *Rooms, conn *WsConnection, router *Router) *Client {
+func NewClient(id string, user user, rooms *Rooms, conn Connection, router *Router) *Client {
 	return &Client{
 		user:        user,
 		id:          id,
 		rooms:       rooms,
 		connnection: conn,
 		router:      router,
-		messages:    make(chan *Message, 50),
+		messages:    make(chan *Frame, 50),
 		stopSending: make(chan interface{}, 1),
 		stopWaiting: make(chan interface{}, 1),
+		sendingDone: make(chan struct{}),
+		joined:      make(map[string]*Room),
+		connected:   time.Now().UTC(),
 	}
 }
 
@@ -31,19 +56,28 @@ type Client struct {
 	user        user
 	rooms       *Rooms
 	router      *Router
-	connnection *WsConnection
-	messages    chan *Message
+	connnection Connection
+	messages    chan *Frame
 	stopSending chan interface{}
 	stopWaiting chan interface{}
+	sendingDone chan struct{}
+	joinedLock  sync.Mutex
+	joined      map[string]*Room
+	connected   time.Time
+	stopOnce    sync.Once
+	reasonLock  sync.Mutex
+	reason      string
 }
 
 // Start starts two goroutines: one for sending and one for receiving messages.
-func (c *Client) Start() {
+// When the context is done, queued messages are sent, the client is informed that
+// the server is restarting and the connection is closed.
+func (c *Client) Start(ctx context.Context) {
 	logger.Infof("Client: %v. Starting", c.user.Name())
 
 	defer c.closeConnection()
 
-	c.startSending()
+	c.startSending(ctx)
 	c.startReceiving()
 
 	<-c.stopWaiting
@@ -56,15 +90,108 @@ func (c *Client) ID() string {
 	return c.id
 }
 
+// Name returns name of the user represented by the client.
+func (c *Client) Name() string {
+	return c.user.Name()
+}
+
+// RemoteAddr returns network address of the connected user.
+func (c *Client) RemoteAddr() string {
+	return c.connnection.RemoteAddr()
+}
+
+// Connected returns time when the client connected.
+func (c *Client) Connected() time.Time {
+	return c.connected
+}
+
+// QueueDepth returns number of messages waiting to be sent to the client.
+func (c *Client) QueueDepth() int {
+	return len(c.messages)
+}
+
+// Disconnect closes client's connection, which stops the client and removes it from all rooms.
+func (c *Client) Disconnect() {
+	c.setDisconnectReason(DisconnectKicked)
+	c.closeConnection()
+}
+
+// DisconnectReason returns the reason why the client stopped or empty string if it is still running.
+func (c *Client) DisconnectReason() string {
+	c.reasonLock.Lock()
+	defer c.reasonLock.Unlock()
+	return c.reason
+}
+
+// setDisconnectReason remembers the reason why the client stopped, only the first reason is kept.
+func (c *Client) setDisconnectReason(reason string) {
+	c.reasonLock.Lock()
+	defer c.reasonLock.Unlock()
+
+	if c.reason == "" {
+		c.reason = reason
+	}
+}
+
+// stopped returns true if the client stopped sending messages and is being removed from rooms.
+func (c *Client) stopped() bool {
+	select {
+	case <-c.sendingDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// joinedRooms returns names of the rooms the client is a member of.
+func (c *Client) joinedRooms() []string {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	names := make([]string, 0, len(c.joined))
+	for name, room := range c.joined {
+		if room.Running() {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
 // String is a string representation of Client struct.
 func (c *Client) String() string {
 	return fmt.Sprintf(`{"name":"%v"}`, c.user.Name())
 }
 
-// Send sends message through connection.
+// Send sends message through connection. Message is dropped if the client stopped sending,
+// so rooms never wait for clients which are gone.
 func (c *Client) Send(msg *Message) {
-	logger.Infof("Client: %v. Adding message to send channel. Message: %v", c.user.Name(), msg.MsgType)
-	c.messages <- msg
+	c.SendFrame(NewFrame(msg))
+}
+
+// SendFrame sends frame through connection. The same frame can be sent to many clients,
+// it is encoded only once.
+func (c *Client) SendFrame(frame *Frame) {
+	logger.Infof("Client: %v. Adding message to send channel. Message: %v", c.user.Name(), frame.Message().MsgType)
+
+	// queue might have free space after the client stopped, messages put there would never be sent
+	if c.stopped() {
+		c.dropFrame(frame)
+		return
+	}
+
+	select {
+	case c.messages <- frame:
+	case <-c.sendingDone:
+		c.dropFrame(frame)
+	}
+}
+
+func (c *Client) dropFrame(frame *Frame) {
+	logger.Infof("Client: %v. Client stopped, message dropped. Message: %v", c.user.Name(), frame.Message().MsgType)
+	c.rooms.dropped(DroppedClientStopped)
 }
 
 func (c *Client) closeConnection() {
@@ -75,29 +202,72 @@ func (c *Client) closeConnection() {
 	}
 }
 
+// stop stops sending messages and finishes Start method. Both goroutines of the client
+// can call it, but only the first call matters.
 func (c *Client) stop() {
-	c.stopSending <- true
-	c.stopWaiting <- true
+	c.stopOnce.Do(func() {
+		c.stopSending <- true
+		c.stopWaiting <- true
+	})
+}
+
+// shutdown sends queued messages and closes the connection informing the other side,
+// that the server is going away. Receiving goroutine notices closed connection and stops the client.
+func (c *Client) shutdown() {
+	logger.Infof("Client: %v. Shutting down", c.user.Name())
+
+	c.setDisconnectReason(DisconnectShutdown)
+
+flushLoop:
+	for {
+		select {
+		case frame := <-c.messages:
+			if err := c.connnection.Send(frame); err != nil {
+				logger.Warnf("Client: %v. Error while sending queued message. Error: %v", c.user.Name(), err)
+				break flushLoop
+			}
+		default:
+			break flushLoop
+		}
+	}
+
+	if err := c.connnection.Send(ServerRestartingMessage()); err != nil {
+		logger.Warnf("Client: %v. Cannot inform about restart. Error: %v", c.user.Name(), err)
+	}
+
+	if err := c.connnection.CloseGoingAway(); err != nil {
+		logger.Warnf("Client: %v. Error while closing connection. Error: %v", c.user.Name(), err)
+	}
 }
 
 // StartSending starts infinite loop which is sending messages.
-func (c *Client) startSending() {
+func (c *Client) startSending(ctx context.Context) {
 	logger.Infof("Client: %v. Starting sending messages", c.user.Name())
 
+	done := ctx.Done()
+
 	go func() {
 	mainLoop:
 		for {
 			select {
-			case msg := <-c.messages:
-				logger.Infof("Client: %v. Sending message. Message: %v", c.user.Name(), msg.MsgType)
+			case <-done:
+				// shutdown happens once, later the loop waits for the stop signal
+				done = nil
+				c.shutdown()
+
+			case frame := <-c.messages:
+				logger.Infof("Client: %v. Sending message. Message: %v", c.user.Name(), frame.Message().MsgType)
 
-				if err := c.connnection.Send(msg); err != nil {
+				if err := c.connnection.Send(frame); err != nil {
 					logger.Warnf("Client: %v. Error while sending message.Error: %v", c.user.Name(), err)
+					c.setDisconnectReason(DisconnectSendError)
 					c.stop()
 				}
 
 			case <-c.stopSending:
 				logger.Infof("Client: %v. Stopping sending messages", c.user.Name())
+				// rooms may be sending messages to the client until it is removed
+				close(c.sendingDone)
 				c.rooms.RemoveClient(c)
 				break mainLoop
 			}
@@ -115,6 +285,12 @@ func (c *Client) startReceiving() {
 			var msg Message
 			if err := c.connnection.Receive(&msg); err != nil {
 				logger.Warnf("Client: %v. Error while receiving message. Error: %v", c.user.Name(), err)
+
+				if errors.Cause(err) == io.EOF {
+					c.setDisconnectReason(DisconnectClosed)
+				} else {
+					c.setDisconnectReason(DisconnectReceiveError)
+				}
 				c.stop()
 
 				break
@@ -125,8 +301,12 @@ func (c *Client) startReceiving() {
 
 			logger.Infof("Client: %v. Received message. Message: %v", c.user.Name(), msg.MsgType)
 
-			if err := c.router.FindRoute(msg.MsgType).Handle(&msg); err != nil {
+			if err := c.router.Handle(&msg); err != nil {
 				logger.Warnf("Client: %v. Error while handling message: %v. Error: %v", c.user.Name(), msg, err)
+
+				if clientErr, ok := AsClientError(err); ok {
+					c.Send(ErrorMessage(clientErr.Error()))
+				}
 			}
 		}
 
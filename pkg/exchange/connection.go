@@ -1,10 +1,35 @@
 package exchange
 
 import (
+	"fmt"
+	"io"
+	"sync"
+
 	"github.com/pkg/errors"
 	"golang.org/x/net/websocket"
 )
 
+// Connection is an interface which defines transport used by Client
+// to exchange messages with the other side.
+type Connection interface {
+	Send(msg interface{}) error
+	Receive(msg interface{}) error
+	Close() error
+	CloseGoingAway() error
+	RemoteAddr() string
+}
+
+// closeStatusGoingAway is a websocket close status sent when the server is shutting down.
+const closeStatusGoingAway = 1001
+
+// frameCodec sends messages as JSON text frames. Frames are sent without encoding them again.
+var frameCodec = websocket.Codec{Marshal: marshalFrame}
+
+func marshalFrame(msg interface{}) ([]byte, byte, error) {
+	data, err := encode(msg)
+	return data, websocket.TextFrame, err
+}
+
 // NewWebSocketConn returns new instance of wsConnection,
 func NewWebSocketConn(webSocketConn *websocket.Conn) *WsConnection {
 	return &WsConnection{
@@ -16,8 +41,9 @@ type WsConnection struct {
 	webSocketConn *websocket.Conn
 }
 
+// Send sends message or Frame as JSON text frame.
 func (c *WsConnection) Send(msg interface{}) error {
-	err := websocket.JSON.Send(c.webSocketConn, msg)
+	err := frameCodec.Send(c.webSocketConn, msg)
 	return errors.Wrapf(err, "error while sending message through websocket")
 }
 
@@ -30,3 +56,118 @@ func (c *WsConnection) Close() error {
 	err := c.webSocketConn.Close()
 	return errors.Wrapf(err, "error while closing websocket connection")
 }
+
+// CloseGoingAway sends close frame with 'going away' status and closes the connection.
+// Close frame with normal status, which is always written while closing the connection,
+// is ignored by the other side because it already received the first close frame.
+func (c *WsConnection) CloseGoingAway() error {
+	if err := c.webSocketConn.WriteClose(closeStatusGoingAway); err != nil {
+		_ = c.webSocketConn.Close()
+		return errors.Wrapf(err, "error while sending close frame")
+	}
+
+	return c.Close()
+}
+
+// RemoteAddr returns network address of the other side of the connection.
+func (c *WsConnection) RemoteAddr() string {
+	return c.webSocketConn.Request().RemoteAddr
+}
+
+var errConnectionClosed = errors.New("connection closed")
+
+// NewChannelConn returns new instance of ChannelConnection with buffers of given size.
+func NewChannelConn(buffer int) *ChannelConnection {
+	return &ChannelConnection{
+		incoming: make(chan *Message, buffer),
+		outgoing: make(chan *Message, buffer),
+		closed:   make(chan struct{}),
+	}
+}
+
+// ChannelConnection is a Connection which doesn't use network. Messages sent
+// by the Client can be read from Messages channel and messages received by
+// the Client are posted with Post method. It allows in-process participants
+// (like bots) to use the same rules as users connected through websocket.
+type ChannelConnection struct {
+	incoming  chan *Message
+	outgoing  chan *Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Send passes message or message of the Frame to the other side of the connection.
+func (c *ChannelConnection) Send(msg interface{}) error {
+	if frame, ok := msg.(*Frame); ok {
+		msg = frame.Message()
+	}
+
+	message, ok := msg.(*Message)
+	if !ok {
+		return fmt.Errorf("unsupported message type %T", msg)
+	}
+
+	// messages are shared by all members of the room, so the other side gets a copy
+	copied := *message
+
+	select {
+	case c.outgoing <- &copied:
+		return nil
+	case <-c.closed:
+		return errConnectionClosed
+	}
+}
+
+// Receive waits for message posted by the other side of the connection.
+func (c *ChannelConnection) Receive(msg interface{}) error {
+	message, ok := msg.(*Message)
+	if !ok {
+		return fmt.Errorf("unsupported message type %T", msg)
+	}
+
+	select {
+	case posted := <-c.incoming:
+		*message = *posted
+		return nil
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+// Close closes the connection. It is safe to call it multiple times.
+func (c *ChannelConnection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// CloseGoingAway closes the connection, there is no close status in in-process connection.
+func (c *ChannelConnection) CloseGoingAway() error {
+	return c.Close()
+}
+
+// RemoteAddr returns address describing in-process connection.
+func (c *ChannelConnection) RemoteAddr() string {
+	return "in-process"
+}
+
+// Messages returns channel with messages sent through the connection.
+func (c *ChannelConnection) Messages() <-chan *Message {
+	return c.outgoing
+}
+
+// Closed returns channel which is closed when the connection is closed.
+func (c *ChannelConnection) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Post passes message to the Client as if it was sent by the other side.
+func (c *ChannelConnection) Post(msg *Message) error {
+	select {
+	case c.incoming <- msg:
+		return nil
+	case <-c.closed:
+		return errConnectionClosed
+	}
+}
@@ -0,0 +1,147 @@
+package exchange
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DirectorySortName sorts rooms by name.
+	DirectorySortName = "name"
+	// DirectorySortMembers sorts rooms from the one with the most members.
+	DirectorySortMembers = "members"
+	// DirectorySortActivity sorts rooms from the most recently active.
+	DirectorySortActivity = "activity"
+
+	// DefaultDirectoryLimit is a number of rooms returned when limit isn't specified.
+	DefaultDirectoryLimit = 50
+	// MaxDirectoryLimit is a maximal number of rooms returned at once.
+	MaxDirectoryLimit = 200
+)
+
+// ErrInvalidDirectorySort is returned when rooms should be sorted by unknown property.
+var ErrInvalidDirectorySort = errors.New("rooms can be sorted by name, members or activity")
+
+// DirectoryQuery describes which rooms should be returned from the directory.
+type DirectoryQuery struct {
+	// Search is a text which has to be a part of name or topic of the room, case is ignored.
+	Search string `json:"search,omitempty"`
+	// Sort is one of DirectorySortName (default), DirectorySortMembers or DirectorySortActivity.
+	Sort   string `json:"sort,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// DirectoryEntry describes single room in the directory.
+type DirectoryEntry struct {
+	Name         string    `json:"name"`
+	Topic        string    `json:"topic,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	Members      int       `json:"members"`
+	LastActivity time.Time `json:"lastActivity"`
+	Joined       bool      `json:"joined"`
+}
+
+// DirectoryPage is a part of the directory matching the query. Total is the number of all
+// matching rooms, next page starts at Offset + len(Rooms).
+type DirectoryPage struct {
+	Rooms  []*DirectoryEntry `json:"rooms"`
+	Total  int               `json:"total"`
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+}
+
+// Directory returns page of rooms matching the query. Rooms joined by the user with given name are flagged.
+func (ch *Rooms) Directory(userName string, query DirectoryQuery) (*DirectoryPage, error) {
+	less, err := directoryOrder(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultDirectoryLimit
+	} else if limit > MaxDirectoryLimit {
+		limit = MaxDirectoryLimit
+	}
+
+	offset := query.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	search := strings.ToLower(query.Search)
+	joined := ch.memberships.rooms(userName)
+
+	entries := make([]*DirectoryEntry, 0)
+	for _, room := range ch.rooms.running() {
+		if search != "" && !strings.Contains(strings.ToLower(room.Name()), search) &&
+			!strings.Contains(strings.ToLower(room.Topic()), search) {
+			continue
+		}
+
+		entry := &DirectoryEntry{
+			Name:         room.Name(),
+			Topic:        room.Topic(),
+			Owner:        room.Owner(),
+			Members:      room.MembersCount(),
+			LastActivity: room.LastActivity(),
+			Joined:       joined[room.Name()],
+		}
+
+		// memberships of the main room aren't counted
+		if room.Main() {
+			entry.Joined = room.HasUser(userName)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+
+	page := &DirectoryPage{
+		Rooms:  make([]*DirectoryEntry, 0),
+		Total:  len(entries),
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	if offset < len(entries) {
+		end := offset + limit
+		if end > len(entries) {
+			end = len(entries)
+		}
+		page.Rooms = entries[offset:end]
+	}
+
+	return page, nil
+}
+
+func directoryOrder(sortBy string) (func(a, b *DirectoryEntry) bool, error) {
+	switch sortBy {
+	case "", DirectorySortName:
+		return func(a, b *DirectoryEntry) bool {
+			return a.Name < b.Name
+		}, nil
+	case DirectorySortMembers:
+		return func(a, b *DirectoryEntry) bool {
+			if a.Members != b.Members {
+				return a.Members > b.Members
+			}
+			return a.Name < b.Name
+		}, nil
+	case DirectorySortActivity:
+		return func(a, b *DirectoryEntry) bool {
+			if !a.LastActivity.Equal(b.LastActivity) {
+				return a.LastActivity.After(b.LastActivity)
+			}
+			return a.Name < b.Name
+		}, nil
+	default:
+		return nil, ErrInvalidDirectorySort
+	}
+}
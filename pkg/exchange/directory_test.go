@@ -0,0 +1,106 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func directoryNames(page *DirectoryPage) []string {
+	names := make([]string, 0, len(page.Rooms))
+	for _, room := range page.Rooms {
+		names = append(names, room.Name)
+	}
+	return names
+}
+
+func TestRoomsDirectoryShouldSearchSortAndPaginate(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	for _, name := range []string{"backend", "frontend", "ops"} {
+		assert.NoError(t, rooms.CreateEmptyRoom(name, "admin"))
+	}
+	assert.NoError(t, rooms.SetTopic("ops", "admin", "Deployments and on-call"))
+
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+	jane := NewClient("jane-session", &testUser{name: "jane"}, rooms, NewChannelConn(10), NewRouter())
+
+	rooms.AddClientToRoom("frontend", john)
+	rooms.AddClientToRoom("frontend", jane)
+	rooms.AddClientToRoom("backend", jane)
+
+	time.Sleep(time.Millisecond)
+	rooms.SendMessageOnRoom(textMessage("backend", "hello"))
+
+	// when
+	byName, nameErr := rooms.Directory("john", DirectoryQuery{})
+	byMembers, membersErr := rooms.Directory("john", DirectoryQuery{Sort: DirectorySortMembers, Limit: 2})
+	nextPage, nextErr := rooms.Directory("john", DirectoryQuery{Sort: DirectorySortMembers, Limit: 2, Offset: 2})
+	byTopic, topicErr := rooms.Directory("john", DirectoryQuery{Search: "ON-CALL"})
+	_, sortErr := rooms.Directory("john", DirectoryQuery{Sort: "size"})
+
+	// then
+	assert.NoError(t, nameErr)
+	assert.Equal(t, []string{"backend", "frontend", "main", "ops"}, directoryNames(byName))
+	assert.Equal(t, 4, byName.Total)
+	assert.Equal(t, DefaultDirectoryLimit, byName.Limit)
+	assert.Equal(t, &DirectoryEntry{
+		Name:         "frontend",
+		Owner:        "admin",
+		Members:      2,
+		LastActivity: byName.Rooms[1].LastActivity,
+		Joined:       true,
+	}, byName.Rooms[1])
+	assert.False(t, byName.Rooms[0].Joined)
+
+	assert.NoError(t, membersErr)
+	assert.Equal(t, []string{"frontend", "backend"}, directoryNames(byMembers))
+	assert.NoError(t, nextErr)
+	assert.Equal(t, []string{"main", "ops"}, directoryNames(nextPage))
+	assert.Equal(t, 4, nextPage.Total)
+
+	assert.NoError(t, topicErr)
+	assert.Equal(t, []string{"ops"}, directoryNames(byTopic))
+	assert.Equal(t, "Deployments and on-call", byTopic.Rooms[0].Topic)
+
+	assert.Equal(t, ErrInvalidDirectorySort, sortErr)
+
+	assert.Eventually(t, func() bool {
+		byActivity, err := rooms.Directory("john", DirectoryQuery{Sort: DirectorySortActivity})
+		return err == nil && byActivity.Rooms[0].Name == "backend"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRoomsShouldAllowOnlyOwnerToSetTopic(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go client.Start(context.Background())
+	defer conn.Close()
+
+	rooms.CreateRoom("ops", client)
+
+	// when
+	ownerErr := rooms.SetTopic("ops", "john", "On-call")
+	otherErr := rooms.SetTopic("ops", "jane", "Hijacked")
+	mainErr := rooms.SetTopic(MainRoomName(), "john", "Main")
+	missingErr := rooms.SetTopic("dev", "john", "Development")
+
+	// then
+	assert.NoError(t, ownerErr)
+	assert.Equal(t, ErrNotRoomOwner, otherErr)
+	assert.Equal(t, ErrNotRoomOwner, mainErr)
+	assert.Equal(t, ErrRoomNotFound, missingErr)
+	assert.Equal(t, NewTopicMessage("ops", "john", "On-call"), nextMessageOfType(t, conn, MsgSetTopicMT))
+	assert.Equal(t, []*RoomInfo{
+		{Name: "main", Members: 0},
+		{Name: "ops", Owner: "john", Topic: "On-call", Members: 1},
+	}, rooms.List())
+}
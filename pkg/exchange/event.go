@@ -0,0 +1,42 @@
+package exchange
+
+import (
+	"time"
+)
+
+const (
+	EventMessagePosted = "message.posted"
+	EventUserJoined    = "user.joined"
+	EventUserLeft      = "user.left"
+	EventRoomCreated   = "room.created"
+	EventRoomRemoved   = "room.removed"
+)
+
+// EventTypes returns types of all events emitted by Rooms.
+func EventTypes() []string {
+	return []string{EventMessagePosted, EventUserJoined, EventUserLeft, EventRoomCreated, EventRoomRemoved}
+}
+
+// Event describes something what has happened in one of the rooms.
+type Event struct {
+	Type    string
+	Room    string
+	User    string
+	Message *Message
+	Time    time.Time
+}
+
+func newEvent(eventType, room, user string) *Event {
+	return &Event{
+		Type: eventType,
+		Room: room,
+		User: user,
+		Time: time.Now().UTC(),
+	}
+}
+
+// Listener is notified about events in the rooms. OnEvent is called concurrently
+// by goroutines handling requests, so it has to be safe for concurrent use and it shouldn't block.
+type Listener interface {
+	OnEvent(event *Event)
+}
@@ -0,0 +1,44 @@
+package exchange
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// NewFrame returns new Frame with given message. Message mustn't be modified after
+// the frame is created, because it is shared by all recipients.
+func NewFrame(msg *Message) *Frame {
+	return &Frame{message: msg}
+}
+
+// Frame is a message which is encoded at most once, no matter to how many clients
+// it is sent. Rooms wrap broadcast messages in frames, so the same bytes are written
+// to every connection.
+type Frame struct {
+	message *Message
+	once    sync.Once
+	data    []byte
+	err     error
+}
+
+// Message returns message sent in this frame.
+func (f *Frame) Message() *Message {
+	return f.message
+}
+
+// Encoded returns JSON representation of the message. Message is encoded by the first call,
+// later calls return the same bytes.
+func (f *Frame) Encoded() ([]byte, error) {
+	f.once.Do(func() {
+		f.data, f.err = json.Marshal(f.message)
+	})
+	return f.data, f.err
+}
+
+// encode returns JSON representation of given message. Frames are encoded only once.
+func encode(msg interface{}) ([]byte, error) {
+	if frame, ok := msg.(*Frame); ok {
+		return frame.Encoded()
+	}
+	return json.Marshal(msg)
+}
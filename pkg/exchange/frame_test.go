@@ -0,0 +1,72 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameShouldBeEncodedOnce(t *testing.T) {
+	// given
+	msg := textMessage("main", "hello")
+	frame := NewFrame(msg)
+
+	expected, err := json.Marshal(msg)
+	assert.NoError(t, err)
+
+	// when
+	first, err1 := frame.Encoded()
+	second, err2 := frame.Encoded()
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Equal(t, expected, first)
+	assert.Same(t, &first[0], &second[0])
+}
+
+func TestChannelConnectionShouldSendMessageOfFrame(t *testing.T) {
+	// given
+	conn := NewChannelConn(1)
+	msg := textMessage("main", "hello")
+
+	// when
+	err := conn.Send(NewFrame(msg))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, msg, <-conn.Messages())
+}
+
+func TestRoomShouldShareFrameBetweenMembers(t *testing.T) {
+	// given
+	room := NewRoom(context.Background(), "ops", "john")
+	room.Start()
+	defer room.Stop()
+
+	rooms := NewRooms()
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(1), NewRouter())
+	jane := NewClient("jane-session", &testUser{name: "jane"}, rooms, NewChannelConn(1), NewRouter())
+
+	assert.NoError(t, room.AddClient(john))
+	assert.NoError(t, room.AddClient(jane))
+
+	// when
+	err := room.SendToEveryone(textMessage("ops", "hello"))
+
+	// then
+	assert.NoError(t, err)
+	assert.Same(t, <-john.messages, <-jane.messages)
+}
+
+func textMessage(room, content string) *Message {
+	return &Message{
+		MsgType:    MsgTextMsgMT,
+		SenderID:   "john-session",
+		SenderName: "john",
+		Room:       room,
+		Content:    content,
+	}
+}
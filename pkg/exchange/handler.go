@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -8,6 +9,14 @@ type Handler interface {
 	Handle(msg *Message) error
 }
 
+// HandlerFunc is an adapter which allows to use ordinary functions as Handlers.
+type HandlerFunc func(msg *Message) error
+
+// Handle calls f(msg).
+func (f HandlerFunc) Handle(msg *Message) error {
+	return f(msg)
+}
+
 func NewRoute(msgType string, handler Handler) *Route {
 	return &Route{
 		msgType: msgType,
@@ -34,20 +43,58 @@ func (r *Route) MsgType() string {
 
 func NewRouter() *Router {
 	return &Router{
-		routes: map[string]*Route{},
+		routes:          map[string]*Route{},
+		middlewares:     make([]Middleware, 0),
+		typeMiddlewares: map[string][]Middleware{},
 	}
 }
 
 type Router struct {
-	routes map[string]*Route
+	routes          map[string]*Route
+	middlewares     []Middleware
+	typeMiddlewares map[string][]Middleware
 }
 
 func (r *Router) RegisterRoute(route *Route) {
 	r.routes[route.MsgType()] = route
 }
 
+// Use registers middlewares which are applied to messages of every type.
+// Middlewares are invoked in the order of registration.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// UseFor registers middlewares which are applied only to messages of given type.
+// They are invoked after all global middlewares.
+func (r *Router) UseFor(msgType string, middlewares ...Middleware) {
+	r.typeMiddlewares[msgType] = append(r.typeMiddlewares[msgType], middlewares...)
+}
+
+// FindRoute returns route for messages of given type with handler wrapped in all
+// registered middlewares or nil if such route doesn't exist.
 func (r *Router) FindRoute(msgType string) *Route {
-	return r.routes[msgType]
+	route, ok := r.routes[msgType]
+	if !ok {
+		return nil
+	}
+
+	handler := Chain(route.handler, r.typeMiddlewares[msgType]...)
+	return NewRoute(msgType, Chain(handler, r.middlewares...))
+}
+
+// Handle passes message to the handler of the route registered for its type.
+// Global middlewares are invoked even if such route doesn't exist.
+func (r *Router) Handle(msg *Message) error {
+	if route := r.FindRoute(msg.MsgType); route != nil {
+		return route.Handle(msg)
+	}
+
+	notFound := HandlerFunc(func(msg *Message) error {
+		return NewClientError("Unknown message type: %v", msg.MsgType)
+	})
+
+	return Chain(notFound, r.middlewares...).Handle(msg)
 }
 
 // ----
@@ -140,3 +187,90 @@ func (h *LogoutHandler) Handle(msg *Message) error {
 	h.client.Send(msg)
 	return nil
 }
+
+// ----
+
+// NewRoomsDirectoryHandler returns handler which sends page of rooms directory to the client.
+func NewRoomsDirectoryHandler(rooms *Rooms, client *Client) *RoomsDirectoryHandler {
+	return &RoomsDirectoryHandler{
+		rooms:  rooms,
+		client: client,
+	}
+}
+
+type RoomsDirectoryHandler struct {
+	rooms  *Rooms
+	client *Client
+}
+
+func (h *RoomsDirectoryHandler) Handle(msg *Message) error {
+	var query DirectoryQuery
+	if msg.DirectoryQuery != nil {
+		query = *msg.DirectoryQuery
+	}
+
+	page, err := h.rooms.Directory(h.client.Name(), query)
+	if err != nil {
+		return NewClientError("Invalid directory request: %v", err)
+	}
+
+	h.client.Send(DirectoryMessage(page))
+	return nil
+}
+
+// ----
+
+// NewSetTopicHandler returns handler which changes topic of the room owned by the client's user.
+func NewSetTopicHandler(rooms *Rooms, client *Client) *SetTopicHandler {
+	return &SetTopicHandler{
+		rooms:  rooms,
+		client: client,
+	}
+}
+
+type SetTopicHandler struct {
+	rooms  *Rooms
+	client *Client
+}
+
+func (h *SetTopicHandler) Handle(msg *Message) error {
+	if err := h.rooms.SetTopic(msg.Room, h.client.Name(), msg.Content); err != nil {
+		return NewClientError("Cannot change topic: %v", err)
+	}
+	return nil
+}
+
+// ----
+
+// NewSearchHandler returns handler which sends to the client stored messages found in the rooms
+// the client's user is a member of.
+func NewSearchHandler(rooms *Rooms, searcher Searcher, client *Client) *SearchHandler {
+	return &SearchHandler{
+		rooms:    rooms,
+		searcher: searcher,
+		client:   client,
+	}
+}
+
+type SearchHandler struct {
+	rooms    *Rooms
+	searcher Searcher
+	client   *Client
+}
+
+func (h *SearchHandler) Handle(msg *Message) error {
+	var query SearchQuery
+	if msg.SearchQuery != nil {
+		query = *msg.SearchQuery
+	}
+
+	page, err := h.searcher.Search(h.rooms.ReadableRooms(h.client.Name()), query)
+	if errors.Is(err, ErrInvalidSearch) || errors.Is(err, ErrInvalidSearchCursor) || errors.Is(err, ErrSearchNotMember) {
+		return NewClientError("Invalid search request: %v", err)
+	} else if err != nil {
+		return fmt.Errorf("cannot search messages, error: %w", err)
+	}
+
+	h.client.Send(SearchResultsMessage(page))
+	return nil
+}
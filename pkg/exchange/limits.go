@@ -0,0 +1,101 @@
+package exchange
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrRoomFull is returned when room has maximal number of members.
+	ErrRoomFull = errors.New("room is full")
+	// ErrTooManyRooms is returned when maximal number of rooms already exists.
+	ErrTooManyRooms = errors.New("too many rooms")
+	// ErrTooManyJoinedRooms is returned when user is a member of maximal number of rooms.
+	ErrTooManyJoinedRooms = errors.New("too many joined rooms")
+	// ErrTooManyConnections is returned when server has maximal number of connections.
+	ErrTooManyConnections = errors.New("too many connections")
+	// ErrTooManyUserConnections is returned when user has maximal number of connections.
+	ErrTooManyUserConnections = errors.New("too many connections of the user")
+)
+
+// Limits restrict resources which can be used by the users. Zero means no limit.
+// The main room isn't counted as a room and it has no members limit.
+type Limits struct {
+	// MaxRoomMembers is a maximal number of clients in a single room.
+	MaxRoomMembers int
+	// MaxRooms is a maximal number of rooms.
+	MaxRooms int
+	// MaxRoomsPerUser is a maximal number of rooms a user is a member of, no matter through how many connections.
+	MaxRoomsPerUser int
+}
+
+// limitedErrorMessage returns text of the ERROR message sent to the client which exceeded the limit.
+func limitedErrorMessage(err error) string {
+	switch err {
+	case ErrRoomFull:
+		return "Room is full"
+	case ErrTooManyRooms:
+		return "Too many rooms, remove unused rooms first"
+	case ErrTooManyJoinedRooms:
+		return "You joined too many rooms, leave some rooms first"
+	default:
+		return "Room doesn't exist"
+	}
+}
+
+// NewConnectionLimiter returns new ConnectionLimiter which allows given number of connections
+// in total and per single user. Zero means no limit.
+func NewConnectionLimiter(maxConnections, maxPerUser int) *ConnectionLimiter {
+	return &ConnectionLimiter{
+		maxConnections: maxConnections,
+		maxPerUser:     maxPerUser,
+		users:          make(map[string]int),
+	}
+}
+
+// ConnectionLimiter counts open connections.
+type ConnectionLimiter struct {
+	maxConnections int
+	maxPerUser     int
+	lock           sync.Mutex
+	connections    int
+	users          map[string]int
+}
+
+// Acquire reserves connection for the user with given name. Returned function releases
+// the reservation and it has to be called when the connection is closed.
+func (l *ConnectionLimiter) Acquire(userName string) (func(), error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.maxConnections > 0 && l.connections >= l.maxConnections {
+		return nil, ErrTooManyConnections
+	}
+
+	if l.maxPerUser > 0 && l.users[userName] >= l.maxPerUser {
+		return nil, ErrTooManyUserConnections
+	}
+
+	l.connections++
+	l.users[userName]++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.release(userName)
+		})
+	}, nil
+}
+
+func (l *ConnectionLimiter) release(userName string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.connections--
+	l.users[userName]--
+
+	if l.users[userName] <= 0 {
+		delete(l.users, userName)
+	}
+}
@@ -0,0 +1,152 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionLimiterShouldLimitConnections(t *testing.T) {
+	// given
+	limiter := NewConnectionLimiter(3, 2)
+
+	// when
+	releaseJohn1, err1 := limiter.Acquire("john")
+	_, err2 := limiter.Acquire("john")
+	_, userErr := limiter.Acquire("john")
+	_, err3 := limiter.Acquire("jane")
+	_, serverErr := limiter.Acquire("bob")
+
+	releaseJohn1()
+	releaseJohn1()
+	_, err4 := limiter.Acquire("bob")
+	_, err5 := limiter.Acquire("bob")
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Equal(t, ErrTooManyUserConnections, userErr)
+	assert.NoError(t, err3)
+	assert.Equal(t, ErrTooManyConnections, serverErr)
+	assert.NoError(t, err4)
+	assert.Equal(t, ErrTooManyConnections, err5)
+}
+
+func TestRoomsShouldLimitNumberOfRooms(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.SetLimits(Limits{MaxRooms: 1})
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go client.Start(context.Background())
+	defer conn.Close()
+
+	// when
+	createErr := rooms.CreateEmptyRoom("ops", "john")
+	limitErr := rooms.CreateEmptyRoom("dev", "john")
+	rooms.CreateRoom("qa", client)
+
+	// then
+	assert.NoError(t, createErr)
+	assert.Equal(t, ErrTooManyRooms, limitErr)
+	assert.Equal(t, ErrorMessage("Too many rooms, remove unused rooms first"), <-conn.Messages())
+
+	// when
+	deleteErr := rooms.DeleteRoom("ops")
+	afterDeleteErr := rooms.CreateEmptyRoom("dev", "john")
+
+	// then
+	assert.NoError(t, deleteErr)
+	assert.NoError(t, afterDeleteErr)
+}
+
+func TestRoomsShouldLimitMembersOfRoom(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.SetLimits(Limits{MaxRoomMembers: 1})
+
+	johnConn, janeConn := NewChannelConn(10), NewChannelConn(10)
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, johnConn, NewRouter())
+	jane := NewClient("jane-session", &testUser{name: "jane"}, rooms, janeConn, NewRouter())
+
+	for _, client := range []*Client{john, jane} {
+		go client.Start(context.Background())
+	}
+	defer johnConn.Close()
+	defer janeConn.Close()
+
+	// when
+	rooms.CreateRoom("ops", john)
+	rooms.AddClientToRoom(MainRoomName(), jane)
+	rooms.AddClientToRoom(MainRoomName(), john)
+	rooms.AddClientToRoom("ops", jane)
+
+	// then
+	assert.Equal(t, NewUserJoinedRoomMessage("ops", john.ID()), <-johnConn.Messages())
+	members, err := rooms.Members("ops")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"john"}, members)
+
+	// main room has no members limit
+	assert.True(t, rooms.IsMember(MainRoomName(), "john"))
+	assert.True(t, rooms.IsMember(MainRoomName(), "jane"))
+
+	assert.Equal(t, ErrorMessage("Room is full"), nextMessageOfType(t, janeConn, MsgErrorMsgMT))
+}
+
+// nextMessageOfType skips messages sent through the connection until message of given type is sent.
+func nextMessageOfType(t *testing.T, conn *ChannelConnection, msgType string) *Message {
+	timeout := time.After(time.Second)
+
+	for {
+		select {
+		case msg := <-conn.Messages():
+			if msg.MsgType == msgType {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("message of type %v not sent", msgType)
+			return nil
+		}
+	}
+}
+
+func TestRoomsShouldLimitRoomsJoinedByUser(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.SetLimits(Limits{MaxRoomsPerUser: 2})
+
+	assert.NoError(t, rooms.CreateEmptyRoom("ops", "admin"))
+	assert.NoError(t, rooms.CreateEmptyRoom("dev", "admin"))
+	assert.NoError(t, rooms.CreateEmptyRoom("qa", "admin"))
+
+	// two connections of the same user
+	conn1, conn2 := NewChannelConn(10), NewChannelConn(10)
+	client1 := NewClient("john-session-1", &testUser{name: "john"}, rooms, conn1, NewRouter())
+	client2 := NewClient("john-session-2", &testUser{name: "john"}, rooms, conn2, NewRouter())
+
+	// when
+	rooms.AddClientToRoom(MainRoomName(), client1)
+	rooms.AddClientToRoom("ops", client1)
+	rooms.AddClientToRoom("ops", client2)
+	rooms.AddClientToRoom("dev", client2)
+	rooms.AddClientToRoom("qa", client2)
+
+	// then
+	assert.True(t, rooms.IsMember("ops", "john"))
+	assert.True(t, rooms.IsMember("dev", "john"))
+	assert.False(t, rooms.IsMember("qa", "john"))
+
+	// when
+	rooms.RemoveClientFromRoom("dev", client2)
+	rooms.AddClientToRoom("qa", client1)
+
+	// then
+	assert.True(t, rooms.IsMember("qa", "john"))
+}
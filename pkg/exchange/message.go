@@ -2,6 +2,7 @@ package exchange
 
 import (
 	"encoding/json"
+	"time"
 )
 
 const (
@@ -13,6 +14,20 @@ const (
 	MsgRemoveRoomMT     = "REMOVE_ROOM"
 	MsgRoomsNamesMT     = "ROOMS_LIST"
 	MsgErrorMsgMT       = "ERROR"
+	MsgServerRestartMT  = "SERVER_RESTARTING"
+	MsgRoomsDirectoryMT = "ROOMS_DIRECTORY"
+	MsgSetTopicMT       = "SET_TOPIC"
+	MsgSearchMT         = "SEARCH"
+	MsgScheduleMT       = "SCHEDULE_MSG"
+	MsgCreatePollMT     = "CREATE_POLL"
+	MsgVoteMT           = "VOTE"
+	MsgPollResultsMT    = "POLL_RESULTS"
+	MsgPinMT            = "PIN_MSG"
+	MsgUnpinMT          = "UNPIN_MSG"
+	MsgPinnedListMT     = "PINNED_LIST"
+
+	// FormatMarkdown is a format of text messages which content should be rendered as Markdown.
+	FormatMarkdown = "markdown"
 
 	system = "system"
 )
@@ -20,12 +35,54 @@ const (
 // Message represents ALL messages exchanged in the app. This may not be the
 // best idea, but in such small app maybe it won't be catastrophic. We will see.
 type Message struct {
-	MsgType    string   `json:"msgType"`
-	SenderID   string   `json:"senderId"`
-	SenderName string   `json:"senderName"`
-	Rooms      []string `json:"rooms"`
-	Room       string   `json:"room"`
-	Content    string   `json:"content"`
+	ID          string        `json:"id,omitempty"`
+	Time        *time.Time    `json:"time,omitempty"`
+	MsgType     string        `json:"msgType"`
+	SenderID    string        `json:"senderId"`
+	SenderName  string        `json:"senderName"`
+	Rooms       []string      `json:"rooms"`
+	Room        string        `json:"room"`
+	Content     string        `json:"content"`
+	Format      string        `json:"format,omitempty"`
+	HTML        string        `json:"html,omitempty"`
+	Attachments []*Attachment `json:"attachments,omitempty"`
+	// DirectoryQuery is sent by the client requesting rooms directory.
+	DirectoryQuery *DirectoryQuery `json:"directoryQuery,omitempty"`
+	// Directory is sent in response to the rooms directory request.
+	Directory *DirectoryPage `json:"directory,omitempty"`
+	// SearchQuery is sent by the client searching stored messages.
+	SearchQuery *SearchQuery `json:"searchQuery,omitempty"`
+	// SearchResults is sent in response to the search request.
+	SearchResults *SearchPage `json:"searchResults,omitempty"`
+	// Poll is sent by the client creating poll.
+	Poll *PollRequest `json:"poll,omitempty"`
+	// Vote is sent by the client voting in the poll.
+	Vote *Vote `json:"vote,omitempty"`
+	// PollResults is sent to the members of the room when the poll is created, changed or closed.
+	PollResults *PollResults `json:"pollResults,omitempty"`
+	// Pins contains messages pinned in the room.
+	Pins []*PinnedMessage `json:"pins,omitempty"`
+}
+
+// Attachment represents file attached to the text message.
+type Attachment struct {
+	ID           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	URL          string `json:"url,omitempty"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+}
+
+// AttachmentIDs returns ids of all attachments referenced by the message.
+func (m *Message) AttachmentIDs() []string {
+	ids := make([]string, 0, len(m.Attachments))
+	for _, attachment := range m.Attachments {
+		ids = append(ids, attachment.ID)
+	}
+	return ids
 }
 
 // String returns string representation of Message struct.
@@ -93,3 +150,105 @@ func NewUserLeftRoomMessage(room, senderID string) *Message {
 		Room:       room,
 	}
 }
+
+// ServerRestartingMessage returns message informing that the server is going to restart
+// and the connection will be closed.
+func ServerRestartingMessage() *Message {
+	return &Message{
+		MsgType:    MsgServerRestartMT,
+		SenderID:   system,
+		SenderName: system,
+		Content:    "Server is restarting, please reconnect in a moment",
+	}
+}
+
+// NewTopicMessage returns message informing that the topic of the room was changed.
+func NewTopicMessage(room, userName, topic string) *Message {
+	return &Message{
+		MsgType:    MsgSetTopicMT,
+		SenderID:   system,
+		SenderName: userName,
+		Room:       room,
+		Content:    topic,
+	}
+}
+
+// DirectoryMessage returns message with page of rooms directory.
+func DirectoryMessage(page *DirectoryPage) *Message {
+	return &Message{
+		MsgType:    MsgRoomsDirectoryMT,
+		SenderID:   system,
+		SenderName: system,
+		Directory:  page,
+	}
+}
+
+// SearchResultsMessage returns message with messages found by the search request.
+func SearchResultsMessage(page *SearchPage) *Message {
+	return &Message{
+		MsgType:       MsgSearchMT,
+		SenderID:      system,
+		SenderName:    system,
+		SearchResults: page,
+	}
+}
+
+// NewScheduledMessage returns message confirming that the message or reminder with given id
+// will be posted into the room at due time.
+func NewScheduledMessage(id, room, content string, due time.Time) *Message {
+	return &Message{
+		ID:         id,
+		Time:       &due,
+		MsgType:    MsgScheduleMT,
+		SenderID:   system,
+		SenderName: system,
+		Room:       room,
+		Content:    content,
+	}
+}
+
+// PollResultsMessage returns message with current or final results of the poll.
+func PollResultsMessage(results *PollResults) *Message {
+	return &Message{
+		MsgType:     MsgPollResultsMT,
+		SenderID:    system,
+		SenderName:  results.Creator,
+		Room:        results.Room,
+		Content:     results.Question,
+		PollResults: results,
+	}
+}
+
+// NewPinMessage returns message informing that the message was pinned in the room.
+func NewPinMessage(pin *PinnedMessage) *Message {
+	return &Message{
+		ID:         pin.ID,
+		MsgType:    MsgPinMT,
+		SenderID:   system,
+		SenderName: pin.PinnedBy,
+		Room:       pin.Room,
+		Pins:       []*PinnedMessage{pin},
+	}
+}
+
+// NewUnpinMessage returns message informing that the message with given id was unpinned in the room.
+func NewUnpinMessage(room, id, userName string) *Message {
+	return &Message{
+		ID:         id,
+		MsgType:    MsgUnpinMT,
+		SenderID:   system,
+		SenderName: userName,
+		Room:       room,
+	}
+}
+
+// PinnedListMessage returns message with all messages pinned in the room.
+func PinnedListMessage(room string, pins []*PinnedMessage) *Message {
+	return &Message{
+		MsgType:    MsgPinnedListMT,
+		SenderID:   system,
+		SenderName: system,
+		Room:       room,
+		Pins:       pins,
+	}
+}
@@ -0,0 +1,235 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adrian83/chat/pkg/markdown"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxContentLength is a maximal number of characters in the content of text message.
+	MaxContentLength = 10000
+)
+
+// Middleware wraps Handler with additional processing, which can be done before
+// and/or after calling the wrapped Handler. Middleware can also stop processing
+// by returning an error without calling the wrapped Handler.
+type Middleware func(Handler) Handler
+
+// Chain wraps handler with given middlewares. First middleware is the outermost one,
+// so it is invoked first.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// ClientError is an error caused by the message sent by the client. Its description
+// is sent back to the client in the ERROR message.
+type ClientError struct {
+	msg string
+}
+
+// NewClientError returns new ClientError with formatted description.
+func NewClientError(format string, args ...interface{}) error {
+	return &ClientError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *ClientError) Error() string {
+	return e.msg
+}
+
+// AsClientError returns ClientError if given error is (or wraps) one.
+func AsClientError(err error) (*ClientError, bool) {
+	var clientErr *ClientError
+	ok := errors.As(err, &clientErr)
+	return clientErr, ok
+}
+
+// RecoveryMiddleware converts panics raised while handling message into errors.
+func RecoveryMiddleware(next Handler) Handler {
+	return HandlerFunc(func(msg *Message) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic while handling message %v: %v", msg.MsgType, r)
+			}
+		}()
+
+		return next.Handle(msg)
+	})
+}
+
+// LoggingMiddleware logs every handled message together with the time of processing.
+func LoggingMiddleware(next Handler) Handler {
+	return HandlerFunc(func(msg *Message) error {
+		start := time.Now()
+		err := next.Handle(msg)
+
+		logger.Infof("Handled message %v from %v in room '%v' in %v. Error: %v", msg.MsgType, msg.SenderName, msg.Room, time.Since(start), err)
+
+		return err
+	})
+}
+
+// NewRateLimitMiddleware returns middleware which allows to handle at most perSecond messages
+// per second on average with bursts of up to burst messages. Returned middleware keeps its
+// state, so new one has to be created for every client.
+func NewRateLimitMiddleware(perSecond float64, burst int) Middleware {
+	bucket := &tokenBucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg *Message) error {
+			if !bucket.take(time.Now()) {
+				return NewClientError("Too many messages, slow down")
+			}
+			return next.Handle(msg)
+		})
+	}
+}
+
+// tokenBucket is not safe for concurrent use, messages of single client are handled sequentially.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// RateLimiter allows at most perSecond messages per second on average with bursts of up to burst
+// messages for every sender. Unlike NewRateLimitMiddleware it is safe for concurrent use, so it can
+// limit messages which aren't sent by connected clients.
+type RateLimiter struct {
+	perSecond float64
+	burst     int
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+}
+
+// NewRateLimiter returns new RateLimiter.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		perSecond: perSecond,
+		burst:     burst,
+		buckets:   map[string]*tokenBucket{},
+	}
+}
+
+// Allow returns true if sender identified by given key can send another message.
+func (l *RateLimiter) Allow(key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			rate:   l.perSecond,
+			burst:  float64(l.burst),
+			tokens: float64(l.burst),
+			last:   now,
+		}
+		l.buckets[key] = bucket
+	}
+
+	return bucket.take(now)
+}
+
+// ValidateTextMessage rejects text messages without room or content and with too long content.
+func ValidateTextMessage(next Handler) Handler {
+	return HandlerFunc(func(msg *Message) error {
+		if msg.Room == "" {
+			return NewClientError("Room cannot be empty")
+		}
+
+		if msg.Content == "" && len(msg.Attachments) == 0 {
+			return NewClientError("Message cannot be empty")
+		}
+
+		if utf8.RuneCountInString(msg.Content) > MaxContentLength {
+			return NewClientError("Message cannot be longer than %v characters", MaxContentLength)
+		}
+
+		return next.Handle(msg)
+	})
+}
+
+type roomMembership interface {
+	IsMember(roomName, userName string) bool
+}
+
+// NewMembershipMiddleware returns middleware which rejects messages sent
+// to the rooms the sender is not a member of.
+func NewMembershipMiddleware(rooms roomMembership) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg *Message) error {
+			if !rooms.IsMember(msg.Room, msg.SenderName) {
+				return NewClientError("You are not a member of the room %v", msg.Room)
+			}
+			return next.Handle(msg)
+		})
+	}
+}
+
+type attachmentResolver interface {
+	Resolve(room string, ids []string) ([]*Attachment, error)
+}
+
+// NewAttachmentsMiddleware returns middleware which replaces attachments referenced
+// in the message with their data. Messages with unknown attachments are rejected.
+func NewAttachmentsMiddleware(attachments attachmentResolver) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg *Message) error {
+			if len(msg.Attachments) > 0 {
+				resolved, err := attachments.Resolve(msg.Room, msg.AttachmentIDs())
+				if err != nil {
+					return NewClientError("Invalid attachments: %v", err)
+				}
+
+				msg.Attachments = resolved
+			}
+
+			return next.Handle(msg)
+		})
+	}
+}
+
+// RenderMarkdown renders HTML of messages with Markdown format. HTML is always
+// rendered by the server, it cannot be provided by the sender.
+func RenderMarkdown(next Handler) Handler {
+	return HandlerFunc(func(msg *Message) error {
+		msg.HTML = ""
+		if msg.Format == FormatMarkdown {
+			msg.HTML = markdown.Render(msg.Content)
+		}
+
+		return next.Handle(msg)
+	})
+}
@@ -0,0 +1,103 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(msg *Message) error {
+			*calls = append(*calls, name)
+			return next.Handle(msg)
+		})
+	}
+}
+
+func TestRouterShouldApplyGlobalAndTypeMiddlewaresInOrder(t *testing.T) {
+	// given
+	calls := make([]string, 0)
+
+	router := NewRouter()
+	router.RegisterRoute(NewRoute(MsgTextMsgMT, HandlerFunc(func(msg *Message) error {
+		calls = append(calls, "handler")
+		return nil
+	})))
+	router.RegisterRoute(NewRoute(MsgLogoutMT, HandlerFunc(func(msg *Message) error {
+		return nil
+	})))
+
+	router.Use(recordingMiddleware("global1", &calls), recordingMiddleware("global2", &calls))
+	router.UseFor(MsgTextMsgMT, recordingMiddleware("text", &calls))
+
+	// when
+	err1 := router.Handle(&Message{MsgType: MsgTextMsgMT})
+	err2 := router.Handle(&Message{MsgType: MsgLogoutMT})
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Equal(t, []string{"global1", "global2", "text", "handler", "global1", "global2"}, calls)
+}
+
+func TestRouterShouldReturnClientErrorForUnknownMessageType(t *testing.T) {
+	// given
+	calls := make([]string, 0)
+
+	router := NewRouter()
+	router.Use(recordingMiddleware("global", &calls))
+
+	// when
+	err := router.Handle(&Message{MsgType: "UNKNOWN"})
+
+	// then
+	_, ok := AsClientError(err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"global"}, calls)
+}
+
+func TestMiddlewaresShouldStopProcessingInvalidMessages(t *testing.T) {
+	// given
+	handled := false
+	handler := Chain(HandlerFunc(func(msg *Message) error {
+		handled = true
+		return nil
+	}), RecoveryMiddleware, NewRateLimitMiddleware(1, 1), ValidateTextMessage)
+
+	// when
+	err1 := handler.Handle(&Message{MsgType: MsgTextMsgMT, Content: "no room"})
+	err2 := handler.Handle(&Message{MsgType: MsgTextMsgMT, Room: "main", Content: "rate limited"})
+
+	// then
+	assert.Equal(t, "Room cannot be empty", err1.Error())
+	assert.Equal(t, "Too many messages, slow down", err2.Error())
+	assert.False(t, handled)
+}
+
+func TestRenderMarkdownShouldIgnoreHTMLSentByClient(t *testing.T) {
+	// given
+	var handled *Message
+	handler := RenderMarkdown(HandlerFunc(func(msg *Message) error {
+		handled = msg
+		return nil
+	}))
+
+	// when
+	err := handler.Handle(&Message{Content: "*hi*", HTML: "<script></script>"})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "", handled.HTML)
+}
+
+func TestRateLimiterShouldLimitSendersSeparately(t *testing.T) {
+	// given
+	limiter := NewRateLimiter(0, 2)
+
+	// when
+	allowed := []bool{limiter.Allow("ci"), limiter.Allow("ci"), limiter.Allow("ci"), limiter.Allow("alerts")}
+
+	// then
+	assert.Equal(t, []bool{true, true, false, true}, allowed)
+}
@@ -0,0 +1,17 @@
+package exchange
+
+import "time"
+
+// PinnedMessage describes message pinned in the room, so it stays visible to the members of the room.
+type PinnedMessage struct {
+	ID          string        `json:"id"`
+	Room        string        `json:"room"`
+	Sender      string        `json:"sender"`
+	Content     string        `json:"content"`
+	Format      string        `json:"format,omitempty"`
+	HTML        string        `json:"html,omitempty"`
+	Attachments []*Attachment `json:"attachments,omitempty"`
+	Posted      time.Time     `json:"posted"`
+	PinnedBy    string        `json:"pinnedBy"`
+	Pinned      time.Time     `json:"pinned"`
+}
@@ -0,0 +1,43 @@
+package exchange
+
+import "time"
+
+// PollRequest describes poll created by the client. Question of the poll is sent as the content
+// of the message, so it is checked like the content of text messages.
+type PollRequest struct {
+	Options []string `json:"options"`
+	// Multiple is true if voters can choose more than one option.
+	Multiple bool `json:"multiple,omitempty"`
+	// Anonymous is true if names of the voters shouldn't be revealed.
+	Anonymous bool `json:"anonymous,omitempty"`
+	// Closes is a time after which votes are not accepted. Server's default is used if it is empty.
+	Closes *time.Time `json:"closes,omitempty"`
+}
+
+// Vote is sent by the client voting in the poll. Options contains indexes of chosen options.
+// Voting again replaces previous vote of the user.
+type Vote struct {
+	PollID  string `json:"pollId"`
+	Options []int  `json:"options"`
+}
+
+// PollResults describes current or, if the poll is closed, final tally of the poll.
+type PollResults struct {
+	ID        string           `json:"id"`
+	Room      string           `json:"room"`
+	Creator   string           `json:"creator"`
+	Question  string           `json:"question"`
+	Multiple  bool             `json:"multiple"`
+	Anonymous bool             `json:"anonymous"`
+	Closes    time.Time        `json:"closes"`
+	Closed    bool             `json:"closed"`
+	Voters    int              `json:"voters"`
+	Options   []*OptionResults `json:"options"`
+}
+
+// OptionResults describes votes for single option of the poll. Voters are empty in anonymous polls.
+type OptionResults struct {
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
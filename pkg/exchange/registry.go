@@ -0,0 +1,272 @@
+package exchange
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// shardsCount is a number of independently locked parts of rooms and clients registries.
+const shardsCount = 32
+
+func shardIndex(key string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % shardsCount)
+}
+
+// roomRegistry is a lock-striped collection of rooms. Operations on rooms with names
+// falling into different shards don't wait for each other.
+type roomRegistry struct {
+	shards [shardsCount]roomShard
+}
+
+type roomShard struct {
+	lock  sync.RWMutex
+	rooms map[string]*Room
+}
+
+func newRoomRegistry() *roomRegistry {
+	registry := &roomRegistry{}
+	for i := range registry.shards {
+		registry.shards[i].rooms = make(map[string]*Room)
+	}
+	return registry
+}
+
+func (r *roomRegistry) shard(name string) *roomShard {
+	return &r.shards[shardIndex(name)]
+}
+
+// get returns running room with given name or nil if such room doesn't exist.
+func (r *roomRegistry) get(name string) *Room {
+	shard := r.shard(name)
+
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+
+	room, ok := shard.rooms[name]
+	if !ok || !room.Running() {
+		return nil
+	}
+	return room
+}
+
+// add adds the room unless running room with the same name already exists.
+// Returns false if the room wasn't added.
+func (r *roomRegistry) add(room *Room) bool {
+	shard := r.shard(room.Name())
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	if existing, ok := shard.rooms[room.Name()]; ok && existing.Running() {
+		return false
+	}
+
+	shard.rooms[room.Name()] = room
+	return true
+}
+
+// remove removes given room. Room with the same name, which replaced given room, is kept.
+// Returns false if the room wasn't in the registry.
+func (r *roomRegistry) remove(room *Room) bool {
+	shard := r.shard(room.Name())
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	if shard.rooms[room.Name()] != room {
+		return false
+	}
+
+	delete(shard.rooms, room.Name())
+	return true
+}
+
+// running returns running rooms.
+func (r *roomRegistry) running() []*Room {
+	rooms := make([]*Room, 0)
+
+	for _, room := range r.all() {
+		if room.Running() {
+			rooms = append(rooms, room)
+		}
+	}
+
+	return rooms
+}
+
+// all returns all rooms, including the ones which are stopping but aren't removed yet.
+func (r *roomRegistry) all() []*Room {
+	rooms := make([]*Room, 0)
+
+	for i := range r.shards {
+		shard := &r.shards[i]
+
+		shard.lock.RLock()
+		for _, room := range shard.rooms {
+			rooms = append(rooms, room)
+		}
+		shard.lock.RUnlock()
+	}
+
+	return rooms
+}
+
+// clientRegistry is a lock-striped collection of connected clients.
+type clientRegistry struct {
+	shards [shardsCount]clientShard
+}
+
+type clientShard struct {
+	lock    sync.RWMutex
+	clients map[string]*Client
+}
+
+func newClientRegistry() *clientRegistry {
+	registry := &clientRegistry{}
+	for i := range registry.shards {
+		registry.shards[i].clients = make(map[string]*Client)
+	}
+	return registry
+}
+
+func (r *clientRegistry) shard(id string) *clientShard {
+	return &r.shards[shardIndex(id)]
+}
+
+func (r *clientRegistry) get(id string) *Client {
+	shard := r.shard(id)
+
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+
+	return shard.clients[id]
+}
+
+func (r *clientRegistry) add(client *Client) {
+	shard := r.shard(client.ID())
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	shard.clients[client.ID()] = client
+}
+
+func (r *clientRegistry) remove(client *Client) {
+	shard := r.shard(client.ID())
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	if shard.clients[client.ID()] == client {
+		delete(shard.clients, client.ID())
+	}
+}
+
+func (r *clientRegistry) all() []*Client {
+	clients := make([]*Client, 0)
+
+	for i := range r.shards {
+		shard := &r.shards[i]
+
+		shard.lock.RLock()
+		for _, client := range shard.clients {
+			clients = append(clients, client)
+		}
+		shard.lock.RUnlock()
+	}
+
+	return clients
+}
+
+func (r *clientRegistry) len() int {
+	var count int
+
+	for i := range r.shards {
+		shard := &r.shards[i]
+
+		shard.lock.RLock()
+		count += len(shard.clients)
+		shard.lock.RUnlock()
+	}
+
+	return count
+}
+
+// membershipRegistry counts clients of every user in every room, so the number of rooms
+// joined by the user can be limited, no matter through how many connections the user joined them.
+type membershipRegistry struct {
+	shards [shardsCount]membershipShard
+}
+
+type membershipShard struct {
+	lock  sync.Mutex
+	users map[string]map[string]int
+}
+
+func newMembershipRegistry() *membershipRegistry {
+	registry := &membershipRegistry{}
+	for i := range registry.shards {
+		registry.shards[i].users = make(map[string]map[string]int)
+	}
+	return registry
+}
+
+// reserve counts client of the user in the room. Returns false if the user isn't a member
+// of the room yet and already is a member of max rooms. Zero max means no limit.
+func (r *membershipRegistry) reserve(userName, roomName string, max int) bool {
+	shard := &r.shards[shardIndex(userName)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	rooms, ok := shard.users[userName]
+	if !ok {
+		rooms = make(map[string]int)
+		shard.users[userName] = rooms
+	}
+
+	if _, member := rooms[roomName]; !member && max > 0 && len(rooms) >= max {
+		return false
+	}
+
+	rooms[roomName]++
+	return true
+}
+
+// release stops counting client of the user in the room.
+func (r *membershipRegistry) release(userName, roomName string) {
+	shard := &r.shards[shardIndex(userName)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	rooms, ok := shard.users[userName]
+	if !ok {
+		return
+	}
+
+	rooms[roomName]--
+	if rooms[roomName] <= 0 {
+		delete(rooms, roomName)
+	}
+
+	if len(rooms) == 0 {
+		delete(shard.users, userName)
+	}
+}
+
+// rooms returns names of the rooms the user is a member of.
+func (r *membershipRegistry) rooms(userName string) map[string]bool {
+	shard := &r.shards[shardIndex(userName)]
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	names := make(map[string]bool, len(shard.users[userName]))
+	for name := range shard.users[userName] {
+		names[name] = true
+	}
+	return names
+}
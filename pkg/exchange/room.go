@@ -1,7 +1,10 @@
 package exchange
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
 
 	logger "github.com/sirupsen/logrus"
 )
@@ -11,59 +14,104 @@ const (
 	main = "main"
 )
 
+// ErrRoomStopped is returned when operation is requested on the room which is stopping or stopped.
+var ErrRoomStopped = errors.New("room is stopped")
+
+// roomState describes stage of the room's lifecycle. Room can only move forward
+// through the states: running -> stopping -> stopped.
+type roomState int32
+
+const (
+	// roomRunning means that the room processes requests.
+	roomRunning roomState = iota
+	// roomStopping means that the room doesn't accept requests, but its goroutine may still run.
+	roomStopping
+	// roomStopped means that the room's goroutine finished.
+	roomStopped
+)
+
 // MainRoomName returns name of the main room.
 func MainRoomName() string {
 	return main
 }
 
-// NewRoom functions returns new Room struct.
-func NewRoom(name string, rooms *Rooms) *Room {
+// NewRoom functions returns new Room struct. Owner is the name of the user who created the room.
+// Room stops when Stop is called or given context is done.
+func NewRoom(ctx context.Context, name, owner string) *Room {
+	ctx, cancel := context.WithCancel(ctx)
+
 	return &Room{
+		lastActivity:     time.Now().UnixNano(),
 		name:             name,
+		owner:            owner,
 		clients:          map[string]*Client{},
-		rooms:            rooms,
-		clientExists:     make(chan clientExist, 5),
-		removeClientChan: make(chan string, 5),
-		addClientChan:    make(chan *Client, 5),
+		users:            map[string]int{},
+		queries:          make(chan func(), 5),
 		incomingMessages: make(chan *Message, 50),
-		interrupt:        make(chan bool, 5),
+		ctx:              ctx,
+		cancel:           cancel,
+		stopped:          make(chan struct{}),
 	}
 }
 
 // NewMainRoom returns new unremovable Room struct with name 'main'.
-func NewMainRoom(rooms *Rooms) *Room {
-	return NewRoom(main, rooms)
+func NewMainRoom(ctx context.Context) *Room {
+	return NewRoom(ctx, main, "")
 }
 
-// Room represents chat room.
+// Room represents chat room. Clients of the room are accessed only by the room's goroutine.
 type Room struct {
+	// lastActivity is accessed atomically, so it is the first field to be 64-bit aligned
+	lastActivity     int64
 	name             string
+	owner            string
+	topic            atomic.Value
 	clients          map[string]*Client
-	rooms            *Rooms
-	removeClientChan chan string
-	addClientChan    chan *Client
-	clientExists     chan clientExist
+	users            map[string]int
+	usersCount       int32
+	queries          chan func()
 	incomingMessages chan *Message
-	interrupt        chan bool
+	maxMembers       int
+	status           int32
+	ctx              context.Context
+	cancel           context.CancelFunc
+	stopped          chan struct{}
 }
 
 // FindClient returns client with given id if it exist in this room.
 func (ch *Room) FindClient(clientID string) (*Client, error) {
-	clientChan := make(chan *Client, 1)
+	var client *Client
 
-	ch.clientExists <- clientExist{
-		existChan: clientChan,
-		clientID:  clientID,
+	err := ch.query(func() {
+		client = ch.clients[clientID]
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	client := <-clientChan
 	if client == nil {
-		return nil, fmt.Errorf("client with id %v cannot be found", clientID)
+		return nil, ErrClientNotFound
 	}
 
 	return client, nil
 }
 
+// HasUser returns true if at least one client of user with given name is in this room.
+func (ch *Room) HasUser(userName string) bool {
+	var exists bool
+
+	ch.query(func() {
+		for _, client := range ch.clients {
+			if client.Name() == userName {
+				exists = true
+				return
+			}
+		}
+	})
+
+	return exists
+}
+
 // Main returns true if this room is a main room.
 func (ch *Room) Main() bool {
 	return ch.name == main
@@ -74,63 +122,224 @@ func (ch *Room) Name() string {
 	return ch.name
 }
 
-// SendToEveryone sends message to everyone in this room.
-func (ch *Room) SendToEveryone(msg *Message) {
-	ch.incomingMessages <- msg
+// Members returns names of users who are members of this room.
+func (ch *Room) Members() []string {
+	names := make([]string, 0)
+
+	ch.query(func() {
+		for name := range ch.users {
+			names = append(names, name)
+		}
+	})
+
+	return names
+}
+
+// MembersCount returns number of users who are members of this room. It doesn't wait for the room's goroutine.
+func (ch *Room) MembersCount() int {
+	return int(atomic.LoadInt32(&ch.usersCount))
+}
+
+// Topic returns topic of the room.
+func (ch *Room) Topic() string {
+	topic, _ := ch.topic.Load().(string)
+	return topic
 }
 
-// AddClient adds client to this room.
-func (ch *Room) AddClient(client *Client) {
-	if ch == nil {
-		logger.Infof("cannot add client: %v to channel, channel doesn't exist", client.ID())
-		return
+// SetTopic sets topic of the room.
+func (ch *Room) SetTopic(topic string) {
+	ch.topic.Store(topic)
+}
+
+// LastActivity returns time when the last text message was sent to the room or time
+// of creation of the room if no message was sent.
+func (ch *Room) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ch.lastActivity)).UTC()
+}
+
+// Clients returns all clients which are members of this room.
+func (ch *Room) Clients() []*Client {
+	clients := make([]*Client, 0)
+
+	ch.query(func() {
+		for _, client := range ch.clients {
+			clients = append(clients, client)
+		}
+	})
+
+	return clients
+}
+
+// query runs given function in the room's goroutine and waits until it finishes.
+// ErrRoomStopped is returned if the room stopped before the function was run.
+func (ch *Room) query(f func()) error {
+	if ch.state() != roomRunning {
+		return ErrRoomStopped
 	}
-	ch.addClientChan <- client
+
+	done := make(chan struct{})
+
+	select {
+	case ch.queries <- func() {
+		defer close(done)
+		f()
+	}:
+	case <-ch.ctx.Done():
+		return ErrRoomStopped
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ch.stopped:
+		// the function might have been run just before the goroutine finished
+		select {
+		case <-done:
+			return nil
+		default:
+			return ErrRoomStopped
+		}
+	}
+}
+
+// Stop stops processing messages by this room. It doesn't wait until the room's
+// goroutine finishes, use Done for that. It is safe to call it multiple times.
+func (ch *Room) Stop() {
+	ch.setState(roomRunning, roomStopping)
+	ch.cancel()
+}
+
+// Done returns channel which is closed when the room's goroutine finishes.
+func (ch *Room) Done() <-chan struct{} {
+	return ch.stopped
 }
 
-// RemoveClient removes client from this room.
-func (ch *Room) RemoveClient(clientID string) {
-	if ch == nil {
-		logger.Infof("cannot remove client: %v from channel, channel doesn't exist", clientID)
-		return
+// Running returns true if the room processes requests.
+func (ch *Room) Running() bool {
+	return ch.state() == roomRunning
+}
+
+func (ch *Room) state() roomState {
+	return roomState(atomic.LoadInt32(&ch.status))
+}
+
+func (ch *Room) setState(from, to roomState) bool {
+	return atomic.CompareAndSwapInt32(&ch.status, int32(from), int32(to))
+}
+
+// Owner returns name of the user who created the room or empty string for the main room.
+func (ch *Room) Owner() string {
+	return ch.owner
+}
+
+// SendToEveryone sends message to everyone in this room. Message isn't sent if the room is stopped.
+func (ch *Room) SendToEveryone(msg *Message) error {
+	if ch.state() != roomRunning {
+		return ErrRoomStopped
+	}
+
+	select {
+	case ch.incomingMessages <- msg:
+		return nil
+	case <-ch.ctx.Done():
+		return ErrRoomStopped
+	}
+}
+
+// AddClient adds client to this room. ErrRoomFull is returned if the room has maximal number of members.
+func (ch *Room) AddClient(client *Client) error {
+	var err error
+
+	queryErr := ch.query(func() {
+		_, member := ch.clients[client.ID()]
+		if !member && ch.maxMembers > 0 && len(ch.clients) >= ch.maxMembers {
+			err = ErrRoomFull
+			return
+		}
+
+		if !member {
+			ch.users[client.Name()]++
+			atomic.StoreInt32(&ch.usersCount, int32(len(ch.users)))
+		}
+
+		ch.clients[client.ID()] = client
+	})
+	if queryErr != nil {
+		return queryErr
+	}
+
+	return err
+}
+
+// RemoveClient removes client from this room and returns number of clients left in the room.
+// Room, other than the main room, which becomes empty stops itself, so no client can join it
+// before it is removed. ErrClientNotFound is returned if the client isn't a member of this room.
+func (ch *Room) RemoveClient(clientID string) (int, error) {
+	var left int
+	var member bool
+
+	err := ch.query(func() {
+		var client *Client
+		client, member = ch.clients[clientID]
+
+		if member {
+			ch.users[client.Name()]--
+			if ch.users[client.Name()] <= 0 {
+				delete(ch.users, client.Name())
+			}
+			atomic.StoreInt32(&ch.usersCount, int32(len(ch.users)))
+		}
+
+		delete(ch.clients, clientID)
+		left = len(ch.clients)
+
+		if member && left == 0 && !ch.Main() {
+			logger.Infof("Room: '%v' is empty. Stopping.", ch.name)
+			ch.Stop()
+		}
+	})
+	if err != nil {
+		return 0, err
 	}
-	ch.removeClientChan <- clientID
+
+	if !member {
+		return left, ErrClientNotFound
+	}
+
+	return left, nil
 }
 
 // Start starts room. After invoking this method room can process sent messages.
 func (ch *Room) Start() {
 	go func() {
+		defer func() {
+			atomic.StoreInt32(&ch.status, int32(roomStopped))
+			close(ch.stopped)
+			logger.Infof("Room: '%v' stopped", ch.name)
+		}()
+
 		for {
 			select {
-			case <-ch.interrupt:
+			case <-ch.ctx.Done():
+				ch.setState(roomRunning, roomStopping)
 				return
 
-			case clientID := <-ch.removeClientChan:
-				delete(ch.clients, clientID)
-
-				if len(ch.clients) == 0 {
-					logger.Infof("Room: '%v' is empty. Should be removed.", ch.Name())
-					ch.rooms.RemoveRoom(ch.Name())
-					ch.interrupt <- true
+			case msg := <-ch.incomingMessages:
+				if msg.MsgType == MsgTextMsgMT {
+					atomic.StoreInt64(&ch.lastActivity, time.Now().UnixNano())
 				}
 
-			case client := <-ch.addClientChan:
-				ch.clients[client.ID()] = client
+				// message is encoded once for all members of the room
+				frame := NewFrame(msg)
 
-			case msg := <-ch.incomingMessages:
 				for _, client := range ch.clients {
 					logger.Infof("Sending msg to %v from room '%v'.", client, ch.name)
-					client.Send(msg)
+					client.SendFrame(frame)
 				}
 
-			case c := <-ch.clientExists:
-				c.existChan <- ch.clients[c.clientID]
+			case query := <-ch.queries:
+				query()
 			}
 		}
 	}()
 }
-
-type clientExist struct {
-	existChan chan *Client
-	clientID  string
-}
@@ -0,0 +1,77 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoomShouldRejectRequestsWhenStopped(t *testing.T) {
+	// given
+	room := NewRoom(context.Background(), "ops", "john")
+	room.Start()
+
+	client := NewClient("john-session", &testUser{name: "john"}, NewRooms(), NewChannelConn(10), NewRouter())
+	assert.NoError(t, room.AddClient(client))
+
+	// when
+	room.Stop()
+	room.Stop()
+	<-room.Done()
+
+	// then
+	assert.False(t, room.Running())
+	assert.Equal(t, ErrRoomStopped, room.AddClient(client))
+	assert.Equal(t, ErrRoomStopped, room.SendToEveryone(&Message{}))
+	_, removeErr := room.RemoveClient(client.ID())
+	assert.Equal(t, ErrRoomStopped, removeErr)
+	_, findErr := room.FindClient(client.ID())
+	assert.Equal(t, ErrRoomStopped, findErr)
+	assert.Empty(t, room.Members())
+}
+
+func TestRoomShouldStopWhenContextIsDone(t *testing.T) {
+	// given
+	ctx, cancel := context.WithCancel(context.Background())
+
+	room := NewRoom(ctx, "ops", "john")
+	room.Start()
+
+	// when
+	cancel()
+
+	// then
+	select {
+	case <-room.Done():
+	case <-time.After(time.Second):
+		t.Fatal("room didn't stop")
+	}
+	assert.False(t, room.Running())
+}
+
+func TestRoomShouldReportClientsLeftAfterRemoval(t *testing.T) {
+	// given
+	room := NewRoom(context.Background(), "ops", "john")
+	room.Start()
+	defer room.Stop()
+
+	rooms := NewRooms()
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+	jane := NewClient("jane-session", &testUser{name: "jane"}, rooms, NewChannelConn(10), NewRouter())
+
+	assert.NoError(t, room.AddClient(john))
+	assert.NoError(t, room.AddClient(jane))
+
+	// when
+	left, err := room.RemoveClient(john.ID())
+	_, missingErr := room.RemoveClient(john.ID())
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, left)
+	assert.Equal(t, ErrClientNotFound, missingErr)
+	assert.True(t, room.HasUser("jane"))
+	assert.False(t, room.HasUser("john"))
+}
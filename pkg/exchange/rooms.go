@@ -1,151 +1,237 @@
 package exchange
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	logger "github.com/sirupsen/logrus"
 )
 
+const (
+	// shutdownPollInterval is a time between checks if all clients disconnected during shutdown.
+	shutdownPollInterval = 50 * time.Millisecond
+	// maxTopicLength is a maximal number of characters in the topic of the room.
+	maxTopicLength = 250
+)
+
 var (
 	roomNameRegexp = `^[a-zA-Z0-9_.-]*$`
 	validRoomName  = regexp.MustCompile(roomNameRegexp)
+
+	// ErrRoomNotFound is returned when room with given name doesn't exist.
+	ErrRoomNotFound = errors.New("room doesn't exist")
+	// ErrRoomExists is returned when room with given name already exists.
+	ErrRoomExists = errors.New("room already exists")
+	// ErrInvalidRoomName is returned when room name is empty or contains forbidden characters.
+	ErrInvalidRoomName = errors.New("invalid room name")
+	// ErrMainRoom is returned when main room should be removed.
+	ErrMainRoom = errors.New("main room cannot be removed")
+	// ErrClientNotFound is returned when client with given id isn't connected.
+	ErrClientNotFound = errors.New("client isn't connected")
+	// ErrRoomsStopped is returned when request is sent after Rooms were stopped.
+	ErrRoomsStopped = errors.New("rooms are stopped")
+	// ErrNotRoomOwner is returned when user who isn't the owner of the room tries to change it.
+	ErrNotRoomOwner = errors.New("only the owner can change the room")
+	// ErrRoomOwned is returned when user tries to create room with the name which belongs to another user.
+	ErrRoomOwned = errors.New("room name belongs to another user")
+	// ErrInvalidTopic is returned when topic of the room is too long.
+	ErrInvalidTopic = fmt.Errorf("topic cannot be longer than %v characters", maxTopicLength)
 )
 
-// NewRooms returns new Rooms struct.
-func NewRooms() *Rooms {
-	ch := make(map[string]*Room)
-
-	roomsListRequests := make(chan *Client, 50)
-	removeClient := make(chan *Client, 50)
-	addClientToRoomRequest := make(chan clientAndRoom, 50)
-	removeClientFromRoomRequest := make(chan clientAndRoom, 50)
-	createRoomRequest := make(chan clientAndRoom, 50)
-	messageRequest := make(chan *Message, 50)
-	removeRoomRequests := make(chan string, 50)
-
-	rooms := Rooms{
-		rooms:                       ch,
-		roomsListRequests:           roomsListRequests,
-		addClientToRoomRequest:      addClientToRoomRequest,
-		removeClientFromRoomRequest: removeClientFromRoomRequest,
-		createRoomRequest:           createRoomRequest,
-		messageRequest:              messageRequest,
-		removeRoomRequests:          removeRoomRequests,
-		removeClient:                removeClient,
-	}
-	mainRoom := NewMainRoom(&rooms)
+// NewRooms returns new Rooms struct. Given listeners are notified about events in all rooms.
+// Rooms process requests until Stop is called.
+func NewRooms(listeners ...Listener) *Rooms {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mainRoom := NewMainRoom(ctx)
 	mainRoom.Start()
-	ch[mainRoom.Name()] = mainRoom
 
-	go rooms.start()
+	rooms := &Rooms{
+		rooms:       newRoomRegistry(),
+		clients:     newClientRegistry(),
+		memberships: newMembershipRegistry(),
+		main:        mainRoom,
+		listeners:   listeners,
+		ctx:         ctx,
+		cancel:      cancel,
+		stopped:     make(chan struct{}),
+	}
+	rooms.rooms.add(mainRoom)
 
-	return &rooms
+	return rooms
 }
 
-type clientAndRoom struct {
-	client *Client
-	room   string
+// Rooms struct represents collections of all rooms. Every room runs in its own goroutine
+// and rooms are kept in lock-striped registry, so requests concerning different rooms
+// don't wait for each other. Requests concerning single client are serialized by the client.
+type Rooms struct {
+	// roomsCount is accessed atomically, so it is the first field to be 64-bit aligned
+	roomsCount  int64
+	rooms       *roomRegistry
+	clients     *clientRegistry
+	memberships *membershipRegistry
+	main        *Room
+	limits      Limits
+	owners      Owners
+	joined      Memberships
+	drops       DropCounter
+	listeners   []Listener
+	welcomers   []Welcomer
+	ctx         context.Context
+	cancel      context.CancelFunc
+	stopOnce    sync.Once
+	stopped     chan struct{}
 }
 
-type RoomsMap map[string]*Room
+// SetLimits sets limits of rooms and their members. It should be called before Rooms are used.
+func (ch *Rooms) SetLimits(limits Limits) {
+	ch.limits = limits
+}
 
-func (r RoomsMap) names() []string {
-	names := make([]string, 0)
-	for name := range r {
-		names = append(names, name)
-	}
-	return names
+// Owners keeps owners of the rooms. Room names belong to users who created them first, so the rooms
+// keep their owners (and everything configured by the owners) after they were removed because their
+// last member left or the server was restarted.
+type Owners interface {
+	// Claim makes user with given name the owner of the room with given name unless the room
+	// already has an owner. Returns the owner of the room.
+	Claim(roomName, userName string) (string, error)
+	// Owner returns the owner of the room with given name and false if the room has no owner.
+	Owner(roomName string) (string, bool)
 }
 
-// Rooms struct represents collections of all rooms.
-type Rooms struct {
-	rooms                       RoomsMap
-	roomsListRequests           chan *Client
-	removeClient                chan *Client
-	removeRoomRequests          chan string
-	addClientToRoomRequest      chan clientAndRoom
-	removeClientFromRoomRequest chan clientAndRoom
-	createRoomRequest           chan clientAndRoom
-	messageRequest              chan *Message
+// SetOwners sets persistent owners of the rooms. Without them the owners are forgotten when
+// the rooms are removed. It should be called before Rooms are used.
+func (ch *Rooms) SetOwners(owners Owners) {
+	ch.owners = owners
 }
 
-func (ch *Rooms) start() {
-	logger.Info("Starting Rooms")
+// DropCounter counts messages which weren't delivered by reason of the drop.
+type DropCounter interface {
+	Dropped(reason string)
+}
 
-	for {
-		select {
-		case client := <-ch.roomsListRequests:
-			rooms := ch.clientRooms(client.ID())
-			msg := RoomsNamesMessage(rooms)
-			client.Send(msg)
+// SetDropCounter sets counter of messages which weren't sent to the clients.
+// It should be called before Rooms are used.
+func (ch *Rooms) SetDropCounter(counter DropCounter) {
+	ch.drops = counter
+}
 
-		case cac := <-ch.addClientToRoomRequest:
-			roomS := ch.rooms[cac.room]
-			roomS.AddClient(cac.client)
+func (ch *Rooms) dropped(reason string) {
+	if ch.drops != nil {
+		ch.drops.Dropped(reason)
+	}
+}
 
-			names := ch.rooms.names()
-			roomNamesMsg := RoomsNamesMessage(names)
-			cac.client.Send(roomNamesMsg)
+// Welcomer returns messages sent to the client which joined the room. It lets the client
+// know the state of the room which isn't a part of the room's history.
+type Welcomer interface {
+	Welcome(roomName string) []*Message
+}
 
-			ujc := NewUserJoinedRoomMessage(cac.room, cac.client.ID())
-			cac.client.Send(ujc)
+// AddWelcomer adds welcomer asked for messages whenever a client joins the room.
+// It should be called before Rooms are used.
+func (ch *Rooms) AddWelcomer(welcomer Welcomer) {
+	ch.welcomers = append(ch.welcomers, welcomer)
+}
 
-		case roomName := <-ch.removeRoomRequests:
+func (ch *Rooms) emit(event *Event) {
+	for _, listener := range ch.listeners {
+		listener.OnEvent(event)
+	}
+}
 
-			if roomName == MainRoomName() {
-				logger.Info("Cannot remove 'main' room")
-				continue
-			}
+// running returns false and logs dropped request if Rooms are stopped.
+func (ch *Rooms) running(request string) bool {
+	if ch.ctx.Err() != nil {
+		logger.Infof("Rooms stopped, request '%v' dropped", request)
+		return false
+	}
+	return true
+}
 
-			delete(ch.rooms, roomName)
-			msg := NewRemoveRoomMessage(roomName)
-			ch.sendToEveryone(MainRoomName(), msg)
+// Ping checks if the main room processes requests before the context is done.
+func (ch *Rooms) Ping(ctx context.Context) error {
+	if ch.ctx.Err() != nil {
+		return ErrRoomsStopped
+	}
 
-		case cac := <-ch.removeClientFromRoomRequest:
-			logger.Infof("Remove client '%v' from room '%v'", cac.client, cac.room)
+	done := make(chan error, 1)
+	go func() {
+		done <- ch.main.query(func() {})
+	}()
 
-			room := ch.rooms[cac.room]
-			room.RemoveClient(cac.client.ID())
-			ujc := NewUserLeftRoomMessage(cac.room, cac.client.ID())
-			cac.client.Send(ujc)
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("rooms don't process requests, error: %w", ctx.Err())
+	}
+}
 
-		case cac := <-ch.createRoomRequest:
-			logger.Infof("Create room request from %v. Room name: %v", cac.client, cac.room)
+// Shutdown waits until all clients disconnect. Clients are disconnected when the context
+// passed to their Start method is done. Clients which are still connected when given
+// context is done are disconnected forcibly.
+func (ch *Rooms) Shutdown(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
 
-			if !ch.roomNameValid(cac.room) {
-				cac.client.Send(ErrorMessage("Invalid room name"))
-				continue
-			}
+	for {
+		if ch.clients.len() == 0 {
+			logger.Info("All clients disconnected")
+			return nil
+		}
 
-			if _, exists := ch.rooms[cac.room]; exists {
-				logger.Infof("Room %v already exists. Client %v cannot create it", cac.room, cac.client)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ch.disconnectAll()
+		}
+	}
+}
 
-				continue
-			}
+// disconnectAll closes connections of all clients.
+func (ch *Rooms) disconnectAll() error {
+	remaining := ch.clients.all()
+
+	for _, client := range remaining {
+		client.Disconnect()
+	}
+
+	return fmt.Errorf("%v clients not disconnected before deadline", len(remaining))
+}
 
-			// create new room with given name
-			newRoom := NewRoom(cac.room, ch)
-			newRoom.Start()
-			newRoom.AddClient(cac.client)
-			// add room to rooms' collection
-			ch.rooms[cac.room] = newRoom
+// Stop stops all rooms. Requests sent later are dropped. It doesn't wait until goroutines
+// of the rooms finish, use Done for that. It is safe to call it multiple times.
+func (ch *Rooms) Stop() {
+	ch.stopOnce.Do(func() {
+		logger.Info("Stopping Rooms")
 
-			ncm := NewCreateRoomMessage(cac.room)
-			ch.sendToEveryone(MainRoomName(), ncm)
+		ch.cancel()
+		rooms := ch.rooms.all()
 
-			ujc := NewUserJoinedRoomMessage(cac.room, cac.client.ID())
-			cac.client.Send(ujc)
+		go func() {
+			defer close(ch.stopped)
 
-		case client := <-ch.removeClient:
-			for _, room := range ch.rooms {
-				room.RemoveClient(client.ID())
+			for _, room := range rooms {
+				<-room.Done()
 			}
 
-		case msg := <-ch.messageRequest:
-			logger.Infof("Send message: %v", msg)
-			ch.sendToEveryone(msg.Room, msg)
-		}
-	}
+			logger.Info("Rooms stopped")
+		}()
+	})
+}
+
+// Done returns channel which is closed when Rooms are stopped and goroutines of all rooms finished.
+func (ch *Rooms) Done() <-chan struct{} {
+	return ch.stopped
 }
 
 func (ch *Rooms) roomNameValid(name string) bool {
@@ -156,72 +242,602 @@ func (ch *Rooms) roomNameValid(name string) bool {
 
 	if !validRoomName.MatchString(name) {
 		logger.Infof("invalid room name, name must match %v", roomNameRegexp)
+		return false
 	}
 
 	return true
 }
 
-func (ch *Rooms) sendToEveryone(roomName string, msg *Message) {
-	if room, ok := ch.rooms[roomName]; ok {
-		logger.Infof("Send to room: %v", room.Name())
-		room.SendToEveryone(msg)
-	} else {
-		logger.Infof("Cannot send message because the room %v doesn't exist", msg.Room)
+// sendToEveryone sends message to all clients of the room and returns true if the room accepted it.
+func (ch *Rooms) sendToEveryone(roomName string, msg *Message) bool {
+	room := ch.rooms.get(roomName)
+	if room == nil {
+		logger.Infof("Cannot send message because the room %v doesn't exist", roomName)
+		return false
+	}
+
+	logger.Infof("Send to room: %v", room.Name())
+
+	if err := room.SendToEveryone(msg); err != nil {
+		logger.Infof("Cannot send message to the room %v. Error: %v", roomName, err)
+		return false
 	}
+
+	return true
 }
 
-func (ch *Rooms) clientRooms(id string) []string {
-	rooms := make([]string, 0)
-	for _, room := range ch.rooms {
-		_, err := room.FindClient(id)
-		if err == nil {
-			rooms = append(rooms, room.Name())
+// newRoom creates and starts room with given name unless such room already exists,
+// its name belongs to another user or there are too many rooms. The name is claimed only
+// after the room is registered, so rejected rooms don't claim names.
+func (ch *Rooms) newRoom(roomName, owner string) (*Room, error) {
+	if ch.owners != nil {
+		if claimed, ok := ch.owners.Owner(roomName); ok && claimed != owner {
+			return nil, ErrRoomOwned
 		}
 	}
-	return rooms
+
+	// main room isn't counted
+	count := atomic.AddInt64(&ch.roomsCount, 1)
+	if ch.limits.MaxRooms > 0 && count > int64(ch.limits.MaxRooms) {
+		atomic.AddInt64(&ch.roomsCount, -1)
+		return nil, ErrTooManyRooms
+	}
+
+	newRoom := NewRoom(ch.ctx, roomName, owner)
+	newRoom.maxMembers = ch.limits.MaxRoomMembers
+	newRoom.Start()
+
+	if !ch.rooms.add(newRoom) {
+		newRoom.Stop()
+		atomic.AddInt64(&ch.roomsCount, -1)
+		return nil, ErrRoomExists
+	}
+
+	if ch.owners != nil {
+		claimed, err := ch.owners.Claim(roomName, owner)
+		if err != nil {
+			ch.unregisterRoom(newRoom)
+			return nil, fmt.Errorf("cannot claim room %v, error: %w", roomName, err)
+		}
+
+		if claimed != owner {
+			ch.unregisterRoom(newRoom)
+			return nil, ErrRoomOwned
+		}
+	}
+
+	return newRoom, nil
+}
+
+// unregisterRoom stops the room and removes it from the registry. Returns false if the room
+// was already removed.
+func (ch *Rooms) unregisterRoom(room *Room) bool {
+	room.Stop()
+
+	if !ch.rooms.remove(room) {
+		return false
+	}
+
+	atomic.AddInt64(&ch.roomsCount, -1)
+	return true
+}
+
+// join adds the client to the room. Client's membership changes are serialized, so the client
+// which is being removed from all rooms cannot join another one.
+func (ch *Rooms) join(client *Client, room *Room) error {
+	client.joinedLock.Lock()
+	defer client.joinedLock.Unlock()
+
+	if client.stopped() {
+		return ErrClientNotFound
+	}
+
+	if joined, ok := client.joined[room.Name()]; ok {
+		if joined == room {
+			return nil
+		}
+		// client was a member of removed room with the same name
+		ch.forgetLocked(client, room.Name())
+	}
+
+	if !room.Main() && !ch.memberships.reserve(client.Name(), room.Name(), ch.limits.MaxRoomsPerUser) {
+		return ErrTooManyJoinedRooms
+	}
+
+	if err := room.AddClient(client); err != nil {
+		if !room.Main() {
+			ch.memberships.release(client.Name(), room.Name())
+		}
+		return err
+	}
+
+	client.joined[room.Name()] = room
+	ch.clients.add(client)
+
+	return nil
+}
+
+// forgetLocked removes the room from the rooms joined by the client and returns the room.
+// Client's joinedLock has to be held.
+func (ch *Rooms) forgetLocked(client *Client, roomName string) (*Room, bool) {
+	room, ok := client.joined[roomName]
+	if !ok {
+		return nil, false
+	}
+
+	delete(client.joined, roomName)
+
+	if !room.Main() {
+		ch.memberships.release(client.Name(), roomName)
+	}
+
+	return room, true
+}
+
+// forget removes removed room from the rooms joined by the client.
+func (ch *Rooms) forget(client *Client, room *Room) {
+	client.joinedLock.Lock()
+	defer client.joinedLock.Unlock()
+
+	if client.joined[room.Name()] == room {
+		ch.forgetLocked(client, room.Name())
+	}
+}
+
+// leave removes the client from the room with given name and returns true if the client
+// was its member. Room which became empty is removed.
+func (ch *Rooms) leave(client *Client, roomName string) bool {
+	client.joinedLock.Lock()
+	defer client.joinedLock.Unlock()
+
+	return ch.leaveLocked(client, roomName)
+}
+
+func (ch *Rooms) leaveLocked(client *Client, roomName string) bool {
+	room, ok := ch.forgetLocked(client, roomName)
+	if !ok {
+		return false
+	}
+
+	left, err := room.RemoveClient(client.ID())
+	if err != nil {
+		return false
+	}
+
+	ch.emit(newEvent(EventUserLeft, roomName, client.Name()))
+
+	if left == 0 && !room.Main() {
+		ch.removeRoom(room)
+	}
+
+	return true
 }
 
-// CreateRoom creates new request for creating new room.
+// removeRoom removes stopped room from the registry. Everyone is informed that the room no longer exists.
+func (ch *Rooms) removeRoom(room *Room) {
+	if !ch.unregisterRoom(room) {
+		return
+	}
+
+	ch.sendToEveryone(MainRoomName(), NewRemoveRoomMessage(room.Name()))
+	ch.emit(newEvent(EventRoomRemoved, room.Name(), ""))
+}
+
+// CreateRoom creates new room with given name and adds given client to it.
 func (ch *Rooms) CreateRoom(roomName string, client *Client) {
-	ch.createRoomRequest <- clientAndRoom{
-		client: client,
-		room:   roomName,
+	if !ch.running("create room") {
+		return
+	}
+
+	logger.Infof("Create room request from %v. Room name: %v", client, roomName)
+
+	if !ch.roomNameValid(roomName) {
+		client.Send(ErrorMessage("Invalid room name"))
+		return
+	}
+
+	newRoom, err := ch.newRoom(roomName, client.Name())
+	if err == ErrRoomExists {
+		logger.Infof("Room %v already exists. Client %v cannot create it", roomName, client)
+		return
+	} else if err == ErrRoomOwned {
+		logger.Infof("Room %v belongs to another user. Client %v cannot create it", roomName, client)
+		client.Send(ErrorMessage("Room name belongs to another user"))
+		return
+	} else if err != nil {
+		logger.Infof("Client %v cannot create room %v. Error: %v", client, roomName, err)
+		client.Send(ErrorMessage(limitedErrorMessage(err)))
+		return
+	}
+
+	if err := ch.join(client, newRoom); err != nil {
+		logger.Infof("Client %v cannot join new room %v. Error: %v", client, roomName, err)
+		ch.unregisterRoom(newRoom)
+		client.Send(ErrorMessage(limitedErrorMessage(err)))
+		return
 	}
+
+	ch.sendToEveryone(MainRoomName(), NewCreateRoomMessage(roomName))
+	client.Send(NewUserJoinedRoomMessage(roomName, client.ID()))
+
+	ch.emit(newEvent(EventRoomCreated, roomName, client.Name()))
 }
 
 // RemoveClient removes client from all rooms.
 func (ch *Rooms) RemoveClient(client *Client) {
 	logger.Infof("Removing Client %v from all rooms", client)
-	ch.removeClient <- client
+
+	client.joinedLock.Lock()
+	defer client.joinedLock.Unlock()
+
+	ch.clients.remove(client)
+
+	for roomName := range client.joined {
+		ch.leaveLocked(client, roomName)
+	}
 }
 
 // RemoveRoom removes room with given name.
 func (ch *Rooms) RemoveRoom(roomName string) {
-	ch.removeRoomRequests <- roomName
+	if roomName == MainRoomName() {
+		logger.Info("Cannot remove 'main' room")
+		return
+	}
+
+	if room := ch.rooms.get(roomName); room != nil {
+		ch.removeRoom(room)
+	}
 }
 
-// ClientsRooms will return list of rooms to given client.
+// ClientsRooms sends list of rooms the client is a member of to given client.
 func (ch *Rooms) ClientsRooms(client *Client) {
-	ch.roomsListRequests <- client
+	if !ch.running("rooms list") {
+		return
+	}
+
+	client.Send(RoomsNamesMessage(client.joinedRooms()))
 }
 
 // AddClientToRoom adds given client to room with given name.
 func (ch *Rooms) AddClientToRoom(roomName string, client *Client) {
-	ch.addClientToRoomRequest <- clientAndRoom{
-		client: client,
-		room:   roomName,
+	if !ch.running("add client to room") {
+		return
+	}
+
+	room := ch.rooms.get(roomName)
+	if room == nil {
+		logger.Infof("Client %v cannot join room %v, room doesn't exist", client, roomName)
+		client.Send(ErrorMessage("Room doesn't exist"))
+		return
 	}
+
+	if err := ch.join(client, room); err != nil {
+		logger.Infof("Client %v cannot join room %v. Error: %v", client, roomName, err)
+		client.Send(ErrorMessage(limitedErrorMessage(err)))
+		return
+	}
+
+	client.Send(RoomsNamesMessage(ch.roomNames()))
+	client.Send(NewUserJoinedRoomMessage(roomName, client.ID()))
+
+	for _, welcomer := range ch.welcomers {
+		for _, msg := range welcomer.Welcome(roomName) {
+			client.Send(msg)
+		}
+	}
+
+	ch.emit(newEvent(EventUserJoined, roomName, client.Name()))
 }
 
 // RemoveClientFromRoom removes given client from room with given name.
 func (ch *Rooms) RemoveClientFromRoom(roomName string, client *Client) {
-	ch.removeClientFromRoomRequest <- clientAndRoom{
-		client: client,
-		room:   roomName,
+	if !ch.running("remove client from room") {
+		return
+	}
+
+	logger.Infof("Remove client '%v' from room '%v'", client, roomName)
+
+	if ch.leave(client, roomName) {
+		client.Send(NewUserLeftRoomMessage(roomName, client.ID()))
 	}
 }
 
 // SendMessageOnRoom sends given message to all clients of given room.
+// Message gets unique id and time of sending.
 func (ch *Rooms) SendMessageOnRoom(message *Message) {
-	ch.messageRequest <- message
+	if !ch.running("send message") {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	message.ID = uuid.New().String()
+	message.Time = &now
+
+	logger.Infof("Send message: %v", message)
+
+	if ch.sendToEveryone(message.Room, message) {
+		event := newEvent(EventMessagePosted, message.Room, message.SenderName)
+		event.Message = message
+		ch.emit(event)
+	}
+}
+
+// Broadcast sends given message to all clients of given room. Unlike SendMessageOnRoom, message
+// is not posted in the room, so it isn't stored in history and integrations are not notified.
+// Returns false if the room doesn't exist.
+func (ch *Rooms) Broadcast(message *Message) bool {
+	if !ch.running("broadcast message") {
+		return false
+	}
+
+	return ch.sendToEveryone(message.Room, message)
+}
+
+// SendToUser sends given message only to the clients of the user with given name which are
+// members of the message's room. Like Broadcast, message is not posted in the room. Message gets
+// unique id and time of sending. Returns false if the user has no clients in the room.
+func (ch *Rooms) SendToUser(userName string, message *Message) bool {
+	if !ch.running("send message to user") {
+		return false
+	}
+
+	room := ch.rooms.get(message.Room)
+	if room == nil {
+		return false
+	}
+
+	now := time.Now().UTC()
+
+	message.ID = uuid.New().String()
+	message.Time = &now
+
+	sent := false
+	for _, client := range room.Clients() {
+		if client.Name() == userName {
+			client.Send(message)
+			sent = true
+		}
+	}
+
+	return sent
+}
+
+// IsMember returns true if user with given name is a member of room with given name.
+func (ch *Rooms) IsMember(roomName, userName string) bool {
+	room := ch.rooms.get(roomName)
+	return room != nil && room.HasUser(userName)
+}
+
+// RoomOwner returns name of the user who created room with given name. Returns false
+// if such room doesn't exist.
+func (ch *Rooms) RoomOwner(roomName string) (string, bool) {
+	room := ch.rooms.get(roomName)
+	if room == nil {
+		return "", false
+	}
+
+	return room.Owner(), true
+}
+
+// OwnerOf returns name of the user who owns room with given name. Unlike RoomOwner it returns
+// owners of the rooms which were removed, so it should be used to authorize changes of rooms'
+// settings. Returns false if the room has no owner.
+func (ch *Rooms) OwnerOf(roomName string) (string, bool) {
+	if roomName == MainRoomName() {
+		return "", true
+	}
+
+	if ch.owners != nil {
+		return ch.owners.Owner(roomName)
+	}
+
+	return ch.RoomOwner(roomName)
+}
+
+func (ch *Rooms) roomNames() []string {
+	rooms := ch.rooms.running()
+
+	names := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		names = append(names, room.Name())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ValidateTopic returns ErrInvalidTopic if given topic cannot be used as a topic of the room.
+func ValidateTopic(topic string) error {
+	if utf8.RuneCountInString(topic) > maxTopicLength {
+		return ErrInvalidTopic
+	}
+	return nil
+}
+
+// SetTopic changes topic of the room with given name. Only the owner of the room can change it.
+// Members of the room are informed about the new topic.
+func (ch *Rooms) SetTopic(roomName, userName, topic string) error {
+	room := ch.rooms.get(roomName)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+
+	if room.Main() || room.Owner() != userName {
+		return ErrNotRoomOwner
+	}
+
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+
+	room.SetTopic(topic)
+	ch.sendToEveryone(roomName, NewTopicMessage(roomName, userName, topic))
+
+	return nil
+}
+
+// RoomInfo contains basic information about the room.
+type RoomInfo struct {
+	Name    string `json:"name"`
+	Owner   string `json:"owner,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Members int    `json:"members"`
+}
+
+// List returns information about all rooms sorted by name.
+func (ch *Rooms) List() []*RoomInfo {
+	infos := make([]*RoomInfo, 0)
+
+	for _, room := range ch.rooms.running() {
+		infos = append(infos, &RoomInfo{
+			Name:    room.Name(),
+			Owner:   room.Owner(),
+			Topic:   room.Topic(),
+			Members: room.MembersCount(),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// Members returns names of users who are members of room with given name.
+func (ch *Rooms) Members(roomName string) ([]string, error) {
+	room := ch.rooms.get(roomName)
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	members := room.Members()
+	sort.Strings(members)
+
+	return members, nil
+}
+
+// CreateEmptyRoom creates room with given name and owner without adding any client to it.
+func (ch *Rooms) CreateEmptyRoom(roomName, owner string) error {
+	if ch.ctx.Err() != nil {
+		return ErrRoomsStopped
+	}
+
+	if !ch.roomNameValid(roomName) {
+		return ErrInvalidRoomName
+	}
+
+	if _, err := ch.newRoom(roomName, owner); err != nil {
+		return err
+	}
+
+	ch.sendToEveryone(MainRoomName(), NewCreateRoomMessage(roomName))
+	ch.emit(newEvent(EventRoomCreated, roomName, owner))
+
+	return nil
+}
+
+// DeleteRoom removes room with given name even if it has members. Members
+// are notified that they left the room.
+func (ch *Rooms) DeleteRoom(roomName string) error {
+	if roomName == MainRoomName() {
+		return ErrMainRoom
+	}
+
+	room := ch.rooms.get(roomName)
+	if room == nil {
+		return ErrRoomNotFound
+	}
+
+	members := room.Clients()
+
+	if !ch.unregisterRoom(room) {
+		return ErrRoomNotFound
+	}
+
+	for _, client := range members {
+		ch.forget(client, room)
+		client.Send(NewUserLeftRoomMessage(roomName, client.ID()))
+	}
+
+	ch.sendToEveryone(MainRoomName(), NewRemoveRoomMessage(roomName))
+	ch.emit(newEvent(EventRoomRemoved, roomName, ""))
+
+	return nil
+}
+
+// ClientInfo contains information about connected client. ID identifies the connection,
+// it is random, so it can be shown to administrators.
+type ClientInfo struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Connected  time.Time `json:"connected"`
+	Rooms      []string  `json:"rooms"`
+	QueueDepth int       `json:"queueDepth"`
+}
+
+// Clients returns information about all connected clients sorted by user name.
+func (ch *Rooms) Clients() []*ClientInfo {
+	infos := make([]*ClientInfo, 0)
+
+	for _, client := range ch.clients.all() {
+		rooms := client.joinedRooms()
+		sort.Strings(rooms)
+
+		infos = append(infos, &ClientInfo{
+			ID:         client.ID(),
+			User:       client.Name(),
+			RemoteAddr: client.RemoteAddr(),
+			Connected:  client.Connected(),
+			Rooms:      rooms,
+			QueueDepth: client.QueueDepth(),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].User != infos[j].User {
+			return infos[i].User < infos[j].User
+		}
+		return infos[i].ID < infos[j].ID
+	})
+
+	return infos
+}
+
+// DisconnectClient closes connection of the client with given id.
+func (ch *Rooms) DisconnectClient(clientID string) error {
+	client := ch.clients.get(clientID)
+	if client == nil {
+		return ErrClientNotFound
+	}
+
+	client.Disconnect()
+
+	return nil
+}
+
+// Stats contains numbers describing current state of the rooms.
+type Stats struct {
+	Clients        int
+	Rooms          int
+	QueuedMessages int
+}
+
+// Stats returns numbers of connected clients, rooms and messages waiting to be sent to the clients.
+func (ch *Rooms) Stats() Stats {
+	clients := ch.clients.all()
+
+	stats := Stats{
+		Clients: len(clients),
+		Rooms:   len(ch.rooms.running()),
+	}
+
+	for _, client := range clients {
+		stats.QueuedMessages += client.QueueDepth()
+	}
+
+	return stats
 }
@@ -0,0 +1,242 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	benchmarkClients = 2000
+	benchmarkRooms   = 200
+	// benchmarkMembers is a number of members of every room apart from the main room.
+	benchmarkMembers = benchmarkClients / benchmarkRooms
+)
+
+// benchmarkSetup connects clients and spreads them evenly between rooms. Every client
+// is also a member of the main room. Text messages delivered to the clients are counted.
+func benchmarkSetup(b *testing.B) (*Rooms, []*Client, *int64) {
+	level := logger.GetLevel()
+	logger.SetLevel(logger.ErrorLevel)
+	b.Cleanup(func() { logger.SetLevel(level) })
+
+	rooms := NewRooms()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var delivered int64
+	clients := make([]*Client, benchmarkClients)
+
+	for i := range clients {
+		conn := NewChannelConn(50)
+		clients[i] = NewClient(fmt.Sprintf("session-%v", i), &testUser{name: fmt.Sprintf("user-%v", i)}, rooms, conn, NewRouter())
+
+		go clients[i].Start(ctx)
+		go func() {
+			for {
+				select {
+				case msg := <-conn.Messages():
+					if msg.MsgType == MsgTextMsgMT {
+						atomic.AddInt64(&delivered, 1)
+					}
+				case <-conn.Closed():
+					return
+				}
+			}
+		}()
+
+		rooms.AddClientToRoom(MainRoomName(), clients[i])
+
+		roomName := fmt.Sprintf("room-%v", i%benchmarkRooms)
+		if i < benchmarkRooms {
+			rooms.CreateRoom(roomName, clients[i])
+		} else {
+			rooms.AddClientToRoom(roomName, clients[i])
+		}
+	}
+
+	b.Cleanup(func() {
+		cancel()
+		rooms.Shutdown(context.Background()) //nolint:errcheck
+		rooms.Stop()
+		<-rooms.Done()
+	})
+
+	atomic.StoreInt64(&delivered, 0)
+
+	return rooms, clients, &delivered
+}
+
+func BenchmarkRoomsSendMessageOnRoom(b *testing.B) {
+	rooms, _, delivered := benchmarkSetup(b)
+
+	start := time.Now()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		random := rand.New(rand.NewSource(rand.Int63()))
+
+		for pb.Next() {
+			rooms.SendMessageOnRoom(&Message{
+				Room:    fmt.Sprintf("room-%v", random.Intn(benchmarkRooms)),
+				MsgType: MsgTextMsgMT,
+				Content: "hello",
+			})
+		}
+	})
+
+	// messages are delivered asynchronously, the benchmark finishes when all members got them
+	for expected := int64(b.N * benchmarkMembers); atomic.LoadInt64(delivered) < expected; {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(delivered))/time.Since(start).Seconds(), "deliveries/s")
+}
+
+func BenchmarkRoomsJoinAndLeave(b *testing.B) {
+	rooms, clients, _ := benchmarkSetup(b)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		random := rand.New(rand.NewSource(rand.Int63()))
+
+		for pb.Next() {
+			client := clients[random.Intn(len(clients))]
+			roomName := fmt.Sprintf("room-%v", random.Intn(benchmarkRooms))
+
+			rooms.AddClientToRoom(roomName, client)
+			rooms.RemoveClientFromRoom(roomName, client)
+		}
+	})
+}
+
+func BenchmarkRoomsMixedRequests(b *testing.B) {
+	rooms, clients, _ := benchmarkSetup(b)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		random := rand.New(rand.NewSource(rand.Int63()))
+
+		for pb.Next() {
+			client := clients[random.Intn(len(clients))]
+			roomName := fmt.Sprintf("room-%v", random.Intn(benchmarkRooms))
+
+			switch random.Intn(4) {
+			case 0:
+				rooms.AddClientToRoom(roomName, client)
+			case 1:
+				rooms.RemoveClientFromRoom(roomName, client)
+			case 2:
+				rooms.ClientsRooms(client)
+			default:
+				rooms.SendMessageOnRoom(&Message{Room: roomName, MsgType: MsgTextMsgMT, Content: "hello"})
+			}
+		}
+	})
+}
+
+const broadcastMembers = 1000
+
+// discardConnection encodes sent messages the way websocket connection does and discards them.
+// With encodePerClient set, frames are encoded by every connection separately.
+type discardConnection struct {
+	encodePerClient bool
+	delivered       *sync.WaitGroup
+	closed          chan struct{}
+}
+
+func (c *discardConnection) Send(msg interface{}) error {
+	frame, ok := msg.(*Frame)
+	if !ok {
+		// only broadcast frames are counted, not the message sent while shutting down
+		return nil
+	}
+	defer c.delivered.Done()
+
+	if c.encodePerClient {
+		msg = frame.Message()
+	}
+
+	data, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = ioutil.Discard.Write(data)
+	return err
+}
+
+func (c *discardConnection) Receive(msg interface{}) error {
+	<-c.closed
+	return io.EOF
+}
+
+func (c *discardConnection) Close() error          { return nil }
+func (c *discardConnection) CloseGoingAway() error { return nil }
+func (c *discardConnection) RemoteAddr() string    { return "discard" }
+
+func benchmarkBroadcast(b *testing.B, encodePerClient bool) {
+	level := logger.GetLevel()
+	logger.SetLevel(logger.ErrorLevel)
+	defer logger.SetLevel(level)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	room := NewRoom(ctx, "bench", "")
+	room.Start()
+
+	var delivered sync.WaitGroup
+	closed := make(chan struct{})
+	defer close(closed)
+
+	for i := 0; i < broadcastMembers; i++ {
+		conn := &discardConnection{encodePerClient: encodePerClient, delivered: &delivered, closed: closed}
+		client := NewClient(fmt.Sprintf("session-%v", i), &testUser{name: fmt.Sprintf("user-%v", i)}, rooms, conn, NewRouter())
+
+		go client.Start(ctx)
+
+		if err := room.AddClient(client); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	msg := textMessage("bench", strings.Repeat("Lorem ipsum dolor sit amet. ", 20))
+	msg.HTML = "<p>" + msg.Content + "</p>"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		delivered.Add(broadcastMembers)
+
+		if err := room.SendToEveryone(msg); err != nil {
+			b.Fatal(err)
+		}
+
+		delivered.Wait()
+	}
+}
+
+func BenchmarkRoomBroadcastTo1kMembers(b *testing.B) {
+	b.Run("encode-once", func(b *testing.B) {
+		benchmarkBroadcast(b, false)
+	})
+	b.Run("encode-per-client", func(b *testing.B) {
+		benchmarkBroadcast(b, true)
+	})
+}
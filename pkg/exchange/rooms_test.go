@@ -0,0 +1,467 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	name string
+}
+
+func (u *testUser) Name() string {
+	return u.name
+}
+
+func TestRoomsShouldCreateListAndDeleteRooms(t *testing.T) {
+	// given
+	rooms := NewRooms()
+
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+
+	// when
+	createErr := rooms.CreateEmptyRoom("ops", "john")
+	duplicateErr := rooms.CreateEmptyRoom("ops", "jane")
+	invalidErr := rooms.CreateEmptyRoom("ops room", "john")
+
+	rooms.AddClientToRoom("ops", client)
+
+	// then
+	assert.NoError(t, createErr)
+	assert.Equal(t, ErrRoomExists, duplicateErr)
+	assert.Equal(t, ErrInvalidRoomName, invalidErr)
+
+	assert.Eventually(t, func() bool {
+		members, err := rooms.Members("ops")
+		return err == nil && len(members) == 1 && members[0] == "john"
+	}, time.Second, 5*time.Millisecond)
+
+	infos := rooms.List()
+	assert.Len(t, infos, 2)
+	assert.Equal(t, &RoomInfo{Name: "main", Members: 0}, infos[0])
+	assert.Equal(t, &RoomInfo{Name: "ops", Owner: "john", Members: 1}, infos[1])
+
+	// when
+	deleteErr := rooms.DeleteRoom("ops")
+	mainErr := rooms.DeleteRoom(MainRoomName())
+	missingErr := rooms.DeleteRoom("ops")
+	_, membersErr := rooms.Members("ops")
+
+	// then
+	assert.NoError(t, deleteErr)
+	assert.Equal(t, ErrMainRoom, mainErr)
+	assert.Equal(t, ErrRoomNotFound, missingErr)
+	assert.Equal(t, ErrRoomNotFound, membersErr)
+	assert.Len(t, rooms.List(), 1)
+}
+
+func TestRoomsShouldListAndDisconnectClients(t *testing.T) {
+	// given
+	rooms := NewRooms()
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go client.Start(context.Background())
+
+	rooms.AddClientToRoom(MainRoomName(), client)
+	rooms.CreateRoom("ops", client)
+
+	// when
+	var clients []*ClientInfo
+	assert.Eventually(t, func() bool {
+		clients = rooms.Clients()
+		return len(clients) == 1 && len(clients[0].Rooms) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// then
+	assert.Equal(t, "john-session", clients[0].ID)
+	assert.Equal(t, "john", clients[0].User)
+	assert.Equal(t, "in-process", clients[0].RemoteAddr)
+	assert.Equal(t, []string{"main", "ops"}, clients[0].Rooms)
+	assert.False(t, clients[0].Connected.IsZero())
+
+	// when
+	err := rooms.DisconnectClient("john-session")
+	missingErr := rooms.DisconnectClient("jane-session")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, ErrClientNotFound, missingErr)
+	<-conn.Closed()
+
+	assert.Eventually(t, func() bool {
+		return len(rooms.Clients()) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, DisconnectKicked, client.DisconnectReason())
+}
+
+type countingDrops struct {
+	lock    sync.Mutex
+	reasons map[string]int
+}
+
+func (c *countingDrops) Dropped(reason string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reasons[reason]++
+}
+
+func TestRoomsShouldCountMessagesSentToStoppedClients(t *testing.T) {
+	// given
+	drops := &countingDrops{reasons: map[string]int{}}
+	rooms := NewRooms()
+	rooms.SetDropCounter(drops)
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-connection", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go client.Start(context.Background())
+	rooms.AddClientToRoom(MainRoomName(), client)
+
+	assert.NoError(t, rooms.DisconnectClient("john-connection"))
+	<-conn.Closed()
+	assert.Eventually(t, client.stopped, time.Second, 5*time.Millisecond)
+
+	// when
+	client.Send(NewCreateRoomMessage("ops"))
+
+	// then
+	drops.lock.Lock()
+	defer drops.lock.Unlock()
+	assert.Equal(t, map[string]int{DroppedClientStopped: 1}, drops.reasons)
+}
+
+func TestRoomsShouldRespondToPing(t *testing.T) {
+	// given
+	rooms := NewRooms()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// when
+	err := rooms.Ping(ctx)
+
+	// then
+	assert.NoError(t, err)
+}
+
+func TestRoomsShouldShutdownClientsWhenContextIsCancelled(t *testing.T) {
+	// given
+	rooms := NewRooms()
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+
+	clientsCtx, disconnectClients := context.WithCancel(context.Background())
+	go client.Start(clientsCtx)
+
+	rooms.AddClientToRoom(MainRoomName(), client)
+
+	assert.Eventually(t, func() bool {
+		return len(rooms.Clients()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// when
+	disconnectClients()
+	err := rooms.Shutdown(ctx)
+
+	// then
+	assert.NoError(t, err)
+	<-conn.Closed()
+
+	var last *Message
+	for len(conn.Messages()) > 0 {
+		last = <-conn.Messages()
+	}
+
+	assert.NotNil(t, last)
+	assert.Equal(t, MsgServerRestartMT, last.MsgType)
+	assert.Equal(t, DisconnectShutdown, client.DisconnectReason())
+	assert.Len(t, rooms.Clients(), 0)
+}
+
+func TestRoomsShouldRejectJoiningRemovedRoom(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go client.Start(context.Background())
+	defer conn.Close()
+
+	rooms.CreateRoom("ops", client)
+	assert.Equal(t, NewUserJoinedRoomMessage("ops", client.ID()), <-conn.Messages())
+
+	// when
+	rooms.RemoveClientFromRoom("ops", client)
+	assert.Equal(t, NewUserLeftRoomMessage("ops", client.ID()), <-conn.Messages())
+
+	rooms.AddClientToRoom("ops", client)
+
+	// then
+	assert.Equal(t, ErrorMessage("Room doesn't exist"), <-conn.Messages())
+	assert.Len(t, rooms.List(), 1)
+}
+
+type memoryOwners map[string]string
+
+func (o memoryOwners) Claim(roomName, userName string) (string, error) {
+	if owner, ok := o[roomName]; ok {
+		return owner, nil
+	}
+	o[roomName] = userName
+	return userName, nil
+}
+
+func (o memoryOwners) Owner(roomName string) (string, bool) {
+	owner, ok := o[roomName]
+	return owner, ok
+}
+
+func TestRoomsShouldKeepOwnersOfRemovedRooms(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.SetOwners(memoryOwners{})
+
+	assert.NoError(t, rooms.CreateEmptyRoom("ops", "john"))
+	assert.NoError(t, rooms.DeleteRoom("ops"))
+
+	// when
+	owner, owned := rooms.OwnerOf("ops")
+	_, running := rooms.RoomOwner("ops")
+	takeoverErr := rooms.CreateEmptyRoom("ops", "jane")
+	recreateErr := rooms.CreateEmptyRoom("ops", "john")
+	_, unknownOwned := rooms.OwnerOf("dev")
+
+	// then
+	assert.Equal(t, "john", owner)
+	assert.True(t, owned)
+	assert.False(t, running)
+	assert.Equal(t, ErrRoomOwned, takeoverErr)
+	assert.NoError(t, recreateErr)
+	assert.False(t, unknownOwned)
+}
+
+func TestRoomsShouldNotClaimNamesOfRejectedRooms(t *testing.T) {
+	// given
+	owners := memoryOwners{}
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.SetOwners(owners)
+	rooms.SetLimits(Limits{MaxRooms: 1})
+
+	assert.NoError(t, rooms.CreateEmptyRoom("ops", "john"))
+
+	// when
+	limitErr := rooms.CreateEmptyRoom("dev", "jane")
+
+	// then
+	assert.Equal(t, ErrTooManyRooms, limitErr)
+	assert.Equal(t, memoryOwners{"ops": "john"}, owners)
+}
+
+type staticWelcomer struct {
+	room    string
+	content string
+}
+
+func (w *staticWelcomer) Welcome(roomName string) []*Message {
+	if roomName != w.room {
+		return nil
+	}
+	return []*Message{{MsgType: MsgSetTopicMT, Room: roomName, Content: w.content}}
+}
+
+func TestRoomsShouldSendWelcomeMessagesToJoiningClient(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.AddWelcomer(&staticWelcomer{room: MainRoomName(), content: "welcome"})
+
+	conn := NewChannelConn(10)
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go client.Start(context.Background())
+	defer conn.Close()
+
+	// when
+	rooms.AddClientToRoom(MainRoomName(), client)
+
+	// then
+	assert.Equal(t, NewUserJoinedRoomMessage(MainRoomName(), client.ID()), nextMessageOfType(t, conn, MsgUserJoinedRoomMT))
+	assert.Equal(t, "welcome", nextMessageOfType(t, conn, MsgSetTopicMT).Content)
+}
+
+func TestRoomsShouldSendMessageOnlyToClientsOfGivenUser(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+	assert.NoError(t, rooms.CreateEmptyRoom("ops", "admin"))
+
+	johnConn, annaConn := NewChannelConn(10), NewChannelConn(10)
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, johnConn, NewRouter())
+	anna := NewClient("anna-session", &testUser{name: "anna"}, rooms, annaConn, NewRouter())
+	for _, client := range []*Client{john, anna} {
+		go client.Start(context.Background())
+		rooms.AddClientToRoom("ops", client)
+	}
+	defer johnConn.Close()
+	defer annaConn.Close()
+
+	// when
+	sent := rooms.SendToUser("anna", textMessage("ops", "reminder"))
+	missing := rooms.SendToUser("jane", textMessage("ops", "reminder"))
+
+	// then
+	assert.True(t, sent)
+	assert.False(t, missing)
+	assert.Equal(t, "reminder", nextMessageOfType(t, annaConn, MsgTextMsgMT).Content)
+
+	timeout := time.After(50 * time.Millisecond)
+	for {
+		select {
+		case msg := <-johnConn.Messages():
+			assert.NotEqual(t, MsgTextMsgMT, msg.MsgType)
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestRoomsShouldNotBlockWhenStopped(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	client := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+
+	// when
+	rooms.Stop()
+	<-rooms.Done()
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+
+		// more requests than buffered channels can hold
+		for i := 0; i < 100; i++ {
+			rooms.AddClientToRoom(MainRoomName(), client)
+			rooms.CreateRoom("ops", client)
+			rooms.RemoveClientFromRoom("ops", client)
+			rooms.SendMessageOnRoom(&Message{Room: MainRoomName()})
+			rooms.ClientsRooms(client)
+			rooms.RemoveRoom("ops")
+			rooms.RemoveClient(client)
+		}
+
+		rooms.List()
+		rooms.Clients()
+		rooms.IsMember(MainRoomName(), "john")
+	}()
+
+	// then
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("requests blocked after rooms were stopped")
+	}
+
+	assert.Equal(t, ErrRoomsStopped, rooms.Ping(context.Background()))
+	assert.Equal(t, ErrRoomsStopped, rooms.CreateEmptyRoom("ops", "john"))
+}
+
+// TestRoomsShouldSurviveConcurrentLifecycleChanges is meant to be run with -race. Clients
+// concurrently create, join, leave and remove rooms, which are removed and stopped when
+// they become empty.
+func TestRoomsShouldSurviveConcurrentLifecycleChanges(t *testing.T) {
+	// given
+	const (
+		clientsCount = 30
+		roomsCount   = 5
+		iterations   = 100
+	)
+
+	rooms := NewRooms()
+
+	conns := make([]*ChannelConnection, clientsCount)
+	clients := make([]*Client, clientsCount)
+
+	for i := range clients {
+		conns[i] = NewChannelConn(10)
+		clients[i] = NewClient(fmt.Sprintf("session-%v", i), &testUser{name: fmt.Sprintf("user-%v", i)}, rooms, conns[i], NewRouter())
+
+		go clients[i].Start(context.Background())
+		go drain(conns[i])
+
+		rooms.AddClientToRoom(MainRoomName(), clients[i])
+	}
+
+	// when
+	var wg sync.WaitGroup
+
+	for i := range clients {
+		wg.Add(1)
+
+		go func(client *Client, seed int64) {
+			defer wg.Done()
+
+			random := rand.New(rand.NewSource(seed))
+
+			for j := 0; j < iterations; j++ {
+				roomName := fmt.Sprintf("room-%v", random.Intn(roomsCount))
+
+				switch random.Intn(6) {
+				case 0:
+					rooms.CreateRoom(roomName, client)
+				case 1:
+					rooms.AddClientToRoom(roomName, client)
+				case 2:
+					rooms.RemoveClientFromRoom(roomName, client)
+				case 3:
+					rooms.SendMessageOnRoom(&Message{Room: roomName, MsgType: MsgTextMsgMT})
+				case 4:
+					rooms.DeleteRoom(roomName)
+				case 5:
+					rooms.Members(roomName)
+					rooms.Clients()
+				}
+			}
+		}(clients[i], int64(i))
+	}
+
+	wg.Wait()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	// then
+	assert.Eventually(t, func() bool {
+		return len(rooms.Clients()) == 0 && len(rooms.List()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rooms.Stop()
+
+	select {
+	case <-rooms.Done():
+	case <-time.After(time.Second):
+		t.Fatal("rooms didn't stop")
+	}
+}
+
+func drain(conn *ChannelConnection) {
+	for {
+		select {
+		case <-conn.Messages():
+		case <-conn.Closed():
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package exchange
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultSearchLimit is a number of found messages returned when limit isn't specified.
+	DefaultSearchLimit = 20
+	// MaxSearchLimit is a maximal number of found messages returned at once.
+	MaxSearchLimit = 100
+	// MaxSearchTextLength is a maximal number of characters of the searched text.
+	MaxSearchTextLength = 100
+)
+
+var (
+	// ErrInvalidSearch is returned when searched text is empty or too long.
+	ErrInvalidSearch = errors.New("search text should have from 1 to 100 characters")
+	// ErrSearchNotMember is returned when messages of the room the user isn't a member of are searched.
+	ErrSearchNotMember = errors.New("only messages of joined rooms can be searched")
+	// ErrInvalidSearchCursor is returned when the cursor of the search page cannot be parsed.
+	ErrInvalidSearchCursor = errors.New("before should be a value returned in the previous page")
+)
+
+// SearchQuery describes which stored messages should be found.
+type SearchQuery struct {
+	// Text has to be a part of the message's content, case is ignored.
+	Text string `json:"text"`
+	// Room restricts results to the messages posted in given room.
+	Room string `json:"room,omitempty"`
+	// Sender restricts results to the messages sent by the user with given name.
+	Sender string `json:"sender,omitempty"`
+	// From restricts results to the messages posted at given time or later.
+	From *time.Time `json:"from,omitempty"`
+	// To restricts results to the messages posted before given time.
+	To *time.Time `json:"to,omitempty"`
+	// Before restricts results to the messages older than the last message of the previous page.
+	// It is the value returned in the previous page and it is used instead of To.
+	Before string `json:"before,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// SearchResult describes single found message. Snippet is a fragment of the message's content
+// escaped as HTML, in which every occurrence of the searched text is wrapped in <mark> element.
+type SearchResult struct {
+	ID      string    `json:"id"`
+	Room    string    `json:"room"`
+	Sender  string    `json:"sender"`
+	Created time.Time `json:"created"`
+	Snippet string    `json:"snippet"`
+}
+
+// SearchPage contains found messages, sorted from the newest. Before contains value which should
+// be used as 'before' of the query to find older messages, it is empty if there are no more messages.
+type SearchPage struct {
+	Results []*SearchResult `json:"results"`
+	Before  string          `json:"before,omitempty"`
+}
+
+// Searcher finds stored messages posted in given rooms. Rooms are mapped to times before which
+// messages can be found, zero time means that all messages of the room can be found.
+type Searcher interface {
+	Search(rooms map[string]time.Time, query SearchQuery) (*SearchPage, error)
+}
+
+// UserRooms returns sorted names of the rooms the user with given name is a member of.
+func (ch *Rooms) UserRooms(userName string) []string {
+	names := make([]string, 0)
+	for name := range ch.memberships.rooms(userName) {
+		names = append(names, name)
+	}
+
+	// memberships of the main room aren't counted
+	if ch.IsMember(main, userName) {
+		names = append(names, main)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Memberships remembers rooms joined by the users, so they can read history of the rooms
+// posted before they left them or the rooms were removed.
+type Memberships interface {
+	// Rooms returns rooms ever joined by the user with given name and times the user left them.
+	// Time is zero if the user didn't leave the room.
+	Rooms(userName string) map[string]time.Time
+}
+
+// SetMemberships sets persistent memberships of the rooms. Without them users can read history
+// only of the rooms they are members of. It should be called before Rooms are used.
+func (ch *Rooms) SetMemberships(memberships Memberships) {
+	ch.joined = memberships
+}
+
+// ReadableRooms returns rooms which history can be read by the user with given name, with times
+// before which messages can be read. Zero time means that the whole history can be read.
+// See CanReadHistory for the rules.
+func (ch *Rooms) ReadableRooms(userName string) map[string]time.Time {
+	rooms := map[string]time.Time{main: {}}
+
+	if ch.joined != nil {
+		for name, left := range ch.joined.Rooms(userName) {
+			if ch.ownsRoom(name, userName) {
+				left = time.Time{}
+			}
+			rooms[name] = left
+		}
+	}
+
+	for _, name := range ch.UserRooms(userName) {
+		rooms[name] = time.Time{}
+	}
+
+	return rooms
+}
+
+// CanReadHistory returns true if the user with given name can read history of the room with given
+// name, with time before which messages can be read. Zero time means that the whole history can
+// be read. Everybody can read whole history of the main room, members and owners whole history
+// of their rooms. Former members can read only messages posted before they left the room.
+func (ch *Rooms) CanReadHistory(roomName, userName string) (time.Time, bool) {
+	if roomName == main || ch.IsMember(roomName, userName) || ch.ownsRoom(roomName, userName) {
+		return time.Time{}, true
+	}
+
+	if ch.joined == nil {
+		return time.Time{}, false
+	}
+
+	left, ok := ch.joined.Rooms(userName)[roomName]
+	return left, ok
+}
+
+func (ch *Rooms) ownsRoom(roomName, userName string) bool {
+	owner, ok := ch.OwnerOf(roomName)
+	return ok && owner == userName && owner != ""
+}
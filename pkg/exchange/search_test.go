@@ -0,0 +1,147 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSearcher struct {
+	rooms map[string]time.Time
+	query SearchQuery
+	err   error
+}
+
+func (s *recordingSearcher) Search(rooms map[string]time.Time, query SearchQuery) (*SearchPage, error) {
+	s.rooms = rooms
+	s.query = query
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &SearchPage{Results: []*SearchResult{{ID: "msg-1", Room: MainRoomName(), Snippet: "<mark>link</mark>"}}}, nil
+}
+
+func TestRoomsShouldReturnRoomsJoinedByUser(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	for _, name := range []string{"backend", "frontend"} {
+		assert.NoError(t, rooms.CreateEmptyRoom(name, "admin"))
+	}
+
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+	rooms.AddClientToRoom(MainRoomName(), john)
+	rooms.AddClientToRoom("frontend", john)
+
+	// when
+	joined := rooms.UserRooms("john")
+	none := rooms.UserRooms("jane")
+
+	// then
+	assert.Equal(t, []string{"frontend", MainRoomName()}, joined)
+	assert.Empty(t, none)
+}
+
+type staticMemberships map[string]map[string]time.Time
+
+func (m staticMemberships) Rooms(userName string) map[string]time.Time {
+	return m[userName]
+}
+
+func TestRoomsShouldLetFormerMembersReadHistoryPostedBeforeTheyLeft(t *testing.T) {
+	// given
+	left := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	rooms := NewRooms()
+	defer rooms.Stop()
+	rooms.SetMemberships(staticMemberships{
+		"john": {"removed": left, "ops": left, "frontend": left},
+		"jane": {"frontend": left},
+	})
+
+	assert.NoError(t, rooms.CreateEmptyRoom("ops", "john"))
+	assert.NoError(t, rooms.CreateEmptyRoom("frontend", "admin"))
+
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+	rooms.AddClientToRoom("frontend", john)
+
+	// when
+	johns := rooms.ReadableRooms("john")
+	janes := rooms.ReadableRooms("jane")
+	mikes := rooms.ReadableRooms("mike")
+
+	// then
+	assert.Equal(t, map[string]time.Time{MainRoomName(): {}, "frontend": {}, "ops": {}, "removed": left}, johns)
+	assert.Equal(t, map[string]time.Time{MainRoomName(): {}, "frontend": left}, janes)
+	assert.Equal(t, map[string]time.Time{MainRoomName(): {}}, mikes)
+
+	testData := []struct {
+		room  string
+		user  string
+		until time.Time
+		ok    bool
+	}{
+		{room: "removed", user: "john", until: left, ok: true},
+		{room: "ops", user: "john", ok: true},
+		{room: "frontend", user: "john", ok: true},
+		{room: "frontend", user: "jane", until: left, ok: true},
+		{room: "ops", user: "jane", ok: false},
+		{room: MainRoomName(), user: "mike", ok: true},
+	}
+
+	for _, data := range testData {
+		until, ok := rooms.CanReadHistory(data.room, data.user)
+		assert.Equal(t, data.ok, ok, "%v in %v", data.user, data.room)
+		assert.Equal(t, data.until, until, "%v in %v", data.user, data.room)
+	}
+}
+
+func TestSearchHandlerShouldSearchJoinedRoomsAndSendResults(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	assert.NoError(t, rooms.CreateEmptyRoom("ops", "admin"))
+
+	conn := NewChannelConn(10)
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, conn, NewRouter())
+	go john.Start(context.Background())
+	defer conn.Close()
+	rooms.AddClientToRoom("ops", john)
+
+	searcher := &recordingSearcher{}
+	handler := NewSearchHandler(rooms, searcher, john)
+
+	// when
+	err := handler.Handle(&Message{MsgType: MsgSearchMT, SearchQuery: &SearchQuery{Text: "link", Sender: "jane"}})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{MainRoomName(): {}, "ops": {}}, searcher.rooms)
+	assert.Equal(t, "jane", searcher.query.Sender)
+
+	msg := nextMessageOfType(t, conn, MsgSearchMT)
+	assert.Len(t, msg.SearchResults.Results, 1)
+	assert.Equal(t, "msg-1", msg.SearchResults.Results[0].ID)
+}
+
+func TestSearchHandlerShouldReturnClientErrorForInvalidQuery(t *testing.T) {
+	// given
+	rooms := NewRooms()
+	defer rooms.Stop()
+
+	john := NewClient("john-session", &testUser{name: "john"}, rooms, NewChannelConn(10), NewRouter())
+	handler := NewSearchHandler(rooms, &recordingSearcher{err: ErrInvalidSearch}, john)
+
+	// when
+	err := handler.Handle(&Message{MsgType: MsgSearchMT})
+
+	// then
+	_, ok := AsClientError(err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,174 @@
+// Package filter checks content of text messages against configurable rules.
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Action describes what happens with the message which matches the rule.
+type Action string
+
+const (
+	// Mask replaces matching fragments with asterisks.
+	Mask Action = "mask"
+	// Reject stops the message, sender receives an error.
+	Reject Action = "reject"
+	// Flag delivers the message, but reports it to moderators.
+	Flag Action = "flag"
+	// None disables the rule.
+	None Action = "none"
+)
+
+// Rule describes fragments of content which should be handled in a special way.
+// Fragments can be described with regular expression, list of words or both.
+// Example rule in JSON: {"name": "profanity", "words": ["darn", "heck"], "action": "mask"}.
+type Rule struct {
+	Name    string   `json:"name"`
+	Pattern string   `json:"pattern"`
+	Words   []string `json:"words"`
+	Action  Action   `json:"action"`
+	// Secret is true for rules detecting credentials, matching fragments are never stored in flags.
+	Secret bool `json:"secret"`
+}
+
+// LoadRules reads list of rules from JSON file.
+func LoadRules(path string) ([]Rule, error) {
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read content filter rules from %v, error: %w", path, err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(bts, &rules); err != nil {
+		return nil, fmt.Errorf("cannot parse content filter rules from %v, error: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// SecretRules returns rules detecting most common credentials with given action.
+func SecretRules(action Action) []Rule {
+	rules := []Rule{
+		{Name: "private key", Pattern: `-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`},
+		{Name: "AWS access key", Pattern: `\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA)[0-9A-Z]{16}\b`},
+		{Name: "AWS secret key", Pattern: `(?i)aws.{0,20}(?:secret|private).{0,20}[:=]\s*['"]?[A-Za-z0-9/+]{40}\b`},
+		{Name: "Google API key", Pattern: `\bAIza[0-9A-Za-z_-]{35}\b`},
+		{Name: "GitHub token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+		{Name: "Slack token", Pattern: `\bxox[abposr]-[A-Za-z0-9-]{10,}\b`},
+		{Name: "Stripe secret key", Pattern: `\b[sr]k_live_[0-9a-zA-Z]{24,}\b`},
+	}
+
+	for i := range rules {
+		rules[i].Action = action
+		rules[i].Secret = true
+	}
+
+	return rules
+}
+
+type compiledRule struct {
+	Rule
+	regexp *regexp.Regexp
+}
+
+// Filter checks content against list of rules.
+type Filter struct {
+	rules []compiledRule
+}
+
+// NewFilter returns new Filter or error if any of the rules is invalid.
+func NewFilter(rules []Rule) (*Filter, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for _, rule := range rules {
+		switch rule.Action {
+		case None:
+			continue
+		case Mask, Reject, Flag:
+		default:
+			return nil, fmt.Errorf("rule '%v' has unknown action '%v'", rule.Name, rule.Action)
+		}
+
+		patterns := make([]string, 0)
+		if rule.Pattern != "" {
+			patterns = append(patterns, rule.Pattern)
+		}
+
+		if len(rule.Words) > 0 {
+			words := make([]string, 0, len(rule.Words))
+			for _, word := range rule.Words {
+				words = append(words, regexp.QuoteMeta(word))
+			}
+			patterns = append(patterns, `(?i)\b(?:`+strings.Join(words, "|")+`)\b`)
+		}
+
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("rule '%v' has neither pattern nor words", rule.Name)
+		}
+
+		re, err := regexp.Compile(`(?:` + strings.Join(patterns, `)|(?:`) + `)`)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%v' has invalid pattern, error: %w", rule.Name, err)
+		}
+
+		compiled = append(compiled, compiledRule{Rule: rule, regexp: re})
+	}
+
+	return &Filter{rules: compiled}, nil
+}
+
+// Result is a result of checking content.
+type Result struct {
+	// Content is a content with masked fragments.
+	Content string
+	// Rejected is a rule which caused rejection of the content or nil.
+	Rejected *Rule
+	// Flagged contains names of rules with Flag action which matched the content.
+	Flagged []string
+	// Redacted is a content with masked fragments and masked secrets, it can be safely stored.
+	Redacted string
+}
+
+// Check applies all rules to given content. Checking stops at the first rule which rejects the content.
+func (f *Filter) Check(content string) *Result {
+	result := &Result{
+		Content:  content,
+		Flagged:  make([]string, 0),
+		Redacted: content,
+	}
+
+	for i := range f.rules {
+		rule := &f.rules[i]
+
+		if !rule.regexp.MatchString(result.Content) {
+			continue
+		}
+
+		switch rule.Action {
+		case Reject:
+			result.Rejected = &rule.Rule
+			return result
+		case Mask:
+			result.Content = rule.mask(result.Content)
+		case Flag:
+			result.Flagged = append(result.Flagged, rule.Name)
+		}
+
+		if rule.Action == Mask || rule.Secret {
+			result.Redacted = rule.mask(result.Redacted)
+		}
+	}
+
+	return result
+}
+
+func (r *compiledRule) mask(content string) string {
+	return r.regexp.ReplaceAllStringFunc(content, func(fragment string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(fragment))
+	})
+}
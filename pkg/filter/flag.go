@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// ErrFlagNotFound is returned when flag which doesn't exist is resolved.
+var ErrFlagNotFound = errors.New("flag not found")
+
+// Flagged is a message reported to moderators.
+type Flagged struct {
+	ID         string     `json:"id" gorethink:"id,omitempty"`
+	Room       string     `json:"room" gorethink:"room"`
+	SenderName string     `json:"senderName" gorethink:"senderName"`
+	Content    string     `json:"content" gorethink:"content"`
+	Rules      []string   `json:"rules" gorethink:"rules"`
+	Created    time.Time  `json:"created" gorethink:"created"`
+	Resolved   bool       `json:"resolved" gorethink:"resolved"`
+	ResolvedBy string     `json:"resolvedBy,omitempty" gorethink:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty" gorethink:"resolvedAt,omitempty"`
+}
+
+// Database is an interface which defines persistence of flagged messages.
+type Database interface {
+	Insert(interface{}) error
+	Upsert(interface{}) error
+	Get(id string, result interface{}) error
+	FindAll(property string, value, result interface{}) error
+}
+
+// FlagStore keeps messages flagged for moderators.
+type FlagStore struct {
+	db  Database
+	now func() time.Time
+}
+
+// NewFlagStore returns new instance of FlagStore.
+func NewFlagStore(db Database) *FlagStore {
+	return &FlagStore{db: db, now: time.Now}
+}
+
+// Flag persists flagged message.
+func (s *FlagStore) Flag(flagged *Flagged) error {
+	logger.Warnf("Message from %v in room '%v' flagged by rules: %v", flagged.SenderName, flagged.Room, flagged.Rules)
+	return s.db.Insert(flagged)
+}
+
+// Unresolved returns flagged messages which weren't reviewed by moderators yet, sorted from the oldest.
+func (s *FlagStore) Unresolved() ([]*Flagged, error) {
+	flags := make([]*Flagged, 0)
+	if err := s.db.FindAll("resolved", false, &flags); err != nil {
+		return nil, fmt.Errorf("cannot read flagged messages, error: %w", err)
+	}
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Created.Before(flags[j].Created)
+	})
+
+	return flags, nil
+}
+
+// Resolve marks flag with given id as reviewed by moderator with given name.
+func (s *FlagStore) Resolve(id, moderator string) (*Flagged, error) {
+	var flagged Flagged
+	if err := s.db.Get(id, &flagged); err != nil {
+		return nil, fmt.Errorf("cannot read flag %v, error: %w", id, err)
+	}
+
+	if flagged.ID == "" {
+		return nil, ErrFlagNotFound
+	}
+
+	if flagged.Resolved {
+		return &flagged, nil
+	}
+
+	resolved := s.now().UTC()
+	flagged.Resolved = true
+	flagged.ResolvedBy = moderator
+	flagged.ResolvedAt = &resolved
+
+	if err := s.db.Upsert(&flagged); err != nil {
+		return nil, fmt.Errorf("cannot resolve flag %v, error: %w", id, err)
+	}
+
+	return &flagged, nil
+}
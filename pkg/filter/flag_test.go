@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagStoreShouldResolveFlags(t *testing.T) {
+	// given
+	created := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id",
+		&Flagged{ID: "2", Room: "ops", Rules: []string{"competitor"}, Created: created.Add(time.Minute)},
+		&Flagged{ID: "1", Room: "ops", Rules: []string{"competitor"}, Created: created},
+	)
+
+	store := NewFlagStore(db)
+	store.now = func() time.Time { return created.Add(time.Hour) }
+
+	// when
+	resolved, err := store.Resolve("1", "admin")
+	_, missingErr := store.Resolve("3", "admin")
+	unresolved, listErr := store.Unresolved()
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, resolved.Resolved)
+	assert.Equal(t, "admin", resolved.ResolvedBy)
+	assert.Equal(t, created.Add(time.Hour), *resolved.ResolvedAt)
+	var stored Flagged
+	assert.NoError(t, db.Get("1", &stored))
+	assert.True(t, stored.Resolved)
+
+	assert.Equal(t, ErrFlagNotFound, missingErr)
+
+	assert.NoError(t, listErr)
+	assert.Len(t, unresolved, 1)
+	assert.Equal(t, "2", unresolved[0].ID)
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"strings"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+type flagger interface {
+	Flag(*Flagged) error
+}
+
+// NewMiddleware returns exchange.Middleware which checks content of messages and options of polls.
+// Rejected messages are not handled and their senders receive error, masked
+// fragments are replaced in the message and flagged messages are reported.
+func NewMiddleware(filter *Filter, flags flagger) exchange.Middleware {
+	return func(next exchange.Handler) exchange.Handler {
+		return exchange.HandlerFunc(func(msg *exchange.Message) error {
+			content, err := check(filter, flags, msg, msg.Content)
+			if err != nil {
+				return err
+			}
+			msg.Content = content
+
+			// options are shown to the members of the room like the question of the poll
+			if msg.Poll != nil {
+				for i, option := range msg.Poll.Options {
+					if msg.Poll.Options[i], err = check(filter, flags, msg, option); err != nil {
+						return err
+					}
+				}
+			}
+
+			return next.Handle(msg)
+		})
+	}
+}
+
+// check returns content with masked fragments or client error if the content is rejected.
+// Flagged content is reported.
+func check(filter *Filter, flags flagger, msg *exchange.Message, content string) (string, error) {
+	result := filter.Check(content)
+
+	if result.Rejected != nil {
+		logger.Warnf("Message from %v in room '%v' rejected by rule '%v'", msg.SenderName, msg.Room, result.Rejected.Name)
+
+		if result.Rejected.Secret {
+			return "", exchange.NewClientError("Message rejected, it looks like it contains a secret (%v). Revoke it if it was shared anywhere", result.Rejected.Name)
+		}
+		return "", exchange.NewClientError("Message rejected, it violates rule '%v'", result.Rejected.Name)
+	}
+
+	if len(result.Flagged) > 0 {
+		flagged := &Flagged{
+			Room:       msg.Room,
+			SenderName: msg.SenderName,
+			Content:    result.Redacted,
+			Rules:      result.Flagged,
+			Created:    time.Now().UTC(),
+		}
+
+		if err := flags.Flag(flagged); err != nil {
+			logger.Errorf("Cannot flag message with rules %v. Error: %v", strings.Join(result.Flagged, ", "), err)
+		}
+	}
+
+	return result.Content, nil
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/filter"
+	"github.com/adrian83/chat/pkg/user"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/gorilla/mux"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	clientVar = "id"
+	flagVar   = "id"
+)
+
+type adminRooms interface {
+	List() []*exchange.RoomInfo
+	Clients() []*exchange.ClientInfo
+	DisconnectClient(clientID string) error
+	DeleteRoom(roomName string) error
+}
+
+type adminFlags interface {
+	Unresolved() ([]*filter.Flagged, error)
+	Resolve(id, moderator string) (*filter.Flagged, error)
+}
+
+// Administrators is a set of names of users who can administer the server and manage all rooms.
+type Administrators map[string]bool
+
+// NewAdministrators returns set of given names of administrators.
+func NewAdministrators(names []string) Administrators {
+	admins := make(Administrators, len(names))
+	for _, name := range names {
+		admins[name] = true
+	}
+	return admins
+}
+
+// IsAdmin returns true if user with given name is an administrator.
+func (a Administrators) IsAdmin(userName string) bool {
+	return a[userName]
+}
+
+// AdminHandler struct responsible for the administration of connected clients, rooms
+// and messages flagged by the content filter. Only users listed in configuration
+// as administrators can use it.
+type AdminHandler struct {
+	templates    *TemplateRepository
+	sessionStore *session.Store
+	rooms        adminRooms
+	flags        adminFlags
+	admins       Administrators
+}
+
+// NewAdminHandler returns new AdminHandler struct. Admins are names of users who can use it.
+func NewAdminHandler(templates *TemplateRepository, sessionStore *session.Store, rooms adminRooms, flags adminFlags,
+	admins Administrators) *AdminHandler {
+	return &AdminHandler{
+		templates:    templates,
+		sessionStore: sessionStore,
+		rooms:        rooms,
+		flags:        flags,
+		admins:       admins,
+	}
+}
+
+// ShowDashboard renders page with connected clients and rooms, which allows to disconnect
+// clients and remove rooms with the JSON API.
+func (h *AdminHandler) ShowDashboard(w http.ResponseWriter, req *http.Request) {
+	model := NewModel()
+
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		http.Redirect(w, req, "/login", http.StatusFound)
+		return
+	}
+
+	if !h.admins.IsAdmin(usr.Name()) {
+		model["message"] = "Only administrators can access this page"
+		w.WriteHeader(http.StatusForbidden)
+		RenderTemplateWithModel(w, h.templates.ServerError, model)
+		return
+	}
+
+	model.AddUser(usr)
+	model["clients"] = h.rooms.Clients()
+	model["rooms"] = h.rooms.List()
+
+	RenderTemplateWithModel(w, h.templates.Admin, model)
+}
+
+// Clients returns all connected clients.
+func (h *AdminHandler) Clients(w http.ResponseWriter, req *http.Request) {
+	if _, ok := h.authorize(w, req); !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.rooms.Clients())
+}
+
+// Disconnect closes connection of the client.
+func (h *AdminHandler) Disconnect(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authorize(w, req)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)[clientVar]
+
+	err := h.rooms.DisconnectClient(id)
+	if errors.Is(err, exchange.ErrClientNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot disconnect client: %v", err))
+		return
+	}
+
+	logger.Infof("Client %v disconnected by administrator %v", id, usr.Name())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Rooms returns all rooms.
+func (h *AdminHandler) Rooms(w http.ResponseWriter, req *http.Request) {
+	if _, ok := h.authorize(w, req); !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.rooms.List())
+}
+
+// DeleteRoom removes room regardless of its owner.
+func (h *AdminHandler) DeleteRoom(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authorize(w, req)
+	if !ok {
+		return
+	}
+
+	room := mux.Vars(req)[roomVar]
+
+	err := h.rooms.DeleteRoom(room)
+	if errors.Is(err, exchange.ErrRoomNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if errors.Is(err, exchange.ErrMainRoom) {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot remove room: %v", err))
+		return
+	}
+
+	logger.Infof("Room %v removed by administrator %v", room, usr.Name())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Flags returns messages flagged by the content filter which weren't resolved yet.
+func (h *AdminHandler) Flags(w http.ResponseWriter, req *http.Request) {
+	if _, ok := h.authorize(w, req); !ok {
+		return
+	}
+
+	flags, err := h.flags.Unresolved()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot read flagged messages: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, flags)
+}
+
+// ResolveFlag marks flagged message as reviewed by current administrator.
+func (h *AdminHandler) ResolveFlag(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authorize(w, req)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)[flagVar]
+
+	flagged, err := h.flags.Resolve(id, usr.Name())
+	if errors.Is(err, filter.ErrFlagNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot resolve flag: %v", err))
+		return
+	}
+
+	logger.Infof("Flag %v resolved by administrator %v", id, usr.Name())
+
+	writeJSON(w, http.StatusOK, flagged)
+}
+
+func (h *AdminHandler) authorize(w http.ResponseWriter, req *http.Request) (*user.User, bool) {
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return nil, false
+	}
+
+	if !h.admins.IsAdmin(usr.Name()) {
+		writeJSONError(w, http.StatusForbidden, "Only administrators can access this resource")
+		return nil, false
+	}
+
+	return usr, true
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticAdminRooms struct {
+	clients []*exchange.ClientInfo
+	rooms   []*exchange.RoomInfo
+}
+
+func (r *staticAdminRooms) List() []*exchange.RoomInfo {
+	return r.rooms
+}
+
+func (r *staticAdminRooms) Clients() []*exchange.ClientInfo {
+	return r.clients
+}
+
+func (r *staticAdminRooms) DisconnectClient(clientID string) error {
+	return nil
+}
+
+func (r *staticAdminRooms) DeleteRoom(roomName string) error {
+	return nil
+}
+
+func TestAdminHandlerShouldShowDashboardOnlyToAdmins(t *testing.T) {
+	// given
+	rooms := &staticAdminRooms{
+		clients: []*exchange.ClientInfo{{ID: "4f1c", User: "john", RemoteAddr: "10.0.0.7:5123", Connected: time.Now(), Rooms: []string{"main", "ops"}}},
+		rooms:   []*exchange.RoomInfo{{Name: "main", Members: 1}, {Name: "ops", Owner: "john", Members: 1}},
+	}
+	handler := NewAdminHandler(NewTemplateRepository("../../static"), newTestSessionStore(t, "admin", "john"), rooms, nil, NewAdministrators([]string{"admin"}))
+
+	// when
+	admin := httptest.NewRecorder()
+	handler.ShowDashboard(admin, newTestRequest("GET", "", "admin", nil))
+
+	member := httptest.NewRecorder()
+	handler.ShowDashboard(member, newTestRequest("GET", "", "john", nil))
+
+	anonymous := httptest.NewRecorder()
+	handler.ShowDashboard(anonymous, httptest.NewRequest("GET", "/admin", nil))
+
+	// then
+	assert.Equal(t, http.StatusOK, admin.Code)
+	assert.Contains(t, admin.Body.String(), "10.0.0.7:5123")
+	assert.Contains(t, admin.Body.String(), "/api/admin/clients/4f1c")
+	assert.Contains(t, admin.Body.String(), "/api/admin/rooms/ops")
+	assert.NotContains(t, admin.Body.String(), "/api/admin/rooms/main")
+
+	assert.Equal(t, http.StatusForbidden, member.Code)
+	assert.NotContains(t, member.Body.String(), "10.0.0.7:5123")
+
+	assert.Equal(t, http.StatusFound, anonymous.Code)
+	assert.Equal(t, "/login", anonymous.Header().Get("Location"))
+}
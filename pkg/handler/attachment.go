@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/adrian83/chat/pkg/attachment"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/gorilla/mux"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	attachmentFileField = "file"
+	attachmentRoomField = "room"
+	attachmentIDVar     = "id"
+
+	// multipartOverhead is a number of bytes allowed in upload request on top of attachment's size.
+	multipartOverhead = 1 << 20
+	// multipartMemory is a number of bytes of uploaded file kept in memory, the rest is stored on disk.
+	multipartMemory = 10 << 20
+)
+
+type attachmentService interface {
+	Upload(owner, room, name string, content io.Reader) (*attachment.Attachment, error)
+	Find(id string) (*attachment.Attachment, error)
+	Open(*attachment.Attachment) (io.ReadCloser, error)
+	OpenThumbnail(*attachment.Attachment) (io.ReadCloser, error)
+}
+
+type roomMembership interface {
+	IsMember(roomName, userName string) bool
+}
+
+// AttachmentHandler struct responsible for uploading and downloading attachments.
+type AttachmentHandler struct {
+	sessionStore *session.Store
+	attachments  attachmentService
+	rooms        roomMembership
+	maxSize      int64
+}
+
+// NewAttachmentHandler returns new AttachmentHandler struct.
+func NewAttachmentHandler(sessionStore *session.Store, attachments attachmentService, rooms roomMembership, maxSize int64) *AttachmentHandler {
+	return &AttachmentHandler{
+		sessionStore: sessionStore,
+		attachments:  attachments,
+		rooms:        rooms,
+		maxSize:      maxSize,
+	}
+}
+
+// Upload stores file sent in multipart form. Only members of the room
+// given in the form can upload attachments into it.
+func (h *AttachmentHandler) Upload(w http.ResponseWriter, req *http.Request) {
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return
+	}
+
+	if !sameSiteRequest(w, req, multipartContentType) {
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, h.maxSize+multipartOverhead)
+	if err := req.ParseMultipartForm(multipartMemory); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse form: %v", err))
+		return
+	}
+
+	room := req.FormValue(attachmentRoomField)
+	if !h.rooms.IsMember(room, usr.Name()) {
+		writeJSONError(w, http.StatusForbidden, "User is not a member of the room")
+		return
+	}
+
+	file, header, err := req.FormFile(attachmentFileField)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot read file: %v", err))
+		return
+	}
+	defer file.Close()
+
+	att, err := h.attachments.Upload(usr.Name(), room, header.Filename, file)
+	if errors.Is(err, attachment.ErrTooLarge) || errors.Is(err, attachment.ErrImageTooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	} else if errors.Is(err, attachment.ErrInvalidImage) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot store attachment: %v", err))
+		return
+	}
+
+	logger.Infof("Attachment %v uploaded by %v into room %v", att.ID, usr.Name(), room)
+
+	writeJSON(w, http.StatusCreated, att)
+}
+
+// Download returns content of the attachment. Only members of the room
+// the attachment was uploaded into can download it.
+func (h *AttachmentHandler) Download(w http.ResponseWriter, req *http.Request) {
+	att, ok := h.findAccessible(w, req)
+	if !ok {
+		return
+	}
+
+	content, err := h.attachments.Open(att)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot read attachment: %v", err))
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	if att.Inline() {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(w, content); err != nil {
+		logger.Warnf("Error while sending attachment %v. Error: %v", att.ID, err)
+	}
+}
+
+// DownloadThumbnail returns thumbnail of the image attachment. Only members of the room
+// the attachment was uploaded into can download it.
+func (h *AttachmentHandler) DownloadThumbnail(w http.ResponseWriter, req *http.Request) {
+	att, ok := h.findAccessible(w, req)
+	if !ok {
+		return
+	}
+
+	content, err := h.attachments.OpenThumbnail(att)
+	if errors.Is(err, attachment.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Attachment has no thumbnail")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot read thumbnail: %v", err))
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", att.Thumbnail)
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(w, content); err != nil {
+		logger.Warnf("Error while sending thumbnail of attachment %v. Error: %v", att.ID, err)
+	}
+}
+
+// findAccessible returns attachment with id given in the path if current user can access it.
+// Otherwise writes error response and returns false.
+func (h *AttachmentHandler) findAccessible(w http.ResponseWriter, req *http.Request) (*attachment.Attachment, bool) {
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return nil, false
+	}
+
+	att, err := h.attachments.Find(mux.Vars(req)[attachmentIDVar])
+	if errors.Is(err, attachment.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot find attachment: %v", err))
+		return nil, false
+	}
+
+	if !h.rooms.IsMember(att.Room, usr.Name()) {
+		writeJSONError(w, http.StatusForbidden, "User is not a member of the room")
+		return nil, false
+	}
+
+	return att, true
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// HealthCheck is a named function checking if a dependency of the application works.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthHandler struct responsible for reporting liveness and readiness of the application.
+type HealthHandler struct {
+	timeout time.Duration
+	checks  []HealthCheck
+}
+
+// NewHealthHandler returns new HealthHandler struct. All checks have to finish within given timeout.
+func NewHealthHandler(timeout time.Duration, checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{
+		timeout: timeout,
+		checks:  checks,
+	}
+}
+
+type healthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Live reports that the application is running.
+func (h *HealthHandler) Live(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{Status: statusOK})
+}
+
+// Ready runs all checks concurrently and reports if the application can serve requests.
+func (h *HealthHandler) Ready(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), h.timeout)
+	defer cancel()
+
+	response := healthResponse{Status: statusOK, Checks: make(map[string]*checkResult, len(h.checks))}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range h.checks {
+		wg.Add(1)
+
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			result := runCheck(ctx, check)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			response.Checks[check.Name] = result
+			if result.Status != statusOK {
+				response.Status = statusUnavailable
+			}
+		}(check)
+	}
+
+	wg.Wait()
+
+	status := http.StatusOK
+	if response.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, response)
+}
+
+// runCheck runs check and waits until it finishes or the context is done.
+func runCheck(ctx context.Context, check HealthCheck) *checkResult {
+	start := time.Now()
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := &checkResult{Status: statusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = statusUnavailable
+		result.Error = err.Error()
+	}
+
+	return result
+}
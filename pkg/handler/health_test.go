@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyShouldReportFailingAndHangingChecks(t *testing.T) {
+	// given
+	healthHandler := NewHealthHandler(50*time.Millisecond,
+		HealthCheck{Name: "ok", Check: func(ctx context.Context) error { return nil }},
+		HealthCheck{Name: "failing", Check: func(ctx context.Context) error { return errors.New("connection refused") }},
+		HealthCheck{Name: "hanging", Check: func(ctx context.Context) error { time.Sleep(time.Second); return nil }},
+	)
+
+	recorder := httptest.NewRecorder()
+
+	// when
+	healthHandler.Ready(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var response healthResponse
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+
+	assert.Equal(t, statusUnavailable, response.Status)
+	assert.Equal(t, statusOK, response.Checks["ok"].Status)
+	assert.Equal(t, "connection refused", response.Checks["failing"].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), response.Checks["hanging"].Error)
+}
+
+func TestReadyShouldReportReadyApplication(t *testing.T) {
+	// given
+	healthHandler := NewHealthHandler(time.Second,
+		HealthCheck{Name: "ok", Check: func(ctx context.Context) error { return nil }},
+	)
+
+	recorder := httptest.NewRecorder()
+
+	// when
+	healthHandler.Ready(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+	// then
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"status":"ok"`)
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/webhook"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/gorilla/mux"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	tokenVar = "token"
+
+	// maxIncomingPayload is a maximal size of the body of request posted to incoming hook.
+	maxIncomingPayload = 64 << 10
+)
+
+type incomingHookService interface {
+	Create(owner, room, name string) (*webhook.IncomingHook, string, error)
+	List(room string) ([]*webhook.IncomingHook, error)
+	Delete(room, id string) error
+	Authenticate(token string) (*webhook.IncomingHook, error)
+}
+
+type rateLimiter interface {
+	Allow(key string) bool
+}
+
+// IncomingWebhookHandler struct responsible for managing incoming hooks
+// and posting messages sent through them into rooms. Owners of the rooms
+// and administrators can manage hooks.
+type IncomingWebhookHandler struct {
+	sessionStore *session.Store
+	hooks        incomingHookService
+	rooms        roomOwnership
+	admins       Administrators
+	limiter      rateLimiter
+	post         exchange.Handler
+}
+
+// NewIncomingWebhookHandler returns new IncomingWebhookHandler struct. Messages posted
+// through hooks are limited by given limiter and passed to given handler.
+func NewIncomingWebhookHandler(sessionStore *session.Store, hooks incomingHookService, rooms roomOwnership,
+	admins Administrators, limiter rateLimiter, post exchange.Handler) *IncomingWebhookHandler {
+	return &IncomingWebhookHandler{
+		sessionStore: sessionStore,
+		hooks:        hooks,
+		rooms:        rooms,
+		admins:       admins,
+		limiter:      limiter,
+		post:         post,
+	}
+}
+
+type incomingHookRequest struct {
+	Name string `json:"name"`
+}
+
+type incomingHookResponse struct {
+	*webhook.IncomingHook
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+type incomingMessage struct {
+	Text   string `json:"text"`
+	Format string `json:"format"`
+}
+
+// Create creates new incoming hook. Response contains token, which isn't available later.
+func (h *IncomingWebhookHandler) Create(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, h.admins, w, req)
+	if !ok {
+		return
+	}
+
+	if !sameSiteRequest(w, req, jsonContentType) {
+		return
+	}
+
+	var body incomingHookRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse request: %v", err))
+		return
+	}
+
+	if l := len(body.Name); l < minUsernameLen || l > maxUsernameLen {
+		writeJSONError(w, http.StatusBadRequest, "Name should have more than 3 and less than 200 characters")
+		return
+	}
+
+	hook, token, err := h.hooks.Create(usr.Name(), room, body.Name)
+	if errors.Is(err, webhook.ErrNameTaken) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot create incoming hook: %v", err))
+		return
+	}
+
+	logger.Infof("Incoming hook %v created by %v for room %v", hook.ID, usr.Name(), room)
+
+	writeJSON(w, http.StatusCreated, incomingHookResponse{
+		IncomingHook: hook,
+		Token:        token,
+		URL:          "/api/hooks/" + token,
+	})
+}
+
+// List returns incoming hooks of the room.
+func (h *IncomingWebhookHandler) List(w http.ResponseWriter, req *http.Request) {
+	_, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, h.admins, w, req)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.hooks.List(room)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot read incoming hooks: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+// Delete removes incoming hook.
+func (h *IncomingWebhookHandler) Delete(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, h.admins, w, req)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)[webhookVar]
+
+	err := h.hooks.Delete(room, id)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot remove incoming hook: %v", err))
+		return
+	}
+
+	logger.Infof("Incoming hook %v removed by %v from room %v", id, usr.Name(), room)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Post sends message from the request body into the room of the hook identified by the token.
+func (h *IncomingWebhookHandler) Post(w http.ResponseWriter, req *http.Request) {
+	hook, err := h.hooks.Authenticate(mux.Vars(req)[tokenVar])
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Unknown hook")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot find hook: %v", err))
+		return
+	}
+
+	if !h.limiter.Allow(hook.ID) {
+		writeJSONError(w, http.StatusTooManyRequests, "Too many messages, slow down")
+		return
+	}
+
+	var body incomingMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxIncomingPayload)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse request: %v", err))
+		return
+	}
+
+	if _, exists := h.rooms.RoomOwner(hook.Room); !exists {
+		writeJSONError(w, http.StatusNotFound, "Room doesn't exist")
+		return
+	}
+
+	msg := &exchange.Message{
+		MsgType:    exchange.MsgTextMsgMT,
+		SenderID:   hook.SenderID(),
+		SenderName: hook.SenderName(),
+		Room:       hook.Room,
+		Content:    body.Text,
+		Format:     body.Format,
+	}
+
+	err = h.post.Handle(msg)
+	if clientErr, ok := exchange.AsClientError(err); ok {
+		writeJSONError(w, http.StatusUnprocessableEntity, clientErr.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot post message: %v", err))
+		return
+	}
+
+	logger.Infof("Message posted into room %v through incoming hook %v", hook.Room, hook.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
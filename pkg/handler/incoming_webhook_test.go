@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/user"
+	"github.com/adrian83/chat/pkg/webhook"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySessions implements the part of redis client used by session.Store.
+type memorySessions map[string]map[string]string
+
+func (m memorySessions) HMSet(key string, fields map[string]interface{}) *redis.StatusCmd {
+	if m[key] == nil {
+		m[key] = map[string]string{}
+	}
+	for field, value := range fields {
+		m[key][field] = fmt.Sprint(value)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (m memorySessions) Expire(key string, expiration time.Duration) *redis.BoolCmd {
+	return redis.NewBoolResult(true, nil)
+}
+
+func (m memorySessions) HGetAll(key string) *redis.StringStringMapCmd {
+	return redis.NewStringStringMapResult(m[key], nil)
+}
+
+func (m memorySessions) HDel(key string, fields ...string) *redis.IntCmd {
+	for _, field := range fields {
+		delete(m[key], field)
+	}
+	return redis.NewIntResult(int64(len(fields)), nil)
+}
+
+func (m memorySessions) Del(keys ...string) *redis.IntCmd {
+	for _, key := range keys {
+		delete(m, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func (m memorySessions) Close() error {
+	return nil
+}
+
+// newTestSessionStore returns session store with sessions of given users. Id of the session is the name of the user.
+func newTestSessionStore(t *testing.T, userNames ...string) *session.Store {
+	store := session.NewStore(memorySessions{}, SessionValidFor)
+
+	for _, name := range userNames {
+		sess, err := store.Create(name)
+		assert.NoError(t, err)
+		assert.NoError(t, sess.Add("user", user.User{ID: name, Login: name}))
+		assert.NoError(t, store.Save(sess))
+	}
+
+	return store
+}
+
+// newTestRequest returns request sent by user with given name, with given route variables.
+func newTestRequest(method, body, userName string, vars map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", jsonContentType)
+	}
+	if userName != "" {
+		req.AddCookie(&http.Cookie{Name: sessionIDName, Value: userName})
+	}
+	return mux.SetURLVars(req, vars)
+}
+
+type staticOwners map[string]string
+
+func (o staticOwners) RoomOwner(roomName string) (string, bool) {
+	owner, ok := o[roomName]
+	return owner, ok
+}
+
+func (o staticOwners) OwnerOf(roomName string) (string, bool) {
+	return o.RoomOwner(roomName)
+}
+
+// newTestIncomingHooks returns service keeping incoming hooks in given table. User anna is registered.
+func newTestIncomingHooks(db *dbtest.Table) *webhook.IncomingService {
+	users := user.NewUserService(dbtest.NewTable("id", &user.User{ID: "anna", Login: "anna"}))
+	return webhook.NewIncomingService(db, users)
+}
+
+type recordingHandler struct {
+	handled []*exchange.Message
+}
+
+func (h *recordingHandler) Handle(msg *exchange.Message) error {
+	h.handled = append(h.handled, msg)
+	if msg.Content == "" {
+		return exchange.NewClientError("Message cannot be empty")
+	}
+	return nil
+}
+
+func newTestIncomingWebhookHandler(t *testing.T, hooks *webhook.IncomingService, post exchange.Handler) *IncomingWebhookHandler {
+	sessions := newTestSessionStore(t, "john", "jane", "admin")
+	rooms := staticOwners{"ops": "john", exchange.MainRoomName(): ""}
+	limiter := exchange.NewRateLimiter(0, 2)
+
+	return NewIncomingWebhookHandler(sessions, hooks, rooms, NewAdministrators([]string{"admin"}), limiter, post)
+}
+
+func TestIncomingWebhookHandlerShouldLetOwnersAndAdminsManageHooks(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	handler := newTestIncomingWebhookHandler(t, newTestIncomingHooks(db), &recordingHandler{})
+
+	ops := map[string]string{roomVar: "ops"}
+	main := map[string]string{roomVar: exchange.MainRoomName()}
+
+	testData := []struct {
+		name        string
+		userName    string
+		vars        map[string]string
+		body        string
+		contentType string
+		origin      string
+		status      int
+	}{
+		{name: "owner", userName: "john", vars: ops, body: `{"name":"jenkins"}`, status: http.StatusCreated},
+		{name: "admin in main room", userName: "admin", vars: main, body: `{"name":"alerts"}`, status: http.StatusCreated},
+		{name: "member", userName: "jane", vars: ops, body: `{"name":"deploy"}`, status: http.StatusForbidden},
+		{name: "member in main room", userName: "jane", vars: main, body: `{"name":"deploy"}`, status: http.StatusForbidden},
+		{name: "anonymous", vars: ops, body: `{"name":"deploy"}`, status: http.StatusUnauthorized},
+		{name: "unknown room", userName: "john", vars: map[string]string{roomVar: "dev"}, body: `{"name":"deploy"}`, status: http.StatusNotFound},
+		{name: "name of user", userName: "john", vars: ops, body: `{"name":"anna"}`, status: http.StatusConflict},
+		{name: "short name", userName: "john", vars: ops, body: `{"name":"x"}`, status: http.StatusBadRequest},
+		{name: "plain text", userName: "john", vars: ops, body: `{"name":"deploy"}`, contentType: "text/plain", status: http.StatusUnsupportedMediaType},
+		{name: "other site", userName: "john", vars: ops, body: `{"name":"deploy"}`, origin: "http://evil.example.com", status: http.StatusForbidden},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			req := newTestRequest("POST", data.body, data.userName, data.vars)
+			if data.contentType != "" {
+				req.Header.Set("Content-Type", data.contentType)
+			}
+			if data.origin != "" {
+				req.Header.Set("Origin", data.origin)
+			}
+
+			// when
+			handler.Create(recorder, req)
+
+			// then
+			assert.Equal(t, data.status, recorder.Code)
+		})
+	}
+
+	// when
+	listRecorder := httptest.NewRecorder()
+	handler.List(listRecorder, newTestRequest("GET", "", "john", ops))
+
+	// then
+	var listed []*webhook.IncomingHook
+	assert.Equal(t, http.StatusOK, listRecorder.Code)
+	assert.NoError(t, json.NewDecoder(listRecorder.Body).Decode(&listed))
+	assert.Len(t, listed, 1)
+	assert.Equal(t, "jenkins", listed[0].Name)
+
+	// when
+	jenkins := map[string]string{roomVar: "ops", webhookVar: listed[0].ID}
+
+	deleteRecorder := httptest.NewRecorder()
+	handler.Delete(deleteRecorder, newTestRequest("DELETE", "", "john", jenkins))
+
+	missingRecorder := httptest.NewRecorder()
+	handler.Delete(missingRecorder, newTestRequest("DELETE", "", "john", jenkins))
+
+	// then
+	assert.Equal(t, http.StatusNoContent, deleteRecorder.Code)
+	assert.Equal(t, http.StatusNotFound, missingRecorder.Code)
+	assert.Equal(t, 1, db.Len())
+}
+
+func TestIncomingWebhookHandlerShouldPostMessagesAsIntegration(t *testing.T) {
+	// given
+	hooks := newTestIncomingHooks(dbtest.NewTable("id"))
+
+	ci, ciToken, err := hooks.Create("john", "ops", "ci")
+	assert.NoError(t, err)
+	_, goneToken, err := hooks.Create("jane", "dev", "gone")
+	assert.NoError(t, err)
+
+	post := &recordingHandler{}
+	handler := newTestIncomingWebhookHandler(t, hooks, post)
+
+	testData := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{name: "valid message", token: ciToken, body: `{"text":"build passed"}`, status: http.StatusAccepted},
+		{name: "invalid token", token: "token-unknown", body: `{"text":"build passed"}`, status: http.StatusNotFound},
+		{name: "removed room", token: goneToken, body: `{"text":"build passed"}`, status: http.StatusNotFound},
+		{name: "rejected message", token: ciToken, body: `{"text":""}`, status: http.StatusUnprocessableEntity},
+		{name: "rate limited", token: ciToken, body: `{"text":"build passed"}`, status: http.StatusTooManyRequests},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			// when
+			handler.Post(recorder, newTestRequest("POST", data.body, "", map[string]string{tokenVar: data.token}))
+
+			// then
+			assert.Equal(t, data.status, recorder.Code)
+		})
+	}
+
+	assert.Len(t, post.handled, 2)
+	assert.Equal(t, "ci (integration)", post.handled[0].SenderName)
+	assert.Equal(t, ci.SenderID(), post.handled[0].SenderID)
+	assert.Equal(t, "ops", post.handled[0].Room)
+	assert.Equal(t, "build passed", post.handled[0].Content)
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// errorResponse is a body of response returned when request cannot be processed.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes given body as JSON with given status code.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Warnf("Error while writing JSON response. Error: %v", err)
+	}
+}
+
+// writeJSONError writes error response with given status code and message.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
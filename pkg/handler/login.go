@@ -11,24 +11,42 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// LoginInvalidForm means that login form wasn't filled correctly.
+	LoginInvalidForm = "invalid_form"
+	// LoginUnknownUser means that user with given name doesn't exist.
+	LoginUnknownUser = "unknown_user"
+	// LoginWrongPassword means that given password doesn't match.
+	LoginWrongPassword = "wrong_password"
+	// LoginError means that login couldn't be processed because of server error.
+	LoginError = "error"
+)
+
 type userService interface {
 	FindUser(string) (*user.User, error)
 }
 
+type loginObserver interface {
+	LoginSucceeded()
+	LoginFailed(reason string)
+}
+
 // LoginHandler struct responsible for handling actions
 // made on login html page.
 type LoginHandler struct {
 	userService  userService
 	sessionStore *session.Store
 	templates    *TemplateRepository
+	observer     loginObserver
 }
 
-// NewLoginHandler returns new LoginHandler struct.
-func NewLoginHandler(templates *TemplateRepository, userService userService, sessionStore *session.Store) *LoginHandler {
+// NewLoginHandler returns new LoginHandler struct. Observer is notified about results of login attempts.
+func NewLoginHandler(templates *TemplateRepository, userService userService, sessionStore *session.Store, observer loginObserver) *LoginHandler {
 	return &LoginHandler{
 		userService:  userService,
 		sessionStore: sessionStore,
 		templates:    templates,
+		observer:     observer,
 	}
 }
 
@@ -42,6 +60,7 @@ func (h *LoginHandler) LoginUser(w http.ResponseWriter, req *http.Request) {
 	model := NewModel()
 
 	if err := req.ParseForm(); err != nil {
+		h.observer.LoginFailed(LoginInvalidForm)
 		model.AddError(fmt.Sprintf("Cannot parse form: %v", err))
 		RenderTemplateWithModel(w, h.templates.ServerError, model)
 		return
@@ -50,35 +69,42 @@ func (h *LoginHandler) LoginUser(w http.ResponseWriter, req *http.Request) {
 	username, password := h.validateLoginForm(req, model)
 
 	if model.HasErrors() {
+		h.observer.LoginFailed(LoginInvalidForm)
 		RenderTemplateWithModel(w, h.templates.Login, model)
 		return
 	}
 
 	usr, err := h.userService.FindUser(username)
 	if err != nil {
+		h.observer.LoginFailed(LoginError)
 		model.AddError(fmt.Sprintf("Cannot get data about user: %v", err))
 		RenderTemplateWithModel(w, h.templates.Login, model)
 		return
 	}
 
 	if usr.Empty() {
+		h.observer.LoginFailed(LoginUnknownUser)
 		model.AddError("User with this username doesn't exist")
 		RenderTemplateWithModel(w, h.templates.Login, model)
 		return
 	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(usr.Password), []byte(password)); err != nil {
+		h.observer.LoginFailed(LoginWrongPassword)
 		model.AddError(fmt.Sprintf("Passwords don't match: %v", err))
 		RenderTemplateWithModel(w, h.templates.Login, model)
 		return
 	}
 
 	if err = h.storeInSession(*usr, w); err != nil {
+		h.observer.LoginFailed(LoginError)
 		model.AddError(fmt.Sprintf("Cannot create session: %v", err))
 		RenderTemplateWithModel(w, h.templates.Login, model)
 		return
 	}
 
+	h.observer.LoginSucceeded()
+
 	http.Redirect(w, req, "/conversation", http.StatusFound)
 
 }
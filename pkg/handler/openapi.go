@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/attachment"
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/filter"
+	"github.com/adrian83/chat/pkg/history"
+	"github.com/adrian83/chat/pkg/openapi"
+	"github.com/adrian83/chat/pkg/retention"
+	"github.com/adrian83/chat/pkg/scheduler"
+	"github.com/adrian83/chat/pkg/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// APIPrefix is a prefix of paths of all JSON API routes.
+	APIPrefix = "/api/"
+	// OpenAPIPath is a path under which OpenAPI document is served.
+	OpenAPIPath = "/api/openapi.json"
+)
+
+// documentedPrefixes contains prefixes of paths of all routes described by the OpenAPI document.
+// Apart from the JSON API these are attachments, health checks and metrics, which are used
+// by clients and tools too. Pages rendered for the browser and the websocket aren't described.
+var documentedPrefixes = []string{APIPrefix, "/attachments", "/healthz", "/readyz", "/metrics"}
+
+var (
+	unauthorized = openapi.Status{Code: http.StatusUnauthorized, Description: "User is not logged in", Body: errorResponse{}}
+	badRequest   = openapi.Status{Code: http.StatusBadRequest, Description: "Invalid request", Body: errorResponse{}}
+	forbidden    = openapi.Status{Code: http.StatusForbidden, Description: "User is not allowed to perform the operation", Body: errorResponse{}}
+	notFound     = openapi.Status{Code: http.StatusNotFound, Description: "Room doesn't exist", Body: errorResponse{}}
+	rejected     = openapi.Status{Code: http.StatusUnprocessableEntity, Description: "Message rejected by the same rules which apply to websocket messages", Body: errorResponse{}}
+	noContent    = openapi.Status{Code: http.StatusNoContent}
+	crossSite    = openapi.Status{Code: http.StatusForbidden, Description: "Request sent from another site", Body: errorResponse{}}
+	notJSON      = openapi.Status{Code: http.StatusUnsupportedMediaType, Description: "Body is not sent as application/json", Body: errorResponse{}}
+
+	attachmentNotAccessible = openapi.Status{Code: http.StatusForbidden, Description: "User is not a member of the room the attachment was uploaded into", Body: errorResponse{}}
+	attachmentNotFound      = openapi.Status{Code: http.StatusNotFound, Description: "Attachment doesn't exist", Body: errorResponse{}}
+)
+
+// attachmentForm describes multipart form sent to upload the attachment.
+type attachmentForm struct {
+	File []byte `json:"file"`
+	Room string `json:"room"`
+}
+
+// apiOperations documents all routes of the JSON API. Bodies are described
+// with the same types which are used by the handlers.
+var apiOperations = map[string]*openapi.Operation{
+	openapi.Key("GET", "/api/rooms"): {
+		Summary:   "List rooms",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: []*exchange.RoomInfo{}}, unauthorized},
+	},
+	openapi.Key("POST", "/api/rooms"): {
+		Summary: "Create room owned by current user",
+		Request: roomRequest{},
+		Responses: []openapi.Status{
+			{Code: http.StatusCreated, Body: exchange.RoomInfo{}}, badRequest, unauthorized, crossSite, notJSON,
+			{Code: http.StatusConflict, Description: "Room already exists or its name belongs to another user", Body: errorResponse{}},
+			{Code: http.StatusServiceUnavailable, Description: "Maximal number of rooms exists", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("DELETE", "/api/rooms/{room}"): {
+		Summary:     "Remove room",
+		Description: "Only the owner can remove the room. Members are notified that they left the room. The name still belongs to the owner, so only the owner can create the room again.",
+		Responses:   []openapi.Status{noContent, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("GET", "/api/rooms/{room}/members"): {
+		Summary:   "List names of users who are members of the room",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: []string{}}, unauthorized, notFound},
+	},
+	openapi.Key("GET", "/api/rooms/{room}/messages"): {
+		Summary:     "Read history of the room",
+		Description: "Messages are sorted from the newest. Older messages can be read with 'before' value returned in the previous page. Members and the owner of the room can read its whole history, former members only messages posted before they left it.",
+		Parameters: []*openapi.Parameter{
+			{Name: "before", In: "query", Description: "Return messages older than 'before' value returned in the previous page or posted before given time", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "limit", In: "query", Description: "Maximal number of returned messages", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+		},
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: history.Page{}}, badRequest, unauthorized, forbidden},
+	},
+	openapi.Key("GET", "/api/rooms/{room}/export"): {
+		Summary:     "Download transcript of the room",
+		Description: "Messages are sorted from the oldest. History can be exported by administrators and users who can read it. Former members of the room can export only messages posted before they left it. If reading of the history fails while the transcript is sent, the transcript ends with a note that it is incomplete.",
+		Parameters: []*openapi.Parameter{
+			{Name: "format", In: "query", Description: "Format of the transcript, 'json' by default", Schema: &openapi.Schema{Type: "string", Enum: []string{history.FormatJSON, history.FormatCSV, history.FormatText, history.FormatHTML}}},
+			{Name: "from", In: "query", Description: "Export messages posted at given time or later", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "to", In: "query", Description: "Export messages posted before given time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+		},
+		Responses: []openapi.Status{
+			{Code: http.StatusOK, Description: "Transcript file in requested format"}, badRequest, unauthorized, forbidden,
+			{Code: http.StatusInternalServerError, Description: "History of the room cannot be read", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("GET", "/api/rooms/{room}/retention"): {
+		Summary:   "Read retention policy of the room",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: retention.Policy{}}, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("PUT", "/api/rooms/{room}/retention"): {
+		Summary:     "Set retention policy of the room",
+		Description: "Messages older than 'days' days and messages not being among the newest 'messages' messages are removed. Zero means no limit. Limits exceeding limits of the server's default policy are lowered to them. Administrators can manage policies of all rooms, including the main room.",
+		Request:     retentionRequest{},
+		Responses:   []openapi.Status{{Code: http.StatusOK, Body: retention.Policy{}}, badRequest, unauthorized, forbidden, notFound, notJSON},
+	},
+	openapi.Key("DELETE", "/api/rooms/{room}/retention"): {
+		Summary:     "Reset retention policy of the room",
+		Description: "The server's default policy is used for the room again.",
+		Responses:   []openapi.Status{{Code: http.StatusOK, Body: retention.Policy{}}, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("GET", "/api/scheduled"): {
+		Summary:     "List messages and reminders scheduled by current user",
+		Description: "Messages are sorted by the time they will be posted at.",
+		Responses:   []openapi.Status{{Code: http.StatusOK, Body: []*scheduler.Job{}}, unauthorized},
+	},
+	openapi.Key("DELETE", "/api/scheduled/{id}"): {
+		Summary: "Cancel message or reminder scheduled by current user",
+		Responses: []openapi.Status{noContent, unauthorized,
+			{Code: http.StatusNotFound, Description: "Scheduled message doesn't exist", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("GET", "/api/directory"): {
+		Summary:     "Search rooms directory",
+		Description: "Rooms joined by current user are flagged. Next page starts at 'offset' increased by the number of returned rooms.",
+		Parameters: []*openapi.Parameter{
+			{Name: "search", In: "query", Description: "Text contained in the name or topic of the room, case is ignored", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "sort", In: "query", Description: "Sort by 'name' (default), 'members' or 'activity'", Schema: &openapi.Schema{Type: "string", Enum: []string{exchange.DirectorySortName, exchange.DirectorySortMembers, exchange.DirectorySortActivity}}},
+			{Name: "offset", In: "query", Description: "Number of skipped rooms", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+			{Name: "limit", In: "query", Description: "Maximal number of returned rooms", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+		},
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: exchange.DirectoryPage{}}, badRequest, unauthorized},
+	},
+	openapi.Key("GET", "/api/search"): {
+		Summary:     "Search messages posted in rooms joined by current user",
+		Description: "Results are sorted from the newest. Snippets are escaped HTML with matches wrapped in 'mark' elements. Rooms the user left or which were removed are searched too, but only messages posted before the user left them are found. Older results can be read with 'before' set to the value returned in the previous page.",
+		Parameters: []*openapi.Parameter{
+			{Name: "text", In: "query", Required: true, Description: "Text contained in the message, case is ignored", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "room", In: "query", Description: "Search only messages posted in given room", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "sender", In: "query", Description: "Search only messages sent by given user", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "from", In: "query", Description: "Search messages posted at given time or later", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "to", In: "query", Description: "Search messages posted before given time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "before", In: "query", Description: "Search messages older than the last message of the previous page, value returned in the previous page", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "limit", In: "query", Description: "Maximal number of returned messages", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+		},
+		Responses: []openapi.Status{
+			{Code: http.StatusOK, Body: exchange.SearchPage{}}, badRequest, unauthorized,
+			{Code: http.StatusForbidden, Description: "User is not and was not a member of the searched room", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("POST", "/api/rooms/{room}/messages"): {
+		Summary:   "Post message as current user",
+		Request:   messageRequest{},
+		Responses: []openapi.Status{{Code: http.StatusAccepted, Body: messageResponse{}}, badRequest, unauthorized, crossSite, notFound, notJSON, rejected},
+	},
+	openapi.Key("GET", "/api/rooms/{room}/webhooks"): {
+		Summary:   "List webhooks of the room",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: []*webhook.Webhook{}}, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("POST", "/api/rooms/{room}/webhooks"): {
+		Summary:     "Register webhook",
+		Description: "Response contains secret used to sign notifications.",
+		Request:     webhookRequest{},
+		Responses:   []openapi.Status{{Code: http.StatusCreated, Body: webhook.Webhook{}}, badRequest, unauthorized, forbidden, notFound, notJSON},
+	},
+	openapi.Key("DELETE", "/api/rooms/{room}/webhooks/{id}"): {
+		Summary:   "Remove webhook",
+		Responses: []openapi.Status{noContent, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("GET", "/api/rooms/{room}/incoming-webhooks"): {
+		Summary:   "List incoming hooks of the room",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: []*webhook.IncomingHook{}}, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("POST", "/api/rooms/{room}/incoming-webhooks"): {
+		Summary:     "Create incoming hook",
+		Description: "Owner of the room and administrators can create hooks. Response contains token which isn't available later.",
+		Request:     incomingHookRequest{},
+		Responses: []openapi.Status{
+			{Code: http.StatusCreated, Body: incomingHookResponse{}}, badRequest, unauthorized, forbidden, notFound, notJSON,
+			{Code: http.StatusConflict, Description: "Name belongs to registered user", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("DELETE", "/api/rooms/{room}/incoming-webhooks/{id}"): {
+		Summary:   "Remove incoming hook",
+		Responses: []openapi.Status{noContent, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("GET", "/api/admin/clients"): {
+		Summary:     "List connected clients",
+		Description: "Every connection has its own random id, which is not related to the session of the user.",
+		Responses:   []openapi.Status{{Code: http.StatusOK, Body: []*exchange.ClientInfo{}}, unauthorized, forbidden},
+	},
+	openapi.Key("DELETE", "/api/admin/clients/{id}"): {
+		Summary:   "Disconnect client",
+		Responses: []openapi.Status{noContent, unauthorized, forbidden, {Code: http.StatusNotFound, Description: "Client isn't connected", Body: errorResponse{}}},
+	},
+	openapi.Key("GET", "/api/admin/rooms"): {
+		Summary:   "List rooms",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: []*exchange.RoomInfo{}}, unauthorized, forbidden},
+	},
+	openapi.Key("DELETE", "/api/admin/rooms/{room}"): {
+		Summary:     "Remove room",
+		Description: "Administrators can remove any room except the main one. Members are notified that they left the room.",
+		Responses:   []openapi.Status{noContent, unauthorized, forbidden, notFound},
+	},
+	openapi.Key("GET", "/api/admin/flags"): {
+		Summary:     "List unresolved messages flagged by the content filter",
+		Description: "Flags are sorted from the oldest. Fragments matching secret rules are redacted.",
+		Responses:   []openapi.Status{{Code: http.StatusOK, Body: []*filter.Flagged{}}, unauthorized, forbidden},
+	},
+	openapi.Key("POST", "/api/admin/flags/{id}/resolve"): {
+		Summary:   "Mark flagged message as reviewed",
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: filter.Flagged{}}, unauthorized, forbidden, {Code: http.StatusNotFound, Description: "Flag doesn't exist", Body: errorResponse{}}},
+	},
+	openapi.Key("GET", OpenAPIPath): {
+		Summary:   "Read this document",
+		Public:    true,
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: map[string]interface{}{}}},
+	},
+	openapi.Key("POST", "/attachments"): {
+		Summary:     "Upload attachment into the room",
+		Description: "Only members of the room can upload attachments. Metadata is removed from images and thumbnails are created for them.",
+		Request:     attachmentForm{},
+		RequestType: "multipart/form-data",
+		Responses: []openapi.Status{
+			{Code: http.StatusCreated, Body: attachment.Attachment{}}, unauthorized,
+			{Code: http.StatusBadRequest, Description: "Invalid form or image", Body: errorResponse{}},
+			{Code: http.StatusForbidden, Description: "User is not a member of the room or request sent from another site", Body: errorResponse{}},
+			{Code: http.StatusRequestEntityTooLarge, Description: "File or image is too large", Body: errorResponse{}},
+			{Code: http.StatusUnsupportedMediaType, Description: "Body is not sent as multipart/form-data", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("GET", "/attachments/{id}"): {
+		Summary:     "Download attachment",
+		Description: "Content is returned with the type detected when the attachment was uploaded.",
+		Responses:   []openapi.Status{{Code: http.StatusOK, Description: "Content of the attachment"}, unauthorized, attachmentNotAccessible, attachmentNotFound},
+	},
+	openapi.Key("GET", "/attachments/{id}/thumbnail"): {
+		Summary: "Download thumbnail of the image attachment",
+		Responses: []openapi.Status{{Code: http.StatusOK, Description: "Thumbnail of the image"}, unauthorized, attachmentNotAccessible,
+			{Code: http.StatusNotFound, Description: "Attachment doesn't exist or has no thumbnail", Body: errorResponse{}},
+		},
+	},
+	openapi.Key("GET", "/healthz"): {
+		Summary:   "Check if the application is running",
+		Public:    true,
+		Responses: []openapi.Status{{Code: http.StatusOK, Body: healthResponse{}}},
+	},
+	openapi.Key("GET", "/readyz"): {
+		Summary:     "Check if the application can serve requests",
+		Description: "Database, redis and rooms are checked.",
+		Public:      true,
+		Responses: []openapi.Status{
+			{Code: http.StatusOK, Body: healthResponse{}},
+			{Code: http.StatusServiceUnavailable, Description: "At least one check failed", Body: healthResponse{}},
+		},
+	},
+	openapi.Key("GET", "/metrics"): {
+		Summary:     "Read metrics of the application",
+		Description: "Metrics are returned in Prometheus text format. Token configured with METRICS_TOKEN has to be sent as a bearer token, without the token metrics aren't available.",
+		Public:      true,
+		Responses: []openapi.Status{
+			{Code: http.StatusOK, Description: "Metrics in Prometheus text format"},
+			{Code: http.StatusUnauthorized, Description: "Token is missing or invalid"},
+		},
+	},
+	openapi.Key("POST", "/api/hooks/{token}"): {
+		Summary:     "Post message through incoming hook",
+		Description: "Sender of the message is the name of the hook followed by '" + webhook.IntegrationSuffix + "'.",
+		Public:      true,
+		Request:     incomingMessage{},
+		Responses: []openapi.Status{
+			{Code: http.StatusAccepted}, badRequest, {Code: http.StatusNotFound, Description: "Unknown hook or room", Body: errorResponse{}}, rejected,
+			{Code: http.StatusTooManyRequests, Description: "Too many messages posted through the hook", Body: errorResponse{}},
+		},
+	},
+}
+
+// APIDocument returns OpenAPI document describing JSON API, attachments, health and metrics routes of given router.
+// Error is returned if any route is not documented or documentation describes route which doesn't exist.
+func APIDocument(router *mux.Router) (*openapi.Document, error) {
+	info := openapi.Info{
+		Title:       "Chat API",
+		Description: "Operations require session cookie set after logging in, unless stated otherwise.",
+		Version:     "1.0",
+	}
+
+	session := &openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: sessionIDName}
+
+	return openapi.Generate(router, documentedPrefixes, info, session, apiOperations)
+}
+
+// OpenAPIHandler struct responsible for serving OpenAPI document of the JSON API.
+type OpenAPIHandler struct {
+	router   *mux.Router
+	document *openapi.Document
+}
+
+// NewOpenAPIHandler returns new OpenAPIHandler struct describing routes of given router.
+// Generate has to be called after all routes are registered.
+func NewOpenAPIHandler(router *mux.Router) *OpenAPIHandler {
+	return &OpenAPIHandler{router: router}
+}
+
+// Generate creates OpenAPI document from the routes of the router.
+func (h *OpenAPIHandler) Generate() error {
+	document, err := APIDocument(h.router)
+	if err != nil {
+		return err
+	}
+
+	h.document = document
+	return nil
+}
+
+// Serve writes OpenAPI document.
+func (h *OpenAPIHandler) Serve(w http.ResponseWriter, req *http.Request) {
+	if h.document == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "API document is not generated yet")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.document)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/retention"
+	session "github.com/adrian83/go-redis-session"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+type retentionService interface {
+	Policy(room string) retention.Policy
+	SetPolicy(room string, days, messages int) (retention.Policy, error)
+	ResetPolicy(room string) (retention.Policy, error)
+}
+
+// RetentionHandler struct responsible for managing retention policies of the rooms.
+// Only owners of the rooms and administrators can manage their policies. Policies of the rooms
+// cannot keep messages longer than the server's default policy.
+type RetentionHandler struct {
+	sessionStore *session.Store
+	policies     retentionService
+	rooms        roomOwnership
+	admins       Administrators
+}
+
+// NewRetentionHandler returns new RetentionHandler struct. Administrators can manage policies
+// of all rooms, including the main room, which has no owner.
+func NewRetentionHandler(sessionStore *session.Store, policies retentionService, rooms roomOwnership, admins Administrators) *RetentionHandler {
+	return &RetentionHandler{
+		sessionStore: sessionStore,
+		policies:     policies,
+		rooms:        rooms,
+		admins:       admins,
+	}
+}
+
+type retentionRequest struct {
+	Days     int `json:"days"`
+	Messages int `json:"messages"`
+}
+
+// Get returns retention policy of the room.
+func (h *RetentionHandler) Get(w http.ResponseWriter, req *http.Request) {
+	_, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, h.admins, w, req)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.policies.Policy(room))
+}
+
+// Set sets own retention policy of the room.
+func (h *RetentionHandler) Set(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, h.admins, w, req)
+	if !ok {
+		return
+	}
+
+	if !sameSiteRequest(w, req, jsonContentType) {
+		return
+	}
+
+	var body retentionRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse request: %v", err))
+		return
+	}
+
+	policy, err := h.policies.SetPolicy(room, body.Days, body.Messages)
+	if errors.Is(err, retention.ErrInvalidPolicy) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot set retention policy: %v", err))
+		return
+	}
+
+	logger.Infof("Retention policy of room %v set by %v to %v days, %v messages", room, usr.Name(), policy.Days, policy.Messages)
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+// Reset removes own retention policy of the room, so the server's default policy is used.
+func (h *RetentionHandler) Reset(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, h.admins, w, req)
+	if !ok {
+		return
+	}
+
+	policy, err := h.policies.ResetPolicy(room)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot reset retention policy: %v", err))
+		return
+	}
+
+	logger.Infof("Retention policy of room %v reset by %v", room, usr.Name())
+
+	writeJSON(w, http.StatusOK, policy)
+}
@@ -0,0 +1,469 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/history"
+	"github.com/adrian83/chat/pkg/user"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/gorilla/mux"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxMessagePayload is a maximal size of the body of request with new message.
+	maxMessagePayload = 64 << 10
+	// apiSenderPrefix is a prefix of sender id of messages posted with the JSON API.
+	apiSenderPrefix = "api-"
+)
+
+type roomService interface {
+	roomOwnership
+	roomMembership
+	List() []*exchange.RoomInfo
+	Members(roomName string) ([]string, error)
+	CreateEmptyRoom(roomName, owner string) error
+	DeleteRoom(roomName string) error
+	SetTopic(roomName, userName, topic string) error
+	Directory(userName string, query exchange.DirectoryQuery) (*exchange.DirectoryPage, error)
+	ReadableRooms(userName string) map[string]time.Time
+	CanReadHistory(roomName, userName string) (time.Time, bool)
+}
+
+type historyService interface {
+	exchange.Searcher
+	Page(room string, before history.Cursor, limit int) (*history.Page, error)
+	Export(w io.Writer, query history.TranscriptQuery) error
+}
+
+// RoomHandler struct responsible for JSON API exposing rooms, their members and history.
+// Messages are posted with the same rules which apply to messages sent through websocket.
+type RoomHandler struct {
+	sessionStore *session.Store
+	rooms        roomService
+	history      historyService
+	post         exchange.Handler
+	admins       Administrators
+}
+
+// NewRoomHandler returns new RoomHandler struct. Posted messages are passed to given handler.
+// Administrators can export history of every room.
+func NewRoomHandler(sessionStore *session.Store, rooms roomService, history historyService, post exchange.Handler,
+	admins Administrators) *RoomHandler {
+	return &RoomHandler{
+		sessionStore: sessionStore,
+		rooms:        rooms,
+		history:      history,
+		post:         post,
+		admins:       admins,
+	}
+}
+
+type roomRequest struct {
+	Name  string `json:"name"`
+	Topic string `json:"topic,omitempty"`
+}
+
+type messageRequest struct {
+	Content     string   `json:"content"`
+	Format      string   `json:"format"`
+	Attachments []string `json:"attachments"`
+}
+
+type messageResponse struct {
+	ID string `json:"id"`
+}
+
+// List returns all rooms.
+func (h *RoomHandler) List(w http.ResponseWriter, req *http.Request) {
+	if _, ok := h.authenticate(w, req); !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.rooms.List())
+}
+
+// Create creates new room owned by current user.
+func (h *RoomHandler) Create(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	if !sameSiteRequest(w, req, jsonContentType) {
+		return
+	}
+
+	var body roomRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse request: %v", err))
+		return
+	}
+
+	if err := exchange.ValidateTopic(body.Topic); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := h.rooms.CreateEmptyRoom(body.Name, usr.Name())
+	if errors.Is(err, exchange.ErrInvalidRoomName) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if errors.Is(err, exchange.ErrRoomExists) || errors.Is(err, exchange.ErrRoomOwned) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	} else if errors.Is(err, exchange.ErrTooManyRooms) {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot create room: %v", err))
+		return
+	}
+
+	if body.Topic != "" {
+		if err := h.rooms.SetTopic(body.Name, usr.Name(), body.Topic); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot set topic: %v", err))
+			return
+		}
+	}
+
+	logger.Infof("Room %v created by %v", body.Name, usr.Name())
+
+	writeJSON(w, http.StatusCreated, &exchange.RoomInfo{Name: body.Name, Owner: usr.Name(), Topic: body.Topic})
+}
+
+// Delete removes room. Only the owner of the room can remove it.
+func (h *RoomHandler) Delete(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := authorizeRoomOwner(h.sessionStore, h.rooms, nil, w, req)
+	if !ok {
+		return
+	}
+
+	err := h.rooms.DeleteRoom(room)
+	if errors.Is(err, exchange.ErrRoomNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if errors.Is(err, exchange.ErrMainRoom) {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot remove room: %v", err))
+		return
+	}
+
+	logger.Infof("Room %v removed by %v", room, usr.Name())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Members returns names of users who are members of the room.
+func (h *RoomHandler) Members(w http.ResponseWriter, req *http.Request) {
+	if _, ok := h.authenticate(w, req); !ok {
+		return
+	}
+
+	members, err := h.rooms.Members(mux.Vars(req)[roomVar])
+	if errors.Is(err, exchange.ErrRoomNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot read members: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+// Post sends message from the request body into the room as current user.
+func (h *RoomHandler) Post(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	if !sameSiteRequest(w, req, jsonContentType) {
+		return
+	}
+
+	var body messageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxMessagePayload)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse request: %v", err))
+		return
+	}
+
+	room := mux.Vars(req)[roomVar]
+	if _, exists := h.rooms.RoomOwner(room); !exists {
+		writeJSONError(w, http.StatusNotFound, "Room doesn't exist")
+		return
+	}
+
+	msg := &exchange.Message{
+		MsgType:    exchange.MsgTextMsgMT,
+		SenderID:   apiSenderPrefix + usr.Name(),
+		SenderName: usr.Name(),
+		Room:       room,
+		Content:    body.Content,
+		Format:     body.Format,
+	}
+
+	for _, id := range body.Attachments {
+		msg.Attachments = append(msg.Attachments, &exchange.Attachment{ID: id})
+	}
+
+	err := h.post.Handle(msg)
+	if clientErr, ok := exchange.AsClientError(err); ok {
+		writeJSONError(w, http.StatusUnprocessableEntity, clientErr.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot post message: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, messageResponse{ID: msg.ID})
+}
+
+// History returns messages posted in the room, starting from the newest. Older messages
+// can be fetched with 'before' parameter taken from the previous page. Members and the owner
+// of the room can read its whole history, former members messages posted before they left the room.
+func (h *RoomHandler) History(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	room := mux.Vars(req)[roomVar]
+	until, ok := h.rooms.CanReadHistory(room, usr.Name())
+	if !ok {
+		writeJSONError(w, http.StatusForbidden, "Only members of the room can read its history")
+		return
+	}
+
+	var before history.Cursor
+	if value := req.URL.Query().Get("before"); value != "" {
+		parsed, err := history.ParseCursor(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Parameter 'before' should be a value returned in the previous page or a time in RFC3339 format")
+			return
+		}
+		before = parsed
+	}
+
+	var limit int
+	if value := req.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Parameter 'limit' should be a positive number")
+			return
+		}
+		limit = parsed
+	}
+
+	if !until.IsZero() && (before.IsZero() || before.Created.After(until)) {
+		before = history.Cursor{Created: until}
+	}
+
+	page, err := h.history.Page(room, before, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot read history: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Export streams transcript of the room's history as a file to download. Format is taken
+// from 'format' parameter (json by default), time range from 'from' and 'to' parameters.
+// History can be exported by administrators and the users who can read it with History, also after
+// the room was removed.
+func (h *RoomHandler) Export(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	room := mux.Vars(req)[roomVar]
+
+	var until time.Time
+	if !h.admins.IsAdmin(usr.Name()) {
+		if until, ok = h.rooms.CanReadHistory(room, usr.Name()); !ok {
+			writeJSONError(w, http.StatusForbidden, "Only members of the room can export its history")
+			return
+		}
+	}
+
+	params := req.URL.Query()
+
+	query := history.TranscriptQuery{Room: room, Format: params.Get("format")}
+	if query.Format == "" {
+		query.Format = history.FormatJSON
+	}
+
+	contentType, extension, err := history.TranscriptType(query.Format)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Parameter '%v' should be a time in RFC3339 format", name))
+			return
+		}
+		*target = parsed
+	}
+
+	if !until.IsZero() && (query.To.IsZero() || query.To.After(until)) {
+		query.To = until
+	}
+
+	fileName := fmt.Sprintf("%v-%v.%v", room, time.Now().UTC().Format("20060102-150405"), extension)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// the status is sent with the beginning of the transcript, so later errors can only be logged
+	// and the history store marks the transcript as incomplete
+	transcript := &transcriptResponse{ResponseWriter: w}
+	if err := h.history.Export(transcript, query); err != nil {
+		logger.Errorf("Cannot export history of room %v for %v. Error: %v", room, usr.Name(), err)
+
+		if !transcript.written {
+			w.Header().Del("Content-Disposition")
+			writeJSONError(w, http.StatusInternalServerError, "Cannot export history of the room")
+		}
+		return
+	}
+
+	logger.Infof("History of room %v exported by %v", room, usr.Name())
+}
+
+// transcriptResponse remembers if anything was written to the response.
+type transcriptResponse struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (r *transcriptResponse) Write(data []byte) (int, error) {
+	r.written = true
+	return r.ResponseWriter.Write(data)
+}
+
+// Directory returns page of rooms matching 'search' parameter, sorted according to 'sort' parameter.
+// Rooms joined by current user are flagged.
+func (h *RoomHandler) Directory(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	params := req.URL.Query()
+
+	query := exchange.DirectoryQuery{
+		Search: params.Get("search"),
+		Sort:   params.Get("sort"),
+	}
+
+	for name, target := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Parameter '%v' should be a non-negative number", name))
+			return
+		}
+		*target = parsed
+	}
+
+	page, err := h.rooms.Directory(usr.Name(), query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Search returns messages posted in the rooms which history can be read by current user, which content
+// contains 'text' parameter. Results can be restricted with 'room', 'sender', 'from' and 'to' parameters.
+// Older results can be fetched with 'before' parameter set to 'before' value taken from the previous page.
+func (h *RoomHandler) Search(w http.ResponseWriter, req *http.Request) {
+	usr, ok := h.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	params := req.URL.Query()
+
+	query := exchange.SearchQuery{
+		Text:   params.Get("text"),
+		Room:   params.Get("room"),
+		Sender: params.Get("sender"),
+		Before: params.Get("before"),
+	}
+
+	for name, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Parameter '%v' should be a time in RFC3339 format", name))
+			return
+		}
+		*target = &parsed
+	}
+
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Parameter 'limit' should be a positive number")
+			return
+		}
+		query.Limit = parsed
+	}
+
+	page, err := h.history.Search(h.rooms.ReadableRooms(usr.Name()), query)
+	if errors.Is(err, exchange.ErrInvalidSearch) || errors.Is(err, exchange.ErrInvalidSearchCursor) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if errors.Is(err, exchange.ErrSearchNotMember) {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot search messages: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *RoomHandler) authenticate(w http.ResponseWriter, req *http.Request) (*user.User, bool) {
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return nil, false
+	}
+
+	return usr, true
+}
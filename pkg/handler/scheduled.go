@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/scheduler"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/gorilla/mux"
+	logger "github.com/sirupsen/logrus"
+)
+
+const scheduledIDVar = "id"
+
+type scheduledService interface {
+	List(userName string) []*scheduler.Job
+	Cancel(userName, id string) error
+}
+
+// ScheduledHandler struct responsible for managing messages and reminders scheduled by the user.
+// Users can see and cancel only their own scheduled messages.
+type ScheduledHandler struct {
+	sessionStore *session.Store
+	scheduled    scheduledService
+}
+
+// NewScheduledHandler returns new ScheduledHandler struct.
+func NewScheduledHandler(sessionStore *session.Store, scheduled scheduledService) *ScheduledHandler {
+	return &ScheduledHandler{
+		sessionStore: sessionStore,
+		scheduled:    scheduled,
+	}
+}
+
+// List returns pending messages and reminders scheduled by current user.
+func (h *ScheduledHandler) List(w http.ResponseWriter, req *http.Request) {
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.scheduled.List(usr.Name()))
+}
+
+// Cancel removes pending message or reminder scheduled by current user.
+func (h *ScheduledHandler) Cancel(w http.ResponseWriter, req *http.Request) {
+	usr, err := ReadUserFromSession(h.sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return
+	}
+
+	id := mux.Vars(req)[scheduledIDVar]
+
+	err = h.scheduled.Cancel(usr.Name(), id)
+	if errors.Is(err, scheduler.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot cancel scheduled message: %v", err))
+		return
+	}
+
+	logger.Infof("Scheduled message %v cancelled by %v", id, usr.Name())
+
+	w.WriteHeader(http.StatusNoContent)
+}
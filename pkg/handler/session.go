@@ -2,7 +2,12 @@ package handler
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+
+	"github.com/adrian83/chat/pkg/user"
+	session "github.com/adrian83/go-redis-session"
 
 	"github.com/pkg/errors"
 )
@@ -11,18 +16,26 @@ import (
 // in redis and for how long cookie with session id exists.
 const SessionValidFor = 3600 // seconds
 
+const (
+	jsonContentType      = "application/json"
+	multipartContentType = "multipart/form-data"
+)
+
 var (
 	sessionIDName = "session_id"
 
 	errSessionCookieNotFound = fmt.Errorf("cookie with session id not found")
+	errUserNotLoggedIn       = fmt.Errorf("user is not logged in")
 )
 
-// StoreSessionCookie stores session cookie with given session id.
+// StoreSessionCookie stores session cookie with given session id. The cookie isn't sent
+// with requests changing state which come from other sites.
 func StoreSessionCookie(ID string, w http.ResponseWriter) {
 	cookie := &http.Cookie{
-		Name:   sessionIDName,
-		Value:  ID,
-		MaxAge: SessionValidFor,
+		Name:     sessionIDName,
+		Value:    ID,
+		MaxAge:   SessionValidFor,
+		SameSite: http.SameSiteLaxMode,
 	}
 
 	http.SetCookie(w, cookie)
@@ -31,9 +44,10 @@ func StoreSessionCookie(ID string, w http.ResponseWriter) {
 // RemoveSessionCookie removes cookie wirt session id.
 func RemoveSessionCookie(w http.ResponseWriter) {
 	cookie := &http.Cookie{
-		Name:   sessionIDName,
-		Value:  "",
-		MaxAge: -1,
+		Name:     sessionIDName,
+		Value:    "",
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
 	}
 
 	http.SetCookie(w, cookie)
@@ -50,3 +64,48 @@ func ReadSessionIDFromCookie(req *http.Request) (string, error) {
 	}
 	return sessionCookie.Value, nil
 }
+
+// ReadUserFromSession returns user kept in session which id is stored in request's cookie.
+func ReadUserFromSession(sessionStore *session.Store, req *http.Request) (*user.User, error) {
+	sessionID, err := ReadSessionIDFromCookie(req)
+	if err != nil {
+		return nil, err
+	}
+
+	userSession, err := sessionStore.Find(sessionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error while getting user session")
+	}
+
+	var usr user.User
+	if err := userSession.Get("user", &usr); err != nil {
+		return nil, errors.Wrap(err, "error while getting user data from session")
+	}
+
+	if usr.Empty() {
+		return nil, errUserNotLoggedIn
+	}
+
+	return &usr, nil
+}
+
+// sameSiteRequest returns true if the request changing state authenticated with the session
+// cookie wasn't forged by another site. Its body has to be of given content type (JSON cannot
+// be sent by other sites without CORS preflight) and its Origin, if sent, has to match the host.
+// Otherwise error response is written.
+func sameSiteRequest(w http.ResponseWriter, req *http.Request, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != contentType {
+		writeJSONError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Content-Type should be %v", contentType))
+		return false
+	}
+
+	if origin := req.Header.Get("Origin"); origin != "" {
+		if originURL, err := url.Parse(origin); err != nil || originURL.Host != req.Host {
+			writeJSONError(w, http.StatusForbidden, "Requests from other sites are not allowed")
+			return false
+		}
+	}
+
+	return true
+}
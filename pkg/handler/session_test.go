@@ -1 +1,60 @@
 package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameSiteRequestShouldRejectForgeableRequests(t *testing.T) {
+	testData := map[string]struct {
+		contentType string
+		origin      string
+		status      int
+	}{
+		"json without origin":       {contentType: "application/json", status: http.StatusOK},
+		"json with charset":         {contentType: "application/json; charset=utf-8", origin: "http://chat.example.com", status: http.StatusOK},
+		"plain text":                {contentType: "text/plain", status: http.StatusUnsupportedMediaType},
+		"form":                      {contentType: "application/x-www-form-urlencoded", status: http.StatusUnsupportedMediaType},
+		"no content type":           {status: http.StatusUnsupportedMediaType},
+		"json from other site":      {contentType: "application/json", origin: "http://evil.example.com", status: http.StatusForbidden},
+		"json from opaque origin":   {contentType: "application/json", origin: "null", status: http.StatusForbidden},
+		"json from other site port": {contentType: "application/json", origin: "http://chat.example.com:8080", status: http.StatusForbidden},
+	}
+
+	for name, data := range testData {
+		t.Run(name, func(t *testing.T) {
+			// given
+			req := httptest.NewRequest("POST", "http://chat.example.com/api/rooms", nil)
+			if data.contentType != "" {
+				req.Header.Set("Content-Type", data.contentType)
+			}
+			if data.origin != "" {
+				req.Header.Set("Origin", data.origin)
+			}
+			recorder := httptest.NewRecorder()
+
+			// when
+			allowed := sameSiteRequest(recorder, req, jsonContentType)
+
+			// then
+			assert.Equal(t, data.status == http.StatusOK, allowed)
+			assert.Equal(t, data.status, recorder.Code)
+		})
+	}
+}
+
+func TestStoreSessionCookieShouldNotSendCookieWithCrossSiteRequests(t *testing.T) {
+	// given
+	recorder := httptest.NewRecorder()
+
+	// when
+	StoreSessionCookie("session", recorder)
+
+	// then
+	cookies := recorder.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+}
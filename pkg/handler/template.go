@@ -12,6 +12,7 @@ func NewTemplateRepository(templatesPath string) *TemplateRepository {
 		ServerError:  NewTemplateBuilder(templatesPath).WithTemplate("main").WithContent("error500").WithTags("footer", "errors", "navigation", "head").Build(),
 		Index:        NewTemplateBuilder(templatesPath).WithTemplate("main").WithContent("index").WithTags("errors", "footer", "navigation", "head", "info").Build(),
 		Register:     NewTemplateBuilder(templatesPath).WithTemplate("main").WithContent("register").WithTags("footer", "navigation", "head", "errors").Build(),
+		Admin:        NewTemplateBuilder(templatesPath).WithTemplate("main").WithContent("admin").WithTags("footer", "navigation", "head", "errors").Build(),
 	}
 }
 
@@ -22,4 +23,5 @@ type TemplateRepository struct {
 	ServerError  *template.Template
 	Index        *template.Template
 	Register     *template.Template
+	Admin        *template.Template
 }
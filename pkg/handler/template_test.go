@@ -15,7 +15,7 @@ func TestTemplatesShouldNotBeNilAndHaveProperNames(t *testing.T) {
 	templates := NewTemplateRepository(staticsPath)
 
 	// then
-	for _, tmpl := range []*template.Template{templates.Conversation, templates.Index, templates.Login, templates.Register, templates.ServerError} {
+	for _, tmpl := range []*template.Template{templates.Conversation, templates.Index, templates.Login, templates.Register, templates.ServerError, templates.Admin} {
 		assert.NotNil(t, tmpl)
 		assert.Equal(t, "main.html", tmpl.Name(), "different name")
 	}
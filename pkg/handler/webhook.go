@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adrian83/chat/pkg/user"
+	"github.com/adrian83/chat/pkg/webhook"
+	session "github.com/adrian83/go-redis-session"
+
+	"github.com/gorilla/mux"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	roomVar    = "room"
+	webhookVar = "id"
+)
+
+type webhookService interface {
+	Register(owner, room, url string, events []string) (*webhook.Webhook, error)
+	List(room string) []*webhook.Webhook
+	Delete(room, id string) error
+}
+
+type roomOwnership interface {
+	RoomOwner(roomName string) (string, bool)
+	OwnerOf(roomName string) (string, bool)
+}
+
+// WebhookHandler struct responsible for managing webhooks of the rooms.
+// Only owners of the rooms can manage their webhooks.
+type WebhookHandler struct {
+	sessionStore *session.Store
+	webhooks     webhookService
+	rooms        roomOwnership
+}
+
+// NewWebhookHandler returns new WebhookHandler struct.
+func NewWebhookHandler(sessionStore *session.Store, webhooks webhookService, rooms roomOwnership) *WebhookHandler {
+	return &WebhookHandler{
+		sessionStore: sessionStore,
+		webhooks:     webhooks,
+		rooms:        rooms,
+	}
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// Register creates new webhook. Response contains secret used to sign notifications.
+func (h *WebhookHandler) Register(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := h.authorizeOwner(w, req)
+	if !ok {
+		return
+	}
+
+	if !sameSiteRequest(w, req, jsonContentType) {
+		return
+	}
+
+	var body webhookRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Cannot parse request: %v", err))
+		return
+	}
+
+	hook, err := h.webhooks.Register(usr.Name(), room, body.URL, body.Events)
+	if errors.Is(err, webhook.ErrInvalidURL) || errors.Is(err, webhook.ErrInvalidEvent) || errors.Is(err, webhook.ErrForbiddenTarget) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot register webhook: %v", err))
+		return
+	}
+
+	logger.Infof("Webhook %v registered by %v for room %v", hook.ID, usr.Name(), room)
+
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// List returns webhooks registered for the room.
+func (h *WebhookHandler) List(w http.ResponseWriter, req *http.Request) {
+	_, room, ok := h.authorizeOwner(w, req)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.webhooks.List(room))
+}
+
+// Delete removes webhook.
+func (h *WebhookHandler) Delete(w http.ResponseWriter, req *http.Request) {
+	usr, room, ok := h.authorizeOwner(w, req)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(req)[webhookVar]
+
+	err := h.webhooks.Delete(room, id)
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("Cannot remove webhook: %v", err))
+		return
+	}
+
+	logger.Infof("Webhook %v removed by %v from room %v", id, usr.Name(), room)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) authorizeOwner(w http.ResponseWriter, req *http.Request) (*user.User, string, bool) {
+	return authorizeRoomOwner(h.sessionStore, h.rooms, nil, w, req)
+}
+
+// authorizeRoomOwner returns current user and room from the path if the user is the owner
+// of the room or one of given administrators. The room doesn't have to be running, its owner
+// is persisted. Otherwise writes error response and returns false.
+func authorizeRoomOwner(sessionStore *session.Store, rooms roomOwnership, admins Administrators, w http.ResponseWriter, req *http.Request) (*user.User, string, bool) {
+	usr, err := ReadUserFromSession(sessionStore, req)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, fmt.Sprintf("Cannot authenticate user: %v", err))
+		return nil, "", false
+	}
+
+	room := mux.Vars(req)[roomVar]
+
+	owner, exists := rooms.OwnerOf(room)
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "Room doesn't exist")
+		return nil, "", false
+	}
+
+	if owner != usr.Name() && !admins.IsAdmin(usr.Name()) {
+		writeJSONError(w, http.StatusForbidden, "Only the owner of the room can manage it")
+		return nil, "", false
+	}
+
+	return usr, room, true
+}
@@ -0,0 +1,93 @@
+package history
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+// Message is a persisted message posted in the room.
+type Message struct {
+	ID          string                 `json:"id" gorethink:"id"`
+	Room        string                 `json:"room" gorethink:"room"`
+	Sender      string                 `json:"sender" gorethink:"sender"`
+	Content     string                 `json:"content" gorethink:"content"`
+	Format      string                 `json:"format,omitempty" gorethink:"format,omitempty"`
+	HTML        string                 `json:"html,omitempty" gorethink:"html,omitempty"`
+	Attachments []*exchange.Attachment `json:"attachments,omitempty" gorethink:"attachments,omitempty"`
+	Created     time.Time              `json:"created" gorethink:"created"`
+}
+
+// NewMessage returns Message created from the message sent in the room.
+func NewMessage(msg *exchange.Message) *Message {
+	created := time.Now().UTC()
+	if msg.Time != nil {
+		created = *msg.Time
+	}
+
+	return &Message{
+		ID:          msg.ID,
+		Room:        msg.Room,
+		Sender:      msg.SenderName,
+		Content:     msg.Content,
+		Format:      msg.Format,
+		HTML:        msg.HTML,
+		Attachments: msg.Attachments,
+		Created:     created,
+	}
+}
+
+// Page is a part of the room's history, messages are sorted from the newest.
+// Before contains value which should be used to fetch older messages,
+// it is empty if there are no more messages.
+type Page struct {
+	Messages []*Message `json:"messages"`
+	Before   string     `json:"before,omitempty"`
+}
+
+const cursorSeparator = "_"
+
+// ErrInvalidCursor is returned when the cursor cannot be parsed.
+var ErrInvalidCursor = errors.New("cursor should be a value returned in the previous page or a time in RFC3339 format")
+
+// Cursor points at the oldest message of the page. Messages posted at the same time are
+// sorted by their ids, so the next page starts exactly after the cursor and no message is skipped.
+// Cursor without an id points at all messages posted at given time.
+type Cursor struct {
+	Created time.Time
+	ID      string
+}
+
+// NewCursor returns cursor pointing at given message.
+func NewCursor(msg *Message) Cursor {
+	return Cursor{Created: msg.Created, ID: msg.ID}
+}
+
+// ParseCursor parses value returned by String. Time in RFC3339 format is a valid cursor too.
+func ParseCursor(value string) (Cursor, error) {
+	parts := strings.SplitN(value, cursorSeparator, 2)
+
+	created, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	cursor := Cursor{Created: created}
+	if len(parts) == 2 {
+		cursor.ID = parts[1]
+	}
+
+	return cursor, nil
+}
+
+// IsZero returns true if the cursor doesn't point at any message.
+func (c Cursor) IsZero() bool {
+	return c.Created.IsZero()
+}
+
+// String returns the cursor in the format accepted by ParseCursor.
+func (c Cursor) String() string {
+	return c.Created.Format(time.RFC3339Nano) + cursorSeparator + c.ID
+}
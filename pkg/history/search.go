@@ -0,0 +1,156 @@
+package history
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+const (
+	// snippetContext is a number of bytes of the content shown before and after the first match.
+	snippetContext = 60
+	ellipsis       = "…"
+)
+
+// Search returns stored messages posted in given rooms which content contains searched text.
+// Messages of the room mapped to non-zero time have to be posted before that time. If the query
+// is restricted to a single room, the room has to be one of given rooms.
+func (s *Store) Search(rooms map[string]time.Time, query exchange.SearchQuery) (*exchange.SearchPage, error) {
+	text := strings.TrimSpace(query.Text)
+	if text == "" || utf8.RuneCountInString(text) > exchange.MaxSearchTextLength {
+		return nil, exchange.ErrInvalidSearch
+	}
+
+	if query.Room != "" {
+		until, ok := rooms[query.Room]
+		if !ok {
+			return nil, exchange.ErrSearchNotMember
+		}
+		rooms = map[string]time.Time{query.Room: until}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = exchange.DefaultSearchLimit
+	} else if limit > exchange.MaxSearchLimit {
+		limit = exchange.MaxSearchLimit
+	}
+
+	from := time.Unix(0, 0).UTC()
+	if query.From != nil {
+		from = *query.From
+	}
+
+	to, toKey := time.Now().UTC().Add(time.Minute), ""
+	if query.To != nil {
+		to = *query.To
+	}
+
+	if query.Before != "" {
+		cursor, err := ParseCursor(query.Before)
+		if err != nil {
+			return nil, exchange.ErrInvalidSearchCursor
+		}
+		to, toKey = cursor.Created, cursor.ID
+	}
+
+	page := &exchange.SearchPage{Results: make([]*exchange.SearchResult, 0)}
+	if len(rooms) == 0 {
+		return page, nil
+	}
+
+	values := make(map[string]interface{}, len(rooms))
+	for room, until := range rooms {
+		values[room] = nil
+		if !until.IsZero() {
+			values[room] = until
+		}
+	}
+
+	filters := make(map[string]interface{})
+	if query.Sender != "" {
+		filters["sender"] = query.Sender
+	}
+
+	// the same expression is used by the database and for highlighting matches
+	pattern := "(?i)" + regexp.QuoteMeta(text)
+
+	messages := make([]*Message, 0)
+	if err := s.db.FindMatching("content", pattern, "room", values, filters, "created", from, to, toKey, limit, &messages); err != nil {
+		return nil, fmt.Errorf("cannot search messages, error: %w", err)
+	}
+
+	matcher := regexp.MustCompile(pattern)
+	for _, msg := range messages {
+		page.Results = append(page.Results, &exchange.SearchResult{
+			ID:      msg.ID,
+			Room:    msg.Room,
+			Sender:  msg.Sender,
+			Created: msg.Created,
+			Snippet: snippet(msg.Content, matcher),
+		})
+	}
+
+	if len(messages) == limit {
+		page.Before = NewCursor(messages[len(messages)-1]).String()
+	}
+
+	return page, nil
+}
+
+// snippet returns HTML escaped fragment of the content around the first match of the matcher.
+// Matches inside the fragment are wrapped in <mark> element.
+func snippet(content string, matcher *regexp.Regexp) string {
+	matches := matcher.FindAllStringIndex(content, -1)
+	if len(matches) == 0 {
+		matches = [][]int{{0, 0}}
+	}
+
+	start := matches[0][0] - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+
+	end := matches[0][1] + snippetContext
+	if end > len(content) {
+		end = len(content)
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	var builder strings.Builder
+
+	if start > 0 {
+		builder.WriteString(ellipsis)
+	}
+
+	position := start
+	for _, match := range matches {
+		if match[0] == match[1] || match[1] > end {
+			continue
+		}
+
+		builder.WriteString(html.EscapeString(content[position:match[0]]))
+		builder.WriteString("<mark>")
+		builder.WriteString(html.EscapeString(content[match[0]:match[1]]))
+		builder.WriteString("</mark>")
+		position = match[1]
+	}
+
+	builder.WriteString(html.EscapeString(content[position:end]))
+
+	if end < len(content) {
+		builder.WriteString(ellipsis)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,177 @@
+package history
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func searchStore(messages ...*Message) *Store {
+	return NewStore(&memoryDatabase{messages: messages})
+}
+
+func storedMessage(id, room, sender, content string, created time.Time) *Message {
+	return &Message{ID: id, Room: room, Sender: sender, Content: content, Created: created}
+}
+
+func TestSearchShouldFindMessagesInGivenRoomsIgnoringCase(t *testing.T) {
+	// given
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := searchStore(
+		storedMessage("1", "ops", "john", "see https://example.com/Deploy", start),
+		storedMessage("2", "ops", "anna", "deploy is done", start.Add(time.Minute)),
+		storedMessage("3", "secret", "anna", "deploy secret", start.Add(2*time.Minute)),
+		storedMessage("4", "ops", "anna", "lunch?", start.Add(3*time.Minute)),
+	)
+
+	// when
+	page, err := store.Search(map[string]time.Time{"main": {}, "ops": {}}, exchange.SearchQuery{Text: "DEPLOY"})
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, page.Before)
+	assert.Len(t, page.Results, 2)
+
+	assert.Equal(t, "2", page.Results[0].ID)
+	assert.Equal(t, "ops", page.Results[0].Room)
+	assert.Equal(t, "anna", page.Results[0].Sender)
+	assert.Equal(t, "<mark>deploy</mark> is done", page.Results[0].Snippet)
+
+	assert.Equal(t, "1", page.Results[1].ID)
+	assert.Equal(t, "see https://example.com/<mark>Deploy</mark>", page.Results[1].Snippet)
+}
+
+func TestSearchShouldFilterByRoomSenderAndDates(t *testing.T) {
+	// given
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := searchStore(
+		storedMessage("1", "ops", "john", "link one", start),
+		storedMessage("2", "ops", "john", "link two", start.Add(time.Minute)),
+		storedMessage("3", "ops", "anna", "link three", start.Add(time.Minute)),
+		storedMessage("4", "dev", "john", "link four", start.Add(time.Minute)),
+		storedMessage("5", "ops", "john", "link five", start.Add(2*time.Minute)),
+	)
+
+	from := start.Add(time.Minute)
+	to := start.Add(2 * time.Minute)
+
+	// when
+	page, err := store.Search(map[string]time.Time{"dev": {}, "ops": {}}, exchange.SearchQuery{
+		Text:   "link",
+		Room:   "ops",
+		Sender: "john",
+		From:   &from,
+		To:     &to,
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Equal(t, "2", page.Results[0].ID)
+}
+
+func TestSearchShouldFindOnlyMessagesPostedBeforeFormerMembersLeftRooms(t *testing.T) {
+	// given
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := searchStore(
+		storedMessage("1", "ops", "john", "link one", start),
+		storedMessage("2", "ops", "john", "link two", start.Add(time.Minute)),
+		storedMessage("3", "dev", "john", "link three", start.Add(2*time.Minute)),
+	)
+
+	rooms := map[string]time.Time{"dev": {}, "ops": start.Add(time.Minute)}
+
+	// when
+	all, allErr := store.Search(rooms, exchange.SearchQuery{Text: "link"})
+	ops, opsErr := store.Search(rooms, exchange.SearchQuery{Text: "link", Room: "ops"})
+
+	// then
+	assert.NoError(t, allErr)
+	assert.Len(t, all.Results, 2)
+	assert.Equal(t, "3", all.Results[0].ID)
+	assert.Equal(t, "1", all.Results[1].ID)
+
+	assert.NoError(t, opsErr)
+	assert.Len(t, ops.Results, 1)
+	assert.Equal(t, "1", ops.Results[0].ID)
+}
+
+func TestSearchShouldReturnPagesOfResults(t *testing.T) {
+	// given
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := searchStore(
+		storedMessage("1", "ops", "john", "link one", start),
+		storedMessage("2", "ops", "john", "link two", start.Add(time.Minute)),
+		storedMessage("3", "ops", "john", "link three", start.Add(time.Minute)),
+		storedMessage("4", "ops", "john", "link four", start.Add(2*time.Minute)),
+	)
+
+	// when
+	first, err1 := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: "link", Limit: 2})
+	second, err2 := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: "link", Limit: 2, Before: first.Before})
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Len(t, first.Results, 2)
+	assert.Equal(t, "4", first.Results[0].ID)
+	assert.Equal(t, "3", first.Results[1].ID)
+	assert.Len(t, second.Results, 2)
+	assert.Equal(t, "2", second.Results[0].ID)
+	assert.Equal(t, "1", second.Results[1].ID)
+}
+
+func TestSearchShouldRejectInvalidQueries(t *testing.T) {
+	// given
+	store := searchStore()
+
+	// when
+	_, emptyErr := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: "  "})
+	_, longErr := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: strings.Repeat("a", exchange.MaxSearchTextLength+1)})
+	_, memberErr := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: "link", Room: "secret"})
+	_, cursorErr := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: "link", Before: "yesterday"})
+
+	// then
+	assert.Equal(t, exchange.ErrInvalidSearch, emptyErr)
+	assert.Equal(t, exchange.ErrInvalidSearch, longErr)
+	assert.Equal(t, exchange.ErrSearchNotMember, memberErr)
+	assert.Equal(t, exchange.ErrInvalidSearchCursor, cursorErr)
+}
+
+func TestSearchShouldTreatTextLiterally(t *testing.T) {
+	// given
+	store := searchStore(
+		storedMessage("1", "ops", "john", "costs $5.00 (net)", time.Now().UTC()),
+		storedMessage("2", "ops", "john", "costs $5a00 net", time.Now().UTC()),
+	)
+
+	// when
+	page, err := store.Search(map[string]time.Time{"ops": {}}, exchange.SearchQuery{Text: "$5.00 (net)"})
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Equal(t, "costs <mark>$5.00 (net)</mark>", page.Results[0].Snippet)
+}
+
+func TestSnippetShouldEscapeAndShortenContent(t *testing.T) {
+	// given
+	content := strings.Repeat("ą", 50) + " <b>link</b> " + strings.Repeat("ę", 50) + " link"
+	matcher := regexp.MustCompile("(?i)link")
+
+	// when
+	result := snippet(content, matcher)
+
+	// then
+	assert.True(t, strings.HasPrefix(result, ellipsis))
+	assert.True(t, strings.HasSuffix(result, ellipsis))
+	assert.Contains(t, result, " &lt;b&gt;<mark>link</mark>&lt;/b&gt; ")
+	assert.NotContains(t, result, "<mark>link</mark>"+ellipsis)
+	assert.True(t, utf8.ValidString(result))
+}
@@ -0,0 +1,160 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLimit is a number of messages returned when limit isn't specified.
+	DefaultLimit = 50
+	// MaxLimit is a maximal number of messages returned at once.
+	MaxLimit = 200
+
+	queueSize = 1000
+
+	// DroppedQueueFull means that message wasn't persisted because too many messages were waiting.
+	DroppedQueueFull = "history_queue_full"
+)
+
+// Database is an interface wrapping methods used to persist and read messages.
+type Database interface {
+	Insert(interface{}) error
+	FindBefore(property string, value interface{}, orderField string, before interface{}, beforeKey string,
+		limit int, result interface{}) error
+	FindMatching(textField, pattern, property string, values map[string]interface{}, filters map[string]interface{},
+		orderField string, from, to interface{}, toKey string, limit int, result interface{}) error
+	FindEach(property string, value interface{}, orderField string, from, to interface{},
+		newResult func() interface{}, f func(result interface{}) error) error
+}
+
+// DropCounter counts messages which weren't persisted by reason of the drop.
+type DropCounter interface {
+	Dropped(reason string)
+}
+
+// Store persists messages posted in rooms in the background and allows to read them.
+type Store struct {
+	db       Database
+	drops    DropCounter
+	queue    chan *Message
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewStore returns new Store. Start has to be called before messages are persisted.
+func NewStore(db Database) *Store {
+	return &Store{
+		db:       db,
+		queue:    make(chan *Message, queueSize),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// SetDropCounter sets counter of messages which weren't persisted. It should be called before Start.
+func (s *Store) SetDropCounter(counter DropCounter) {
+	s.drops = counter
+}
+
+// Start starts goroutine persisting messages.
+func (s *Store) Start() {
+	go func() {
+		defer close(s.done)
+
+		for {
+			select {
+			case msg := <-s.queue:
+				s.save(msg)
+			case <-s.stopping:
+				for {
+					select {
+					case msg := <-s.queue:
+						s.save(msg)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Close stops accepting new messages and waits until queued messages are persisted
+// or the context is done.
+func (s *Store) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+	})
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("messages not persisted before deadline, error: %w", ctx.Err())
+	}
+}
+
+// OnEvent queues posted messages to be persisted.
+func (s *Store) OnEvent(event *exchange.Event) {
+	if event.Type != exchange.EventMessagePosted || event.Message == nil {
+		return
+	}
+
+	msg := NewMessage(event.Message)
+
+	select {
+	case <-s.stopping:
+		logger.Warnf("Message %v in room %v not persisted, store is stopped", msg.ID, msg.Room)
+		return
+	default:
+	}
+
+	select {
+	case s.queue <- msg:
+	default:
+		logger.Errorf("Message %v in room %v not persisted, queue is full", msg.ID, msg.Room)
+		if s.drops != nil {
+			s.drops.Dropped(DroppedQueueFull)
+		}
+	}
+}
+
+func (s *Store) save(msg *Message) {
+	if err := s.db.Insert(msg); err != nil {
+		logger.Errorf("Cannot persist message %v in room %v. Error: %v", msg.ID, msg.Room, err)
+	}
+}
+
+// Page returns at most limit messages of given room older than the message pointed by the cursor.
+// Zero cursor means the newest messages.
+func (s *Store) Page(room string, before Cursor, limit int) (*Page, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	if before.IsZero() {
+		before = Cursor{Created: time.Now().UTC().Add(time.Minute)}
+	}
+
+	messages := make([]*Message, 0)
+	if err := s.db.FindBefore("room", room, "created", before.Created, before.ID, limit, &messages); err != nil {
+		return nil, fmt.Errorf("cannot read history of room %v, error: %w", room, err)
+	}
+
+	page := &Page{Messages: messages}
+	if len(messages) == limit {
+		page.Before = NewCursor(messages[len(messages)-1]).String()
+	}
+
+	return page, nil
+}
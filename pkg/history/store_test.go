@@ -0,0 +1,258 @@
+package history
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryDatabase struct {
+	lock     sync.Mutex
+	messages []*Message
+}
+
+func (m *memoryDatabase) Insert(entity interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = append(m.messages, entity.(*Message))
+	return nil
+}
+
+func (m *memoryDatabase) FindBefore(property string, value interface{}, orderField string, before interface{}, beforeKey string,
+	limit int, result interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	cursor := &Message{Created: before.(time.Time), ID: beforeKey}
+
+	found := make([]*Message, 0)
+	for _, msg := range m.messages {
+		if msg.Room == value && older(msg, cursor) {
+			found = append(found, msg)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return older(found[j], found[i])
+	})
+
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	*result.(*[]*Message) = found
+	return nil
+}
+
+func (m *memoryDatabase) FindMatching(textField, pattern, property string, values map[string]interface{}, filters map[string]interface{},
+	orderField string, from, to interface{}, toKey string, limit int, result interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	matcher := regexp.MustCompile(pattern)
+
+	cursor := &Message{Created: to.(time.Time), ID: toKey}
+
+	found := make([]*Message, 0)
+	for _, msg := range m.messages {
+		until, inRoom := values[msg.Room]
+		if inRoom && until != nil && !msg.Created.Before(until.(time.Time)) {
+			continue
+		}
+
+		if !inRoom || !matcher.MatchString(msg.Content) || msg.Created.Before(from.(time.Time)) || !older(msg, cursor) {
+			continue
+		}
+
+		if sender, ok := filters["sender"]; ok && msg.Sender != sender {
+			continue
+		}
+
+		found = append(found, msg)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return older(found[j], found[i])
+	})
+
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	*result.(*[]*Message) = found
+	return nil
+}
+
+func (m *memoryDatabase) FindEach(property string, value interface{}, orderField string, from, to interface{},
+	newResult func() interface{}, f func(result interface{}) error) error {
+	m.lock.Lock()
+	found := make([]*Message, 0)
+	for _, msg := range m.messages {
+		if msg.Room == value && !msg.Created.Before(from.(time.Time)) && msg.Created.Before(to.(time.Time)) {
+			found = append(found, msg)
+		}
+	}
+	m.lock.Unlock()
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Created.Before(found[j].Created)
+	})
+
+	for _, msg := range found {
+		result := newResult().(*Message)
+		*result = *msg
+		if err := f(result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func older(msg, than *Message) bool {
+	if msg.Created.Equal(than.Created) {
+		return msg.ID < than.ID
+	}
+	return msg.Created.Before(than.Created)
+}
+
+func postedEvent(room, content string, created time.Time) *exchange.Event {
+	return &exchange.Event{
+		Type: exchange.EventMessagePosted,
+		Room: room,
+		Message: &exchange.Message{
+			ID:         content,
+			Time:       &created,
+			SenderName: "john",
+			Room:       room,
+			Content:    content,
+		},
+	}
+}
+
+func TestStoreShouldPersistPostedMessagesAndReturnThemInPages(t *testing.T) {
+	// given
+	db := &memoryDatabase{}
+	store := NewStore(db)
+	store.Start()
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, content := range []string{"first", "second", "third"} {
+		store.OnEvent(postedEvent("ops", content, start.Add(time.Duration(i)*time.Minute)))
+	}
+	store.OnEvent(postedEvent("other", "elsewhere", start))
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "ops", User: "john"})
+
+	assert.NoError(t, store.Close(context.Background()))
+
+	// when
+	first, err1 := store.Page("ops", Cursor{}, 2)
+	before, _ := ParseCursor(first.Before)
+	second, err2 := store.Page("ops", before, 2)
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Len(t, db.messages, 4)
+
+	assert.Len(t, first.Messages, 2)
+	assert.Equal(t, "third", first.Messages[0].Content)
+	assert.Equal(t, "second", first.Messages[1].Content)
+	assert.Equal(t, "john", first.Messages[1].Sender)
+
+	assert.Len(t, second.Messages, 1)
+	assert.Equal(t, "first", second.Messages[0].Content)
+	assert.Empty(t, second.Before)
+}
+
+func TestStoreShouldNotSkipMessagesPostedAtTheSameTimeBetweenPages(t *testing.T) {
+	// given
+	posted := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	db := &memoryDatabase{messages: []*Message{
+		{ID: "a", Room: "ops", Created: posted},
+		{ID: "b", Room: "ops", Created: posted},
+		{ID: "c", Room: "ops", Created: posted},
+		{ID: "d", Room: "ops", Created: posted.Add(-time.Second)},
+	}}
+	store := NewStore(db)
+
+	// when
+	first, err1 := store.Page("ops", Cursor{}, 2)
+	before, err2 := ParseCursor(first.Before)
+	second, err3 := store.Page("ops", before, 2)
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.NoError(t, err3)
+
+	assert.Equal(t, "c", first.Messages[0].ID)
+	assert.Equal(t, "b", first.Messages[1].ID)
+	assert.Equal(t, Cursor{Created: posted, ID: "b"}, before)
+
+	assert.Len(t, second.Messages, 2)
+	assert.Equal(t, "a", second.Messages[0].ID)
+	assert.Equal(t, "d", second.Messages[1].ID)
+}
+
+func TestParseCursorShouldAcceptCursorsAndTimes(t *testing.T) {
+	// given
+	posted := time.Date(2020, 1, 1, 12, 0, 0, 5, time.UTC)
+
+	// when
+	cursor, cursorErr := ParseCursor(Cursor{Created: posted, ID: "a_b"}.String())
+	timeOnly, timeErr := ParseCursor(posted.Format(time.RFC3339))
+	_, invalidErr := ParseCursor("yesterday")
+
+	// then
+	assert.NoError(t, cursorErr)
+	assert.True(t, posted.Equal(cursor.Created))
+	assert.Equal(t, "a_b", cursor.ID)
+
+	assert.NoError(t, timeErr)
+	assert.Equal(t, "", timeOnly.ID)
+
+	assert.Equal(t, ErrInvalidCursor, invalidErr)
+}
+
+type countingDrops map[string]int
+
+func (c countingDrops) Dropped(reason string) {
+	c[reason]++
+}
+
+func TestStoreShouldCountMessagesDroppedWhenQueueIsFull(t *testing.T) {
+	// given
+	drops := countingDrops{}
+	store := NewStore(&memoryDatabase{})
+	store.SetDropCounter(drops)
+
+	// when
+	for i := 0; i < queueSize+2; i++ {
+		store.OnEvent(postedEvent("ops", "spam", time.Now()))
+	}
+
+	// then
+	assert.Equal(t, countingDrops{DroppedQueueFull: 2}, drops)
+}
+
+func TestStoreShouldIgnoreMessagesAfterClose(t *testing.T) {
+	// given
+	db := &memoryDatabase{}
+	store := NewStore(db)
+	store.Start()
+	assert.NoError(t, store.Close(context.Background()))
+
+	// when
+	store.OnEvent(postedEvent("ops", "late", time.Now()))
+
+	// then
+	assert.Empty(t, db.messages)
+}
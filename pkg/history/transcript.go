@@ -0,0 +1,369 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatJSON is a format of transcript which is a JSON document.
+	FormatJSON = "json"
+	// FormatCSV is a format of transcript which is a CSV file with a header.
+	FormatCSV = "csv"
+	// FormatText is a format of transcript which is a plain text, one message per line.
+	FormatText = "text"
+	// FormatHTML is a format of transcript which is a standalone HTML page.
+	FormatHTML = "html"
+
+	transcriptTimeFormat = "2006-01-02 15:04:05 MST"
+
+	// incompleteTranscript ends transcripts which couldn't be read to the end.
+	incompleteTranscript = "Transcript is incomplete, reading of the history failed"
+)
+
+// ErrUnknownFormat is returned when transcript is requested in unsupported format.
+var ErrUnknownFormat = errors.New("transcript format should be json, csv, text or html")
+
+// TranscriptQuery describes which messages should be exported and how. Zero From means
+// the oldest messages, zero To means messages posted until now.
+type TranscriptQuery struct {
+	Room   string
+	Format string
+	From   time.Time
+	To     time.Time
+}
+
+// TranscriptType returns content type and file extension of the transcript in given format.
+func TranscriptType(format string) (string, string, error) {
+	switch format {
+	case FormatJSON:
+		return "application/json", "json", nil
+	case FormatCSV:
+		return "text/csv; charset=utf-8", "csv", nil
+	case FormatText:
+		return "text/plain; charset=utf-8", "txt", nil
+	case FormatHTML:
+		return "text/html; charset=utf-8", "html", nil
+	default:
+		return "", "", ErrUnknownFormat
+	}
+}
+
+// Export writes messages of the room posted in given time range, from the oldest, as a transcript
+// in requested format. Messages are written while they are read, so the transcript isn't kept in memory.
+// Nothing is written if the history cannot be read at all. If reading fails after the transcript
+// was begun, the transcript ends with a visible note that it is incomplete.
+func (s *Store) Export(w io.Writer, query TranscriptQuery) error {
+	writer, err := newTranscriptWriter(w, query)
+	if err != nil {
+		return err
+	}
+
+	from := query.From
+	if from.IsZero() {
+		from = time.Unix(0, 0).UTC()
+	}
+
+	to := query.To
+	if to.IsZero() {
+		to = time.Now().UTC().Add(time.Minute)
+	}
+
+	// the transcript is begun with the first message, so errors of the query are returned before anything is written
+	begun := false
+	begin := func() error {
+		if begun {
+			return nil
+		}
+		begun = true
+		return writer.begin()
+	}
+
+	newMessage := func() interface{} {
+		return &Message{}
+	}
+
+	err = s.db.FindEach("room", query.Room, "created", from, to, newMessage, func(result interface{}) error {
+		if err := begin(); err != nil {
+			return err
+		}
+		return writer.write(result.(*Message))
+	})
+	if err != nil {
+		if begun {
+			if failErr := writer.fail(); failErr != nil {
+				logger.Errorf("Cannot end incomplete transcript of room %v. Error: %v", query.Room, failErr)
+			}
+		}
+		return fmt.Errorf("cannot export history of room %v, error: %w", query.Room, err)
+	}
+
+	if err := begin(); err != nil {
+		return fmt.Errorf("cannot write transcript of room %v, error: %w", query.Room, err)
+	}
+
+	if err := writer.end(); err != nil {
+		return fmt.Errorf("cannot write transcript of room %v, error: %w", query.Room, err)
+	}
+
+	return nil
+}
+
+type transcriptWriter interface {
+	begin() error
+	write(msg *Message) error
+	end() error
+	// fail ends the transcript with the note that it is incomplete.
+	fail() error
+}
+
+func newTranscriptWriter(w io.Writer, query TranscriptQuery) (transcriptWriter, error) {
+	switch query.Format {
+	case FormatJSON:
+		return &jsonTranscript{w: w, query: query}, nil
+	case FormatCSV:
+		return &csvTranscript{w: csv.NewWriter(w)}, nil
+	case FormatText:
+		return &textTranscript{w: w, query: query}, nil
+	case FormatHTML:
+		return &htmlTranscript{w: w, query: query}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// rangeDescription describes time range of the transcript in human readable form.
+func rangeDescription(query TranscriptQuery) string {
+	from, to := "the beginning", "now"
+	if !query.From.IsZero() {
+		from = query.From.UTC().Format(transcriptTimeFormat)
+	}
+	if !query.To.IsZero() {
+		to = query.To.UTC().Format(transcriptTimeFormat)
+	}
+	return fmt.Sprintf("from %v to %v", from, to)
+}
+
+// attachmentNames returns names of the attachments or their ids if names aren't known.
+func attachmentNames(msg *Message) []string {
+	names := make([]string, 0, len(msg.Attachments))
+	for _, attachment := range msg.Attachments {
+		if attachment.Name != "" {
+			names = append(names, attachment.Name)
+		} else {
+			names = append(names, attachment.ID)
+		}
+	}
+	return names
+}
+
+// jsonTranscript writes JSON document with the room's name, time range and array of messages.
+type jsonTranscript struct {
+	w     io.Writer
+	query TranscriptQuery
+	count int
+}
+
+type jsonTranscriptHeader struct {
+	Room string     `json:"room"`
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+func (t *jsonTranscript) begin() error {
+	header := jsonTranscriptHeader{Room: t.query.Room}
+	if !t.query.From.IsZero() {
+		header.From = &t.query.From
+	}
+	if !t.query.To.IsZero() {
+		header.To = &t.query.To
+	}
+
+	bts, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	// messages are appended to the header object
+	_, err = fmt.Fprintf(t.w, "%v,\"messages\":[", strings.TrimSuffix(string(bts), "}"))
+	return err
+}
+
+func (t *jsonTranscript) write(msg *Message) error {
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if t.count > 0 {
+		if _, err := io.WriteString(t.w, ","); err != nil {
+			return err
+		}
+	}
+	t.count++
+
+	_, err = t.w.Write(bts)
+	return err
+}
+
+func (t *jsonTranscript) end() error {
+	_, err := io.WriteString(t.w, "]}\n")
+	return err
+}
+
+func (t *jsonTranscript) fail() error {
+	bts, err := json.Marshal(incompleteTranscript)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(t.w, "],\"error\":%s}\n", bts)
+	return err
+}
+
+// csvTranscript writes CSV file with a header, names of the attachments are separated with spaces.
+type csvTranscript struct {
+	w *csv.Writer
+}
+
+func (t *csvTranscript) begin() error {
+	return t.w.Write([]string{"id", "created", "sender", "content", "attachments"})
+}
+
+func (t *csvTranscript) write(msg *Message) error {
+	return t.w.Write([]string{
+		msg.ID,
+		msg.Created.UTC().Format(time.RFC3339Nano),
+		csvCell(msg.Sender),
+		csvCell(msg.Content),
+		csvCell(strings.Join(attachmentNames(msg), " ")),
+	})
+}
+
+// csvCell prefixes cells which spreadsheets would evaluate as formulas with an apostrophe,
+// so content of the messages is shown as text when the transcript is opened.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (t *csvTranscript) end() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+func (t *csvTranscript) fail() error {
+	if err := t.w.Write([]string{"", "", "", incompleteTranscript, ""}); err != nil {
+		return err
+	}
+	return t.end()
+}
+
+// textTranscript writes every message in a separate line, following lines of multiline
+// messages are indented.
+type textTranscript struct {
+	w     io.Writer
+	query TranscriptQuery
+}
+
+func (t *textTranscript) begin() error {
+	_, err := fmt.Fprintf(t.w, "Transcript of room %v %v\n\n", t.query.Room, rangeDescription(t.query))
+	return err
+}
+
+func (t *textTranscript) write(msg *Message) error {
+	content := strings.ReplaceAll(msg.Content, "\n", "\n    ")
+
+	if names := attachmentNames(msg); len(names) > 0 {
+		content += fmt.Sprintf(" [attachments: %v]", strings.Join(names, ", "))
+	}
+
+	_, err := fmt.Fprintf(t.w, "[%v] %v: %v\n", msg.Created.UTC().Format(transcriptTimeFormat), msg.Sender, content)
+	return err
+}
+
+func (t *textTranscript) end() error {
+	return nil
+}
+
+func (t *textTranscript) fail() error {
+	_, err := fmt.Fprintf(t.w, "\n%v\n", incompleteTranscript)
+	return err
+}
+
+// htmlTranscript writes standalone HTML page, messages are rendered as escaped plain text.
+type htmlTranscript struct {
+	w     io.Writer
+	query TranscriptQuery
+}
+
+var htmlTranscriptTemplate = template.Must(template.New("transcript").Parse(`
+{{- define "begin" -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Transcript of room {{.Room}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #ddd; padding: 0.4em; text-align: left; vertical-align: top; }
+td.content { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Transcript of room {{.Room}}</h1>
+<p>{{.Range}}</p>
+<table>
+<tr><th>Time</th><th>Sender</th><th>Message</th></tr>
+{{end -}}
+{{- define "message" -}}
+<tr id="{{.ID}}"><td>{{.Time}}</td><td>{{.Sender}}</td><td class="content">{{.Content}}{{range .Attachments}}<br>[{{.}}]{{end}}</td></tr>
+{{end -}}
+{{- define "fail" -}}
+<tr class="error"><td colspan="3"><strong>{{.}}</strong></td></tr>
+{{end -}}
+{{- define "end" -}}
+</table>
+</body>
+</html>
+{{end -}}
+`))
+
+func (t *htmlTranscript) begin() error {
+	return htmlTranscriptTemplate.ExecuteTemplate(t.w, "begin", map[string]string{
+		"Room":  t.query.Room,
+		"Range": "Messages posted " + rangeDescription(t.query),
+	})
+}
+
+func (t *htmlTranscript) write(msg *Message) error {
+	return htmlTranscriptTemplate.ExecuteTemplate(t.w, "message", map[string]interface{}{
+		"ID":          msg.ID,
+		"Time":        msg.Created.UTC().Format(transcriptTimeFormat),
+		"Sender":      msg.Sender,
+		"Content":     msg.Content,
+		"Attachments": attachmentNames(msg),
+	})
+}
+
+func (t *htmlTranscript) end() error {
+	return htmlTranscriptTemplate.ExecuteTemplate(t.w, "end", nil)
+}
+
+func (t *htmlTranscript) fail() error {
+	if err := htmlTranscriptTemplate.ExecuteTemplate(t.w, "fail", incompleteTranscript); err != nil {
+		return err
+	}
+	return t.end()
+}
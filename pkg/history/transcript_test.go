@@ -0,0 +1,235 @@
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func transcriptStore() *Store {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	attached := storedMessage("2", "incident", "anna", "see <logs>\nand graphs", start.Add(time.Minute))
+	attached.Attachments = []*exchange.Attachment{{ID: "att-1", Name: "graph.png"}}
+
+	return searchStore(
+		storedMessage("3", "incident", "john", "resolved", start.Add(2*time.Minute)),
+		attached,
+		storedMessage("1", "incident", "john", "db is down", start),
+		storedMessage("4", "other", "john", "unrelated", start),
+		storedMessage("5", "incident", "john", "postmortem tomorrow", start.Add(time.Hour)),
+	)
+}
+
+// failingEachDatabase fails reading of the history after given number of messages.
+type failingEachDatabase struct {
+	*memoryDatabase
+	after int
+}
+
+func (db *failingEachDatabase) FindEach(property string, value interface{}, orderField string, from, to interface{},
+	newResult func() interface{}, f func(result interface{}) error) error {
+	read := 0
+	return db.memoryDatabase.FindEach(property, value, orderField, from, to, newResult, func(result interface{}) error {
+		if read == db.after {
+			return errors.New("connection lost")
+		}
+		read++
+		return f(result)
+	})
+}
+
+func transcriptQuery(format string) TranscriptQuery {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	return TranscriptQuery{Room: "incident", Format: format, From: start, To: start.Add(time.Hour)}
+}
+
+func TestExportShouldWriteJSONTranscriptFromTheOldestMessage(t *testing.T) {
+	// given
+	store := transcriptStore()
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery(FormatJSON))
+
+	// then
+	assert.NoError(t, err)
+
+	var transcript struct {
+		Room     string     `json:"room"`
+		From     time.Time  `json:"from"`
+		Messages []*Message `json:"messages"`
+	}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &transcript))
+	assert.Equal(t, "incident", transcript.Room)
+	assert.Equal(t, transcriptQuery(FormatJSON).From, transcript.From)
+	assert.Len(t, transcript.Messages, 3)
+	assert.Equal(t, "1", transcript.Messages[0].ID)
+	assert.Equal(t, "2", transcript.Messages[1].ID)
+	assert.Equal(t, "3", transcript.Messages[2].ID)
+}
+
+func TestExportShouldWriteEmptyJSONTranscript(t *testing.T) {
+	// given
+	store := searchStore()
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, TranscriptQuery{Room: "incident", Format: FormatJSON})
+
+	// then
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"room":"incident","messages":[]}`, buffer.String())
+}
+
+func TestExportShouldWriteCSVTranscript(t *testing.T) {
+	// given
+	store := transcriptStore()
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery(FormatCSV))
+
+	// then
+	assert.NoError(t, err)
+
+	records, csvErr := csv.NewReader(&buffer).ReadAll()
+	assert.NoError(t, csvErr)
+	assert.Equal(t, [][]string{
+		{"id", "created", "sender", "content", "attachments"},
+		{"1", "2020-01-01T12:00:00Z", "john", "db is down", ""},
+		{"2", "2020-01-01T12:01:00Z", "anna", "see <logs>\nand graphs", "graph.png"},
+		{"3", "2020-01-01T12:02:00Z", "john", "resolved", ""},
+	}, records)
+}
+
+func TestExportShouldEscapeFormulasInCSVTranscript(t *testing.T) {
+	// given
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	attached := storedMessage("2", "incident", "anna", "-2+3", start.Add(time.Minute))
+	attached.Attachments = []*exchange.Attachment{{ID: "att-1", Name: "@evil.csv"}}
+
+	store := searchStore(
+		storedMessage("1", "incident", "=cmd", `=HYPERLINK("http://evil","click")`, start),
+		attached,
+		storedMessage("3", "incident", "john", "a = b + c", start.Add(2*time.Minute)),
+	)
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery(FormatCSV))
+
+	// then
+	assert.NoError(t, err)
+
+	records, csvErr := csv.NewReader(&buffer).ReadAll()
+	assert.NoError(t, csvErr)
+	assert.Equal(t, [][]string{
+		{"id", "created", "sender", "content", "attachments"},
+		{"1", "2020-01-01T12:00:00Z", "'=cmd", `'=HYPERLINK("http://evil","click")`, ""},
+		{"2", "2020-01-01T12:01:00Z", "anna", "'-2+3", "'@evil.csv"},
+		{"3", "2020-01-01T12:02:00Z", "john", "a = b + c", ""},
+	}, records)
+}
+
+func TestExportShouldWriteTextTranscript(t *testing.T) {
+	// given
+	store := transcriptStore()
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery(FormatText))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "Transcript of room incident from 2020-01-01 12:00:00 UTC to 2020-01-01 13:00:00 UTC\n\n"+
+		"[2020-01-01 12:00:00 UTC] john: db is down\n"+
+		"[2020-01-01 12:01:00 UTC] anna: see <logs>\n    and graphs [attachments: graph.png]\n"+
+		"[2020-01-01 12:02:00 UTC] john: resolved\n", buffer.String())
+}
+
+func TestExportShouldWriteEscapedHTMLTranscript(t *testing.T) {
+	// given
+	store := transcriptStore()
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery(FormatHTML))
+
+	// then
+	assert.NoError(t, err)
+
+	page := buffer.String()
+	assert.Contains(t, page, "<title>Transcript of room incident</title>")
+	assert.Contains(t, page, `<tr id="1"><td>2020-01-01 12:00:00 UTC</td><td>john</td><td class="content">db is down</td></tr>`)
+	assert.Contains(t, page, "see &lt;logs&gt;\nand graphs<br>[graph.png]")
+	assert.NotContains(t, page, "postmortem")
+	assert.Contains(t, page, "</html>")
+}
+
+func TestExportShouldRejectUnknownFormat(t *testing.T) {
+	// given
+	store := transcriptStore()
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery("pdf"))
+	_, _, typeErr := TranscriptType("pdf")
+
+	// then
+	assert.Equal(t, ErrUnknownFormat, err)
+	assert.Equal(t, ErrUnknownFormat, typeErr)
+	assert.Zero(t, buffer.Len())
+}
+
+func TestExportShouldNotWriteAnythingWhenHistoryCannotBeRead(t *testing.T) {
+	// given
+	store := NewStore(&failingEachDatabase{memoryDatabase: transcriptStore().db.(*memoryDatabase)})
+	var buffer bytes.Buffer
+
+	// when
+	err := store.Export(&buffer, transcriptQuery(FormatJSON))
+
+	// then
+	assert.Error(t, err)
+	assert.Zero(t, buffer.Len())
+}
+
+func TestExportShouldEndTranscriptWithErrorWhenReadingFails(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCSV, FormatText, FormatHTML} {
+		// given
+		store := NewStore(&failingEachDatabase{memoryDatabase: transcriptStore().db.(*memoryDatabase), after: 1})
+		var buffer bytes.Buffer
+
+		// when
+		err := store.Export(&buffer, transcriptQuery(format))
+
+		// then
+		assert.Error(t, err, format)
+		assert.Contains(t, buffer.String(), "db is down", format)
+		assert.Contains(t, buffer.String(), incompleteTranscript, format)
+		assert.NotContains(t, buffer.String(), "resolved", format)
+	}
+
+	// when
+	store := NewStore(&failingEachDatabase{memoryDatabase: transcriptStore().db.(*memoryDatabase), after: 1})
+	var buffer bytes.Buffer
+	exportErr := store.Export(&buffer, transcriptQuery(FormatJSON))
+
+	var transcript map[string]interface{}
+	decodeErr := json.Unmarshal(buffer.Bytes(), &transcript)
+
+	// then
+	assert.Error(t, exportErr)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, incompleteTranscript, transcript["error"])
+	assert.Len(t, transcript["messages"], 1)
+}
@@ -0,0 +1,256 @@
+// Package markdown renders small subset of Markdown used in chat messages into HTML.
+// Everything which is not recognized as Markdown is escaped, so the result is safe
+// to be displayed in the browser. Only following elements are produced: p, br,
+// pre, code, blockquote, strong, em, del and a (with http, https or mailto links).
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	fence       = "```"
+	quotePrefix = ">"
+)
+
+var (
+	languageRegexp = regexp.MustCompile(`^[a-zA-Z0-9_+-]{1,20}$`)
+
+	allowedSchemes = map[string]struct{}{
+		"http":   {},
+		"https":  {},
+		"mailto": {},
+	}
+)
+
+// Render returns sanitized HTML representation of given Markdown text.
+func Render(source string) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	paragraph := make([]string, 0)
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>")
+			out.WriteString(renderLines(paragraph))
+			out.WriteString("</p>")
+			paragraph = paragraph[:0]
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, fence):
+			flush()
+			i = renderCodeBlock(&out, lines, i)
+
+		case strings.HasPrefix(trimmed, quotePrefix):
+			flush()
+			quote := make([]string, 0)
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), quotePrefix); i++ {
+				quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), quotePrefix), " "))
+			}
+			i--
+			out.WriteString("<blockquote>")
+			out.WriteString(renderLines(quote))
+			out.WriteString("</blockquote>")
+
+		case trimmed == "":
+			flush()
+
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+
+	flush()
+
+	return out.String()
+}
+
+// renderCodeBlock renders fenced code block which starts in line with given index
+// and returns index of the last line of the block.
+func renderCodeBlock(out *strings.Builder, lines []string, start int) int {
+	language := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[start]), fence))
+
+	out.WriteString("<pre><code")
+	if languageRegexp.MatchString(language) {
+		out.WriteString(` class="language-`)
+		out.WriteString(language)
+		out.WriteString(`"`)
+	}
+	out.WriteString(">")
+
+	end := start + 1
+	for ; end < len(lines) && strings.TrimSpace(lines[end]) != fence; end++ {
+		if end > start+1 {
+			out.WriteString("\n")
+		}
+		out.WriteString(html.EscapeString(lines[end]))
+	}
+
+	out.WriteString("</code></pre>")
+
+	return end
+}
+
+func renderLines(lines []string) string {
+	rendered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		rendered = append(rendered, renderInline(line))
+	}
+	return strings.Join(rendered, "<br>")
+}
+
+// emphasis describes inline elements enclosed in delimiters.
+var emphasis = []struct {
+	delimiter string
+	tag       string
+}{
+	{delimiter: "**", tag: "strong"},
+	{delimiter: "~~", tag: "del"},
+	{delimiter: "*", tag: "em"},
+	{delimiter: "_", tag: "em"},
+}
+
+func renderInline(text string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		if rendered, consumed := renderInlineElement(rest, i == 0 || !isWordByte(text[i-1])); consumed > 0 {
+			out.WriteString(rendered)
+			i += consumed
+			continue
+		}
+
+		out.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+
+	return out.String()
+}
+
+// renderInlineElement tries to render element which starts at the beginning of given text.
+// Returns rendered HTML and number of consumed bytes, or zero if there is no element.
+func renderInlineElement(text string, wordStart bool) (string, int) {
+	switch {
+	case text[0] == '\\' && len(text) > 1 && isPunctuation(text[1]):
+		return html.EscapeString(text[1:2]), 2
+
+	case text[0] == '`':
+		return renderCode(text)
+
+	case text[0] == '[':
+		return renderLink(text)
+
+	case wordStart && (strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://")):
+		return renderAutolink(text)
+	}
+
+	for _, e := range emphasis {
+		if !strings.HasPrefix(text, e.delimiter) || (e.delimiter == "_" && !wordStart) {
+			continue
+		}
+
+		inner := text[len(e.delimiter):]
+		end := strings.Index(inner, e.delimiter)
+		if end <= 0 || inner[0] == ' ' || inner[end-1] == ' ' {
+			continue
+		}
+
+		after := inner[end+len(e.delimiter):]
+		if e.delimiter == "_" && after != "" && isWordByte(after[0]) {
+			continue
+		}
+
+		return "<" + e.tag + ">" + renderInline(inner[:end]) + "</" + e.tag + ">", 2*len(e.delimiter) + end
+	}
+
+	return "", 0
+}
+
+func renderCode(text string) (string, int) {
+	ticks := len(text) - len(strings.TrimLeft(text, "`"))
+	delimiter := text[:ticks]
+
+	end := strings.Index(text[ticks:], delimiter)
+	if end < 0 {
+		return html.EscapeString(delimiter), ticks
+	}
+
+	code := strings.TrimSpace(text[ticks : ticks+end])
+	return "<code>" + html.EscapeString(code) + "</code>", 2*ticks + end
+}
+
+func renderLink(text string) (string, int) {
+	closeBracket := strings.Index(text, "](")
+	if closeBracket < 0 {
+		return "", 0
+	}
+
+	closeParen := strings.IndexByte(text[closeBracket:], ')')
+	if closeParen < 0 {
+		return "", 0
+	}
+
+	label := text[1:closeBracket]
+	href := strings.TrimSpace(text[closeBracket+2 : closeBracket+closeParen])
+	consumed := closeBracket + closeParen + 1
+
+	if label == "" || !safeURL(href) {
+		// link is rendered as plain text
+		return html.EscapeString(text[:consumed]), consumed
+	}
+
+	return anchor(href, renderInline(label)), consumed
+}
+
+func renderAutolink(text string) (string, int) {
+	end := strings.IndexAny(text, " \t<>\"")
+	if end < 0 {
+		end = len(text)
+	}
+
+	href := strings.TrimRight(text[:end], ".,;:!?)'")
+	if !safeURL(href) {
+		return "", 0
+	}
+
+	return anchor(href, html.EscapeString(href)), len(href)
+}
+
+func anchor(href, label string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">` + label + "</a>"
+}
+
+// safeURL returns true if given URL is absolute and uses one of allowed schemes.
+func safeURL(rawURL string) bool {
+	if strings.ContainsAny(rawURL, " \t\n") {
+		return false
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	_, ok := allowedSchemes[strings.ToLower(parsed.Scheme)]
+	return ok && (parsed.Host != "" || parsed.Opaque != "")
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+func isPunctuation(b byte) bool {
+	return strings.IndexByte("\\`*_[]()~>#+-.!", b) >= 0
+}
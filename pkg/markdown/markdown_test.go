@@ -0,0 +1,48 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderShouldSupportFormatting(t *testing.T) {
+	testData := map[string]string{
+		"hello **bold** and *italic*":      "<p>hello <strong>bold</strong> and <em>italic</em></p>",
+		"use `go test ./...` to run":       "<p>use <code>go test ./...</code> to run</p>",
+		"snake_case_name stays _as is_":    "<p>snake_case_name stays <em>as is</em></p>",
+		"first\nsecond\n\nthird":           "<p>first<br>second</p><p>third</p>",
+		"> quoted\n> text":                 "<blockquote>quoted<br>text</blockquote>",
+		"```go\nfmt.Println(\"<b>\")\n```": `<pre><code class="language-go">fmt.Println(&#34;&lt;b&gt;&#34;)</code></pre>`,
+		"[docs](https://golang.org/doc)":   `<p><a href="https://golang.org/doc" rel="nofollow noopener noreferrer" target="_blank">docs</a></p>`,
+		"see https://golang.org.":          `<p>see <a href="https://golang.org" rel="nofollow noopener noreferrer" target="_blank">https://golang.org</a>.</p>`,
+	}
+
+	for source, expected := range testData {
+		// when
+		result := Render(source)
+
+		// then
+		assert.Equal(t, expected, result, source)
+	}
+}
+
+func TestRenderShouldRemoveUnsafeContent(t *testing.T) {
+	testData := map[string]string{
+		"<script>alert(1)</script>":                         "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		"[click](javascript:alert(1))":                      "<p>[click](javascript:alert(1))</p>",
+		"[click](data:text/html;base64,PHNjcmlwdD4=)":       "<p>[click](data:text/html;base64,PHNjcmlwdD4=)</p>",
+		`[x](https://a.com/" onclick="alert(1))`:            `<p>[x](https://a.com/&#34; onclick=&#34;alert(1))</p>`,
+		"```\"><script>\n<img src=x onerror=alert(1)>\n```": "<pre><code>&lt;img src=x onerror=alert(1)&gt;</code></pre>",
+		"**<img src=x>**":                                   "<p><strong>&lt;img src=x&gt;</strong></p>",
+		"https://a.com/<script>":                            `<p><a href="https://a.com/" rel="nofollow noopener noreferrer" target="_blank">https://a.com/</a>&lt;script&gt;</p>`,
+	}
+
+	for source, expected := range testData {
+		// when
+		result := Render(source)
+
+		// then
+		assert.Equal(t, expected, result, source)
+	}
+}
@@ -0,0 +1,224 @@
+// Package membership remembers rooms joined by the users.
+package membership
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// Member records that the user joined the room with given name and when the user left it.
+// Left is zero while the user is a member of the room.
+type Member struct {
+	ID     string    `json:"id" gorethink:"id"`
+	Room   string    `json:"room" gorethink:"room"`
+	User   string    `json:"user" gorethink:"user"`
+	Joined time.Time `json:"joined" gorethink:"joined"`
+	Left   time.Time `json:"left" gorethink:"left"`
+}
+
+// memberID returns id of the membership. Room names cannot contain slashes, so ids are unique.
+func memberID(roomName, userName string) string {
+	return roomName + "/" + userName
+}
+
+// Database is an interface which defines persistence of memberships.
+type Database interface {
+	Upsert(interface{}) error
+	All(result interface{}) error
+}
+
+const queueSize = 1000
+
+// Store remembers rooms joined by the users and when they left them, so they can read history
+// of the rooms posted before they left them or the rooms were removed. Time of the first join
+// is kept when the user joins the room again. Memberships are cached in memory and persisted
+// in the background.
+type Store struct {
+	db       Database
+	now      func() time.Time
+	lock     sync.RWMutex
+	rooms    map[string]map[string]*Member
+	queue    chan *Member
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewStore returns new instance of Store. Start has to be called before memberships are persisted.
+func NewStore(db Database) *Store {
+	return &Store{
+		db:       db,
+		now:      time.Now,
+		rooms:    map[string]map[string]*Member{},
+		queue:    make(chan *Member, queueSize),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts goroutine persisting memberships.
+func (s *Store) Start() {
+	go func() {
+		defer close(s.done)
+
+		for {
+			select {
+			case member := <-s.queue:
+				s.save(member)
+			case <-s.stopping:
+				for {
+					select {
+					case member := <-s.queue:
+						s.save(member)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Close stops accepting new memberships and waits until queued memberships are persisted
+// or the context is done.
+func (s *Store) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+	})
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("memberships not persisted before deadline, error: %w", ctx.Err())
+	}
+}
+
+// Load reads all memberships from database.
+func (s *Store) Load() error {
+	members := make([]*Member, 0)
+	if err := s.db.All(&members); err != nil {
+		return fmt.Errorf("cannot read memberships, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rooms = make(map[string]map[string]*Member)
+	for _, member := range members {
+		s.add(member)
+	}
+
+	return nil
+}
+
+// OnEvent remembers users who created, joined or left the rooms and queues their memberships
+// to be persisted. Users leave removed rooms as well. Memberships of the main room aren't stored.
+func (s *Store) OnEvent(event *exchange.Event) {
+	if event.Room == exchange.MainRoomName() {
+		return
+	}
+
+	var changed []*Member
+
+	s.lock.Lock()
+	switch event.Type {
+	case exchange.EventUserJoined, exchange.EventRoomCreated:
+		changed = s.join(event.Room, event.User)
+	case exchange.EventUserLeft:
+		changed = s.leave(event.Room, event.User)
+	case exchange.EventRoomRemoved:
+		for userName := range s.rooms {
+			changed = append(changed, s.leave(event.Room, userName)...)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, member := range changed {
+		s.enqueue(member)
+	}
+}
+
+// join marks the user as a member of the room and returns copy of changed membership.
+// It should be called with the lock held.
+func (s *Store) join(roomName, userName string) []*Member {
+	if userName == "" {
+		return nil
+	}
+
+	member, ok := s.rooms[userName][roomName]
+	if ok && member.Left.IsZero() {
+		return nil
+	}
+
+	if !ok {
+		member = &Member{ID: memberID(roomName, userName), Room: roomName, User: userName, Joined: s.now().UTC()}
+		s.add(member)
+	}
+	member.Left = time.Time{}
+
+	changed := *member
+	return []*Member{&changed}
+}
+
+// leave remembers when the user left the room and returns copy of changed membership.
+// It should be called with the lock held.
+func (s *Store) leave(roomName, userName string) []*Member {
+	member, ok := s.rooms[userName][roomName]
+	if !ok || !member.Left.IsZero() {
+		return nil
+	}
+
+	member.Left = s.now().UTC()
+
+	changed := *member
+	return []*Member{&changed}
+}
+
+func (s *Store) enqueue(member *Member) {
+	select {
+	case <-s.stopping:
+		logger.Warnf("Membership of %v in room %v not persisted, store is stopped", member.User, member.Room)
+		return
+	default:
+	}
+
+	select {
+	case s.queue <- member:
+	default:
+		logger.Errorf("Membership of %v in room %v not persisted, queue is full", member.User, member.Room)
+	}
+}
+
+func (s *Store) save(member *Member) {
+	if err := s.db.Upsert(member); err != nil {
+		logger.Errorf("Cannot store membership of %v in room %v. Error: %v", member.User, member.Room, err)
+	}
+}
+
+// Rooms returns rooms ever joined by the user with given name and times the user left them.
+// Time is zero if the user didn't leave the room.
+func (s *Store) Rooms(userName string) map[string]time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	rooms := make(map[string]time.Time, len(s.rooms[userName]))
+	for name, member := range s.rooms[userName] {
+		rooms[name] = member.Left
+	}
+
+	return rooms
+}
+
+func (s *Store) add(member *Member) {
+	if s.rooms[member.User] == nil {
+		s.rooms[member.User] = make(map[string]*Member)
+	}
+	s.rooms[member.User][member.Room] = member
+}
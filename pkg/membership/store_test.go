@@ -0,0 +1,80 @@
+package membership
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreShouldRememberRoomsJoinedByUser(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	store := NewStore(db)
+	store.Start()
+
+	// when
+	store.OnEvent(&exchange.Event{Type: exchange.EventRoomCreated, Room: "ops", User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "ops", User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "dev", User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: exchange.MainRoomName(), User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserLeft, Room: "qa", User: "john"})
+	closeErr := store.Close(context.Background())
+
+	// then
+	assert.NoError(t, closeErr)
+	assert.Equal(t, map[string]time.Time{"dev": {}, "ops": {}}, store.Rooms("john"))
+	assert.Empty(t, store.Rooms("jane"))
+	assert.Equal(t, 2, db.Len())
+
+	// when
+	restarted := NewStore(db)
+	loadErr := restarted.Load()
+
+	// then
+	assert.NoError(t, loadErr)
+	assert.Equal(t, map[string]time.Time{"dev": {}, "ops": {}}, restarted.Rooms("john"))
+}
+
+func TestStoreShouldRememberWhenUsersLeftRooms(t *testing.T) {
+	// given
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	db := dbtest.NewTable("id")
+	store := NewStore(db)
+	store.now = func() time.Time { return now }
+	store.Start()
+
+	// when
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "ops", User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "dev", User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "dev", User: "jane"})
+
+	now = now.Add(time.Hour)
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserLeft, Room: "ops", User: "john"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserLeft, Room: "dev", User: "jane"})
+
+	now = now.Add(time.Hour)
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserJoined, Room: "dev", User: "jane"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventRoomRemoved, Room: "dev"})
+	store.OnEvent(&exchange.Event{Type: exchange.EventUserLeft, Room: "ops", User: "john"})
+	closeErr := store.Close(context.Background())
+
+	// then
+	assert.NoError(t, closeErr)
+
+	left := time.Date(2020, 5, 1, 13, 0, 0, 0, time.UTC)
+	removed := time.Date(2020, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, map[string]time.Time{"ops": left, "dev": removed}, store.Rooms("john"))
+	assert.Equal(t, map[string]time.Time{"dev": removed}, store.Rooms("jane"))
+
+	var jane Member
+	assert.NoError(t, db.Get("dev/jane", &jane))
+	assert.Equal(t, time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), jane.Joined)
+	assert.Equal(t, removed, jane.Left)
+}
@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "chat"
+
+	// ConnectionAccepted means that websocket connection was accepted.
+	ConnectionAccepted = "accepted"
+	// ConnectionNoSession means that websocket connection was rejected because of missing session cookie.
+	ConnectionNoSession = "no_session"
+	// ConnectionUnauthenticated means that websocket connection was rejected because user isn't logged in.
+	ConnectionUnauthenticated = "unauthenticated"
+	// ConnectionLimited means that websocket connection was rejected because of connection limits.
+	ConnectionLimited = "limited"
+
+	// DroppedSendFailed means that message couldn't be sent to the client. Other reasons
+	// of dropped messages are defined by packages which drop them and counted with Dropped.
+	DroppedSendFailed = "send_failed"
+
+	bearerPrefix = "Bearer "
+
+	errorKindClient   = "client"
+	errorKindInternal = "internal"
+)
+
+type statsSource interface {
+	Stats() exchange.Stats
+}
+
+// Metrics contains Prometheus collectors describing the state of the chat.
+type Metrics struct {
+	registry         *prometheus.Registry
+	messagesReceived *prometheus.CounterVec
+	messagesSent     *prometheus.CounterVec
+	handlerErrors    *prometheus.CounterVec
+	droppedMessages  *prometheus.CounterVec
+	connections      *prometheus.CounterVec
+	disconnections   *prometheus.CounterVec
+	logins           *prometheus.CounterVec
+	databaseLatency  *prometheus.HistogramVec
+	sessionLatency   *prometheus.HistogramVec
+}
+
+// New returns new Metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_received_total",
+			Help:      "Number of messages received from clients by message type.",
+		}, []string{"type"}),
+		messagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_sent_total",
+			Help:      "Number of messages sent to clients by message type.",
+		}, []string{"type"}),
+		handlerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "handler_errors_total",
+			Help:      "Number of messages which couldn't be handled by message type and kind of error (client or internal).",
+		}, []string{"type", "kind"}),
+		droppedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dropped_messages_total",
+			Help:      "Number of messages which weren't delivered by reason.",
+		}, []string{"reason"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "websocket_connections_total",
+			Help:      "Number of websocket connection attempts by result.",
+		}, []string{"result"}),
+		disconnections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "websocket_disconnections_total",
+			Help:      "Number of closed websocket connections by reason.",
+		}, []string{"reason"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Number of login attempts by result and reason of failure.",
+		}, []string{"result", "reason"}),
+		databaseLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rethinkdb_query_duration_seconds",
+			Help:      "Duration of RethinkDB queries by table and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"table", "operation"}),
+		sessionLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "redis_command_duration_seconds",
+			Help:      "Duration of Redis commands used by session store by command.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command"}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.messagesReceived,
+		m.messagesSent,
+		m.handlerErrors,
+		m.droppedMessages,
+		m.connections,
+		m.disconnections,
+		m.logins,
+		m.databaseLatency,
+		m.sessionLatency,
+	)
+
+	return m
+}
+
+// Watch registers gauges describing connected clients, rooms and outbound queues,
+// which are read from given source when metrics are scraped.
+func (m *Metrics) Watch(source statsSource) {
+	m.registry.MustRegister(newStatsCollector(source))
+}
+
+// Handler returns handler exposing metrics in Prometheus format to the clients which send given token
+// as a bearer token. Metrics reveal activity of the users, so they aren't public. All requests are
+// rejected if the token is empty.
+func (m *Metrics) Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sent := strings.TrimPrefix(req.Header.Get("Authorization"), bearerPrefix)
+		if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		metrics.ServeHTTP(w, req)
+	})
+}
+
+// Dropped counts message which wasn't delivered because of given reason.
+func (m *Metrics) Dropped(reason string) {
+	m.droppedMessages.WithLabelValues(reason).Inc()
+}
+
+// Middleware counts messages received from clients and errors returned by handlers.
+func (m *Metrics) Middleware(next exchange.Handler) exchange.Handler {
+	return exchange.HandlerFunc(func(msg *exchange.Message) error {
+		m.messagesReceived.WithLabelValues(msg.MsgType).Inc()
+
+		err := next.Handle(msg)
+		if _, ok := exchange.AsClientError(err); ok {
+			m.handlerErrors.WithLabelValues(msg.MsgType, errorKindClient).Inc()
+		} else if err != nil {
+			m.handlerErrors.WithLabelValues(msg.MsgType, errorKindInternal).Inc()
+		}
+
+		return err
+	})
+}
+
+// Connection returns connection which counts messages sent through given connection.
+func (m *Metrics) Connection(conn exchange.Connection) exchange.Connection {
+	return &connection{Connection: conn, metrics: m}
+}
+
+// Connected counts websocket connection attempt with given result.
+func (m *Metrics) Connected(result string) {
+	m.connections.WithLabelValues(result).Inc()
+}
+
+// Disconnected counts closed websocket connection with given reason.
+func (m *Metrics) Disconnected(reason string) {
+	m.disconnections.WithLabelValues(reason).Inc()
+}
+
+// LoginSucceeded counts successful login.
+func (m *Metrics) LoginSucceeded() {
+	m.logins.WithLabelValues("success", "").Inc()
+}
+
+// LoginFailed counts failed login with given reason.
+func (m *Metrics) LoginFailed(reason string) {
+	m.logins.WithLabelValues("failure", reason).Inc()
+}
+
+// ObserveQuery records duration of RethinkDB query.
+func (m *Metrics) ObserveQuery(table, operation string, duration time.Duration) {
+	m.databaseLatency.WithLabelValues(table, operation).Observe(duration.Seconds())
+}
+
+// WrapRedisProcess records duration of Redis commands, it should be passed to redis.Client.WrapProcess.
+func (m *Metrics) WrapRedisProcess(process func(redis.Cmder) error) func(redis.Cmder) error {
+	return func(cmd redis.Cmder) error {
+		start := time.Now()
+		err := process(cmd)
+		m.sessionLatency.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// connection counts messages sent through wrapped connection.
+type connection struct {
+	exchange.Connection
+	metrics *Metrics
+}
+
+func (c *connection) Send(msg interface{}) error {
+	msgType := "unknown"
+	switch message := msg.(type) {
+	case *exchange.Message:
+		msgType = message.MsgType
+	case *exchange.Frame:
+		msgType = message.Message().MsgType
+	}
+
+	if err := c.Connection.Send(msg); err != nil {
+		c.metrics.droppedMessages.WithLabelValues(DroppedSendFailed).Inc()
+		return err
+	}
+
+	c.metrics.messagesSent.WithLabelValues(msgType).Inc()
+	return nil
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticStats exchange.Stats
+
+func (s staticStats) Stats() exchange.Stats {
+	return exchange.Stats(s)
+}
+
+func TestMiddlewareShouldCountReceivedMessagesAndErrors(t *testing.T) {
+	// given
+	metrics := New()
+
+	handler := metrics.Middleware(exchange.HandlerFunc(func(msg *exchange.Message) error {
+		switch msg.Content {
+		case "invalid":
+			return exchange.NewClientError("invalid message")
+		case "broken":
+			return errors.New("broken")
+		}
+		return nil
+	}))
+
+	// when
+	for _, content := range []string{"ok", "invalid", "broken"} {
+		_ = handler.Handle(&exchange.Message{MsgType: exchange.MsgTextMsgMT, Content: content})
+	}
+
+	// then
+	assert.Equal(t, 3.0, testutil.ToFloat64(metrics.messagesReceived.WithLabelValues(exchange.MsgTextMsgMT)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.handlerErrors.WithLabelValues(exchange.MsgTextMsgMT, errorKindClient)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.handlerErrors.WithLabelValues(exchange.MsgTextMsgMT, errorKindInternal)))
+}
+
+func TestConnectionShouldCountSentAndDroppedMessages(t *testing.T) {
+	// given
+	metrics := New()
+
+	channelConn := exchange.NewChannelConn(1)
+	conn := metrics.Connection(channelConn)
+
+	// when
+	err1 := conn.Send(exchange.NewFrame(&exchange.Message{MsgType: exchange.MsgTextMsgMT}))
+	_ = channelConn.Close()
+	err2 := conn.Send(&exchange.Message{MsgType: exchange.MsgTextMsgMT})
+
+	// then
+	assert.NoError(t, err1)
+	assert.Error(t, err2)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.messagesSent.WithLabelValues(exchange.MsgTextMsgMT)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.droppedMessages.WithLabelValues(DroppedSendFailed)))
+}
+
+func TestHandlerShouldExposeMetrics(t *testing.T) {
+	// given
+	metrics := New()
+	metrics.Watch(staticStats{Clients: 3, Rooms: 2, QueuedMessages: 7})
+	metrics.Connected(ConnectionAccepted)
+	metrics.Disconnected(exchange.DisconnectClosed)
+	metrics.LoginFailed("wrong_password")
+	metrics.Dropped(exchange.DroppedClientStopped)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+
+	// when
+	metrics.Handler("scrape-token").ServeHTTP(recorder, req)
+
+	// then
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	assert.Contains(t, string(body), "chat_connected_clients 3")
+	assert.Contains(t, string(body), "chat_rooms 2")
+	assert.Contains(t, string(body), "chat_outbound_queue_depth 7")
+	assert.Contains(t, string(body), `chat_websocket_connections_total{result="accepted"} 1`)
+	assert.Contains(t, string(body), `chat_websocket_disconnections_total{reason="closed"} 1`)
+	assert.Contains(t, string(body), `chat_logins_total{reason="wrong_password",result="failure"} 1`)
+	assert.Contains(t, string(body), `chat_dropped_messages_total{reason="client_stopped"} 1`)
+}
+
+func TestHandlerShouldRejectRequestsWithoutToken(t *testing.T) {
+	// given
+	metrics := New()
+
+	wrongToken := httptest.NewRequest("GET", "/metrics", nil)
+	wrongToken.Header.Set("Authorization", "Bearer guess")
+
+	noToken := httptest.NewRequest("GET", "/metrics", nil)
+	noToken.Header.Set("Authorization", "Bearer ")
+
+	// when
+	wrong := httptest.NewRecorder()
+	metrics.Handler("scrape-token").ServeHTTP(wrong, wrongToken)
+
+	missing := httptest.NewRecorder()
+	metrics.Handler("scrape-token").ServeHTTP(missing, httptest.NewRequest("GET", "/metrics", nil))
+
+	disabled := httptest.NewRecorder()
+	metrics.Handler("").ServeHTTP(disabled, noToken)
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, wrong.Code)
+	assert.Equal(t, http.StatusUnauthorized, missing.Code)
+	assert.Equal(t, http.StatusUnauthorized, disabled.Code)
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsCollector reads numbers describing current state of the rooms once per scrape.
+type statsCollector struct {
+	source         statsSource
+	clients        *prometheus.Desc
+	rooms          *prometheus.Desc
+	queuedMessages *prometheus.Desc
+}
+
+func newStatsCollector(source statsSource) *statsCollector {
+	return &statsCollector{
+		source:         source,
+		clients:        prometheus.NewDesc(namespace+"_connected_clients", "Number of connected clients.", nil, nil),
+		rooms:          prometheus.NewDesc(namespace+"_rooms", "Number of rooms.", nil, nil),
+		queuedMessages: prometheus.NewDesc(namespace+"_outbound_queue_depth", "Number of messages waiting to be sent to all clients.", nil, nil),
+	}
+}
+
+func (c *statsCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.clients
+	descs <- c.rooms
+	descs <- c.queuedMessages
+}
+
+func (c *statsCollector) Collect(metrics chan<- prometheus.Metric) {
+	stats := c.source.Stats()
+
+	metrics <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(stats.Clients))
+	metrics <- prometheus.MustNewConstMetric(c.rooms, prometheus.GaugeValue, float64(stats.Rooms))
+	metrics <- prometheus.MustNewConstMetric(c.queuedMessages, prometheus.GaugeValue, float64(stats.QueuedMessages))
+}
@@ -0,0 +1,180 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const jsonContentType = "application/json"
+
+// Operation documents single route. Request and response bodies are given
+// as values of types which are (de)serialized by the handler.
+type Operation struct {
+	Summary     string
+	Description string
+	// Public is true if the operation doesn't require session.
+	Public      bool
+	Parameters  []*Parameter
+	Request     interface{}
+	RequestType string
+	Responses   []Status
+}
+
+// Status documents single response of the operation. Body is optional.
+type Status struct {
+	Code        int
+	Description string
+	Body        interface{}
+}
+
+// Key returns key identifying operation with given method and path template.
+func Key(method, path string) string {
+	return method + " " + path
+}
+
+// Generate returns document describing routes of given router with paths starting with one of given prefixes.
+// Every such route must be documented in operations and every operation must match one of the routes,
+// so the document cannot get out of sync with the router.
+func Generate(router *mux.Router, prefixes []string, info Info, security *SecurityScheme, operations map[string]*Operation) (*Document, error) {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]map[string]*PathItem),
+	}
+
+	if security != nil {
+		doc.Components = &Components{SecuritySchemes: map[string]*SecurityScheme{"session": security}}
+	}
+
+	documented := make(map[string]bool)
+	undocumented := make([]string, 0)
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !hasPrefix(path, prefixes) {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return fmt.Errorf("route %v has no methods", path)
+		}
+
+		vars := pathVars(path)
+
+		for _, method := range methods {
+			key := Key(method, path)
+
+			operation, ok := operations[key]
+			if !ok {
+				undocumented = append(undocumented, key)
+				continue
+			}
+			documented[key] = true
+
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*PathItem)
+			}
+
+			doc.Paths[path][strings.ToLower(method)] = newPathItem(operation, vars, security != nil)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := make([]string, 0)
+	for key := range operations {
+		if !documented[key] {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(undocumented) > 0 || len(unknown) > 0 {
+		sort.Strings(undocumented)
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("API documentation out of sync, undocumented routes: %v, unknown operations: %v", undocumented, unknown)
+	}
+
+	return doc, nil
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathVars returns names of variables of given path template, e.g. 'room' for '/rooms/{room}'.
+func pathVars(path string) []string {
+	vars := make([]string, 0)
+
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.SplitN(segment[1:len(segment)-1], ":", 2)[0]
+			vars = append(vars, name)
+		}
+	}
+
+	return vars
+}
+
+func newPathItem(operation *Operation, vars []string, secured bool) *PathItem {
+	item := &PathItem{
+		Summary:     operation.Summary,
+		Description: operation.Description,
+		Responses:   make(map[string]*Response),
+	}
+
+	for _, name := range vars {
+		item.Parameters = append(item.Parameters, &Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	item.Parameters = append(item.Parameters, operation.Parameters...)
+
+	if operation.Request != nil {
+		contentType := operation.RequestType
+		if contentType == "" {
+			contentType = jsonContentType
+		}
+
+		item.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{contentType: {Schema: SchemaOf(operation.Request)}},
+		}
+	}
+
+	for _, response := range operation.Responses {
+		description := response.Description
+		if description == "" {
+			description = http.StatusText(response.Code)
+		}
+
+		resp := &Response{Description: description}
+		if response.Body != nil {
+			resp.Content = map[string]*MediaType{jsonContentType: {Schema: SchemaOf(response.Body)}}
+		}
+
+		item.Responses[strconv.Itoa(response.Code)] = resp
+	}
+
+	if secured && !operation.Public {
+		item.Security = []map[string][]string{{"session": {}}}
+	}
+
+	return item
+}
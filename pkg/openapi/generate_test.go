@@ -0,0 +1,125 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type base struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type item struct {
+	*base
+	Name    string         `json:"name"`
+	Tags    []string       `json:"tags,omitempty"`
+	Labels  map[string]int `json:"labels,omitempty"`
+	Size    int64          `json:"size"`
+	Secret  string         `json:"-"`
+	private string
+}
+
+type node struct {
+	Children []*node `json:"children"`
+}
+
+func noop(w http.ResponseWriter, req *http.Request) {}
+
+func testRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/", noop)
+	router.HandleFunc("/api/items", noop).Methods("GET")
+	router.HandleFunc("/api/items/{id}", noop).Methods("DELETE")
+	router.HandleFunc("/healthz", noop).Methods("GET")
+	return router
+}
+
+func TestSchemaOfShouldDescribeJSONRepresentation(t *testing.T) {
+	// when
+	schema := SchemaOf(&item{})
+
+	// then
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, []string{"created", "id", "name", "size"}, schema.Required)
+	assert.Len(t, schema.Properties, 6)
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, schema.Properties["created"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, schema.Properties["tags"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "integer", Format: "int32"}}, schema.Properties["labels"])
+	assert.Equal(t, &Schema{Type: "integer", Format: "int64"}, schema.Properties["size"])
+}
+
+func TestSchemaOfShouldStopAtRecursiveTypes(t *testing.T) {
+	// when
+	schema := SchemaOf(node{})
+
+	// then
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "object"}}, schema.Properties["children"])
+}
+
+func TestGenerateShouldDocumentRoutesWithPrefix(t *testing.T) {
+	// given
+	operations := map[string]*Operation{
+		Key("GET", "/api/items"): {
+			Summary:   "List items",
+			Responses: []Status{{Code: http.StatusOK, Body: []*item{}}},
+		},
+		Key("DELETE", "/api/items/{id}"): {
+			Summary:   "Remove item",
+			Public:    true,
+			Responses: []Status{{Code: http.StatusNoContent}},
+		},
+	}
+
+	// when
+	doc, err := Generate(testRouter(), []string{"/api/"}, Info{Title: "Items", Version: "1"}, &SecurityScheme{Type: "apiKey"}, operations)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, doc.Paths, 2)
+
+	list := doc.Paths["/api/items"]["get"]
+	assert.Equal(t, "List items", list.Summary)
+	assert.Equal(t, "array", list.Responses["200"].Content["application/json"].Schema.Type)
+	assert.Equal(t, []map[string][]string{{"session": {}}}, list.Security)
+
+	remove := doc.Paths["/api/items/{id}"]["delete"]
+	assert.Equal(t, []*Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, remove.Parameters)
+	assert.Equal(t, "No Content", remove.Responses["204"].Description)
+	assert.Nil(t, remove.Security)
+}
+
+func TestGenerateShouldFailWhenDocumentationIsOutOfSync(t *testing.T) {
+	// given
+	operations := map[string]*Operation{
+		Key("GET", "/api/items"):  {Summary: "List items"},
+		Key("POST", "/api/items"): {Summary: "Create item"},
+	}
+
+	// when
+	_, err := Generate(testRouter(), []string{"/api/"}, Info{}, nil, operations)
+
+	// then
+	assert.EqualError(t, err, "API documentation out of sync, undocumented routes: [DELETE /api/items/{id}], unknown operations: [POST /api/items]")
+}
+
+func TestGenerateShouldDocumentRoutesWithAnyOfPrefixes(t *testing.T) {
+	// given
+	operations := map[string]*Operation{
+		Key("GET", "/api/items"):         {Summary: "List items"},
+		Key("DELETE", "/api/items/{id}"): {Summary: "Remove item"},
+		Key("GET", "/healthz"):           {Summary: "Check health", Public: true},
+	}
+
+	// when
+	doc, err := Generate(testRouter(), []string{"/api/", "/healthz"}, Info{}, nil, operations)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, doc.Paths, 3)
+	assert.Equal(t, "Check health", doc.Paths["/healthz"]["get"].Summary)
+}
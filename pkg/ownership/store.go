@@ -0,0 +1,86 @@
+// Package ownership keeps owners of the rooms.
+package ownership
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Owner is a user who owns room with given name.
+type Owner struct {
+	Room    string    `json:"room" gorethink:"room"`
+	User    string    `json:"user" gorethink:"user"`
+	Claimed time.Time `json:"claimed" gorethink:"claimed"`
+}
+
+// Database is an interface which defines persistence of owners of the rooms.
+type Database interface {
+	Insert(interface{}) error
+	All(result interface{}) error
+}
+
+// Store keeps owners of the rooms. Room name belongs to the user who created the room first,
+// so only this user can create the room again after it was removed. Owners are cached in memory.
+type Store struct {
+	db     Database
+	now    func() time.Time
+	lock   sync.RWMutex
+	owners map[string]string
+}
+
+// NewStore returns new instance of Store.
+func NewStore(db Database) *Store {
+	return &Store{
+		db:     db,
+		now:    time.Now,
+		owners: map[string]string{},
+	}
+}
+
+// Load reads all owners from database.
+func (s *Store) Load() error {
+	owners := make([]*Owner, 0)
+	if err := s.db.All(&owners); err != nil {
+		return fmt.Errorf("cannot read owners of rooms, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.owners = make(map[string]string, len(owners))
+	for _, owner := range owners {
+		s.owners[owner.Room] = owner.User
+	}
+
+	return nil
+}
+
+// Claim makes user with given name the owner of the room with given name unless the room
+// already has an owner. Returns the owner of the room.
+func (s *Store) Claim(roomName, userName string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if owner, ok := s.owners[roomName]; ok {
+		return owner, nil
+	}
+
+	owner := &Owner{Room: roomName, User: userName, Claimed: s.now().UTC()}
+	if err := s.db.Insert(owner); err != nil {
+		return "", fmt.Errorf("cannot store owner of room %v, error: %w", roomName, err)
+	}
+
+	s.owners[roomName] = userName
+
+	return userName, nil
+}
+
+// Owner returns the owner of the room with given name and false if the room has no owner.
+func (s *Store) Owner(roomName string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	owner, ok := s.owners[roomName]
+	return owner, ok
+}
@@ -0,0 +1,38 @@
+package ownership
+
+import (
+	"testing"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreShouldKeepFirstOwnerOfRoom(t *testing.T) {
+	// given
+	db := dbtest.NewTable("room")
+	store := NewStore(db)
+
+	// when
+	first, firstErr := store.Claim("ops", "john")
+	second, secondErr := store.Claim("ops", "jane")
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	assert.Equal(t, "john", first)
+	assert.Equal(t, "john", second)
+	assert.Equal(t, 1, db.Len())
+
+	// when
+	restarted := NewStore(db)
+	loadErr := restarted.Load()
+	owner, owned := restarted.Owner("ops")
+	_, unknownOwned := restarted.Owner("dev")
+
+	// then
+	assert.NoError(t, loadErr)
+	assert.Equal(t, "john", owner)
+	assert.True(t, owned)
+	assert.False(t, unknownOwned)
+}
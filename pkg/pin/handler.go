@@ -0,0 +1,54 @@
+package pin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+// clientErrors are errors caused by the pin requests sent by the client.
+var clientErrors = []error{ErrNotModerator, ErrRoomNotFound, ErrMessageNotFound, ErrAlreadyPinned, ErrNotPinned, ErrTooManyPins}
+
+// NewPinHandler returns handler which pins message in the room. Id of the pinned message
+// is the id of the request.
+func NewPinHandler(service *Service) *PinHandler {
+	return &PinHandler{service: service}
+}
+
+type PinHandler struct {
+	service *Service
+}
+
+func (h *PinHandler) Handle(msg *exchange.Message) error {
+	_, err := h.service.Pin(msg.Room, msg.ID, msg.SenderName)
+	return handleError("pin", err)
+}
+
+// NewUnpinHandler returns handler which unpins message in the room. Id of the unpinned message
+// is the id of the request.
+func NewUnpinHandler(service *Service) *UnpinHandler {
+	return &UnpinHandler{service: service}
+}
+
+type UnpinHandler struct {
+	service *Service
+}
+
+func (h *UnpinHandler) Handle(msg *exchange.Message) error {
+	return handleError("unpin", h.service.Unpin(msg.Room, msg.ID, msg.SenderName))
+}
+
+func handleError(action string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, clientErr := range clientErrors {
+		if errors.Is(err, clientErr) {
+			return exchange.NewClientError("Cannot %v message: %v", action, err)
+		}
+	}
+
+	return fmt.Errorf("cannot %v message, error: %w", action, err)
+}
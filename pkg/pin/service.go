@@ -0,0 +1,317 @@
+// Package pin keeps messages pinned by moderators in the rooms.
+package pin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/history"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// MaxPins is a maximal number of messages pinned in single room.
+const MaxPins = 50
+
+var (
+	// ErrNotModerator is returned when user who isn't a moderator of the room tries to change its pins.
+	ErrNotModerator = errors.New("only the owner of the room or administrators can pin messages")
+	// ErrRoomNotFound is returned when pins of the room which doesn't exist are changed.
+	ErrRoomNotFound = errors.New("room doesn't exist")
+	// ErrMessageNotFound is returned when pinned message isn't stored in the room's history.
+	ErrMessageNotFound = errors.New("message not found in the room")
+	// ErrAlreadyPinned is returned when message is already pinned.
+	ErrAlreadyPinned = errors.New("message is already pinned")
+	// ErrNotPinned is returned when message which isn't pinned is unpinned.
+	ErrNotPinned = errors.New("message is not pinned")
+	// ErrTooManyPins is returned when the room has maximal number of pinned messages.
+	ErrTooManyPins = fmt.Errorf("room cannot have more than %v pinned messages", MaxPins)
+)
+
+// Pin is a message pinned in the room. It contains only the id of the message, which is read
+// from the room's history, so the pin is removed when the message is removed from the history.
+type Pin struct {
+	// ID is the id of the pinned message.
+	ID       string    `json:"id" gorethink:"id"`
+	Room     string    `json:"room" gorethink:"room"`
+	PinnedBy string    `json:"pinnedBy" gorethink:"pinnedBy"`
+	Pinned   time.Time `json:"pinned" gorethink:"pinned"`
+}
+
+func (p *Pin) pinned(msg *history.Message) *exchange.PinnedMessage {
+	return &exchange.PinnedMessage{
+		ID:          p.ID,
+		Room:        p.Room,
+		Sender:      msg.Sender,
+		Content:     msg.Content,
+		Format:      msg.Format,
+		HTML:        msg.HTML,
+		Attachments: msg.Attachments,
+		Posted:      msg.Created,
+		PinnedBy:    p.PinnedBy,
+		Pinned:      p.Pinned,
+	}
+}
+
+// Database is an interface which defines persistence of pins.
+type Database interface {
+	Insert(interface{}) error
+	All(result interface{}) error
+	Delete(id string) error
+}
+
+// MessageDatabase is an interface wrapping methods used to read pinned messages.
+type MessageDatabase interface {
+	Get(id string, result interface{}) error
+	GetAll(ids []string, result interface{}) error
+}
+
+// Rooms is an interface wrapping methods used to check moderators of the rooms
+// and to inform members of the rooms about pins.
+type Rooms interface {
+	OwnerOf(roomName string) (string, bool)
+	Broadcast(msg *exchange.Message) bool
+}
+
+// Service keeps messages pinned in the rooms. Pins are cached in memory together with the pinned
+// messages. Rooms are identified by their names, so pins are kept when the room disappears after
+// its last member left.
+type Service struct {
+	db       Database
+	messages MessageDatabase
+	rooms    Rooms
+	admins   map[string]bool
+	now      func() time.Time
+	lock     sync.Mutex
+	byRoom   map[string][]*exchange.PinnedMessage
+}
+
+// NewService returns new Service. Owners of the rooms and given administrators can pin messages.
+func NewService(db Database, messages MessageDatabase, rooms Rooms, admins []string) *Service {
+	service := &Service{
+		db:       db,
+		messages: messages,
+		rooms:    rooms,
+		admins:   map[string]bool{},
+		now:      time.Now,
+		byRoom:   map[string][]*exchange.PinnedMessage{},
+	}
+
+	for _, admin := range admins {
+		service.admins[admin] = true
+	}
+
+	return service
+}
+
+// Load reads all pins and pinned messages from database. Pins of the messages removed
+// from the rooms' history while the server was down are removed.
+func (s *Service) Load() error {
+	pins := make([]*Pin, 0)
+	if err := s.db.All(&pins); err != nil {
+		return fmt.Errorf("cannot read pins, error: %w", err)
+	}
+
+	ids := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		ids = append(ids, pin.ID)
+	}
+
+	messages := make([]*history.Message, 0)
+	if err := s.messages.GetAll(ids, &messages); err != nil {
+		return fmt.Errorf("cannot read pinned messages, error: %w", err)
+	}
+
+	byID := make(map[string]*history.Message, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+	}
+
+	byRoom := map[string][]*exchange.PinnedMessage{}
+	for _, pin := range pins {
+		msg, ok := byID[pin.ID]
+		if !ok {
+			if err := s.db.Delete(pin.ID); err != nil {
+				return fmt.Errorf("cannot remove pin of message %v, error: %w", pin.ID, err)
+			}
+			logger.Infof("Pin of message %v removed from room %v dropped", pin.ID, pin.Room)
+			continue
+		}
+
+		byRoom[pin.Room] = append(byRoom[pin.Room], pin.pinned(msg))
+	}
+
+	for _, pinned := range byRoom {
+		sortPins(pinned)
+	}
+
+	s.lock.Lock()
+	s.byRoom = byRoom
+	s.lock.Unlock()
+
+	return nil
+}
+
+// Pin pins message with given id in given room and informs members of the room about it.
+func (s *Service) Pin(room, id, userName string) (*exchange.PinnedMessage, error) {
+	if err := s.authorize(room, userName); err != nil {
+		return nil, err
+	}
+
+	if id == "" {
+		return nil, ErrMessageNotFound
+	}
+
+	var msg history.Message
+	if err := s.messages.Get(id, &msg); err != nil {
+		return nil, fmt.Errorf("cannot read message %v, error: %w", id, err)
+	}
+
+	if msg.ID == "" || msg.Room != room {
+		return nil, ErrMessageNotFound
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pinned := s.byRoom[room]
+	if indexOf(pinned, id) >= 0 {
+		return nil, ErrAlreadyPinned
+	}
+
+	if len(pinned) >= MaxPins {
+		return nil, ErrTooManyPins
+	}
+
+	pin := &Pin{
+		ID:       id,
+		Room:     room,
+		PinnedBy: userName,
+		Pinned:   s.now().UTC(),
+	}
+
+	// lock is held while the pin is persisted, so the limit of pins isn't exceeded
+	if err := s.db.Insert(pin); err != nil {
+		return nil, fmt.Errorf("cannot persist pin of message %v, error: %w", id, err)
+	}
+
+	message := pin.pinned(&msg)
+
+	pinned = append(pinned, message)
+	sortPins(pinned)
+	s.byRoom[room] = pinned
+
+	s.rooms.Broadcast(exchange.NewPinMessage(message))
+
+	return message, nil
+}
+
+// Unpin unpins message with given id in given room and informs members of the room about it.
+func (s *Service) Unpin(room, id, userName string) error {
+	if err := s.authorize(room, userName); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if indexOf(s.byRoom[room], id) < 0 {
+		return ErrNotPinned
+	}
+
+	if err := s.remove(room, id); err != nil {
+		return err
+	}
+
+	s.rooms.Broadcast(exchange.NewUnpinMessage(room, id, userName))
+
+	return nil
+}
+
+// Pinned returns messages pinned in given room sorted by time of pinning.
+func (s *Service) Pinned(room string) []*exchange.PinnedMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append(make([]*exchange.PinnedMessage, 0, len(s.byRoom[room])), s.byRoom[room]...)
+}
+
+// MessagesRemoved removes pins of the messages with given ids which were removed from the history
+// of given room. Clients receive current pins when they join the room.
+func (s *Service) MessagesRemoved(room string, ids []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range ids {
+		if indexOf(s.byRoom[room], id) < 0 {
+			continue
+		}
+
+		if err := s.remove(room, id); err != nil {
+			logger.Warnf("Cannot remove pin of message %v removed from room %v. Error: %v", id, room, err)
+			continue
+		}
+
+		logger.Infof("Pin of message %v removed from room %v dropped", id, room)
+	}
+}
+
+// remove removes pin of the message with given id from database and cache. It should be called
+// with the lock held.
+func (s *Service) remove(room, id string) error {
+	if err := s.db.Delete(id); err != nil {
+		return fmt.Errorf("cannot remove pin of message %v, error: %w", id, err)
+	}
+
+	pinned := s.byRoom[room]
+	index := indexOf(pinned, id)
+
+	pinned = append(pinned[:index:index], pinned[index+1:]...)
+	if len(pinned) == 0 {
+		delete(s.byRoom, room)
+	} else {
+		s.byRoom[room] = pinned
+	}
+
+	return nil
+}
+
+// Welcome returns list of messages pinned in given room. It is used to inform
+// the client which joined the room about pins.
+func (s *Service) Welcome(room string) []*exchange.Message {
+	return []*exchange.Message{exchange.PinnedListMessage(room, s.Pinned(room))}
+}
+
+// authorize returns error if user with given name isn't a moderator of given room.
+func (s *Service) authorize(room, userName string) error {
+	// persisted owner is used, so pins of the removed room cannot be changed by its next creator
+	owner, exists := s.rooms.OwnerOf(room)
+	if !exists {
+		return ErrRoomNotFound
+	}
+
+	if s.admins[userName] || (owner != "" && owner == userName) {
+		return nil
+	}
+
+	return ErrNotModerator
+}
+
+func indexOf(pinned []*exchange.PinnedMessage, id string) int {
+	for i, msg := range pinned {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortPins(pinned []*exchange.PinnedMessage) {
+	sort.Slice(pinned, func(i, j int) bool {
+		return pinned[i].Pinned.Before(pinned[j].Pinned)
+	})
+}
@@ -0,0 +1,185 @@
+package pin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/history"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMessages() *dbtest.Table {
+	posted := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	return dbtest.NewTable("id",
+		&history.Message{ID: "runbook", Room: "ops", Sender: "anna", Content: "https://wiki/runbook", Created: posted},
+		&history.Message{ID: "oncall", Room: "ops", Sender: "anna", Content: "https://wiki/oncall", Created: posted},
+		&history.Message{ID: "hello", Room: "main", Sender: "anna", Content: "hello", Created: posted},
+	)
+}
+
+type fakeRooms struct {
+	owners map[string]string
+	sent   []*exchange.Message
+}
+
+func (r *fakeRooms) OwnerOf(roomName string) (string, bool) {
+	owner, ok := r.owners[roomName]
+	return owner, ok
+}
+
+func (r *fakeRooms) Broadcast(msg *exchange.Message) bool {
+	r.sent = append(r.sent, msg)
+	return true
+}
+
+func newTestService(db Database, rooms Rooms) *Service {
+	return NewService(db, newTestMessages(), rooms, []string{"admin"})
+}
+
+func TestServiceShouldAllowOnlyModeratorsToPinMessages(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	rooms := &fakeRooms{owners: map[string]string{"ops": "john", "main": ""}}
+	service := newTestService(db, rooms)
+
+	// when
+	pinned, ownerErr := service.Pin("ops", "runbook", "john")
+	_, adminErr := service.Pin("main", "hello", "admin")
+	_, memberErr := service.Pin("ops", "oncall", "anna")
+	_, mainErr := service.Pin("main", "hello", "john")
+	_, missingRoomErr := service.Pin("dev", "runbook", "admin")
+
+	// then
+	assert.NoError(t, ownerErr)
+	assert.Equal(t, "runbook", pinned.ID)
+	assert.Equal(t, "https://wiki/runbook", pinned.Content)
+	assert.Equal(t, "anna", pinned.Sender)
+	assert.Equal(t, "john", pinned.PinnedBy)
+
+	assert.NoError(t, adminErr)
+	assert.Equal(t, ErrNotModerator, memberErr)
+	assert.Equal(t, ErrNotModerator, mainErr)
+	assert.Equal(t, ErrRoomNotFound, missingRoomErr)
+
+	assert.Equal(t, 2, db.Len())
+	assert.Len(t, rooms.sent, 2)
+	assert.Equal(t, exchange.MsgPinMT, rooms.sent[0].MsgType)
+	assert.Equal(t, []*exchange.PinnedMessage{pinned}, rooms.sent[0].Pins)
+}
+
+func TestServiceShouldRejectInvalidPins(t *testing.T) {
+	// given
+	rooms := &fakeRooms{owners: map[string]string{"ops": "john"}}
+	service := newTestService(dbtest.NewTable("id"), rooms)
+
+	_, err := service.Pin("ops", "runbook", "john")
+	assert.NoError(t, err)
+
+	// when
+	_, duplicateErr := service.Pin("ops", "runbook", "john")
+	_, unknownErr := service.Pin("ops", "unknown", "john")
+	_, otherRoomErr := service.Pin("ops", "hello", "john")
+	_, emptyErr := service.Pin("ops", "", "john")
+	notPinnedErr := service.Unpin("ops", "oncall", "john")
+
+	// then
+	assert.Equal(t, ErrAlreadyPinned, duplicateErr)
+	assert.Equal(t, ErrMessageNotFound, unknownErr)
+	assert.Equal(t, ErrMessageNotFound, otherRoomErr)
+	assert.Equal(t, ErrMessageNotFound, emptyErr)
+	assert.Equal(t, ErrNotPinned, notPinnedErr)
+}
+
+func TestServiceShouldUnpinMessages(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	rooms := &fakeRooms{owners: map[string]string{"ops": "john"}}
+	service := newTestService(db, rooms)
+
+	_, err := service.Pin("ops", "runbook", "john")
+	assert.NoError(t, err)
+
+	// when
+	memberErr := service.Unpin("ops", "runbook", "anna")
+	ownerErr := service.Unpin("ops", "runbook", "john")
+
+	// then
+	assert.Equal(t, ErrNotModerator, memberErr)
+	assert.NoError(t, ownerErr)
+	assert.Equal(t, 0, db.Len())
+	assert.Empty(t, service.Pinned("ops"))
+
+	last := rooms.sent[len(rooms.sent)-1]
+	assert.Equal(t, exchange.NewUnpinMessage("ops", "runbook", "john"), last)
+}
+
+func TestServiceShouldWelcomeClientsWithLoadedPins(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id",
+		&Pin{ID: "oncall", Room: "ops", Pinned: time.Date(2020, 3, 11, 0, 0, 0, 0, time.UTC)},
+		&Pin{ID: "runbook", Room: "ops", Pinned: time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)},
+	)
+	service := newTestService(db, &fakeRooms{})
+	assert.NoError(t, service.Load())
+
+	// when
+	ops := service.Welcome("ops")
+	mainRoom := service.Welcome("main")
+
+	// then
+	assert.Len(t, ops, 1)
+	assert.Equal(t, exchange.MsgPinnedListMT, ops[0].MsgType)
+	assert.Len(t, ops[0].Pins, 2)
+	assert.Equal(t, "runbook", ops[0].Pins[0].ID)
+	assert.Equal(t, "oncall", ops[0].Pins[1].ID)
+
+	assert.Len(t, mainRoom, 1)
+	assert.Empty(t, mainRoom[0].Pins)
+}
+
+func TestServiceShouldDropPinsOfMessagesRemovedWhileServerWasDown(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id",
+		&Pin{ID: "oncall", Room: "ops", Pinned: time.Date(2020, 3, 11, 0, 0, 0, 0, time.UTC)},
+		&Pin{ID: "removed", Room: "ops", Pinned: time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)},
+	)
+	service := newTestService(db, &fakeRooms{})
+
+	// when
+	err := service.Load()
+
+	// then
+	assert.NoError(t, err)
+	pinned := service.Pinned("ops")
+	assert.Len(t, pinned, 1)
+	assert.Equal(t, "oncall", pinned[0].ID)
+	assert.Equal(t, "https://wiki/oncall", pinned[0].Content)
+	assert.False(t, db.Has("removed"))
+}
+
+func TestServiceShouldDropPinsOfRemovedMessages(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id",
+		&Pin{ID: "oncall", Room: "ops", Pinned: time.Date(2020, 3, 11, 0, 0, 0, 0, time.UTC)},
+		&Pin{ID: "runbook", Room: "ops", Pinned: time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)},
+	)
+	rooms := &fakeRooms{}
+	service := newTestService(db, rooms)
+	assert.NoError(t, service.Load())
+
+	// when
+	service.MessagesRemoved("ops", []string{"runbook", "unknown"})
+	service.MessagesRemoved("dev", []string{"oncall"})
+
+	// then
+	pinned := service.Pinned("ops")
+	assert.Len(t, pinned, 1)
+	assert.Equal(t, "oncall", pinned[0].ID)
+	assert.False(t, db.Has("runbook"))
+	assert.True(t, db.Has("oncall"))
+	assert.Empty(t, rooms.sent)
+}
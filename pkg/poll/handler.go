@@ -0,0 +1,57 @@
+package poll
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+// NewCreatePollHandler returns handler which creates poll in the room. Question of the poll
+// is the content of the message.
+func NewCreatePollHandler(service *Service) *CreatePollHandler {
+	return &CreatePollHandler{service: service}
+}
+
+type CreatePollHandler struct {
+	service *Service
+}
+
+func (h *CreatePollHandler) Handle(msg *exchange.Message) error {
+	if msg.Poll == nil {
+		return exchange.NewClientError("Options of the poll cannot be empty")
+	}
+
+	_, err := h.service.Create(msg.Room, msg.SenderName, msg.Content, *msg.Poll)
+	if errors.Is(err, ErrInvalidOptions) || errors.Is(err, ErrInvalidCloseTime) || errors.Is(err, ErrTooManyPolls) {
+		return exchange.NewClientError("Cannot create poll: %v", err)
+	} else if err != nil {
+		return fmt.Errorf("cannot create poll, error: %w", err)
+	}
+
+	return nil
+}
+
+// NewVoteHandler returns handler which counts vote of the client's user in the poll.
+func NewVoteHandler(service *Service) *VoteHandler {
+	return &VoteHandler{service: service}
+}
+
+type VoteHandler struct {
+	service *Service
+}
+
+func (h *VoteHandler) Handle(msg *exchange.Message) error {
+	if msg.Vote == nil {
+		return exchange.NewClientError("Vote cannot be empty")
+	}
+
+	err := h.service.Vote(msg.Room, msg.SenderName, *msg.Vote)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidVote) {
+		return exchange.NewClientError("Cannot vote: %v", err)
+	} else if err != nil {
+		return fmt.Errorf("cannot vote, error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package poll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollHandlersShouldReturnClientErrorsForInvalidRequests(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	service := newTestService(dbtest.NewTable("id"), &recordingRooms{}, now)
+
+	create := NewCreatePollHandler(service)
+	vote := NewVoteHandler(service)
+
+	// when
+	noOptionsErr := create.Handle(&exchange.Message{MsgType: exchange.MsgCreatePollMT, Room: "ops", SenderName: "john", Content: "Lunch?"})
+	invalidErr := create.Handle(&exchange.Message{MsgType: exchange.MsgCreatePollMT, Room: "ops", SenderName: "john", Content: "Lunch?",
+		Poll: &exchange.PollRequest{Options: []string{"pizza"}}})
+	createErr := create.Handle(&exchange.Message{MsgType: exchange.MsgCreatePollMT, Room: "ops", SenderName: "john", Content: "Lunch?",
+		Poll: &exchange.PollRequest{Options: []string{"pizza", "sushi"}}})
+	noVoteErr := vote.Handle(&exchange.Message{MsgType: exchange.MsgVoteMT, Room: "ops", SenderName: "anna"})
+	unknownPollErr := vote.Handle(&exchange.Message{MsgType: exchange.MsgVoteMT, Room: "ops", SenderName: "anna",
+		Vote: &exchange.Vote{PollID: "unknown", Options: []int{0}}})
+	voteErr := vote.Handle(&exchange.Message{MsgType: exchange.MsgVoteMT, Room: "ops", SenderName: "anna",
+		Vote: &exchange.Vote{PollID: "uuid-1", Options: []int{1}}})
+
+	// then
+	for _, err := range []error{noOptionsErr, invalidErr, noVoteErr, unknownPollErr} {
+		_, isClientErr := exchange.AsClientError(err)
+		assert.True(t, isClientErr)
+	}
+
+	assert.NoError(t, createErr)
+	assert.NoError(t, voteErr)
+}
@@ -0,0 +1,76 @@
+package poll
+
+import (
+	"sort"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+// Poll is a question asked in the room together with options the members of the room can vote for.
+type Poll struct {
+	ID        string   `json:"id" gorethink:"id,omitempty"`
+	Room      string   `json:"room" gorethink:"room"`
+	Creator   string   `json:"creator" gorethink:"creator"`
+	Question  string   `json:"question" gorethink:"question"`
+	Options   []string `json:"options" gorethink:"options"`
+	Multiple  bool     `json:"multiple" gorethink:"multiple"`
+	Anonymous bool     `json:"anonymous" gorethink:"anonymous"`
+	// Votes contains indexes of options chosen by the voters, keyed by the names of the voters.
+	Votes   map[string][]int `json:"votes" gorethink:"votes"`
+	Closes  time.Time        `json:"closes" gorethink:"closes"`
+	Closed  bool             `json:"closed" gorethink:"closed"`
+	Created time.Time        `json:"created" gorethink:"created"`
+}
+
+// Results returns current tally of the poll. Names of the voters are sorted and they are
+// omitted if the poll is anonymous.
+func (p *Poll) Results() *exchange.PollResults {
+	options := make([]*exchange.OptionResults, len(p.Options))
+	for i, text := range p.Options {
+		options[i] = &exchange.OptionResults{Text: text}
+	}
+
+	for voter, chosen := range p.Votes {
+		for _, option := range chosen {
+			if option < 0 || option >= len(options) {
+				continue
+			}
+
+			options[option].Votes++
+			if !p.Anonymous {
+				options[option].Voters = append(options[option].Voters, voter)
+			}
+		}
+	}
+
+	for _, option := range options {
+		sort.Strings(option.Voters)
+	}
+
+	return &exchange.PollResults{
+		ID:        p.ID,
+		Room:      p.Room,
+		Creator:   p.Creator,
+		Question:  p.Question,
+		Multiple:  p.Multiple,
+		Anonymous: p.Anonymous,
+		Closes:    p.Closes,
+		Closed:    p.Closed,
+		Voters:    len(p.Votes),
+		Options:   options,
+	}
+}
+
+// withVote returns copy of the poll with the vote of given user replaced by chosen options.
+func (p *Poll) withVote(voter string, chosen []int) *Poll {
+	votes := make(map[string][]int, len(p.Votes)+1)
+	for name, options := range p.Votes {
+		votes[name] = options
+	}
+	votes[voter] = chosen
+
+	voted := *p
+	voted.Votes = votes
+	return &voted
+}
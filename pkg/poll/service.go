@@ -0,0 +1,504 @@
+// Package poll lets members of the rooms vote on questions asked in the rooms.
+package poll
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/worker"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// MinOptions is a minimal number of options of the poll.
+	MinOptions = 2
+	// MaxOptions is a maximal number of options of the poll.
+	MaxOptions = 10
+	// MaxOptionLength is a maximal number of characters of single option.
+	MaxOptionLength = 200
+
+	// idleWait is a time the service waits when there are no open polls, new polls wake it up earlier.
+	idleWait = time.Hour
+	// voterKeyLength is a length in bytes of the generated key of anonymous voters.
+	voterKeyLength = 32
+)
+
+var (
+	// ErrInvalidOptions is returned when poll has too few or too many options or its options are invalid.
+	ErrInvalidOptions = errors.New("poll should have from 2 to 10 different, non-empty options with up to 200 characters")
+	// ErrInvalidCloseTime is returned when poll doesn't close in the future or closes too late.
+	ErrInvalidCloseTime = errors.New("poll should close in the future, but not later than allowed by the server")
+	// ErrNotFound is returned when open poll cannot be found in the room.
+	ErrNotFound = errors.New("open poll not found in the room")
+	// ErrInvalidVote is returned when vote chooses unknown options or too many options.
+	ErrInvalidVote = errors.New("vote should choose existing options, exactly one unless the poll allows multiple choices")
+	// ErrTooManyPolls is returned when the room or the user has maximal number of open polls.
+	ErrTooManyPolls = errors.New("too many open polls, wait until some of them close")
+)
+
+// Database is an interface which defines persistence of polls.
+type Database interface {
+	UUID() (string, error)
+	Upsert(interface{}) error
+	FindAll(property string, value interface{}, result interface{}) error
+}
+
+// Rooms is an interface wrapping method used to inform members of the rooms about polls.
+type Rooms interface {
+	Broadcast(msg *exchange.Message) bool
+}
+
+// Config contains settings of the Service.
+type Config struct {
+	// DefaultDuration is a time for which the poll without close time is open.
+	DefaultDuration time.Duration
+	// MaxDuration is a maximal time for which the poll can be open.
+	MaxDuration time.Duration
+	// TallyDelay is a time for which results are held back after a vote, so votes cast
+	// in the meantime are sent together. Zero sends results after every vote.
+	TallyDelay time.Duration
+	// MaxPerRoom is a maximal number of open polls in a single room, zero means no limit.
+	MaxPerRoom int
+	// MaxPerUser is a maximal number of open polls created by a single user, zero means no limit.
+	MaxPerUser int
+	// VoterKey is a secret key used to hash names of voters of anonymous polls. It should
+	// be the same after restarts, otherwise voters cannot change their votes. Random key
+	// is generated if it is empty.
+	VoterKey []byte
+}
+
+// DefaultConfig returns settings used in production.
+func DefaultConfig() Config {
+	return Config{
+		DefaultDuration: 24 * time.Hour,
+		MaxDuration:     30 * 24 * time.Hour,
+		TallyDelay:      time.Second,
+		MaxPerRoom:      10,
+		MaxPerUser:      5,
+	}
+}
+
+// openPoll is an open poll with the lock held while changes of the poll are persisted, so changes
+// of the poll are persisted in order and they don't wait for changes of other polls. The poll isn't
+// modified, but replaced with the service's lock held. Lock of the poll has to be taken before
+// the service's lock.
+type openPoll struct {
+	lock sync.Mutex
+	poll *Poll
+}
+
+// Service keeps open polls, counts votes and closes polls at their close time. Members of the room
+// receive results of the poll whenever it is created, someone votes or the poll is closed.
+// Open polls are loaded at start, so they survive restarts of the server. Names of voters
+// of anonymous polls are stored only as keyed hashes.
+type Service struct {
+	db      Database
+	rooms   Rooms
+	config  Config
+	now     func() time.Time
+	lock    sync.Mutex
+	open    map[string]*openPoll
+	tallies map[string]time.Time
+	// creating contains polls which are being persisted, they count towards limits of open polls
+	creating map[string]*Poll
+	loop     *worker.Loop
+}
+
+// NewService returns new Service. Load and Start have to be called before polls are closed.
+func NewService(db Database, rooms Rooms, config Config) *Service {
+	if len(config.VoterKey) == 0 {
+		config.VoterKey = make([]byte, voterKeyLength)
+		if _, err := rand.Read(config.VoterKey); err != nil {
+			panic(fmt.Sprintf("cannot generate key of anonymous voters, error: %v", err))
+		}
+	}
+
+	service := &Service{
+		db:       db,
+		rooms:    rooms,
+		config:   config,
+		now:      time.Now,
+		open:     map[string]*openPoll{},
+		tallies:  map[string]time.Time{},
+		creating: map[string]*Poll{},
+	}
+	service.loop = worker.NewLoop(idleWait, service.work)
+
+	return service
+}
+
+// Load reads open polls from database.
+func (s *Service) Load() error {
+	polls := make([]*Poll, 0)
+	if err := s.db.FindAll("closed", false, &polls); err != nil {
+		return fmt.Errorf("cannot read open polls, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.open = map[string]*openPoll{}
+	for _, poll := range polls {
+		s.open[poll.ID] = &openPoll{poll: poll}
+	}
+
+	return nil
+}
+
+// Start starts goroutine closing polls at their close time and sending held back results.
+// Polls which should have been closed while the server was down are closed right after the start.
+func (s *Service) Start() {
+	s.loop.Start()
+}
+
+// Close stops closing polls and waits until the closing in progress finishes
+// or the context is done. Open polls stay persisted.
+func (s *Service) Close(ctx context.Context) error {
+	if err := s.loop.Close(ctx); err != nil {
+		return fmt.Errorf("polls service not stopped before deadline, error: %w", err)
+	}
+	return nil
+}
+
+// Create persists new poll with given question asked by the user with given name
+// and sends its results to the members of the room. Number of open polls in the room
+// and created by the user are limited.
+func (s *Service) Create(room, creator, question string, request exchange.PollRequest) (*Poll, error) {
+	now := s.now().UTC()
+
+	options, err := validOptions(request.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	closes := now.Add(s.config.DefaultDuration)
+	if request.Closes != nil {
+		closes = request.Closes.UTC()
+	}
+
+	if !closes.After(now) || closes.After(now.Add(s.config.MaxDuration)) {
+		return nil, ErrInvalidCloseTime
+	}
+
+	id, err := s.db.UUID()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create id of poll, error: %w", err)
+	}
+
+	poll := &Poll{
+		ID:        id,
+		Room:      room,
+		Creator:   creator,
+		Question:  question,
+		Options:   options,
+		Multiple:  request.Multiple,
+		Anonymous: request.Anonymous,
+		Votes:     map[string][]int{},
+		Closes:    closes,
+		Created:   now,
+	}
+
+	if err := s.reserve(poll); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Upsert(poll)
+
+	s.lock.Lock()
+	delete(s.creating, poll.ID)
+	if err == nil {
+		s.open[poll.ID] = &openPoll{poll: poll}
+	}
+	results := poll.Results()
+	s.lock.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot persist poll, error: %w", err)
+	}
+
+	// the new poll may close earlier than the one the service waits for
+	s.loop.Wake()
+
+	s.rooms.Broadcast(exchange.PollResultsMessage(results))
+
+	return poll, nil
+}
+
+// reserve counts the poll towards limits of open polls while it is persisted
+// or returns ErrTooManyPolls if the limits are reached.
+func (s *Service) reserve(poll *Poll) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	others := make([]*Poll, 0, len(s.open)+len(s.creating))
+	for _, open := range s.open {
+		others = append(others, open.poll)
+	}
+	for _, creating := range s.creating {
+		others = append(others, creating)
+	}
+
+	inRoom, byUser := 0, 0
+	for _, other := range others {
+		if other.Room == poll.Room {
+			inRoom++
+		}
+		if other.Creator == poll.Creator {
+			byUser++
+		}
+	}
+
+	if (s.config.MaxPerRoom > 0 && inRoom >= s.config.MaxPerRoom) || (s.config.MaxPerUser > 0 && byUser >= s.config.MaxPerUser) {
+		return ErrTooManyPolls
+	}
+
+	s.creating[poll.ID] = poll
+	return nil
+}
+
+// Vote replaces vote of the user with given name in the open poll of given room
+// and sends updated results to the members of the room, after TallyDelay.
+func (s *Service) Vote(room, voter string, vote exchange.Vote) error {
+	s.lock.Lock()
+	open, ok := s.open[vote.PollID]
+	s.lock.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	// lock of the poll is held while the vote is persisted, so concurrent votes are not lost
+	open.lock.Lock()
+	defer open.lock.Unlock()
+
+	s.lock.Lock()
+	poll, closed := open.poll, s.open[vote.PollID] != open
+	s.lock.Unlock()
+
+	if closed || poll.Room != room || !poll.Closes.After(s.now()) {
+		return ErrNotFound
+	}
+
+	chosen, err := validVote(poll, vote.Options)
+	if err != nil {
+		return err
+	}
+
+	if poll.Anonymous {
+		voter = s.anonymous(poll, voter)
+	}
+
+	voted := poll.withVote(voter, chosen)
+	if err := s.db.Upsert(voted); err != nil {
+		return fmt.Errorf("cannot persist vote in poll %v, error: %w", poll.ID, err)
+	}
+
+	s.lock.Lock()
+	open.poll = voted
+
+	scheduled := false
+	if _, pending := s.tallies[poll.ID]; !pending && s.config.TallyDelay > 0 {
+		s.tallies[poll.ID] = s.now().Add(s.config.TallyDelay)
+		scheduled = true
+	}
+	s.lock.Unlock()
+
+	if s.config.TallyDelay <= 0 {
+		s.rooms.Broadcast(exchange.PollResultsMessage(voted.Results()))
+	} else if scheduled {
+		s.loop.Wake()
+	}
+
+	return nil
+}
+
+// anonymous returns keyed hash of the voter's name, which is different in every poll.
+func (s *Service) anonymous(poll *Poll, voter string) string {
+	mac := hmac.New(sha256.New, s.config.VoterKey)
+	mac.Write([]byte(poll.ID + "\x00" + voter))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Welcome returns results of open polls of given room sorted by time of creation.
+// It is used to inform the client which joined the room about polls.
+func (s *Service) Welcome(room string) []*exchange.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	polls := make([]*Poll, 0)
+	for _, open := range s.open {
+		if open.poll.Room == room {
+			polls = append(polls, open.poll)
+		}
+	}
+
+	sort.Slice(polls, func(i, j int) bool {
+		return polls[i].Created.Before(polls[j].Created)
+	})
+
+	messages := make([]*exchange.Message, 0, len(polls))
+	for _, poll := range polls {
+		messages = append(messages, exchange.PollResultsMessage(poll.Results()))
+	}
+
+	return messages
+}
+
+// work closes due polls and sends held back results. It returns time when it should be
+// called again or zero time if there is nothing to do.
+func (s *Service) work() time.Time {
+	next := s.closeDue()
+
+	if tally := s.sendTallies(); !tally.IsZero() && (next.IsZero() || tally.Before(next)) {
+		next = tally
+	}
+
+	return next
+}
+
+// sendTallies sends results of the polls which were held back for TallyDelay and returns
+// time when the next results should be sent or zero time if no results are held back.
+func (s *Service) sendTallies() time.Time {
+	now := s.now()
+
+	var next time.Time
+	due := make([]*exchange.PollResults, 0)
+
+	s.lock.Lock()
+	for id, tally := range s.tallies {
+		if tally.After(now) {
+			if next.IsZero() || tally.Before(next) {
+				next = tally
+			}
+			continue
+		}
+
+		delete(s.tallies, id)
+
+		if open, ok := s.open[id]; ok {
+			due = append(due, open.poll.Results())
+		}
+	}
+	s.lock.Unlock()
+
+	for _, results := range due {
+		s.rooms.Broadcast(exchange.PollResultsMessage(results))
+	}
+
+	return next
+}
+
+// closeDue closes polls which close time passed and returns time when the next poll
+// closes or zero time if there are no open polls.
+func (s *Service) closeDue() time.Time {
+	now := s.now()
+
+	var next time.Time
+	due := make([]*openPoll, 0)
+
+	s.lock.Lock()
+	for _, open := range s.open {
+		if open.poll.Closes.After(now) {
+			if next.IsZero() || open.poll.Closes.Before(next) {
+				next = open.poll.Closes
+			}
+			continue
+		}
+
+		due = append(due, open)
+	}
+	s.lock.Unlock()
+
+	for _, open := range due {
+		s.closePoll(open)
+	}
+
+	return next
+}
+
+// closePoll persists the poll as closed and sends its final results to the members of the room.
+func (s *Service) closePoll(open *openPoll) {
+	// votes in progress are persisted before the poll is closed
+	open.lock.Lock()
+	defer open.lock.Unlock()
+
+	s.lock.Lock()
+	closed := *open.poll
+	s.lock.Unlock()
+
+	closed.Closed = true
+
+	if err := s.db.Upsert(&closed); err != nil {
+		logger.Errorf("Cannot close poll %v in room %v. Error: %v", closed.ID, closed.Room, err)
+		return
+	}
+
+	// final results are sent instead of the held back ones
+	s.lock.Lock()
+	delete(s.open, closed.ID)
+	delete(s.tallies, closed.ID)
+	s.lock.Unlock()
+
+	results := closed.Results()
+	if !s.rooms.Broadcast(exchange.PollResultsMessage(results)) {
+		logger.Infof("Results of poll %v not sent, room %v doesn't exist", closed.ID, closed.Room)
+	}
+
+	logger.Infof("Poll %v in room %v closed with %v voters", closed.ID, closed.Room, results.Voters)
+}
+
+func validOptions(options []string) ([]string, error) {
+	if len(options) < MinOptions || len(options) > MaxOptions {
+		return nil, ErrInvalidOptions
+	}
+
+	valid := make([]string, 0, len(options))
+	seen := map[string]bool{}
+
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" || utf8.RuneCountInString(option) > MaxOptionLength || seen[option] {
+			return nil, ErrInvalidOptions
+		}
+
+		seen[option] = true
+		valid = append(valid, option)
+	}
+
+	return valid, nil
+}
+
+func validVote(poll *Poll, options []int) ([]int, error) {
+	if len(options) == 0 || (!poll.Multiple && len(options) > 1) {
+		return nil, ErrInvalidVote
+	}
+
+	chosen := make([]int, 0, len(options))
+	seen := map[int]bool{}
+
+	for _, option := range options {
+		if option < 0 || option >= len(poll.Options) {
+			return nil, ErrInvalidVote
+		}
+
+		if !seen[option] {
+			seen[option] = true
+			chosen = append(chosen, option)
+		}
+	}
+
+	sort.Ints(chosen)
+	return chosen, nil
+}
@@ -0,0 +1,297 @@
+package poll
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// storedPoll returns poll with given id persisted in the table.
+func storedPoll(t *testing.T, db *dbtest.Table, id string) *Poll {
+	var poll Poll
+	assert.NoError(t, db.Get(id, &poll))
+	return &poll
+}
+
+type recordingRooms struct {
+	lock sync.Mutex
+	sent []*exchange.Message
+}
+
+func (r *recordingRooms) Broadcast(msg *exchange.Message) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sent = append(r.sent, msg)
+	return true
+}
+
+func (r *recordingRooms) results() []*exchange.PollResults {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	results := make([]*exchange.PollResults, 0, len(r.sent))
+	for _, msg := range r.sent {
+		results = append(results, msg.PollResults)
+	}
+	return results
+}
+
+func newTestService(db Database, rooms Rooms, now time.Time) *Service {
+	service := NewService(db, rooms, DefaultConfig())
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func TestServiceShouldCreateValidPolls(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id")
+	rooms := &recordingRooms{}
+	service := newTestService(db, rooms, now)
+
+	past := now.Add(-time.Minute)
+	far := now.AddDate(1, 0, 0)
+
+	// when
+	poll, err := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{" pizza ", "sushi"}})
+	_, tooFewErr := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza"}})
+	_, duplicateErr := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza", "pizza"}})
+	_, pastErr := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza", "sushi"}, Closes: &past})
+	_, farErr := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza", "sushi"}, Closes: &far})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pizza", "sushi"}, poll.Options)
+	assert.Equal(t, now.Add(24*time.Hour), poll.Closes)
+	assert.Equal(t, poll, storedPoll(t, db, poll.ID))
+
+	assert.Equal(t, ErrInvalidOptions, tooFewErr)
+	assert.Equal(t, ErrInvalidOptions, duplicateErr)
+	assert.Equal(t, ErrInvalidCloseTime, pastErr)
+	assert.Equal(t, ErrInvalidCloseTime, farErr)
+
+	results := rooms.results()
+	assert.Len(t, results, 1)
+	assert.Equal(t, "Lunch?", results[0].Question)
+	assert.Equal(t, 0, results[0].Voters)
+}
+
+func TestServiceShouldLimitOpenPolls(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	config := DefaultConfig()
+	config.MaxPerRoom = 2
+	config.MaxPerUser = 1
+
+	service := NewService(dbtest.NewTable("id"), &recordingRooms{}, config)
+	service.now = func() time.Time { return now }
+
+	request := exchange.PollRequest{Options: []string{"pizza", "sushi"}}
+
+	// when
+	_, johnErr := service.Create("ops", "john", "Lunch?", request)
+	_, johnAgainErr := service.Create("dev", "john", "Dinner?", request)
+	_, annaErr := service.Create("ops", "anna", "Breakfast?", request)
+	_, mikeErr := service.Create("ops", "mike", "Coffee?", request)
+	_, mikeElsewhereErr := service.Create("dev", "mike", "Coffee?", request)
+
+	// then
+	assert.NoError(t, johnErr)
+	assert.Equal(t, ErrTooManyPolls, johnAgainErr)
+	assert.NoError(t, annaErr)
+	assert.Equal(t, ErrTooManyPolls, mikeErr)
+	assert.NoError(t, mikeElsewhereErr)
+}
+
+func TestServiceShouldCountVotesAndBroadcastTallies(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id")
+	rooms := &recordingRooms{}
+	service := newTestService(db, rooms, now)
+
+	single, err := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza", "sushi"}})
+	assert.NoError(t, err)
+	multiple, err := service.Create("ops", "john", "Days?", exchange.PollRequest{Options: []string{"mon", "tue", "wed"}, Multiple: true, Anonymous: true})
+	assert.NoError(t, err)
+
+	// when
+	johnErr := service.Vote("ops", "john", exchange.Vote{PollID: single.ID, Options: []int{0}})
+	annaErr := service.Vote("ops", "anna", exchange.Vote{PollID: single.ID, Options: []int{0}})
+	changedErr := service.Vote("ops", "anna", exchange.Vote{PollID: single.ID, Options: []int{1}})
+	tooManyErr := service.Vote("ops", "anna", exchange.Vote{PollID: single.ID, Options: []int{0, 1}})
+	unknownOptionErr := service.Vote("ops", "anna", exchange.Vote{PollID: single.ID, Options: []int{2}})
+	otherRoomErr := service.Vote("main", "anna", exchange.Vote{PollID: single.ID, Options: []int{0}})
+	multipleErr := service.Vote("ops", "anna", exchange.Vote{PollID: multiple.ID, Options: []int{2, 0, 2}})
+
+	// then
+	assert.NoError(t, johnErr)
+	assert.NoError(t, annaErr)
+	assert.NoError(t, changedErr)
+	assert.Equal(t, ErrInvalidVote, tooManyErr)
+	assert.Equal(t, ErrInvalidVote, unknownOptionErr)
+	assert.Equal(t, ErrNotFound, otherRoomErr)
+	assert.NoError(t, multipleErr)
+
+	assert.Len(t, rooms.results(), 2)
+
+	// when
+	service.now = func() time.Time { return now.Add(DefaultConfig().TallyDelay) }
+	next := service.work()
+
+	// then
+	assert.Equal(t, now.Add(24*time.Hour), next)
+
+	results := rooms.results()
+	assert.Len(t, results, 4)
+
+	tallies := map[string]*exchange.PollResults{}
+	for _, result := range results[2:] {
+		tallies[result.ID] = result
+	}
+
+	tally := tallies[single.ID]
+	assert.Equal(t, 2, tally.Voters)
+	assert.Equal(t, &exchange.OptionResults{Text: "pizza", Votes: 1, Voters: []string{"john"}}, tally.Options[0])
+	assert.Equal(t, &exchange.OptionResults{Text: "sushi", Votes: 1, Voters: []string{"anna"}}, tally.Options[1])
+
+	anonymous := tallies[multiple.ID]
+	assert.Equal(t, 1, anonymous.Voters)
+	assert.Equal(t, &exchange.OptionResults{Text: "mon", Votes: 1}, anonymous.Options[0])
+	assert.Equal(t, &exchange.OptionResults{Text: "tue"}, anonymous.Options[1])
+	assert.Equal(t, &exchange.OptionResults{Text: "wed", Votes: 1}, anonymous.Options[2])
+
+	votes := storedPoll(t, db, multiple.ID).Votes
+	assert.Len(t, votes, 1)
+	assert.NotContains(t, votes, "anna")
+}
+
+func TestServiceShouldReplaceVoteOfAnonymousVoter(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id")
+	service := newTestService(db, &recordingRooms{}, now)
+
+	poll, err := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza", "sushi"}, Anonymous: true})
+	assert.NoError(t, err)
+
+	// when
+	firstErr := service.Vote("ops", "anna", exchange.Vote{PollID: poll.ID, Options: []int{0}})
+	changedErr := service.Vote("ops", "anna", exchange.Vote{PollID: poll.ID, Options: []int{1}})
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, changedErr)
+
+	results := storedPoll(t, db, poll.ID).Results()
+	assert.Equal(t, 1, results.Voters)
+	assert.Equal(t, 0, results.Options[0].Votes)
+	assert.Equal(t, 1, results.Options[1].Votes)
+}
+
+// slowTable holds back persisting of votes in the poll with given id until it is released.
+type slowTable struct {
+	*dbtest.Table
+	slow     string
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (t *slowTable) Upsert(entity interface{}) error {
+	if poll := entity.(*Poll); poll.ID == t.slow && len(poll.Votes) > 0 {
+		close(t.started)
+		<-t.released
+	}
+	return t.Table.Upsert(entity)
+}
+
+func TestServiceShouldNotHoldBackVotesInOtherPollsWhileVoteIsPersisted(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := &slowTable{Table: dbtest.NewTable("id"), slow: "uuid-1", started: make(chan struct{}), released: make(chan struct{})}
+	service := newTestService(db, &recordingRooms{}, now)
+
+	slow, err := service.Create("ops", "john", "Lunch?", exchange.PollRequest{Options: []string{"pizza", "sushi"}})
+	assert.NoError(t, err)
+	fast, err := service.Create("ops", "anna", "Dinner?", exchange.PollRequest{Options: []string{"pizza", "sushi"}})
+	assert.NoError(t, err)
+
+	slowErr := make(chan error)
+	go func() {
+		slowErr <- service.Vote("ops", "mike", exchange.Vote{PollID: slow.ID, Options: []int{0}})
+	}()
+	<-db.started
+
+	// when
+	fastErr := service.Vote("ops", "mike", exchange.Vote{PollID: fast.ID, Options: []int{1}})
+	welcome := service.Welcome("ops")
+	close(db.released)
+
+	// then
+	assert.NoError(t, fastErr)
+	assert.NoError(t, <-slowErr)
+	assert.Len(t, welcome, 2)
+	assert.Equal(t, 1, storedPoll(t, db.Table, slow.ID).Results().Voters)
+	assert.Equal(t, 1, storedPoll(t, db.Table, fast.ID).Results().Voters)
+}
+
+func TestServiceShouldClosePollsAndBroadcastFinalResults(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id",
+		&Poll{ID: "1", Room: "ops", Question: "Lunch?", Options: []string{"pizza", "sushi"}, Votes: map[string][]int{"john": {1}}, Closes: now},
+		&Poll{ID: "2", Room: "ops", Question: "Days?", Options: []string{"mon", "tue"}, Votes: map[string][]int{}, Closes: now.Add(time.Hour)},
+		&Poll{ID: "3", Room: "ops", Question: "Old?", Options: []string{"yes", "no"}, Closed: true, Closes: now.Add(-time.Hour)},
+	)
+	rooms := &recordingRooms{}
+
+	service := newTestService(db, rooms, now)
+	assert.NoError(t, service.Load())
+
+	// when
+	next := service.closeDue()
+	voteErr := service.Vote("ops", "anna", exchange.Vote{PollID: "1", Options: []int{0}})
+
+	// then
+	assert.Equal(t, now.Add(time.Hour), next)
+	assert.Equal(t, ErrNotFound, voteErr)
+	assert.True(t, storedPoll(t, db, "1").Closed)
+	assert.False(t, storedPoll(t, db, "2").Closed)
+
+	results := rooms.results()
+	assert.Len(t, results, 1)
+	assert.True(t, results[0].Closed)
+	assert.Equal(t, 1, results[0].Options[1].Votes)
+
+	welcome := service.Welcome("ops")
+	assert.Len(t, welcome, 1)
+	assert.Equal(t, "Days?", welcome[0].PollResults.Question)
+	assert.Empty(t, service.Welcome("main"))
+}
+
+func TestServiceShouldClosePollsMissedBeforeStart(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id", &Poll{ID: "1", Room: "ops", Question: "Lunch?", Options: []string{"pizza", "sushi"}, Closes: time.Now().Add(-time.Hour)})
+	rooms := &recordingRooms{}
+
+	service := NewService(db, rooms, DefaultConfig())
+	assert.NoError(t, service.Load())
+
+	// when
+	service.Start()
+
+	// then
+	assert.Eventually(t, func() bool {
+		return len(rooms.results()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, service.Close(context.Background()))
+	assert.True(t, storedPoll(t, db, "1").Closed)
+}
@@ -0,0 +1,146 @@
+// Package retention removes messages which shouldn't be kept anymore.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidPolicy is returned when policy contains negative limits.
+var ErrInvalidPolicy = errors.New("days and messages of the retention policy cannot be negative")
+
+// Policy describes how long messages of the room are kept. Messages older than Days days
+// and messages not being among the newest Messages messages are expired. Zero means no limit,
+// so policy with both limits set to zero keeps messages forever.
+type Policy struct {
+	Room     string `json:"room,omitempty" gorethink:"room"`
+	Days     int    `json:"days" gorethink:"days"`
+	Messages int    `json:"messages" gorethink:"messages"`
+	// Default is true if the room has no own policy and the server's default is used.
+	Default bool `json:"default" gorethink:"-"`
+}
+
+// Forever returns true if the policy doesn't expire any messages.
+func (p *Policy) Forever() bool {
+	return p.Days <= 0 && p.Messages <= 0
+}
+
+// Cutoff returns time before which messages are expired because of their age.
+// Zero time is returned if messages don't expire because of their age.
+func (p *Policy) Cutoff(now time.Time) time.Time {
+	if p.Days <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -p.Days)
+}
+
+// Database is an interface which defines persistence of policies.
+type Database interface {
+	Upsert(interface{}) error
+	All(result interface{}) error
+	Delete(id string) error
+}
+
+// Service keeps retention policies of the rooms. Policies are cached in memory.
+// Policies of the rooms cannot keep messages longer than the default policy.
+type Service struct {
+	db       Database
+	defaults Policy
+	lock     sync.RWMutex
+	byRoom   map[string]*Policy
+}
+
+// NewService returns new instance of Service. Given policy is used for rooms without own policy.
+func NewService(db Database, defaults Policy) *Service {
+	return &Service{
+		db:       db,
+		defaults: defaults,
+		byRoom:   map[string]*Policy{},
+	}
+}
+
+// Load reads all policies from database.
+func (s *Service) Load() error {
+	policies := make([]*Policy, 0)
+	if err := s.db.All(&policies); err != nil {
+		return fmt.Errorf("cannot read retention policies, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.byRoom = map[string]*Policy{}
+	for _, policy := range policies {
+		// the default policy could be changed after the policy was set
+		s.byRoom[policy.Room] = s.clamp(policy)
+	}
+
+	return nil
+}
+
+// Policy returns policy of given room or the default policy if the room has no own policy.
+func (s *Service) Policy(room string) Policy {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if policy, ok := s.byRoom[room]; ok {
+		return *policy
+	}
+
+	policy := s.defaults
+	policy.Room = room
+	policy.Default = true
+	return policy
+}
+
+// SetPolicy sets own policy of given room. Limits exceeding limits of the default policy
+// are lowered to them, so the returned policy can differ from the requested one.
+func (s *Service) SetPolicy(room string, days, messages int) (Policy, error) {
+	if days < 0 || messages < 0 {
+		return Policy{}, ErrInvalidPolicy
+	}
+
+	policy := s.clamp(&Policy{Room: room, Days: days, Messages: messages})
+	if err := s.db.Upsert(policy); err != nil {
+		return Policy{}, fmt.Errorf("cannot persist retention policy of room %v, error: %w", room, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.byRoom[room] = policy
+	return *policy, nil
+}
+
+// clamp lowers limits of the policy to the limits of the default policy. No limit (zero)
+// exceeds every limit.
+func (s *Service) clamp(policy *Policy) *Policy {
+	if s.defaults.Days > 0 && (policy.Days <= 0 || policy.Days > s.defaults.Days) {
+		policy.Days = s.defaults.Days
+	}
+	if s.defaults.Messages > 0 && (policy.Messages <= 0 || policy.Messages > s.defaults.Messages) {
+		policy.Messages = s.defaults.Messages
+	}
+	return policy
+}
+
+// ResetPolicy removes own policy of given room, so the default policy is used again.
+func (s *Service) ResetPolicy(room string) (Policy, error) {
+	s.lock.Lock()
+	_, exists := s.byRoom[room]
+	s.lock.Unlock()
+
+	if exists {
+		if err := s.db.Delete(room); err != nil {
+			return Policy{}, fmt.Errorf("cannot remove retention policy of room %v, error: %w", room, err)
+		}
+
+		s.lock.Lock()
+		delete(s.byRoom, room)
+		s.lock.Unlock()
+	}
+
+	return s.Policy(room), nil
+}
@@ -0,0 +1,80 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceShouldReturnRoomPolicyOrDefault(t *testing.T) {
+	// given
+	db := dbtest.NewTable("room", &Policy{Room: "incident", Messages: 100})
+
+	service := NewService(db, Policy{Days: 30})
+	assert.NoError(t, service.Load())
+
+	// when
+	own := service.Policy("incident")
+	defaults := service.Policy("ops")
+
+	// then
+	assert.Equal(t, Policy{Room: "incident", Days: 30, Messages: 100}, own)
+	assert.Equal(t, Policy{Room: "ops", Days: 30, Default: true}, defaults)
+}
+
+func TestServiceShouldSetAndResetPolicy(t *testing.T) {
+	// given
+	db := dbtest.NewTable("room")
+	service := NewService(db, Policy{})
+
+	// when
+	set, setErr := service.SetPolicy("ops", 7, 0)
+	_, invalidErr := service.SetPolicy("ops", -1, 0)
+	afterSet := service.Policy("ops")
+	reset, resetErr := service.ResetPolicy("ops")
+
+	// then
+	assert.NoError(t, setErr)
+	assert.Equal(t, Policy{Room: "ops", Days: 7}, set)
+	assert.Equal(t, ErrInvalidPolicy, invalidErr)
+	assert.Equal(t, set, afterSet)
+
+	assert.NoError(t, resetErr)
+	assert.Equal(t, Policy{Room: "ops", Default: true}, reset)
+	assert.True(t, reset.Forever())
+	assert.Equal(t, 0, db.Len())
+}
+
+func TestServiceShouldNotKeepMessagesLongerThanDefaultPolicy(t *testing.T) {
+	// given
+	service := NewService(dbtest.NewTable("room"), Policy{Days: 30, Messages: 1000})
+
+	// when
+	forever, foreverErr := service.SetPolicy("forever", 0, 0)
+	longer, longerErr := service.SetPolicy("longer", 60, 500)
+	shorter, shorterErr := service.SetPolicy("shorter", 7, 100)
+
+	// then
+	assert.NoError(t, foreverErr)
+	assert.NoError(t, longerErr)
+	assert.NoError(t, shorterErr)
+	assert.Equal(t, Policy{Room: "forever", Days: 30, Messages: 1000}, forever)
+	assert.Equal(t, Policy{Room: "longer", Days: 30, Messages: 500}, longer)
+	assert.Equal(t, Policy{Room: "shorter", Days: 7, Messages: 100}, shorter)
+}
+
+func TestPolicyCutoffShouldDependOnDays(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// when
+	byDays := (&Policy{Days: 9}).Cutoff(now)
+	byMessages := (&Policy{Messages: 10}).Cutoff(now)
+
+	// then
+	assert.Equal(t, time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), byDays)
+	assert.True(t, byMessages.IsZero())
+}
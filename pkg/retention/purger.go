@@ -0,0 +1,298 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/history"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// purgeBatchSize is a maximal number of expired messages read at once.
+const purgeBatchSize = 500
+
+// errBatchFull stops reading expired messages when the batch is full.
+var errBatchFull = errors.New("batch is full")
+
+// MessageDatabase is an interface wrapping methods used to find and remove expired messages.
+type MessageDatabase interface {
+	Distinct(property string, result interface{}) error
+	FindNth(property string, value interface{}, orderField string, n int, result interface{}) error
+	FindEach(property string, value interface{}, orderField string, from, to interface{},
+		newResult func() interface{}, f func(result interface{}) error) error
+	Delete(id string) error
+}
+
+// Archive persists messages removed from the rooms' history.
+type Archive interface {
+	Upsert(interface{}) error
+}
+
+// AttachmentRemover removes expired attachments.
+type AttachmentRemover interface {
+	// Rooms returns names of the rooms with attachments.
+	Rooms() ([]string, error)
+	// Expire removes attachments of the room which were neither uploaded nor attached to a message
+	// since given time and returns number of removed attachments. If archive is true, they are moved
+	// into the archive of attachments.
+	Expire(room string, before time.Time, archive bool) (int, error)
+}
+
+// RemovalListener is notified about messages removed from the rooms' history.
+type RemovalListener interface {
+	// MessagesRemoved is called with ids of the messages removed from the history of the room.
+	MessagesRemoved(room string, ids []string)
+}
+
+// Purger periodically removes messages expired according to the rooms' retention policies.
+// Attachments expire together with the messages posted when they were uploaded or attached to
+// a message the last time, so attachments of the kept messages are kept as well. If archive is set,
+// expired messages are moved into it and attachments are moved into the archive of attachments,
+// otherwise messages and attachments are deleted.
+type Purger struct {
+	policies    *Service
+	messages    MessageDatabase
+	archive     Archive
+	attachments AttachmentRemover
+	listener    RemovalListener
+	interval    time.Duration
+	now         func() time.Time
+	stopping    chan struct{}
+	stopOnce    sync.Once
+	done        chan struct{}
+}
+
+// NewPurger returns new Purger which removes expired messages every interval. Archive can be nil,
+// then messages are deleted. Start has to be called before messages are removed.
+func NewPurger(policies *Service, messages MessageDatabase, archive Archive, attachments AttachmentRemover, interval time.Duration) *Purger {
+	return &Purger{
+		policies:    policies,
+		messages:    messages,
+		archive:     archive,
+		attachments: attachments,
+		interval:    interval,
+		now:         time.Now,
+		stopping:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// SetRemovalListener sets listener notified about removed messages. It should be called before Start.
+func (p *Purger) SetRemovalListener(listener RemovalListener) {
+	p.listener = listener
+}
+
+// Start starts goroutine removing expired messages. Messages expired while the server
+// was down are removed right after the start.
+func (p *Purger) Start() {
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := p.Purge(); err != nil {
+				logger.Errorf("Cannot purge expired messages. Error: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-p.stopping:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops removing messages and waits until the purge in progress finishes
+// or the context is done.
+func (p *Purger) Close(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stopping)
+	})
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("messages purge not finished before deadline, error: %w", ctx.Err())
+	}
+}
+
+// Purge removes expired messages and attachments of all rooms and returns number of removed messages.
+func (p *Purger) Purge() (int, error) {
+	rooms, err := p.rooms()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+
+	for _, room := range rooms {
+		select {
+		case <-p.stopping:
+			return total, nil
+		default:
+		}
+
+		purged, err := p.purgeRoom(room)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// rooms returns sorted names of the rooms with messages or attachments.
+func (p *Purger) rooms() ([]string, error) {
+	withMessages := make([]string, 0)
+	if err := p.messages.Distinct("room", &withMessages); err != nil {
+		return nil, fmt.Errorf("cannot read rooms with messages, error: %w", err)
+	}
+
+	withAttachments, err := p.attachments.Rooms()
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, room := range append(withMessages, withAttachments...) {
+		names[room] = true
+	}
+
+	rooms := make([]string, 0, len(names))
+	for room := range names {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	return rooms, nil
+}
+
+func (p *Purger) purgeRoom(room string) (int, error) {
+	policy := p.policies.Policy(room)
+	if policy.Forever() {
+		return 0, nil
+	}
+
+	cutoff, err := p.cutoff(policy)
+	if err != nil || cutoff.IsZero() {
+		return 0, err
+	}
+
+	var messages int
+
+	for {
+		batch, err := p.expired(room, cutoff)
+		if err != nil {
+			return messages, err
+		}
+
+		removed := make([]string, 0, len(batch))
+		for _, msg := range batch {
+			if err := p.remove(msg); err != nil {
+				p.notify(room, removed)
+				return messages, err
+			}
+			removed = append(removed, msg.ID)
+			messages++
+		}
+		p.notify(room, removed)
+
+		if len(batch) < purgeBatchSize {
+			break
+		}
+	}
+
+	attachments, err := p.attachments.Expire(room, cutoff, p.archive != nil)
+	if err != nil {
+		return messages, fmt.Errorf("cannot remove expired attachments of room %v, error: %w", room, err)
+	}
+
+	if messages > 0 || attachments > 0 {
+		action := "Deleted"
+		if p.archive != nil {
+			action = "Archived"
+		}
+
+		logger.Infof("%v %v messages and %v attachments of room %v posted before %v, policy: %v days, %v messages",
+			action, messages, attachments, room, cutoff.UTC().Format(time.RFC3339), policy.Days, policy.Messages)
+	}
+
+	return messages, nil
+}
+
+// cutoff returns time before which messages of the room are expired according to the policy.
+// Zero time means that no message is expired.
+func (p *Purger) cutoff(policy Policy) (time.Time, error) {
+	cutoff := policy.Cutoff(p.now().UTC())
+
+	if policy.Messages > 0 {
+		var oldestExpired history.Message
+		if err := p.messages.FindNth("room", policy.Room, "created", policy.Messages, &oldestExpired); err != nil {
+			return time.Time{}, fmt.Errorf("cannot find oldest message to keep in room %v, error: %w", policy.Room, err)
+		}
+
+		if oldestExpired.ID != "" {
+			// messages posted at the same time as the newest expired message are expired too
+			byCount := oldestExpired.Created.Add(time.Nanosecond)
+			if byCount.After(cutoff) {
+				cutoff = byCount
+			}
+		}
+	}
+
+	return cutoff, nil
+}
+
+// expired returns at most purgeBatchSize oldest messages of the room posted before cutoff.
+func (p *Purger) expired(room string, cutoff time.Time) ([]*history.Message, error) {
+	batch := make([]*history.Message, 0, purgeBatchSize)
+
+	newMessage := func() interface{} {
+		return &history.Message{}
+	}
+
+	err := p.messages.FindEach("room", room, "created", time.Unix(0, 0).UTC(), cutoff, newMessage, func(result interface{}) error {
+		batch = append(batch, result.(*history.Message))
+		if len(batch) >= purgeBatchSize {
+			return errBatchFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFull) {
+		return nil, fmt.Errorf("cannot read expired messages of room %v, error: %w", room, err)
+	}
+
+	return batch, nil
+}
+
+// notify notifies the listener about messages removed from the room.
+func (p *Purger) notify(room string, ids []string) {
+	if p.listener != nil && len(ids) > 0 {
+		p.listener.MessagesRemoved(room, ids)
+	}
+}
+
+// remove archives or deletes the message.
+func (p *Purger) remove(msg *history.Message) error {
+	if p.archive != nil {
+		if err := p.archive.Upsert(msg); err != nil {
+			return fmt.Errorf("cannot archive message %v, error: %w", msg.ID, err)
+		}
+	}
+
+	if err := p.messages.Delete(msg.ID); err != nil {
+		return fmt.Errorf("cannot delete message %v, error: %w", msg.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/history"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryMessageDatabase adds queries used by the purger to the in-memory table of messages.
+type memoryMessageDatabase struct {
+	*dbtest.Table
+}
+
+func newMemoryMessageDatabase(messages ...interface{}) memoryMessageDatabase {
+	return memoryMessageDatabase{Table: dbtest.NewTable("id", messages...)}
+}
+
+func (db memoryMessageDatabase) sorted(room string) []*history.Message {
+	found := make([]*history.Message, 0)
+	if err := db.FindAll("room", room, &found); err != nil {
+		panic(err)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Created.Before(found[j].Created)
+	})
+
+	return found
+}
+
+func (db memoryMessageDatabase) Distinct(property string, result interface{}) error {
+	messages := make([]*history.Message, 0)
+	if err := db.All(&messages); err != nil {
+		return err
+	}
+
+	rooms := map[string]bool{}
+	for _, msg := range messages {
+		rooms[msg.Room] = true
+	}
+
+	names := make([]string, 0)
+	for room := range rooms {
+		names = append(names, room)
+	}
+	sort.Strings(names)
+
+	*result.(*[]string) = names
+	return nil
+}
+
+func (db memoryMessageDatabase) FindNth(property string, value interface{}, orderField string, n int, result interface{}) error {
+	found := db.sorted(value.(string))
+	if n < len(found) {
+		*result.(*history.Message) = *found[len(found)-1-n]
+	}
+	return nil
+}
+
+func (db memoryMessageDatabase) FindEach(property string, value interface{}, orderField string, from, to interface{},
+	newResult func() interface{}, f func(result interface{}) error) error {
+	for _, msg := range db.sorted(value.(string)) {
+		if msg.Created.Before(from.(time.Time)) || !msg.Created.Before(to.(time.Time)) {
+			continue
+		}
+
+		result := newResult().(*history.Message)
+		*result = *msg
+		if err := f(result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db memoryMessageDatabase) ids(room string) []string {
+	ids := make([]string, 0)
+	for _, msg := range db.sorted(room) {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+type memoryArchive struct {
+	messages []*history.Message
+}
+
+func (a *memoryArchive) Upsert(entity interface{}) error {
+	a.messages = append(a.messages, entity.(*history.Message))
+	return nil
+}
+
+// recordingAttachments keeps times when attachments were used, keyed by rooms and ids of attachments.
+type recordingAttachments struct {
+	used     map[string]map[string]time.Time
+	deleted  []string
+	archived []string
+}
+
+func (a *recordingAttachments) Rooms() ([]string, error) {
+	rooms := make([]string, 0)
+	for room := range a.used {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms, nil
+}
+
+func (a *recordingAttachments) Expire(room string, before time.Time, archive bool) (int, error) {
+	expired := make([]string, 0)
+	for id, used := range a.used[room] {
+		if used.Before(before) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Strings(expired)
+
+	for _, id := range expired {
+		delete(a.used[room], id)
+	}
+
+	if archive {
+		a.archived = append(a.archived, expired...)
+	} else {
+		a.deleted = append(a.deleted, expired...)
+	}
+
+	return len(expired), nil
+}
+
+// recordingListener keeps ids of removed messages, one slice per notification.
+type recordingListener struct {
+	removed [][]string
+}
+
+func (l *recordingListener) MessagesRemoved(room string, ids []string) {
+	l.removed = append(l.removed, ids)
+}
+
+var now = time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func messageFrom(id, room string, age time.Duration, attachments ...string) *history.Message {
+	msg := &history.Message{ID: id, Room: room, Sender: "john", Content: id, Created: now.Add(-age)}
+	for _, attachment := range attachments {
+		msg.Attachments = append(msg.Attachments, &exchange.Attachment{ID: attachment})
+	}
+	return msg
+}
+
+func newTestPurger(policies *Service, messages MessageDatabase, archive Archive, attachments AttachmentRemover) *Purger {
+	purger := NewPurger(policies, messages, archive, attachments, time.Hour)
+	purger.now = func() time.Time { return now }
+	return purger
+}
+
+func TestPurgerShouldDeleteMessagesAndAttachmentsExpiredByAgeOrCount(t *testing.T) {
+	// given
+	day := 24 * time.Hour
+	messages := newMemoryMessageDatabase(
+		messageFrom("ops-old", "ops", 40*day, "att-1", "att-2"),
+		messageFrom("ops-new", "ops", 10*day, "att-2"),
+		messageFrom("incident-1", "incident", 4*time.Hour),
+		messageFrom("incident-2", "incident", 3*time.Hour),
+		messageFrom("incident-3", "incident", 2*time.Hour),
+	)
+
+	policies := NewService(dbtest.NewTable("room"), Policy{Days: 30})
+	_, err := policies.SetPolicy("incident", 0, 2)
+	assert.NoError(t, err)
+
+	// the second attachment is attached to the kept message as well, the last one is never attached
+	attachments := &recordingAttachments{used: map[string]map[string]time.Time{
+		"ops":     {"att-1": now.Add(-40 * day), "att-2": now.Add(-10 * day)},
+		"uploads": {"att-3": now.Add(-31 * day), "att-4": now.Add(-day)},
+	}}
+	purger := newTestPurger(policies, messages, nil, attachments)
+
+	// when
+	purged, err := purger.Purge()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Equal(t, []string{"ops-new"}, messages.ids("ops"))
+	assert.Equal(t, []string{"incident-2", "incident-3"}, messages.ids("incident"))
+	assert.Equal(t, []string{"att-1", "att-3"}, attachments.deleted)
+}
+
+func TestPurgerShouldArchiveExpiredMessagesAndTheirAttachments(t *testing.T) {
+	// given
+	messages := newMemoryMessageDatabase(
+		messageFrom("old", "ops", 48*time.Hour, "att-1"),
+		messageFrom("new", "ops", time.Hour),
+	)
+
+	archive := &memoryArchive{}
+	attachments := &recordingAttachments{used: map[string]map[string]time.Time{"ops": {"att-1": now.Add(-48 * time.Hour)}}}
+	purger := newTestPurger(NewService(dbtest.NewTable("room"), Policy{Days: 1}), messages, archive, attachments)
+
+	// when
+	purged, err := purger.Purge()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, []string{"new"}, messages.ids("ops"))
+	assert.Len(t, archive.messages, 1)
+	assert.Equal(t, "old", archive.messages[0].ID)
+	assert.Empty(t, attachments.deleted)
+	assert.Equal(t, []string{"att-1"}, attachments.archived)
+}
+
+func TestPurgerShouldDeleteMessagesInBatches(t *testing.T) {
+	// given
+	expired := make([]interface{}, 0)
+	for i := 0; i < purgeBatchSize*2+10; i++ {
+		expired = append(expired, messageFrom(fmt.Sprintf("msg-%04d", i), "ops", time.Duration(i+1)*time.Minute))
+	}
+
+	messages := newMemoryMessageDatabase(expired...)
+	listener := &recordingListener{}
+	purger := newTestPurger(NewService(dbtest.NewTable("room"), Policy{Messages: 5}), messages, nil, &recordingAttachments{})
+	purger.SetRemovalListener(listener)
+
+	// when
+	purged, err := purger.Purge()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, len(expired)-5, purged)
+	assert.Equal(t, []string{"msg-0004", "msg-0003", "msg-0002", "msg-0001", "msg-0000"}, messages.ids("ops"))
+
+	assert.Len(t, listener.removed, 3)
+	assert.Len(t, listener.removed[0], purgeBatchSize)
+	assert.Equal(t, "msg-1009", listener.removed[0][0])
+	assert.Len(t, listener.removed[2], 5)
+}
+
+func TestPurgerShouldPurgeMessagesExpiredBeforeStart(t *testing.T) {
+	// given
+	messages := newMemoryMessageDatabase(messageFrom("old", "ops", 48*time.Hour))
+	purger := newTestPurger(NewService(dbtest.NewTable("room"), Policy{Days: 1}), messages, nil, &recordingAttachments{})
+
+	// when
+	purger.Start()
+
+	// then
+	assert.Eventually(t, func() bool {
+		return len(messages.ids("ops")) == 0
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, purger.Close(context.Background()))
+}
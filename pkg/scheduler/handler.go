@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+// remindCommand is a prefix of text messages which schedule reminders.
+const remindCommand = "/remind"
+
+// remindUsage describes syntax of the remind command.
+const remindUsage = "Usage: /remind [@user] <10m|2h30m|3d|2006-01-02T15:04:05Z07:00> <text>"
+
+type notifier interface {
+	Send(msg *exchange.Message)
+}
+
+// NewScheduleHandler returns handler which schedules message sent by the client. The message
+// is posted into its room at the time set in the message. Client receives confirmation with
+// id of the scheduled message, which can be used to cancel it.
+func NewScheduleHandler(scheduler *Scheduler, client notifier) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduler: scheduler,
+		client:    client,
+	}
+}
+
+type ScheduleHandler struct {
+	scheduler *Scheduler
+	client    notifier
+}
+
+func (h *ScheduleHandler) Handle(msg *exchange.Message) error {
+	if msg.Time == nil {
+		return exchange.NewClientError("Time of the scheduled message cannot be empty")
+	}
+
+	if len(msg.Attachments) > 0 {
+		return exchange.NewClientError("Scheduled messages cannot have attachments")
+	}
+
+	job := &Job{
+		Kind:    KindMessage,
+		Room:    msg.Room,
+		Sender:  msg.SenderName,
+		Content: msg.Content,
+		Format:  msg.Format,
+		HTML:    msg.HTML,
+		Due:     *msg.Time,
+	}
+
+	return schedule(h.scheduler, h.client, job)
+}
+
+// NewRemindMiddleware returns middleware which handles text messages with the remind command.
+// Such messages are not posted into the room, instead reminder is scheduled and sent
+// at requested time only to the reminded user, if the user is a member of the room.
+func NewRemindMiddleware(scheduler *Scheduler, client notifier) exchange.Middleware {
+	return func(next exchange.Handler) exchange.Handler {
+		return exchange.HandlerFunc(func(msg *exchange.Message) error {
+			if !isRemindCommand(msg.Content) {
+				return next.Handle(msg)
+			}
+
+			job, err := parseRemind(msg.Content, msg.SenderName, time.Now())
+			if err != nil {
+				return exchange.NewClientError("%v. %v", err, remindUsage)
+			}
+
+			job.Room = msg.Room
+
+			return schedule(scheduler, client, job)
+		})
+	}
+}
+
+func schedule(scheduler *Scheduler, client notifier, job *Job) error {
+	scheduled, err := scheduler.Schedule(job)
+	if errors.Is(err, ErrInvalidDue) || errors.Is(err, ErrEmptyContent) || errors.Is(err, ErrTooManyJobs) {
+		return exchange.NewClientError("Cannot schedule %v: %v", job.Kind, err)
+	} else if err != nil {
+		return fmt.Errorf("cannot schedule %v, error: %w", job.Kind, err)
+	}
+
+	client.Send(exchange.NewScheduledMessage(scheduled.ID, scheduled.Room, scheduled.Content, scheduled.Due))
+	return nil
+}
+
+func isRemindCommand(content string) bool {
+	fields := strings.Fields(content)
+	return len(fields) > 0 && fields[0] == remindCommand
+}
+
+// parseRemind parses remind command sent by the user with given name.
+func parseRemind(content, sender string, now time.Time) (*Job, error) {
+	args := strings.Fields(strings.TrimPrefix(strings.TrimSpace(content), remindCommand))
+
+	recipient := sender
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		recipient = strings.TrimPrefix(args[0], "@")
+		if recipient == "" {
+			return nil, errors.New("name of the reminded user cannot be empty")
+		}
+		args = args[1:]
+	}
+
+	if len(args) < 2 {
+		return nil, errors.New("time and text of the reminder are required")
+	}
+
+	due, err := parseDue(args[0], now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		Kind:      KindReminder,
+		Sender:    sender,
+		Recipient: recipient,
+		Content:   strings.Join(args[1:], " "),
+		Due:       due,
+	}, nil
+}
+
+// parseDue parses time as delay after now (Go duration or number of days with 'd' suffix)
+// or as time in RFC 3339 format.
+func parseDue(value string, now time.Time) (time.Time, error) {
+	if due, err := time.Parse(time.RFC3339, value); err == nil {
+		return due, nil
+	}
+
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return now.AddDate(0, 0, days), nil
+		}
+	}
+
+	delay, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%v'", value)
+	}
+
+	return now.Add(delay), nil
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	sent []*exchange.Message
+}
+
+func (n *recordingNotifier) Send(msg *exchange.Message) {
+	n.sent = append(n.sent, msg)
+}
+
+func TestParseRemindShouldReadRecipientTimeAndText(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// when
+	own, ownErr := parseRemind("/remind 2h30m check the build", "john", now)
+	other, otherErr := parseRemind("/remind @anna 2d review PR", "john", now)
+	absolute, absoluteErr := parseRemind("/remind 2020-03-11T09:00:00Z standup", "john", now)
+	_, invalidErr := parseRemind("/remind tomorrow standup", "john", now)
+	_, missingErr := parseRemind("/remind @anna 1h", "john", now)
+
+	// then
+	assert.NoError(t, ownErr)
+	assert.Equal(t, &Job{Kind: KindReminder, Sender: "john", Recipient: "john", Content: "check the build", Due: now.Add(150 * time.Minute)}, own)
+
+	assert.NoError(t, otherErr)
+	assert.Equal(t, "anna", other.Recipient)
+	assert.Equal(t, "review PR", other.Content)
+	assert.Equal(t, now.AddDate(0, 0, 2), other.Due)
+
+	assert.NoError(t, absoluteErr)
+	assert.Equal(t, time.Date(2020, 3, 11, 9, 0, 0, 0, time.UTC), absolute.Due)
+
+	assert.Error(t, invalidErr)
+	assert.Error(t, missingErr)
+}
+
+func TestRemindMiddlewareShouldScheduleReminderInsteadOfPostingMessage(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	scheduler := NewScheduler(db, newFakeRooms(), DefaultConfig())
+	client := &recordingNotifier{}
+
+	var posted []*exchange.Message
+	next := exchange.HandlerFunc(func(msg *exchange.Message) error {
+		posted = append(posted, msg)
+		return nil
+	})
+
+	handler := NewRemindMiddleware(scheduler, client)(next)
+
+	// when
+	remindErr := handler.Handle(&exchange.Message{MsgType: exchange.MsgTextMsgMT, Room: "ops", SenderName: "john", Content: "/remind 1h deploy"})
+	textErr := handler.Handle(&exchange.Message{MsgType: exchange.MsgTextMsgMT, Room: "ops", SenderName: "john", Content: "/reminder is not a command"})
+	invalidErr := handler.Handle(&exchange.Message{MsgType: exchange.MsgTextMsgMT, Room: "ops", SenderName: "john", Content: "/remind later deploy"})
+
+	// then
+	assert.NoError(t, remindErr)
+	assert.NoError(t, textErr)
+	_, isClientErr := exchange.AsClientError(invalidErr)
+	assert.True(t, isClientErr)
+
+	assert.Len(t, posted, 1)
+	assert.Equal(t, 1, db.Len())
+
+	assert.Len(t, client.sent, 1)
+	assert.Equal(t, exchange.MsgScheduleMT, client.sent[0].MsgType)
+	assert.Equal(t, "ops", client.sent[0].Room)
+	assert.Equal(t, "uuid-1", client.sent[0].ID)
+}
+
+func TestScheduleHandlerShouldRejectMessageWithoutTime(t *testing.T) {
+	// given
+	scheduler := NewScheduler(dbtest.NewTable("id"), newFakeRooms(), DefaultConfig())
+	client := &recordingNotifier{}
+	handler := NewScheduleHandler(scheduler, client)
+
+	due := time.Now().Add(time.Hour)
+
+	// when
+	missingErr := handler.Handle(&exchange.Message{MsgType: exchange.MsgScheduleMT, Room: "ops", SenderName: "john", Content: "deploy"})
+	err := handler.Handle(&exchange.Message{MsgType: exchange.MsgScheduleMT, Room: "ops", SenderName: "john", Content: "deploy", Time: &due})
+
+	// then
+	_, isClientErr := exchange.AsClientError(missingErr)
+	assert.True(t, isClientErr)
+	assert.NoError(t, err)
+	assert.Len(t, client.sent, 1)
+	assert.Len(t, scheduler.List("john"), 1)
+}
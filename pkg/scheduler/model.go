@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+const (
+	// KindMessage is a kind of job which posts message into the room.
+	KindMessage = "message"
+	// KindReminder is a kind of job which reminds the user about something in the room.
+	KindReminder = "reminder"
+)
+
+// Job is a message which should be posted into the room at Due time.
+type Job struct {
+	ID   string `json:"id" gorethink:"id,omitempty"`
+	Kind string `json:"kind" gorethink:"kind"`
+	Room string `json:"room" gorethink:"room"`
+	// Sender is the name of the user who scheduled the job.
+	Sender string `json:"sender" gorethink:"sender"`
+	// Recipient is the name of the user who is reminded. It is set only for reminders.
+	Recipient string `json:"recipient,omitempty" gorethink:"recipient,omitempty"`
+	// RoomOwner is the owner of the room when the job was scheduled.
+	RoomOwner string    `json:"-" gorethink:"roomOwner"`
+	Content   string    `json:"content" gorethink:"content"`
+	Format    string    `json:"format,omitempty" gorethink:"format,omitempty"`
+	HTML      string    `json:"html,omitempty" gorethink:"html,omitempty"`
+	Due       time.Time `json:"due" gorethink:"due"`
+	Created   time.Time `json:"created" gorethink:"created"`
+
+	// retryAt is a time of the next delivery attempt of the job which couldn't be delivered.
+	retryAt time.Time
+}
+
+// Empty returns 'true' if the Job struct is empty, false otherwise.
+func (j *Job) Empty() bool {
+	return j == nil || j.ID == ""
+}
+
+// message returns text message posted into the room when the job is due. Reminders are sent
+// only to the reminded user.
+func (j *Job) message() *exchange.Message {
+	msg := &exchange.Message{
+		MsgType:    exchange.MsgTextMsgMT,
+		SenderID:   idPrefix + j.ID,
+		SenderName: j.Sender,
+		Room:       j.Room,
+		Content:    j.Content,
+		Format:     j.Format,
+		HTML:       j.HTML,
+	}
+
+	if j.Kind == KindReminder {
+		msg.Format, msg.HTML = "", ""
+
+		if j.Recipient == j.Sender {
+			msg.Content = fmt.Sprintf("@%v reminder: %v", j.Recipient, j.Content)
+		} else {
+			msg.Content = fmt.Sprintf("@%v reminder from @%v: %v", j.Recipient, j.Sender, j.Content)
+		}
+	}
+
+	return msg
+}
+
+// nextAttempt returns time when the job should be delivered.
+func (j *Job) nextAttempt() time.Time {
+	if j.retryAt.After(j.Due) {
+		return j.retryAt
+	}
+	return j.Due
+}
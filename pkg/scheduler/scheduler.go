@@ -0,0 +1,311 @@
+// Package scheduler posts messages into the rooms at requested time.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+	"github.com/adrian83/chat/pkg/worker"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	idPrefix = "scheduler-"
+	// idleWait is a time the scheduler waits when there are no jobs, new jobs wake it up earlier.
+	idleWait = time.Hour
+)
+
+var (
+	// ErrNotFound is returned when job cannot be found.
+	ErrNotFound = errors.New("scheduled message not found")
+	// ErrInvalidDue is returned when job isn't due in the future or it is due too far in the future.
+	ErrInvalidDue = errors.New("scheduled time should be in the future, but not later than a year from now")
+	// ErrEmptyContent is returned when job has nothing to post.
+	ErrEmptyContent = errors.New("scheduled message cannot be empty")
+	// ErrTooManyJobs is returned when user has maximal number of pending jobs.
+	ErrTooManyJobs = errors.New("too many scheduled messages, cancel some of them first")
+)
+
+// Database is an interface which defines persistence of jobs.
+type Database interface {
+	UUID() (string, error)
+	Insert(interface{}) error
+	All(result interface{}) error
+	Delete(id string) error
+}
+
+// Rooms is an interface wrapping methods used to post messages into the rooms.
+type Rooms interface {
+	RoomOwner(roomName string) (string, bool)
+	OwnerOf(roomName string) (string, bool)
+	IsMember(roomName, userName string) bool
+	SendMessageOnRoom(msg *exchange.Message)
+	SendToUser(userName string, msg *exchange.Message) bool
+}
+
+// Config contains settings of the Scheduler.
+type Config struct {
+	// MaxLateness is a time after which job which couldn't be delivered, because the server
+	// was down or the room didn't exist, is dropped.
+	MaxLateness time.Duration
+	// RetryInterval is a time between delivery attempts of jobs which room doesn't exist.
+	RetryInterval time.Duration
+	// MaxAhead is a maximal time between scheduling and delivering the job.
+	MaxAhead time.Duration
+	// MaxPerUser is a maximal number of pending jobs scheduled by a single user.
+	MaxPerUser int
+}
+
+// DefaultConfig returns settings used in production.
+func DefaultConfig() Config {
+	return Config{
+		MaxLateness:   24 * time.Hour,
+		RetryInterval: time.Minute,
+		MaxAhead:      365 * 24 * time.Hour,
+		MaxPerUser:    100,
+	}
+}
+
+// Scheduler persists jobs and posts their messages into the rooms when they are due.
+// Pending jobs are loaded at start, so they survive restarts of the server. Messages are
+// posted only while their senders are members of the rooms and reminders are sent only
+// to the reminded users. Jobs of the rooms which got a different owner are dropped.
+type Scheduler struct {
+	db     Database
+	rooms  Rooms
+	config Config
+	now    func() time.Time
+	lock   sync.Mutex
+	jobs   map[string]*Job
+	loop   *worker.Loop
+}
+
+// NewScheduler returns new Scheduler. Load and Start have to be called before jobs are delivered.
+func NewScheduler(db Database, rooms Rooms, config Config) *Scheduler {
+	scheduler := &Scheduler{
+		db:     db,
+		rooms:  rooms,
+		config: config,
+		now:    time.Now,
+		jobs:   map[string]*Job{},
+	}
+	scheduler.loop = worker.NewLoop(idleWait, scheduler.deliverDue)
+
+	return scheduler
+}
+
+// Load reads pending jobs from database.
+func (s *Scheduler) Load() error {
+	jobs := make([]*Job, 0)
+	if err := s.db.All(&jobs); err != nil {
+		return fmt.Errorf("cannot read scheduled messages, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.jobs = map[string]*Job{}
+	for _, job := range jobs {
+		s.jobs[job.ID] = job
+	}
+
+	return nil
+}
+
+// Start starts goroutine delivering due jobs. Jobs which were due while the server
+// was down are delivered right after the start, unless they are later than MaxLateness.
+func (s *Scheduler) Start() {
+	s.loop.Start()
+}
+
+// Close stops delivering jobs and waits until the delivery in progress finishes
+// or the context is done. Pending jobs stay persisted.
+func (s *Scheduler) Close(ctx context.Context) error {
+	if err := s.loop.Close(ctx); err != nil {
+		return fmt.Errorf("scheduler not stopped before deadline, error: %w", err)
+	}
+	return nil
+}
+
+// Schedule persists given job. Its id, time of creation and owner of its room are set.
+func (s *Scheduler) Schedule(job *Job) (*Job, error) {
+	now := s.now().UTC()
+
+	if !job.Due.After(now) || job.Due.After(now.Add(s.config.MaxAhead)) {
+		return nil, ErrInvalidDue
+	}
+
+	if strings.TrimSpace(job.Content) == "" {
+		return nil, ErrEmptyContent
+	}
+
+	if s.config.MaxPerUser > 0 && len(s.List(job.Sender)) >= s.config.MaxPerUser {
+		return nil, ErrTooManyJobs
+	}
+
+	id, err := s.db.UUID()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create id of scheduled message, error: %w", err)
+	}
+
+	job.ID = id
+	job.Due = job.Due.UTC()
+	job.Created = now
+	job.RoomOwner, _ = s.rooms.OwnerOf(job.Room)
+
+	if err := s.db.Insert(job); err != nil {
+		return nil, fmt.Errorf("cannot persist scheduled message, error: %w", err)
+	}
+
+	s.lock.Lock()
+	s.jobs[job.ID] = job
+	s.lock.Unlock()
+
+	// the new job may be due earlier than the one the scheduler waits for
+	s.loop.Wake()
+
+	return job, nil
+}
+
+// List returns pending jobs scheduled by the user with given name, sorted by due time.
+func (s *Scheduler) List(userName string) []*Job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs := make([]*Job, 0)
+	for _, job := range s.jobs {
+		if job.Sender == userName {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Due.Before(jobs[j].Due)
+	})
+
+	return jobs
+}
+
+// Cancel removes pending job with given id scheduled by the user with given name.
+func (s *Scheduler) Cancel(userName, id string) error {
+	s.lock.Lock()
+	job, ok := s.jobs[id]
+	s.lock.Unlock()
+
+	if !ok || job.Sender != userName {
+		return ErrNotFound
+	}
+
+	if err := s.db.Delete(id); err != nil {
+		return fmt.Errorf("cannot remove scheduled message %v, error: %w", id, err)
+	}
+
+	s.lock.Lock()
+	delete(s.jobs, id)
+	s.lock.Unlock()
+
+	return nil
+}
+
+// deliverDue delivers jobs which are due and returns time when the next job is due
+// or zero time if there are no pending jobs.
+func (s *Scheduler) deliverDue() time.Time {
+	now := s.now().UTC()
+
+	s.lock.Lock()
+	due := make([]*Job, 0)
+	for _, job := range s.jobs {
+		if !job.nextAttempt().After(now) {
+			due = append(due, job)
+		}
+	}
+	s.lock.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].Due.Before(due[j].Due)
+	})
+
+	for _, job := range due {
+		s.deliver(job, now)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var next time.Time
+	for _, job := range s.jobs {
+		if attempt := job.nextAttempt(); next.IsZero() || attempt.Before(next) {
+			next = attempt
+		}
+	}
+
+	return next
+}
+
+func (s *Scheduler) deliver(job *Job, now time.Time) {
+	late := now.Sub(job.Due)
+
+	if late > s.config.MaxLateness {
+		logger.Warnf("Scheduled %v %v of %v in room %v dropped, it is late by %v", job.Kind, job.ID, job.Sender, job.Room, late)
+		s.remove(job)
+		return
+	}
+
+	if _, exists := s.rooms.RoomOwner(job.Room); !exists {
+		logger.Infof("Room %v of scheduled %v %v doesn't exist, delivery will be retried", job.Room, job.Kind, job.ID)
+		s.retry(job, now)
+		return
+	}
+
+	// room names can be released, the job isn't delivered into a room of somebody else
+	if owner, _ := s.rooms.OwnerOf(job.Room); owner != job.RoomOwner {
+		logger.Warnf("Scheduled %v %v of %v dropped, room %v has a different owner", job.Kind, job.ID, job.Sender, job.Room)
+		s.remove(job)
+		return
+	}
+
+	if !s.rooms.IsMember(job.Room, job.Sender) {
+		logger.Infof("Sender of scheduled %v %v isn't a member of room %v, delivery will be retried", job.Kind, job.ID, job.Room)
+		s.retry(job, now)
+		return
+	}
+
+	if job.Kind == KindReminder {
+		if !s.rooms.SendToUser(job.Recipient, job.message()) {
+			logger.Infof("Recipient of reminder %v isn't a member of room %v, delivery will be retried", job.ID, job.Room)
+			s.retry(job, now)
+			return
+		}
+	} else {
+		s.rooms.SendMessageOnRoom(job.message())
+	}
+
+	if late > time.Minute {
+		logger.Warnf("Scheduled %v %v of %v in room %v delivered late by %v", job.Kind, job.ID, job.Sender, job.Room, late)
+	}
+
+	s.remove(job)
+}
+
+func (s *Scheduler) retry(job *Job, now time.Time) {
+	s.lock.Lock()
+	job.retryAt = now.Add(s.config.RetryInterval)
+	s.lock.Unlock()
+}
+
+func (s *Scheduler) remove(job *Job) {
+	if err := s.db.Delete(job.ID); err != nil {
+		logger.Errorf("Cannot remove scheduled %v %v. Error: %v", job.Kind, job.ID, err)
+	}
+
+	s.lock.Lock()
+	delete(s.jobs, job.ID)
+	s.lock.Unlock()
+}
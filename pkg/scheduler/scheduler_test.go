@@ -0,0 +1,274 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRooms struct {
+	lock     sync.Mutex
+	existing map[string]bool
+	owners   map[string]string
+	members  map[string]bool
+	sent     []*exchange.Message
+	sentTo   map[string][]*exchange.Message
+}
+
+func newFakeRooms(rooms ...string) *fakeRooms {
+	fake := &fakeRooms{existing: map[string]bool{}, owners: map[string]string{}, members: map[string]bool{}, sentTo: map[string][]*exchange.Message{}}
+	for _, room := range rooms {
+		fake.existing[room] = true
+	}
+	return fake
+}
+
+func (r *fakeRooms) join(roomName string, userNames ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, userName := range userNames {
+		r.members[roomName+"/"+userName] = true
+	}
+}
+
+func (r *fakeRooms) RoomOwner(roomName string) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.owners[roomName], r.existing[roomName]
+}
+
+func (r *fakeRooms) OwnerOf(roomName string) (string, bool) {
+	return r.RoomOwner(roomName)
+}
+
+func (r *fakeRooms) IsMember(roomName, userName string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.members[roomName+"/"+userName]
+}
+
+func (r *fakeRooms) SendToUser(userName string, msg *exchange.Message) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.members[msg.Room+"/"+userName] {
+		return false
+	}
+
+	r.sentTo[userName] = append(r.sentTo[userName], msg)
+	return true
+}
+
+func (r *fakeRooms) SendMessageOnRoom(msg *exchange.Message) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sent = append(r.sent, msg)
+}
+
+func (r *fakeRooms) sentMessages() []*exchange.Message {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]*exchange.Message{}, r.sent...)
+}
+
+func newTestScheduler(db Database, rooms Rooms, now time.Time) *Scheduler {
+	scheduler := NewScheduler(db, rooms, DefaultConfig())
+	scheduler.now = func() time.Time { return now }
+	return scheduler
+}
+
+func TestSchedulerShouldPersistValidJobs(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id")
+	scheduler := newTestScheduler(db, newFakeRooms(), now)
+
+	// when
+	job, err := scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: "deploy", Due: now.Add(time.Hour)})
+	_, pastErr := scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: "deploy", Due: now.Add(-time.Hour)})
+	_, farErr := scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: "deploy", Due: now.AddDate(2, 0, 0)})
+	_, emptyErr := scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: " ", Due: now.Add(time.Hour)})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid-1", job.ID)
+	assert.Equal(t, now, job.Created)
+	assert.Equal(t, ErrInvalidDue, pastErr)
+	assert.Equal(t, ErrInvalidDue, farErr)
+	assert.Equal(t, ErrEmptyContent, emptyErr)
+	assert.Equal(t, 1, db.Len())
+	assert.Equal(t, []*Job{job}, scheduler.List("john"))
+	assert.Empty(t, scheduler.List("anna"))
+}
+
+func TestSchedulerShouldLimitPendingJobsPerUser(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	scheduler := newTestScheduler(dbtest.NewTable("id"), newFakeRooms(), now)
+	scheduler.config.MaxPerUser = 1
+
+	_, err := scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: "first", Due: now.Add(time.Hour)})
+	assert.NoError(t, err)
+
+	// when
+	_, err = scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: "second", Due: now.Add(time.Hour)})
+
+	// then
+	assert.Equal(t, ErrTooManyJobs, err)
+}
+
+func TestSchedulerShouldCancelOnlyOwnJobs(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id")
+	scheduler := newTestScheduler(db, newFakeRooms(), now)
+
+	job, err := scheduler.Schedule(&Job{Kind: KindMessage, Room: "ops", Sender: "john", Content: "deploy", Due: now.Add(time.Hour)})
+	assert.NoError(t, err)
+
+	// when
+	otherErr := scheduler.Cancel("anna", job.ID)
+	ownErr := scheduler.Cancel("john", job.ID)
+
+	// then
+	assert.Equal(t, ErrNotFound, otherErr)
+	assert.NoError(t, ownErr)
+	assert.Empty(t, scheduler.List("john"))
+	assert.Equal(t, 0, db.Len())
+}
+
+func TestSchedulerShouldDeliverDueJobs(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id",
+		&Job{ID: "1", Kind: KindMessage, Room: "ops", Sender: "john", Content: "deploy", Format: exchange.FormatMarkdown, HTML: "<p>deploy</p>", Due: now.Add(-time.Minute)},
+		&Job{ID: "2", Kind: KindReminder, Room: "ops", Sender: "john", Recipient: "anna", Content: "review", Due: now},
+		&Job{ID: "3", Kind: KindMessage, Room: "ops", Sender: "john", Content: "later", Due: now.Add(time.Hour)},
+	)
+	rooms := newFakeRooms("ops")
+	rooms.join("ops", "john", "anna")
+
+	scheduler := newTestScheduler(db, rooms, now)
+	assert.NoError(t, scheduler.Load())
+
+	// when
+	next := scheduler.deliverDue()
+
+	// then
+	sent := rooms.sentMessages()
+	assert.Len(t, sent, 1)
+	assert.Equal(t, "deploy", sent[0].Content)
+	assert.Equal(t, "<p>deploy</p>", sent[0].HTML)
+	assert.Equal(t, "john", sent[0].SenderName)
+
+	reminders := rooms.sentTo["anna"]
+	assert.Len(t, reminders, 1)
+	assert.Equal(t, exchange.MsgTextMsgMT, reminders[0].MsgType)
+	assert.Equal(t, "@anna reminder from @john: review", reminders[0].Content)
+	assert.Empty(t, rooms.sentTo["john"])
+
+	assert.Equal(t, now.Add(time.Hour), next)
+	assert.Equal(t, 1, db.Len())
+}
+
+func TestSchedulerShouldRetryJobsOfMissingRoomsAndDropTooLateJobs(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id",
+		&Job{ID: "1", Kind: KindMessage, Room: "ops", Sender: "john", Content: "missing room", Due: now},
+		&Job{ID: "2", Kind: KindMessage, Room: "main", Sender: "john", Content: "too late", Due: now.Add(-48 * time.Hour)},
+	)
+	rooms := newFakeRooms("main")
+	rooms.join("main", "john")
+
+	scheduler := newTestScheduler(db, rooms, now)
+	assert.NoError(t, scheduler.Load())
+
+	// when
+	next := scheduler.deliverDue()
+
+	// then
+	assert.Empty(t, rooms.sentMessages())
+	assert.Equal(t, now.Add(time.Minute), next)
+	assert.Equal(t, 1, db.Len())
+	assert.Len(t, scheduler.List("john"), 1)
+}
+
+func TestSchedulerShouldDeliverOnlyWhenSenderAndRecipientAreMembersOfTheSameRoom(t *testing.T) {
+	// given
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := dbtest.NewTable("id",
+		&Job{ID: "1", Kind: KindMessage, Room: "ops", Sender: "john", Content: "sender left", Due: now},
+		&Job{ID: "2", Kind: KindReminder, Room: "ops", Sender: "anna", Recipient: "jane", Content: "recipient away", Due: now},
+		&Job{ID: "3", Kind: KindMessage, Room: "dev", Sender: "anna", RoomOwner: "anna", Content: "room taken over", Due: now},
+	)
+	rooms := newFakeRooms("ops", "dev")
+	rooms.owners["dev"] = "mark"
+	rooms.join("ops", "anna")
+	rooms.join("dev", "anna")
+
+	scheduler := newTestScheduler(db, rooms, now)
+	assert.NoError(t, scheduler.Load())
+
+	// when
+	next := scheduler.deliverDue()
+
+	// then
+	assert.Empty(t, rooms.sentMessages())
+	assert.Empty(t, rooms.sentTo)
+	assert.Equal(t, now.Add(time.Minute), next)
+	assert.Len(t, scheduler.List("john"), 1)
+	assert.Len(t, scheduler.List("anna"), 1)
+	assert.Equal(t, 2, db.Len())
+}
+
+func TestSchedulerShouldDeliverJobsMissedBeforeStart(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id", &Job{ID: "1", Kind: KindMessage, Room: "main", Sender: "john", Content: "missed", Due: time.Now().Add(-time.Hour)})
+	rooms := newFakeRooms("main")
+	rooms.join("main", "john")
+
+	scheduler := NewScheduler(db, rooms, DefaultConfig())
+	assert.NoError(t, scheduler.Load())
+
+	// when
+	scheduler.Start()
+
+	// then
+	assert.Eventually(t, func() bool {
+		return len(rooms.sentMessages()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, scheduler.Close(context.Background()))
+	assert.Equal(t, 0, db.Len())
+}
+
+func TestSchedulerShouldDeliverJobScheduledAfterStart(t *testing.T) {
+	// given
+	rooms := newFakeRooms("main")
+	rooms.join("main", "john")
+
+	scheduler := NewScheduler(dbtest.NewTable("id"), rooms, DefaultConfig())
+	scheduler.Start()
+	defer scheduler.Close(context.Background())
+
+	// when
+	_, err := scheduler.Schedule(&Job{Kind: KindMessage, Room: "main", Sender: "john", Content: "soon", Due: time.Now().Add(50 * time.Millisecond)})
+
+	// then
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(rooms.sentMessages()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,363 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// HeaderEvent contains type of the event.
+	HeaderEvent = "X-Chat-Event"
+	// HeaderDelivery contains unique id of the notification, it is the same for all attempts.
+	HeaderDelivery = "X-Chat-Delivery"
+	// HeaderTimestamp contains unix time (in seconds) of the attempt.
+	HeaderTimestamp = "X-Chat-Timestamp"
+	// HeaderSignature contains 'sha256=' followed by hex encoded HMAC-SHA256
+	// of timestamp, dot and request body, computed with webhook's secret.
+	HeaderSignature = "X-Chat-Signature"
+
+	signaturePrefix = "sha256="
+
+	// DroppedDeadLetter means that notification wasn't delivered and became a dead letter.
+	DroppedDeadLetter = "webhook_dead_letter"
+)
+
+// Sign returns signature of the notification sent at given time (unix seconds) with given body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if given signature is valid for given timestamp and body.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+type subscribers interface {
+	Subscribers(room, eventType string) []*Webhook
+}
+
+type deadLetters interface {
+	Insert(interface{}) error
+}
+
+// DropCounter counts notifications which weren't delivered by reason of the drop.
+type DropCounter interface {
+	Dropped(reason string)
+}
+
+// Config contains settings of the Dispatcher.
+type Config struct {
+	Workers     int
+	QueueSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	// AllowPrivate allows notifications to loopback, link-local and private addresses.
+	// It should be enabled only in tests.
+	AllowPrivate bool
+}
+
+// DefaultConfig returns settings used in production.
+func DefaultConfig() Config {
+	return Config{
+		Workers:     4,
+		QueueSize:   1000,
+		MaxAttempts: 6,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		Timeout:     10 * time.Second,
+	}
+}
+
+type delivery struct {
+	id      string
+	webhook *Webhook
+	event   string
+	body    []byte
+	attempt int
+	lastErr error
+}
+
+// Dispatcher delivers notifications about events to the webhooks in the background.
+// Failed deliveries are retried with exponential backoff, notifications which cannot
+// be delivered are logged and stored as dead letters. Dead letters are stored in
+// the background too, so events are never blocked by the database.
+type Dispatcher struct {
+	webhooks    subscribers
+	deadLetters deadLetters
+	drops       DropCounter
+	config      Config
+	client      *http.Client
+	queue       chan *delivery
+	letters     chan *DeadLetter
+	stopping    chan struct{}
+	stopOnce    sync.Once
+	workers     sync.WaitGroup
+	flush       chan struct{}
+	flushed     chan struct{}
+}
+
+// NewDispatcher returns new Dispatcher. Start has to be called before events are delivered.
+// Notifications are never sent to loopback, link-local or private addresses unless
+// it is allowed in the config.
+func NewDispatcher(webhooks subscribers, deadLetters deadLetters, config Config) *Dispatcher {
+	transport := &http.Transport{
+		DialContext:         newDialer(config.Timeout, config.AllowPrivate).DialContext,
+		TLSHandshakeTimeout: config.Timeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &Dispatcher{
+		webhooks:    webhooks,
+		deadLetters: deadLetters,
+		config:      config,
+		client:      &http.Client{Timeout: config.Timeout, Transport: transport},
+		queue:       make(chan *delivery, config.QueueSize),
+		letters:     make(chan *DeadLetter, config.QueueSize),
+		stopping:    make(chan struct{}),
+		flush:       make(chan struct{}),
+		flushed:     make(chan struct{}),
+	}
+}
+
+// SetDropCounter sets counter of notifications which weren't delivered. It should be called before Start.
+func (d *Dispatcher) SetDropCounter(counter DropCounter) {
+	d.drops = counter
+}
+
+// Start starts workers delivering notifications and storing dead letters.
+func (d *Dispatcher) Start() {
+	for i := 0; i < d.config.Workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+
+	go d.storeDeadLetters()
+}
+
+// Close stops accepting new events and waits until queued notifications are delivered
+// or the context is done. Notifications which are retried later are stored as dead letters.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.stopOnce.Do(func() {
+		close(d.stopping)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(d.flush)
+		<-d.flushed
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook notifications not delivered before deadline, error: %w", ctx.Err())
+	}
+}
+
+// OnEvent queues notifications for all webhooks subscribing given event.
+func (d *Dispatcher) OnEvent(event *exchange.Event) {
+	webhooks := d.webhooks.Subscribers(event.Room, event.Type)
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(newPayload(event))
+	if err != nil {
+		logger.Errorf("Cannot create webhook payload for event %v in room %v. Error: %v", event.Type, event.Room, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		d.enqueue(&delivery{
+			id:      uuid.New().String(),
+			webhook: webhook,
+			event:   event.Type,
+			body:    body,
+		})
+	}
+}
+
+func (d *Dispatcher) enqueue(del *delivery) {
+	select {
+	case <-d.stopping:
+		d.deadLetter(del, "dispatcher stopped")
+		return
+	default:
+	}
+
+	select {
+	case d.queue <- del:
+	default:
+		d.deadLetter(del, "queue is full")
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+
+	for {
+		select {
+		case del := <-d.queue:
+			d.deliver(del)
+		case <-d.stopping:
+			for {
+				select {
+				case del := <-d.queue:
+					d.deliver(del)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(del *delivery) {
+	del.attempt++
+
+	retry, err := d.send(del)
+	if err == nil {
+		logger.Infof("Webhook %v notified about %v (delivery %v, attempt %v)", del.webhook.ID, del.event, del.id, del.attempt)
+		return
+	}
+
+	del.lastErr = err
+	logger.Warnf("Webhook %v notification %v failed (attempt %v). Error: %v", del.webhook.ID, del.id, del.attempt, err)
+
+	if !retry || del.attempt >= d.config.MaxAttempts {
+		d.deadLetter(del, err.Error())
+		return
+	}
+
+	time.AfterFunc(d.backoff(del.attempt), func() {
+		d.enqueue(del)
+	})
+}
+
+// send posts notification and returns error if it wasn't accepted together
+// with information if it makes sense to try again.
+func (d *Dispatcher) send(del *delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, del.webhook.URL, bytes.NewReader(del.body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, del.event)
+	req.Header.Set(HeaderDelivery, del.id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(del.webhook.Secret, timestamp, del.body))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, ErrForbiddenTarget) {
+		return false, err
+	} else if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	// drain body, so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("webhook responded with status %v", resp.StatusCode)
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.config.Backoff
+	for i := 1; i < attempt && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > d.config.MaxBackoff {
+		return d.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (d *Dispatcher) deadLetter(del *delivery, reason string) {
+	logger.Errorf("Webhook %v notification %v about %v in room %v dropped after %v attempts. Reason: %v",
+		del.webhook.ID, del.id, del.event, del.webhook.Room, del.attempt, reason)
+
+	if d.drops != nil {
+		d.drops.Dropped(DroppedDeadLetter)
+	}
+
+	letter := &DeadLetter{
+		ID:        del.id,
+		WebhookID: del.webhook.ID,
+		Room:      del.webhook.Room,
+		URL:       del.webhook.URL,
+		Event:     del.event,
+		Payload:   string(del.body),
+		Attempts:  del.attempt,
+		Error:     reason,
+		Created:   time.Now().UTC(),
+	}
+
+	select {
+	case d.letters <- letter:
+	default:
+		logger.Errorf("Cannot store dead letter of webhook notification %v, too many dead letters are waiting", del.id)
+	}
+}
+
+// storeDeadLetters persists dead letters until the dispatcher is closed and all queued letters are stored.
+func (d *Dispatcher) storeDeadLetters() {
+	defer close(d.flushed)
+
+	for {
+		select {
+		case letter := <-d.letters:
+			d.storeDeadLetter(letter)
+		case <-d.flush:
+			for {
+				select {
+				case letter := <-d.letters:
+					d.storeDeadLetter(letter)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) storeDeadLetter(letter *DeadLetter) {
+	if err := d.deadLetters.Insert(letter); err != nil {
+		logger.Errorf("Cannot store dead letter of webhook notification %v. Error: %v", letter.ID, err)
+	}
+}
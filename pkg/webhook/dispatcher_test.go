@@ -0,0 +1,258 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticSubscribers []*Webhook
+
+func (s staticSubscribers) Subscribers(room, eventType string) []*Webhook {
+	return s
+}
+
+type memoryDeadLetters struct {
+	lock    sync.Mutex
+	letters []*DeadLetter
+}
+
+func (m *memoryDeadLetters) Insert(entity interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.letters = append(m.letters, entity.(*DeadLetter))
+	return nil
+}
+
+type countingDrops struct {
+	lock    sync.Mutex
+	reasons map[string]int
+}
+
+func (c *countingDrops) Dropped(reason string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reasons[reason]++
+}
+
+func testConfig() Config {
+	return Config{
+		Workers:      1,
+		QueueSize:    10,
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+		Timeout:      time.Second,
+		AllowPrivate: true,
+	}
+}
+
+func testEvent() *exchange.Event {
+	return &exchange.Event{
+		Type:    exchange.EventMessagePosted,
+		Room:    "ops",
+		User:    "john",
+		Message: &exchange.Message{SenderID: "session-id", SenderName: "john", Content: "build failed"},
+		Time:    time.Now(),
+	}
+}
+
+func TestDispatcherShouldSendSignedNotificationAndRetryFailures(t *testing.T) {
+	// given
+	requests := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests <- req
+		bodies <- body
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: "hook", Room: "ops", URL: server.URL, Secret: "secret"}
+	deadLetters := &memoryDeadLetters{}
+
+	dispatcher := NewDispatcher(staticSubscribers{webhook}, deadLetters, testConfig())
+	dispatcher.Start()
+
+	// when
+	dispatcher.OnEvent(testEvent())
+
+	// then
+	select {
+	case req := <-requests:
+		body := <-bodies
+		assert.Equal(t, exchange.EventMessagePosted, req.Header.Get(HeaderEvent))
+		assert.True(t, Verify("secret", req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body))
+		assert.False(t, Verify("other", req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderSignature), body))
+
+		var payload Payload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, "build failed", payload.Message.Content)
+		assert.NotContains(t, string(body), "session-id")
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not delivered")
+	}
+
+	assert.NoError(t, dispatcher.Close(context.Background()))
+	assert.Empty(t, deadLetters.letters)
+}
+
+func TestDispatcherShouldStoreDeadLetterAfterLastAttempt(t *testing.T) {
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: "hook", Room: "ops", URL: server.URL, Secret: "secret"}
+	deadLetters := &memoryDeadLetters{}
+	drops := &countingDrops{reasons: map[string]int{}}
+
+	dispatcher := NewDispatcher(staticSubscribers{webhook}, deadLetters, testConfig())
+	dispatcher.SetDropCounter(drops)
+	dispatcher.Start()
+	defer dispatcher.Close(context.Background())
+
+	// when
+	dispatcher.OnEvent(testEvent())
+
+	// then
+	assert.Eventually(t, func() bool {
+		deadLetters.lock.Lock()
+		defer deadLetters.lock.Unlock()
+		return len(deadLetters.letters) == 1 && deadLetters.letters[0].Attempts == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	drops.lock.Lock()
+	defer drops.lock.Unlock()
+	assert.Equal(t, map[string]int{DroppedDeadLetter: 1}, drops.reasons)
+}
+
+func TestDispatcherShouldNotRetryRejectedNotifications(t *testing.T) {
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{ID: "hook", Room: "ops", URL: server.URL, Secret: "secret"}
+	deadLetters := &memoryDeadLetters{}
+
+	dispatcher := NewDispatcher(staticSubscribers{webhook}, deadLetters, testConfig())
+	dispatcher.Start()
+	defer dispatcher.Close(context.Background())
+
+	// when
+	dispatcher.OnEvent(testEvent())
+
+	// then
+	assert.Eventually(t, func() bool {
+		deadLetters.lock.Lock()
+		defer deadLetters.lock.Unlock()
+		return len(deadLetters.letters) == 1 && deadLetters.letters[0].Attempts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDispatcherShouldRefuseToConnectToPrivateAddresses(t *testing.T) {
+	// given
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests <- req
+	}))
+	defer server.Close()
+
+	config := testConfig()
+	config.AllowPrivate = false
+
+	webhook := &Webhook{ID: "hook", Room: "ops", URL: server.URL, Secret: "secret"}
+	deadLetters := &memoryDeadLetters{}
+
+	dispatcher := NewDispatcher(staticSubscribers{webhook}, deadLetters, config)
+	dispatcher.Start()
+
+	// when
+	dispatcher.OnEvent(testEvent())
+
+	// then
+	assert.Eventually(t, func() bool {
+		deadLetters.lock.Lock()
+		defer deadLetters.lock.Unlock()
+		return len(deadLetters.letters) == 1 && deadLetters.letters[0].Attempts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, dispatcher.Close(context.Background()))
+	assert.Empty(t, requests)
+}
+
+type blockingDeadLetters struct {
+	memoryDeadLetters
+	release chan struct{}
+}
+
+func (b *blockingDeadLetters) Insert(entity interface{}) error {
+	<-b.release
+	return b.memoryDeadLetters.Insert(entity)
+}
+
+func TestDispatcherShouldNotWaitForDeadLettersWhenQueueIsFull(t *testing.T) {
+	// given
+	webhook := &Webhook{ID: "hook", Room: "ops", URL: "http://example.com", Secret: "secret"}
+	deadLetters := &blockingDeadLetters{release: make(chan struct{})}
+
+	config := testConfig()
+	config.QueueSize = 1
+
+	// workers aren't started, so the queue is full after the first event
+	dispatcher := NewDispatcher(staticSubscribers{webhook}, deadLetters, config)
+	go dispatcher.storeDeadLetters()
+
+	// when
+	returned := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			dispatcher.OnEvent(testEvent())
+		}
+		close(returned)
+	}()
+
+	// then
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("OnEvent blocked while dead letter was stored")
+	}
+
+	close(deadLetters.release)
+	assert.Eventually(t, func() bool {
+		deadLetters.lock.Lock()
+		defer deadLetters.lock.Unlock()
+		return len(deadLetters.letters) >= 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBackoffShouldGrowExponentiallyUpToLimit(t *testing.T) {
+	// given
+	dispatcher := NewDispatcher(staticSubscribers{}, &memoryDeadLetters{}, Config{Backoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	// when
+	backoffs := []time.Duration{dispatcher.backoff(1), dispatcher.backoff(2), dispatcher.backoff(3), dispatcher.backoff(5)}
+
+	// then
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 10 * time.Second}, backoffs)
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adrian83/chat/pkg/user"
+)
+
+const (
+	roomProp      = "room"
+	tokenHashProp = "tokenHash"
+
+	// IntegrationSuffix is appended to the names of hooks, so messages posted
+	// through hooks cannot be mistaken for messages sent by users.
+	IntegrationSuffix = " (integration)"
+)
+
+// ErrNameTaken is returned when incoming hook should be named as registered user.
+var ErrNameTaken = errors.New("name belongs to registered user")
+
+// IncomingHook allows external services to post messages into the room.
+// Only hash of the token is stored, the token itself is returned once, when hook is created.
+type IncomingHook struct {
+	ID        string    `json:"id" gorethink:"id,omitempty"`
+	Room      string    `json:"room" gorethink:"room"`
+	Name      string    `json:"name" gorethink:"name"`
+	TokenHash string    `json:"-" gorethink:"tokenHash"`
+	Owner     string    `json:"owner" gorethink:"owner"`
+	Created   time.Time `json:"created" gorethink:"created"`
+}
+
+// Empty returns 'true' if the IncomingHook struct is empty, false otherwise.
+func (h *IncomingHook) Empty() bool {
+	return h == nil || h.ID == ""
+}
+
+// SenderID returns id used as sender of messages posted through the hook.
+func (h *IncomingHook) SenderID() string {
+	return "integration-" + h.ID
+}
+
+// SenderName returns name used as sender of messages posted through the hook.
+func (h *IncomingHook) SenderName() string {
+	return h.Name + IntegrationSuffix
+}
+
+// IncomingDatabase is an interface which defines persistence of incoming hooks.
+type IncomingDatabase interface {
+	UUID() (string, error)
+	Insert(interface{}) error
+	Get(id string, result interface{}) error
+	Find(property string, value, result interface{}) error
+	FindAll(property string, value, result interface{}) error
+	Delete(id string) error
+}
+
+// Users is an interface wrapping method used to find registered users.
+type Users interface {
+	FindUser(name string) (*user.User, error)
+}
+
+// IncomingService manages incoming hooks.
+type IncomingService struct {
+	db    IncomingDatabase
+	users Users
+}
+
+// NewIncomingService returns new instance of IncomingService.
+func NewIncomingService(db IncomingDatabase, users Users) *IncomingService {
+	return &IncomingService{db: db, users: users}
+}
+
+// Create creates new hook posting messages into given room as an integration with given name.
+// Hooks cannot be named as registered users. Returns the hook and its secret token.
+func (s *IncomingService) Create(owner, room, name string) (*IncomingHook, string, error) {
+	for _, userName := range []string{name, name + IntegrationSuffix} {
+		usr, err := s.users.FindUser(userName)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read user %v, error: %w", userName, err)
+		}
+
+		if !usr.Empty() {
+			return nil, "", ErrNameTaken
+		}
+	}
+
+	id, err := s.db.UUID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	hook := &IncomingHook{
+		ID:        id,
+		Room:      room,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Owner:     owner,
+		Created:   time.Now().UTC(),
+	}
+
+	if err := s.db.Insert(hook); err != nil {
+		return nil, "", fmt.Errorf("cannot store incoming hook, error: %w", err)
+	}
+
+	return hook, token, nil
+}
+
+// List returns hooks posting into given room.
+func (s *IncomingService) List(room string) ([]*IncomingHook, error) {
+	hooks := make([]*IncomingHook, 0)
+	if err := s.db.FindAll(roomProp, room, &hooks); err != nil {
+		return nil, fmt.Errorf("cannot read incoming hooks, error: %w", err)
+	}
+	return hooks, nil
+}
+
+// Delete removes hook with given id posting into given room.
+func (s *IncomingService) Delete(room, id string) error {
+	var hook IncomingHook
+	if err := s.db.Get(id, &hook); err != nil {
+		return fmt.Errorf("cannot read incoming hook, error: %w", err)
+	}
+
+	if hook.Empty() || hook.Room != room {
+		return ErrNotFound
+	}
+
+	return s.db.Delete(id)
+}
+
+// Authenticate returns hook with given token.
+func (s *IncomingService) Authenticate(token string) (*IncomingHook, error) {
+	if token == "" {
+		return nil, ErrNotFound
+	}
+
+	var hook IncomingHook
+	if err := s.db.Find(tokenHashProp, hashToken(token), &hook); err != nil {
+		return nil, fmt.Errorf("cannot read incoming hook, error: %w", err)
+	}
+
+	if hook.Empty() {
+		return nil, ErrNotFound
+	}
+
+	return &hook, nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
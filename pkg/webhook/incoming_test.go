@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+	"github.com/adrian83/chat/pkg/user"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type registeredUsers []string
+
+func (u registeredUsers) FindUser(name string) (*user.User, error) {
+	for _, registered := range u {
+		if registered == name {
+			return &user.User{ID: name, Login: name}, nil
+		}
+	}
+	return &user.User{}, nil
+}
+
+func TestIncomingServiceShouldCreateAndAuthenticateHooks(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	service := NewIncomingService(db, registeredUsers{"john"})
+
+	// when
+	hook, token, err := service.Create("john", "ops", "ci")
+	authenticated, authErr := service.Authenticate(token)
+	_, invalidErr := service.Authenticate("invalid")
+	_, emptyErr := service.Authenticate("")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "ops", hook.Room)
+	assert.Equal(t, "ci (integration)", hook.SenderName())
+	assert.NotEqual(t, token, hook.TokenHash)
+	assert.Len(t, token, 2*secretSize)
+
+	assert.NoError(t, authErr)
+	assert.Equal(t, hook.ID, authenticated.ID)
+	assert.Equal(t, ErrNotFound, invalidErr)
+	assert.Equal(t, ErrNotFound, emptyErr)
+}
+
+func TestIncomingServiceShouldRejectNamesOfRegisteredUsers(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	service := NewIncomingService(db, registeredUsers{"john", "ci (integration)"})
+
+	// when
+	_, _, userErr := service.Create("john", "ops", "john")
+	_, _, suffixErr := service.Create("john", "ops", "ci")
+
+	// then
+	assert.Equal(t, ErrNameTaken, userErr)
+	assert.Equal(t, ErrNameTaken, suffixErr)
+	assert.Equal(t, 0, db.Len())
+}
+
+func TestIncomingServiceShouldListAndDeleteHooksOfRoom(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	service := NewIncomingService(db, registeredUsers{})
+
+	ops, _, err := service.Create("john", "ops", "ci")
+	assert.NoError(t, err)
+	_, _, err = service.Create("jane", "dev", "alerts")
+	assert.NoError(t, err)
+
+	// when
+	otherRoomErr := service.Delete("dev", ops.ID)
+	listed, listErr := service.List("ops")
+	deleteErr := service.Delete("ops", ops.ID)
+	missingErr := service.Delete("ops", ops.ID)
+	afterDelete, _ := service.List("ops")
+
+	// then
+	assert.Equal(t, ErrNotFound, otherRoomErr)
+	assert.NoError(t, listErr)
+	assert.Equal(t, []*IncomingHook{ops}, listed)
+	assert.NoError(t, deleteErr)
+	assert.Equal(t, ErrNotFound, missingErr)
+	assert.Empty(t, afterDelete)
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+// Webhook is an URL which receives notifications about events in the room.
+type Webhook struct {
+	ID      string    `json:"id" gorethink:"id,omitempty"`
+	Room    string    `json:"room" gorethink:"room"`
+	URL     string    `json:"url" gorethink:"url"`
+	Secret  string    `json:"secret,omitempty" gorethink:"secret"`
+	Events  []string  `json:"events" gorethink:"events"`
+	Owner   string    `json:"owner" gorethink:"owner"`
+	Created time.Time `json:"created" gorethink:"created"`
+}
+
+// Empty returns 'true' if the Webhook struct is empty, false otherwise.
+func (w *Webhook) Empty() bool {
+	return w == nil || w.ID == ""
+}
+
+// Subscribes returns true if webhook should be notified about events of given type.
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutSecret returns copy of the webhook without secret.
+func (w *Webhook) WithoutSecret() *Webhook {
+	copied := *w
+	copied.Secret = ""
+	return &copied
+}
+
+// Payload is a body of request sent to the webhook.
+type Payload struct {
+	Event   string          `json:"event"`
+	Room    string          `json:"room"`
+	User    string          `json:"user,omitempty"`
+	Message *MessagePayload `json:"message,omitempty"`
+	Time    time.Time       `json:"time"`
+}
+
+// MessagePayload contains data of posted message.
+type MessagePayload struct {
+	Sender      string                 `json:"sender"`
+	Content     string                 `json:"content"`
+	HTML        string                 `json:"html,omitempty"`
+	Attachments []*exchange.Attachment `json:"attachments,omitempty"`
+}
+
+func newPayload(event *exchange.Event) *Payload {
+	payload := &Payload{
+		Event: event.Type,
+		Room:  event.Room,
+		User:  event.User,
+		Time:  event.Time,
+	}
+
+	if event.Message != nil {
+		payload.Message = &MessagePayload{
+			Sender:      event.Message.SenderName,
+			Content:     event.Message.Content,
+			HTML:        event.Message.HTML,
+			Attachments: event.Message.Attachments,
+		}
+	}
+
+	return payload
+}
+
+// DeadLetter is a notification which couldn't be delivered to the webhook.
+type DeadLetter struct {
+	ID        string    `json:"id" gorethink:"id,omitempty"`
+	WebhookID string    `json:"webhookId" gorethink:"webhookId"`
+	Room      string    `json:"room" gorethink:"room"`
+	URL       string    `json:"url" gorethink:"url"`
+	Event     string    `json:"event" gorethink:"event"`
+	Payload   string    `json:"payload" gorethink:"payload"`
+	Attempts  int       `json:"attempts" gorethink:"attempts"`
+	Error     string    `json:"error" gorethink:"error"`
+	Created   time.Time `json:"created" gorethink:"created"`
+}
@@ -0,0 +1,192 @@
+// Package webhook notifies external services about events in the rooms.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/adrian83/chat/pkg/exchange"
+)
+
+const secretSize = 32
+
+var (
+	// ErrNotFound is returned when webhook cannot be found.
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalidURL is returned when webhook URL is not an absolute http(s) URL.
+	ErrInvalidURL = errors.New("webhook url should be an absolute http or https url")
+	// ErrInvalidEvent is returned when webhook subscribes unknown event.
+	ErrInvalidEvent = errors.New("unknown event type")
+)
+
+// Database is an interface which defines persistence of webhooks.
+type Database interface {
+	UUID() (string, error)
+	Insert(interface{}) error
+	All(result interface{}) error
+	Delete(id string) error
+}
+
+// Service keeps webhooks registered for the rooms. All webhooks are cached
+// in memory, so they can be found without querying database for every event.
+type Service struct {
+	db       Database
+	lookupIP func(host string) ([]net.IP, error)
+	lock     sync.RWMutex
+	byRoom   map[string][]*Webhook
+}
+
+// NewService returns new instance of Service.
+func NewService(db Database) *Service {
+	return &Service{
+		db:       db,
+		lookupIP: net.LookupIP,
+		byRoom:   map[string][]*Webhook{},
+	}
+}
+
+// Load reads all webhooks from database.
+func (s *Service) Load() error {
+	webhooks := make([]*Webhook, 0)
+	if err := s.db.All(&webhooks); err != nil {
+		return fmt.Errorf("cannot read webhooks, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.byRoom = map[string][]*Webhook{}
+	for _, webhook := range webhooks {
+		s.byRoom[webhook.Room] = append(s.byRoom[webhook.Room], webhook)
+	}
+
+	return nil
+}
+
+// Register creates webhook notified about given events in given room. If no events
+// are given webhook is notified about all events. URLs pointing to loopback, link-local
+// or private addresses are rejected. Returned webhook contains secret used to sign notifications.
+func (s *Service) Register(owner, room, rawURL string, events []string) (*Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return nil, ErrInvalidURL
+	}
+
+	if err := checkHost(parsed.Hostname(), s.lookupIP); err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		events = exchange.EventTypes()
+	}
+
+	for _, event := range events {
+		if !validEvent(event) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, event)
+		}
+	}
+
+	id, err := s.db.UUID()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		ID:      id,
+		Room:    room,
+		URL:     parsed.String(),
+		Secret:  secret,
+		Events:  events,
+		Owner:   owner,
+		Created: time.Now().UTC(),
+	}
+
+	if err := s.db.Insert(webhook); err != nil {
+		return nil, fmt.Errorf("cannot store webhook, error: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.byRoom[room] = append(s.byRoom[room], webhook)
+
+	return webhook, nil
+}
+
+// List returns webhooks registered for given room (without secrets).
+func (s *Service) List(room string) []*Webhook {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	webhooks := make([]*Webhook, 0, len(s.byRoom[room]))
+	for _, webhook := range s.byRoom[room] {
+		webhooks = append(webhooks, webhook.WithoutSecret())
+	}
+
+	return webhooks
+}
+
+// Delete removes webhook with given id registered for given room.
+func (s *Service) Delete(room, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	webhooks := s.byRoom[room]
+	for i, webhook := range webhooks {
+		if webhook.ID != id {
+			continue
+		}
+
+		if err := s.db.Delete(id); err != nil {
+			return fmt.Errorf("cannot remove webhook, error: %w", err)
+		}
+
+		s.byRoom[room] = append(webhooks[:i:i], webhooks[i+1:]...)
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// Subscribers returns webhooks which should be notified about event of given type in given room.
+func (s *Service) Subscribers(room, eventType string) []*Webhook {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	webhooks := make([]*Webhook, 0)
+	for _, webhook := range s.byRoom[room] {
+		if webhook.Subscribes(eventType) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	return webhooks
+}
+
+func validEvent(eventType string) bool {
+	for _, event := range exchange.EventTypes() {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	bts := make([]byte, secretSize)
+	if _, err := rand.Read(bts); err != nil {
+		return "", fmt.Errorf("cannot generate secret, error: %w", err)
+	}
+	return hex.EncodeToString(bts), nil
+}
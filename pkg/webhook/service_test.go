@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/adrian83/chat/pkg/db/dbtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterShouldRejectInternalTargets(t *testing.T) {
+	// given
+	db := dbtest.NewTable("id")
+	service := NewService(db)
+	service.lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "ci.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		case "internal.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.7")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	forbidden := []string{
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://192.168.1.10/hook",
+		"http://172.20.0.2/hook",
+		"http://[fd00::1]/hook",
+		"http://0.0.0.0/hook",
+		"https://internal.example.com/hook",
+	}
+
+	for _, url := range forbidden {
+		// when
+		_, err := service.Register("john", "ops", url, nil)
+
+		// then
+		assert.Equal(t, ErrForbiddenTarget, err, url)
+	}
+
+	// when
+	_, unresolvedErr := service.Register("john", "ops", "https://unknown.example.com/hook", nil)
+	webhook, err := service.Register("john", "ops", "https://ci.example.com/hook", nil)
+
+	// then
+	assert.True(t, errors.Is(unresolvedErr, ErrInvalidURL))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ci.example.com/hook", webhook.URL)
+	assert.Equal(t, 1, db.Len())
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned when webhook URL points to loopback, link-local or private address.
+var ErrForbiddenTarget = errors.New("webhook url cannot point to loopback, link-local or private address")
+
+// privateNetworks are networks which aren't reachable from the internet, in addition
+// to loopback and link-local ones recognized by net.IP methods.
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"fc00::/7",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// forbiddenIP returns true if webhooks cannot be sent to given address.
+func forbiddenIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkHost returns ErrForbiddenTarget if given host is (or resolves to) an address which cannot be notified.
+func checkHost(host string, lookupIP func(host string) ([]net.IP, error)) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+
+	ips, err := lookupIP(host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve host %v", ErrInvalidURL, host)
+	}
+
+	for _, ip := range ips {
+		if forbiddenIP(ip) {
+			return ErrForbiddenTarget
+		}
+	}
+
+	return nil
+}
+
+// newDialer returns dialer which refuses connections to forbidden addresses. Addresses are checked
+// after the host is resolved, so webhooks cannot reach internal services by changing DNS records.
+func newDialer(timeout time.Duration, allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if allowPrivate {
+		return dialer
+	}
+
+	dialer.Control = func(network, address string, conn syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+
+		if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+			return ErrForbiddenTarget
+		}
+
+		return nil
+	}
+
+	return dialer
+}
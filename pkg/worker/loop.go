@@ -0,0 +1,79 @@
+// Package worker runs background work of the services at requested times.
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Loop calls given function in its own goroutine at the time returned by the previous call
+// or earlier, when Wake is called. Zero time means that there is nothing to do, then the loop
+// waits for idle time.
+type Loop struct {
+	work     func() time.Time
+	idle     time.Duration
+	wake     chan struct{}
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewLoop returns new Loop calling given function. Start has to be called before the function is called.
+func NewLoop(idle time.Duration, work func() time.Time) *Loop {
+	return &Loop{
+		work:     work,
+		idle:     idle,
+		wake:     make(chan struct{}, 1),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts goroutine calling the function. The function is called right after the start.
+func (l *Loop) Start() {
+	go func() {
+		defer close(l.done)
+
+		for {
+			wait := l.idle
+			if next := l.work(); !next.IsZero() {
+				wait = time.Until(next)
+			}
+
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-timer.C:
+			case <-l.wake:
+				timer.Stop()
+			case <-l.stopping:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Wake makes the loop call the function without waiting for the requested time. It should be
+// called when there is new work, which may be due earlier than the work the loop waits for.
+func (l *Loop) Wake() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the loop and waits until the call in progress finishes or the context is done.
+func (l *Loop) Close(ctx context.Context) error {
+	l.stopOnce.Do(func() {
+		close(l.stopping)
+	})
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopShouldCallFunctionAfterStartAndWake(t *testing.T) {
+	// given
+	var calls int32
+	loop := NewLoop(time.Hour, func() time.Time {
+		atomic.AddInt32(&calls, 1)
+		return time.Time{}
+	})
+
+	// when
+	loop.Start()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	loop.Wake()
+
+	// then
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, loop.Close(context.Background()))
+	assert.NoError(t, loop.Close(context.Background()))
+}